@@ -0,0 +1,541 @@
+// Package caldav is a minimal CalDAV client (RFC 4791) for subscribing to a
+// remote calendar collection: it discovers the collection and reads the
+// calendar objects changed since the last sync (RFC 6578), falling back to
+// reading all of them from servers without sync support.
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	nsDAV = "DAV:"
+
+	// multigetBatchSize is how many objects are read per calendar-multiget.
+	multigetBatchSize = 100
+)
+
+// ErrUnauthorized is returned when the server rejects the credentials.
+var ErrUnauthorized = errors.New("caldav: authentication failed")
+
+// Client talks to one CalDAV server. Requests only go to the scheme and host
+// of the URL given to Discover or Sync, so that the credentials are not sent
+// elsewhere.
+type Client struct {
+	HTTP *http.Client
+	// Authorize, if set, adds the credentials to each request.
+	Authorize func(req *http.Request)
+	// MaxResponseSize bounds the body of each response (0 = unbounded).
+	MaxResponseSize int64
+	// Known, if set, reports whether the object at an href has been read
+	// before. Sync does not read such objects again.
+	Known func(href string) bool
+}
+
+// Object is a calendar object resource.
+type Object struct {
+	Href string // absolute URL
+	ETag string
+	Data []byte // the iCalendar data
+}
+
+// Discover returns the URL of the calendar collection at rawURL, which may
+// also be the server, a principal or a calendar home. For the latter, the
+// first collection with events is chosen.
+func (c *Client) Discover(ctx context.Context, rawURL string) (string, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	start := base
+	if strings.Trim(base.Path, "/") == "" {
+		if start, err = c.wellKnown(ctx, base); err != nil {
+			return "", err
+		}
+	}
+	resp, err := c.propfind(ctx, base, start, "0", propfindDiscover)
+	if err != nil {
+		return "", err
+	}
+	self := resp.find(start)
+	if self == nil {
+		return "", fmt.Errorf("caldav: no properties returned for %s", start)
+	}
+	if self.isCalendar() {
+		return start.String(), nil
+	}
+
+	home := self.prop().CalendarHomeSet.Href
+	if home == "" && self.prop().CurrentUserPrincipal.Href != "" {
+		principal, err := c.resolve(base, start, self.prop().CurrentUserPrincipal.Href)
+		if err != nil {
+			return "", err
+		}
+		resp, err := c.propfind(ctx, base, principal, "0", propfindDiscover)
+		if err != nil {
+			return "", err
+		}
+		if p := resp.find(principal); p != nil {
+			home = p.prop().CalendarHomeSet.Href
+		}
+	}
+	homeURL := start // the URL may be a calendar home already
+	if home != "" {
+		if homeURL, err = c.resolve(base, start, home); err != nil {
+			return "", err
+		}
+	}
+
+	resp, err = c.propfind(ctx, base, homeURL, "1", propfindDiscover)
+	if err != nil {
+		return "", err
+	}
+	for i := range resp.Responses {
+		r := &resp.Responses[i]
+		if r.isCalendar() && r.hasEvents() {
+			u, err := c.resolve(base, homeURL, r.Href)
+			if err != nil {
+				return "", err
+			}
+			return u.String(), nil
+		}
+	}
+	return "", fmt.Errorf("caldav: no calendar collection found at %s", rawURL)
+}
+
+// wellKnown returns the context path that the well-known URL of a server
+// redirects to (RFC 6764), or the server URL if there is none. Redirects are
+// followed here since an HTTP client would turn a PROPFIND into a GET.
+func (c *Client) wellKnown(ctx context.Context, base *url.URL) (*url.URL, error) {
+	u := base.ResolveReference(&url.URL{Path: "/.well-known/caldav"})
+	client := *c.HTTP
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", u.String(), strings.NewReader(propfindDiscover))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "0")
+	c.authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusMultiStatus:
+		return u, nil
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		return c.resolve(base, u, resp.Header.Get("Location"))
+	default:
+		return base, nil
+	}
+}
+
+// Sync calls fn for each calendar object of the collection added or changed
+// since the sync token, or for all of them when token is empty, and returns
+// the new sync token. Objects removed from the collection are not reported,
+// nor are the ones Known reports, changed or not.
+// A token the server no longer accepts starts over with all objects; a server
+// without sync support always gives all objects and an empty token.
+func (c *Client) Sync(ctx context.Context, collectionURL, token string, fn func(Object) error) (string, error) {
+	collection, err := url.Parse(collectionURL)
+	if err != nil {
+		return "", err
+	}
+	newToken, err := c.syncCollection(ctx, collection, token, fn)
+	var statusErr *StatusError
+	if token != "" && errors.As(err, &statusErr) && statusErr.Precondition == "valid-sync-token" {
+		newToken, err = c.syncCollection(ctx, collection, "", fn)
+	}
+	if errors.As(err, &statusErr) && statusErr.unsupported() {
+		return "", c.calendarQuery(ctx, collection, fn)
+	}
+	return newToken, err
+}
+
+func (c *Client) syncCollection(ctx context.Context, collection *url.URL, token string, fn func(Object) error) (string, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+		`<d:sync-token>` + xmlEscape(token) + `</d:sync-token>` +
+		`<d:sync-level>1</d:sync-level>` +
+		c.listProp() +
+		`</d:sync-collection>`
+	return c.report(ctx, collection, "0", body, fn)
+}
+
+func (c *Client) calendarQuery(ctx context.Context, collection *url.URL, fn func(Object) error) error {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+		c.listProp() +
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter></c:filter>` +
+		`</c:calendar-query>`
+	_, err := c.report(ctx, collection, "1", body, fn)
+	return err
+}
+
+// listProp is the prop element of a REPORT that lists the objects of a
+// collection. With Known set, the data is left out, to read only the objects
+// not known with calendar-multiget.
+func (c *Client) listProp() string {
+	if c.Known != nil {
+		return `<d:prop><d:getetag/></d:prop>`
+	}
+	return `<d:prop><d:getetag/><c:calendar-data/></d:prop>`
+}
+
+// report runs a REPORT whose multistatus lists calendar objects, reading the
+// objects the server listed without their data with calendar-multiget.
+func (c *Client) report(ctx context.Context, collection *url.URL, depth, body string, fn func(Object) error) (string, error) {
+	resp, err := c.do(ctx, collection, collection, "REPORT", depth, body)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var missing []string
+	token, err := readMultistatus(c.limit(resp.Body), func(r *response) error {
+		if !r.ok() {
+			return nil // removed
+		}
+		u, err := c.resolve(collection, collection, r.Href)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSuffix(u.Path, "/") == strings.TrimSuffix(collection.Path, "/") {
+			return nil // the collection itself
+		}
+		if c.Known != nil && c.Known(u.String()) {
+			return nil
+		}
+		p := r.prop()
+		if p.CalendarData == "" {
+			missing = append(missing, r.Href)
+			return nil
+		}
+		return fn(Object{Href: u.String(), ETag: p.ETag, Data: []byte(p.CalendarData)})
+	})
+	if err != nil {
+		return "", err
+	}
+	for len(missing) > 0 {
+		n := min(len(missing), multigetBatchSize)
+		if err := c.multiget(ctx, collection, missing[:n], fn); err != nil {
+			return "", err
+		}
+		missing = missing[n:]
+	}
+	return token, nil
+}
+
+func (c *Client) multiget(ctx context.Context, collection *url.URL, hrefs []string, fn func(Object) error) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+		`<d:prop><d:getetag/><c:calendar-data/></d:prop>`)
+	for _, href := range hrefs {
+		b.WriteString(`<d:href>` + xmlEscape(href) + `</d:href>`)
+	}
+	b.WriteString(`</c:calendar-multiget>`)
+
+	resp, err := c.do(ctx, collection, collection, "REPORT", "1", b.String())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, err = readMultistatus(c.limit(resp.Body), func(r *response) error {
+		p := r.prop()
+		if !r.ok() || p.CalendarData == "" {
+			return nil
+		}
+		u, err := c.resolve(collection, collection, r.Href)
+		if err != nil {
+			return err
+		}
+		return fn(Object{Href: u.String(), ETag: p.ETag, Data: []byte(p.CalendarData)})
+	})
+	return err
+}
+
+const propfindDiscover = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop>` +
+	`<d:resourcetype/><d:current-user-principal/><c:calendar-home-set/><c:supported-calendar-component-set/>` +
+	`</d:prop></d:propfind>`
+
+func (c *Client) propfind(ctx context.Context, base, u *url.URL, depth, body string) (*multistatus, error) {
+	resp, err := c.do(ctx, base, u, "PROPFIND", depth, body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	ms := &multistatus{}
+	if _, err := readMultistatus(c.limit(resp.Body), func(r *response) error {
+		ms.Responses = append(ms.Responses, *r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// do sends a WebDAV request, which must get a 207 Multi-Status response.
+func (c *Client) do(ctx context.Context, base, u *url.URL, method, depth, body string) (*http.Response, error) {
+	if !sameOrigin(base, u) {
+		return nil, fmt.Errorf("caldav: %s is not on the server of %s", u, base)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+	c.authorize(req)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusMultiStatus {
+		return resp, nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+	return nil, newStatusError(method, resp)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.Authorize != nil {
+		c.Authorize(req)
+	}
+}
+
+func (c *Client) limit(r io.Reader) io.Reader {
+	if c.MaxResponseSize > 0 {
+		return io.LimitReader(r, c.MaxResponseSize)
+	}
+	return r
+}
+
+// resolve resolves an href of a response to a request to u, which must stay
+// on the server of base.
+func (c *Client) resolve(base, u *url.URL, href string) (*url.URL, error) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: invalid href %q: %v", href, err)
+	}
+	resolved := u.ResolveReference(ref)
+	if !sameOrigin(base, resolved) {
+		return nil, fmt.Errorf("caldav: %s is not on the server of %s", resolved, base)
+	}
+	return resolved, nil
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
+
+// StatusError is an unexpected response status.
+type StatusError struct {
+	Method     string
+	StatusCode int
+	// Precondition is the name of the failed precondition in a WebDAV error
+	// body (RFC 4918, section 16), if any.
+	Precondition string
+}
+
+func (e *StatusError) Error() string {
+	if e.Precondition != "" {
+		return fmt.Sprintf("caldav: %s returned status %d (%s)", e.Method, e.StatusCode, e.Precondition)
+	}
+	return fmt.Sprintf("caldav: %s returned status %d", e.Method, e.StatusCode)
+}
+
+// unsupported reports whether the server does not support a REPORT.
+func (e *StatusError) unsupported() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusForbidden:
+		return e.Precondition == "supported-report" || e.Precondition == ""
+	}
+	return false
+}
+
+func newStatusError(method string, resp *http.Response) *StatusError {
+	e := &StatusError{Method: method, StatusCode: resp.StatusCode}
+	var body struct {
+		Conditions []struct {
+			XMLName xml.Name
+		} `xml:",any"`
+	}
+	if xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body) == nil && len(body.Conditions) > 0 {
+		e.Precondition = body.Conditions[0].XMLName.Local
+	}
+	return e
+}
+
+type multistatus struct {
+	Responses []response
+}
+
+// find returns the response for u, or nil.
+func (m *multistatus) find(u *url.URL) *response {
+	for i := range m.Responses {
+		r := &m.Responses[i]
+		ref, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		if strings.TrimSuffix(u.ResolveReference(ref).Path, "/") == strings.TrimSuffix(u.Path, "/") {
+			return r
+		}
+	}
+	if len(m.Responses) == 1 {
+		return &m.Responses[0] // e.g. a server that redirected the request
+	}
+	return nil
+}
+
+type response struct {
+	Href     string     `xml:"DAV: href"`
+	Status   string     `xml:"DAV: status"`
+	Propstat []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   prop   `xml:"DAV: prop"`
+}
+
+type prop struct {
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	CurrentUserPrincipal hrefProp `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      hrefProp `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	SupportedComponents  struct {
+		Comps []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	ETag         string `xml:"DAV: getetag"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+type hrefProp struct {
+	Href string `xml:"DAV: href"`
+}
+
+// ok reports whether the resource exists; a removed member in a
+// sync-collection report has a 404 status.
+func (r *response) ok() bool {
+	return r.Status == "" || statusCode(r.Status) == http.StatusOK
+}
+
+// prop returns the properties found, merged from the 200 propstats.
+func (r *response) prop() prop {
+	var p prop
+	for _, ps := range r.Propstat {
+		if statusCode(ps.Status) != http.StatusOK {
+			continue
+		}
+		if ps.Prop.ResourceType.Calendar != nil {
+			p.ResourceType = ps.Prop.ResourceType
+		}
+		if ps.Prop.CurrentUserPrincipal.Href != "" {
+			p.CurrentUserPrincipal = ps.Prop.CurrentUserPrincipal
+		}
+		if ps.Prop.CalendarHomeSet.Href != "" {
+			p.CalendarHomeSet = ps.Prop.CalendarHomeSet
+		}
+		if len(ps.Prop.SupportedComponents.Comps) > 0 {
+			p.SupportedComponents = ps.Prop.SupportedComponents
+		}
+		if ps.Prop.ETag != "" {
+			p.ETag = ps.Prop.ETag
+		}
+		if ps.Prop.CalendarData != "" {
+			p.CalendarData = ps.Prop.CalendarData
+		}
+	}
+	return p
+}
+
+func (r *response) isCalendar() bool {
+	return r.prop().ResourceType.Calendar != nil
+}
+
+// hasEvents reports whether a calendar collection may contain events; a
+// collection that does not list its components may contain any.
+func (r *response) hasEvents() bool {
+	comps := r.prop().SupportedComponents.Comps
+	if len(comps) == 0 {
+		return true
+	}
+	for _, c := range comps {
+		if strings.EqualFold(c.Name, "VEVENT") {
+			return true
+		}
+	}
+	return false
+}
+
+// statusCode returns the code of a status line such as "HTTP/1.1 200 OK".
+func statusCode(status string) int {
+	fields := strings.Fields(status)
+	if len(fields) < 2 {
+		return 0
+	}
+	code, _ := strconv.Atoi(fields[1])
+	return code
+}
+
+// readMultistatus calls fn for each response of a multistatus body as it is
+// read, and returns its sync token.
+func readMultistatus(r io.Reader, fn func(*response) error) (string, error) {
+	dec := xml.NewDecoder(r)
+	token := ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return token, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("caldav: invalid multistatus: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != nsDAV {
+			continue
+		}
+		switch start.Name.Local {
+		case "response":
+			var resp response
+			if err := dec.DecodeElement(&resp, &start); err != nil {
+				return "", fmt.Errorf("caldav: invalid multistatus: %v", err)
+			}
+			if err := fn(&resp); err != nil {
+				return "", err
+			}
+		case "sync-token":
+			if err := dec.DecodeElement(&token, &start); err != nil {
+				return "", fmt.Errorf("caldav: invalid multistatus: %v", err)
+			}
+			token = strings.TrimSpace(token)
+		}
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package caldav_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/caldav"
+	"github.com/mikaelstaldal/mycal/internal/caldav/caldavtest"
+)
+
+func event(uid string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + uid +
+		"\r\nDTSTART:20260601T090000Z\r\nDTEND:20260601T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func newClient(srv *caldavtest.Server) *caldav.Client {
+	username, password := srv.Username, srv.Password
+	return &caldav.Client{HTTP: http.DefaultClient, Authorize: func(req *http.Request) {
+		req.SetBasicAuth(username, password)
+	}}
+}
+
+// collect syncs and returns the hrefs of the objects reported.
+func collect(t *testing.T, c *caldav.Client, collectionURL, token string) ([]string, string) {
+	t.Helper()
+	var hrefs []string
+	newToken, err := c.Sync(context.Background(), collectionURL, token, func(o caldav.Object) error {
+		assert.NotEmpty(t, o.Data)
+		assert.NotEmpty(t, o.ETag)
+		hrefs = append(hrefs, o.Href)
+		return nil
+	})
+	require.NoError(t, err)
+	return hrefs, newToken
+}
+
+func TestDiscover(t *testing.T) {
+	srv := caldavtest.NewServer(t)
+	srv.Username, srv.Password = "user", "secret"
+	c := newClient(srv)
+
+	for _, start := range []string{
+		srv.URL,                          // well-known URL, principal, calendar home
+		srv.URL + "/dav/calendars/user/", // calendar home
+		srv.CollectionURL(),
+	} {
+		got, err := c.Discover(context.Background(), start)
+		require.NoError(t, err, start)
+		assert.Equal(t, srv.CollectionURL(), got, start)
+	}
+
+	srv.Password = "changed"
+	_, err := c.Discover(context.Background(), srv.CollectionURL())
+	assert.ErrorIs(t, err, caldav.ErrUnauthorized)
+}
+
+func TestSync(t *testing.T) {
+	srv := caldavtest.NewServer(t)
+	srv.Put("a.ics", event("a"))
+	srv.Put("b.ics", event("b"))
+	c := newClient(srv)
+
+	hrefs, token := collect(t, c, srv.CollectionURL(), "")
+	assert.Equal(t, []string{srv.CollectionURL() + "a.ics", srv.CollectionURL() + "b.ics"}, hrefs)
+	require.NotEmpty(t, token)
+
+	srv.Put("b.ics", event("b"))
+	srv.Put("c.ics", event("c"))
+	srv.Remove("a.ics")
+	hrefs, token2 := collect(t, c, srv.CollectionURL(), token)
+	assert.Equal(t, []string{srv.CollectionURL() + "b.ics", srv.CollectionURL() + "c.ics"}, hrefs, "only changes, without removals")
+	assert.NotEqual(t, token, token2)
+
+	hrefs, _ = collect(t, c, srv.CollectionURL(), token2)
+	assert.Empty(t, hrefs)
+
+	// A token the server does not know starts over
+	hrefs, _ = collect(t, c, srv.CollectionURL(), "http://other.test/sync/1")
+	assert.Len(t, hrefs, 2)
+	assert.Equal(t, []string{"", token, token2, "http://other.test/sync/1", ""}, srv.SyncTokens())
+}
+
+func TestSync_Multiget(t *testing.T) {
+	srv := caldavtest.NewServer(t)
+	srv.OmitData = true
+	srv.Put("a.ics", event("a"))
+	srv.Put("b.ics", event("b"))
+
+	hrefs, token := collect(t, newClient(srv), srv.CollectionURL(), "")
+	assert.Len(t, hrefs, 2)
+	assert.NotEmpty(t, token)
+}
+
+func TestSync_Known(t *testing.T) {
+	srv := caldavtest.NewServer(t)
+	srv.Put("a.ics", event("a"))
+	srv.Put("b.ics", event("b"))
+	c := newClient(srv)
+	c.Known = func(href string) bool { return href == srv.CollectionURL()+"a.ics" }
+
+	hrefs, token := collect(t, c, srv.CollectionURL(), "")
+	assert.Equal(t, []string{srv.CollectionURL() + "b.ics"}, hrefs)
+	assert.Equal(t, []string{caldavtest.CollectionPath + "b.ics"}, srv.Multiget(), "known objects are not read")
+
+	srv.Put("a.ics", event("a"))
+	hrefs, _ = collect(t, c, srv.CollectionURL(), token)
+	assert.Empty(t, hrefs, "not even when changed")
+}
+
+func TestSync_WithoutSyncSupport(t *testing.T) {
+	srv := caldavtest.NewServer(t)
+	srv.NoSync = true
+	srv.Put("a.ics", event("a"))
+	srv.Put("b.ics", event("b"))
+
+	hrefs, token := collect(t, newClient(srv), srv.CollectionURL(), "")
+	assert.Len(t, hrefs, 2)
+	assert.Empty(t, token)
+}
@@ -0,0 +1,264 @@
+// Package caldavtest provides an in-process CalDAV server for tests, with one
+// principal, a calendar home and a calendar collection of events.
+package caldavtest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	principalPath = "/dav/principals/user/"
+	homePath      = "/dav/calendars/user/"
+	// CollectionPath is the path of the calendar collection of events.
+	CollectionPath = homePath + "events/"
+	tasksPath      = homePath + "tasks/"
+	tokenPrefix    = "http://mycal.test/sync/"
+)
+
+// Server is a CalDAV server. The server root redirects its well-known URL to
+// /dav/, whose principal has a calendar home with a collection of tasks
+// followed by CollectionPath.
+type Server struct {
+	*httptest.Server
+
+	// Username and Password, if set, are required with basic authentication.
+	Username, Password string
+	// NoSync makes the server refuse sync-collection reports.
+	NoSync bool
+	// OmitData leaves the calendar data out of sync-collection reports, so
+	// that it has to be read with calendar-multiget.
+	OmitData bool
+
+	mu         sync.Mutex
+	version    int
+	objects    map[string]object // by name in the collection
+	syncTokens []string
+	multiget   []string
+}
+
+type object struct {
+	data    string
+	version int // when it was last changed; removed objects have no data
+}
+
+// NewServer starts a server. It is closed with the test.
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{objects: make(map[string]object)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// CollectionURL returns the URL of the calendar collection of events.
+func (s *Server) CollectionURL() string {
+	return s.URL + CollectionPath
+}
+
+// Put adds or changes a calendar object of the collection.
+func (s *Server) Put(name, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.objects[name] = object{data: data, version: s.version}
+}
+
+// Remove removes a calendar object from the collection.
+func (s *Server) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.objects[name] = object{version: s.version}
+}
+
+// SyncTokens returns the sync tokens of the sync-collection reports received,
+// in order.
+func (s *Server) SyncTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.syncTokens...)
+}
+
+// Multiget returns the hrefs of the objects read with calendar-multiget, in
+// order.
+func (s *Server) Multiget() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.multiget...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Username != "" || s.Password != "" {
+		if user, pass, ok := r.BasicAuth(); !ok || user != s.Username || pass != s.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="caldavtest"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/.well-known/caldav":
+		http.Redirect(w, r, "/dav/", http.StatusMovedPermanently)
+	case r.Method == "PROPFIND":
+		s.propfind(w, r)
+	case r.Method == "REPORT" && r.URL.Path == CollectionPath:
+		s.report(w, r)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (s *Server) propfind(w http.ResponseWriter, r *http.Request) {
+	var responses []string
+	switch r.URL.Path {
+	case "/dav/":
+		responses = append(responses, propResponse("/dav/", `<d:resourcetype><d:collection/></d:resourcetype>`+
+			`<d:current-user-principal><d:href>`+principalPath+`</d:href></d:current-user-principal>`))
+	case principalPath:
+		responses = append(responses, propResponse(principalPath, `<d:resourcetype><d:principal/></d:resourcetype>`+
+			`<c:calendar-home-set><d:href>`+homePath+`</d:href></c:calendar-home-set>`))
+	case homePath:
+		responses = append(responses, propResponse(homePath, `<d:resourcetype><d:collection/></d:resourcetype>`))
+		if r.Header.Get("Depth") == "1" {
+			responses = append(responses,
+				propResponse(tasksPath, calendarProps("VTODO")),
+				propResponse(CollectionPath, calendarProps("VEVENT")))
+		}
+	case tasksPath:
+		responses = append(responses, propResponse(tasksPath, calendarProps("VTODO")))
+	case CollectionPath:
+		responses = append(responses, propResponse(CollectionPath, calendarProps("VEVENT")))
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeMultistatus(w, responses, "")
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		XMLName   xml.Name
+		SyncToken string   `xml:"DAV: sync-token"`
+		Hrefs     []string `xml:"DAV: href"`
+		Prop      struct {
+			CalendarData *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+		} `xml:"DAV: prop"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withData := req.Prop.CalendarData != nil
+	var responses []string
+	token := ""
+	switch req.XMLName.Local {
+	case "sync-collection":
+		if s.NoSync {
+			writeError(w, http.StatusForbidden, "supported-report")
+			return
+		}
+		s.syncTokens = append(s.syncTokens, req.SyncToken)
+		since := 0
+		if req.SyncToken != "" {
+			n, err := strconv.Atoi(strings.TrimPrefix(req.SyncToken, tokenPrefix))
+			if err != nil || !strings.HasPrefix(req.SyncToken, tokenPrefix) || n > s.version {
+				writeError(w, http.StatusForbidden, "valid-sync-token")
+				return
+			}
+			since = n
+		}
+		for _, name := range s.names() {
+			o := s.objects[name]
+			switch {
+			case o.version <= since:
+			case o.data == "":
+				if since > 0 {
+					responses = append(responses, `<d:response><d:href>`+CollectionPath+name+`</d:href>`+
+						`<d:status>HTTP/1.1 404 Not Found</d:status></d:response>`)
+				}
+			default:
+				responses = append(responses, objectResponse(name, o, withData && !s.OmitData))
+			}
+		}
+		token = tokenPrefix + strconv.Itoa(s.version)
+	case "calendar-query":
+		for _, name := range s.names() {
+			if o := s.objects[name]; o.data != "" {
+				responses = append(responses, objectResponse(name, o, withData))
+			}
+		}
+	case "calendar-multiget":
+		s.multiget = append(s.multiget, req.Hrefs...)
+		for _, href := range req.Hrefs {
+			name := strings.TrimPrefix(href, CollectionPath)
+			if o, ok := s.objects[name]; ok && o.data != "" {
+				responses = append(responses, objectResponse(name, o, true))
+			} else {
+				responses = append(responses, `<d:response><d:href>`+href+`</d:href>`+
+					`<d:status>HTTP/1.1 404 Not Found</d:status></d:response>`)
+			}
+		}
+	default:
+		writeError(w, http.StatusForbidden, "supported-report")
+		return
+	}
+	writeMultistatus(w, responses, token)
+}
+
+func (s *Server) names() []string {
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func calendarProps(component string) string {
+	return `<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>` +
+		`<c:supported-calendar-component-set><c:comp name="` + component + `"/></c:supported-calendar-component-set>`
+}
+
+func propResponse(href, props string) string {
+	return `<d:response><d:href>` + href + `</d:href><d:propstat><d:prop>` + props +
+		`</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`
+}
+
+func objectResponse(name string, o object, withData bool) string {
+	props := fmt.Sprintf(`<d:getetag>"%d"</d:getetag>`, o.version)
+	if withData {
+		var data strings.Builder
+		_ = xml.EscapeText(&data, []byte(o.data))
+		props += `<c:calendar-data>` + data.String() + `</c:calendar-data>`
+	}
+	return propResponse(CollectionPath+name, props)
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []string, token string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>`+
+		`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+	for _, r := range responses {
+		fmt.Fprint(w, r)
+	}
+	if token != "" {
+		fmt.Fprint(w, `<d:sync-token>`+token+`</d:sync-token>`)
+	}
+	fmt.Fprint(w, `</d:multistatus>`)
+}
+
+func writeError(w http.ResponseWriter, status int, precondition string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><d:error xmlns:d="DAV:"><d:%s/></d:error>`, precondition)
+}
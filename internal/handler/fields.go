@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+)
+
+// eventFields copies each optional property of an event, by JSON name, for
+// sparse field selection with fields=.
+var eventFields = map[string]func(dst, src *api.Event){
+	"parent_id":                 func(d, s *api.Event) { d.ParentID = s.ParentID },
+	"description":               func(d, s *api.Event) { d.Description = s.Description },
+	"start_date":                func(d, s *api.Event) { d.StartDate = s.StartDate },
+	"end_date":                  func(d, s *api.Event) { d.EndDate = s.EndDate },
+	"start_time":                func(d, s *api.Event) { d.StartTime = s.StartTime },
+	"end_time":                  func(d, s *api.Event) { d.EndTime = s.EndTime },
+	"all_day":                   func(d, s *api.Event) { d.AllDay = s.AllDay },
+	"color":                     func(d, s *api.Event) { d.Color = s.Color },
+	"recurrence_freq":           func(d, s *api.Event) { d.RecurrenceFreq = s.RecurrenceFreq },
+	"recurrence_count":          func(d, s *api.Event) { d.RecurrenceCount = s.RecurrenceCount },
+	"recurrence_until":          func(d, s *api.Event) { d.RecurrenceUntil = s.RecurrenceUntil },
+	"recurrence_interval":       func(d, s *api.Event) { d.RecurrenceInterval = s.RecurrenceInterval },
+	"recurrence_by_day":         func(d, s *api.Event) { d.RecurrenceByDay = s.RecurrenceByDay },
+	"recurrence_by_monthday":    func(d, s *api.Event) { d.RecurrenceByMonthday = s.RecurrenceByMonthday },
+	"recurrence_by_month":       func(d, s *api.Event) { d.RecurrenceByMonth = s.RecurrenceByMonth },
+	"exdates":                   func(d, s *api.Event) { d.Exdates = s.Exdates },
+	"rdates":                    func(d, s *api.Event) { d.Rdates = s.Rdates },
+	"recurrence_parent_id":      func(d, s *api.Event) { d.RecurrenceParentID = s.RecurrenceParentID },
+	"recurrence_original_start": func(d, s *api.Event) { d.RecurrenceOriginalStart = s.RecurrenceOriginalStart },
+	"duration":                  func(d, s *api.Event) { d.Duration = s.Duration },
+	"categories":                func(d, s *api.Event) { d.Categories = s.Categories },
+	"url":                       func(d, s *api.Event) { d.URL = s.URL },
+	"reminder_minutes":          func(d, s *api.Event) { d.ReminderMinutes = s.ReminderMinutes },
+	"transparent":               func(d, s *api.Event) { d.Transparent = s.Transparent },
+	"location":                  func(d, s *api.Event) { d.Location = s.Location },
+	"latitude":                  func(d, s *api.Event) { d.Latitude = s.Latitude },
+	"longitude":                 func(d, s *api.Event) { d.Longitude = s.Longitude },
+	"calendar_id":               func(d, s *api.Event) { d.CalendarID = s.CalendarID },
+	"calendar_name":             func(d, s *api.Event) { d.CalendarName = s.CalendarName },
+	"created_at":                func(d, s *api.Event) { d.CreatedAt = s.CreatedAt },
+	"updated_at":                func(d, s *api.Event) { d.UpdatedAt = s.UpdatedAt },
+	"deleted_at":                func(d, s *api.Event) { d.DeletedAt = s.DeletedAt },
+	"snippet":                   func(d, s *api.Event) { d.Snippet = s.Snippet },
+}
+
+// eventProjection returns a function that reduces an event to the given
+// properties; id and title are always kept. It returns nil when fields is
+// empty, meaning all properties.
+func eventProjection(fields []string) (func(api.Event) api.Event, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var copiers []func(dst, src *api.Event)
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "id" || f == "title" || f == "" {
+			continue
+		}
+		copyField, ok := eventFields[f]
+		if !ok {
+			return nil, badRequest("unknown field: " + f)
+		}
+		copiers = append(copiers, copyField)
+	}
+	return func(e api.Event) api.Event {
+		p := api.Event{ID: e.ID, Title: e.Title}
+		for _, copyField := range copiers {
+			copyField(&p, &e)
+		}
+		return p
+	}, nil
+}
@@ -1,34 +1,134 @@
 package handler
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mikaelstaldal/go-server-common/recovery"
 	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/ical"
 	"github.com/mikaelstaldal/mycal/internal/service"
 )
 
-// NewRouter creates an HTTP handler for all API routes using the ogen-generated server.
-func NewRouter(svc *service.EventService, prefSvc *service.PreferencesService, feedSvc *service.FeedService, calSvc *service.CalendarService) http.Handler {
+// NewRouter creates an HTTP handler for all API routes using the ogen-generated
+// server, and for the change stream of bus.
+func NewRouter(svc *service.EventService, prefSvc *service.PreferencesService, feedSvc *service.FeedService, calSvc *service.CalendarService, dumpSvc *service.DumpService, hookSvc *service.WebhookService, pubSvc *service.PublicationService, bus *service.EventBus) http.Handler {
 	impl := &handlerImpl{
 		svc:     svc,
 		prefSvc: prefSvc,
 		feedSvc: feedSvc,
 		calSvc:  calSvc,
+		dumpSvc: dumpSvc,
+		hookSvc: hookSvc,
+		pubSvc:  pubSvc,
 	}
 	server, err := api.NewServer(impl)
 	if err != nil {
 		log.Fatalf("ogen server init: %v", err)
 	}
-	return withMiddleware(addCalendarDispositionHeader(server))
+	mux := http.NewServeMux()
+	// The stream is not compressed, since the gzip middleware cannot flush.
+	mux.Handle("GET /api/v1/stream", recovery.Middleware(apiCacheMiddleware(streamHandler(bus))))
+	mux.Handle("/", metricsMiddleware(server, withMiddleware(calendarFormatMiddleware(server))))
+	return mux
 }
 
-// addCalendarDispositionHeader sets Content-Disposition for iCalendar feed responses.
-func addCalendarDispositionHeader(next http.Handler) http.Handler {
+// importTimeout is how long an iCalendar import may take to upload and
+// import, instead of the server's read and write timeouts.
+const importTimeout = 10 * time.Minute
+
+// LimitRequestBody limits request bodies to limit bytes. iCalendar imports
+// may be up to MaxICalImportSize, and take up to importTimeout. It must wrap
+// the server's own ResponseWriter, to extend its deadlines.
+func LimitRequestBody(next http.Handler, limit int64) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/api/v1/events.ics" || r.URL.Path == "/calendar.ics" {
-			w.Header().Set("Content-Disposition", `attachment; filename="mycal.ics"`)
+		n := limit
+		if r.Method == http.MethodPost && (r.URL.Path == "/api/v1/import" || r.URL.Path == "/api/v1/import/validate") {
+			n = MaxICalImportSize
+			rc := http.NewResponseController(w)
+			deadline := time.Now().Add(importTimeout)
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline)
 		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
 		next.ServeHTTP(w, r)
 	})
 }
+
+// isCalendarFeed reports whether a request is for one of the iCalendar feeds.
+func isCalendarFeed(r *http.Request) bool {
+	return r.URL.Path == "/api/v1/events.ics" || r.URL.Path == "/calendar.ics"
+}
+
+// isCalendarExport reports whether a request is for one of the iCalendar feeds
+// or the export of a single event.
+func isCalendarExport(r *http.Request) bool {
+	return isCalendarFeed(r) ||
+		strings.HasPrefix(r.URL.Path, "/api/v1/events/") && strings.HasSuffix(r.URL.Path, "/ics")
+}
+
+// calendarFileExtensions are the extensions of the feed's file name by format.
+var calendarFileExtensions = map[ical.Format]string{
+	ical.FormatICal: "ics",
+	ical.FormatJCal: "json",
+	ical.FormatXCal: "xml",
+}
+
+type formatKey struct{}
+
+// calendarFormatMiddleware selects the format of iCalendar exports from the
+// Accept header and stores it in the request context. It sets
+// Content-Disposition for the iCalendar feeds and the CSV export.
+func calendarFormatMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/events.csv" {
+			w.Header().Set("Content-Disposition", `attachment; filename="mycal.csv"`)
+		}
+		if !isCalendarExport(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		format := negotiateFormat(r.Header.Get("Accept"))
+		w.Header().Add("Vary", "Accept")
+		if isCalendarFeed(r) {
+			w.Header().Set("Content-Disposition", `attachment; filename="mycal.`+calendarFileExtensions[format]+`"`)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), formatKey{}, format)))
+	})
+}
+
+func formatFromContext(ctx context.Context) ical.Format {
+	if format, ok := ctx.Value(formatKey{}).(ical.Format); ok {
+		return format
+	}
+	return ical.FormatICal
+}
+
+// negotiateFormat returns the format of highest quality in an Accept header.
+// The text format is preferred on ties, and used when none of the formats is
+// acceptable, since calendar clients send all kinds of Accept headers.
+func negotiateFormat(accept string) ical.Format {
+	best, bestQ := ical.FormatICal, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch format := ical.Format(strings.ToLower(strings.TrimSpace(mediaType))); format {
+		case ical.FormatICal, ical.FormatJCal, ical.FormatXCal:
+			if q > bestQ || q == bestQ && format == ical.FormatICal {
+				best, bestQ = format, q
+			}
+		}
+	}
+	return best
+}
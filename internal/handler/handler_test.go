@@ -1,8 +1,12 @@
 package handler_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -17,7 +21,9 @@ import (
 
 	"github.com/mikaelstaldal/mycal/internal/api"
 	"github.com/mikaelstaldal/mycal/internal/handler"
+	"github.com/mikaelstaldal/mycal/internal/metrics"
 	"github.com/mikaelstaldal/mycal/internal/repository"
+	"github.com/mikaelstaldal/mycal/internal/secret"
 	"github.com/mikaelstaldal/mycal/internal/service"
 )
 
@@ -43,13 +49,23 @@ func setupTestServer(t *testing.T) *httptest.Server {
 	require.NoError(t, err, "open db")
 	repo, err := repository.NewSQLiteRepository(db)
 	require.NoError(t, err, "init repo")
-	calSvc := service.NewCalendarService(repo)
-	svc := service.NewEventService(repo, repo)
+	bus := service.NewEventBus()
+	calSvc := service.NewCalendarService(repo, bus)
+	svc := service.NewEventService(repo, repo, repo, bus)
 	prefSvc := service.NewPreferencesService(repo)
-	feedSvc := service.NewFeedService(repo, repo, repo)
-	router := handler.NewRouter(svc, prefSvc, feedSvc, calSvc)
-	ts := httptest.NewServer(router)
+	secrets, err := secret.NewBox(make([]byte, secret.KeySize))
+	require.NoError(t, err)
+	feedSvc := service.NewFeedService(repo, repo, repo, repo, bus, secrets)
+	dumpSvc := service.NewDumpService(repo, repo, bus)
+	webhookSvc := service.NewWebhookService(repo, bus)
+	publicationSvc := service.NewPublicationService(repo, svc)
+	router := handler.NewRouter(svc, prefSvc, feedSvc, calSvc, dumpSvc, webhookSvc, publicationSvc, bus)
+	mux := http.NewServeMux()
+	mux.Handle("/public/", handler.NewPublicRouter(publicationSvc, calSvc))
+	mux.Handle("/", router)
+	ts := httptest.NewServer(mux)
 	t.Cleanup(func() {
+		bus.Close()
 		ts.Close()
 		db.Close()
 	})
@@ -104,6 +120,27 @@ func doDelete(t *testing.T, url string) *http.Response {
 	return resp
 }
 
+// doWithHeader sends a request with one extra header, and a JSON body unless
+// body is nil.
+func doWithHeader(t *testing.T, method, url, header, value string, body any) *http.Response {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := marshalBody(body)
+		require.NoError(t, err, "marshal")
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	require.NoError(t, err, "new request")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(header, value)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, strings.ToLower(method))
+	return resp
+}
+
 func decodeJSON[T any](t *testing.T, resp *http.Response) T {
 	t.Helper()
 	defer resp.Body.Close()
@@ -137,6 +174,7 @@ func TestCreateEvent(t *testing.T) {
 		StartTime:   api.NewOptDateTime(mustTime("2026-03-15T10:00:00Z")),
 		EndTime:     api.NewOptDateTime(mustTime("2026-03-15T11:00:00Z")),
 		Location:    api.NewOptString("Room 42"),
+		Transparent: api.NewOptBool(true),
 	}
 	resp := postJSON(t, ts.URL+"/api/v1/events", body)
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
@@ -145,6 +183,7 @@ func TestCreateEvent(t *testing.T) {
 	assert.Equal(t, "Meeting", event.Title)
 	assert.Equal(t, "Team sync", event.Description.Value)
 	assert.Equal(t, "Room 42", event.Location.Value)
+	assert.True(t, event.Transparent.Value)
 	assert.True(t, event.CreatedAt.Set, "expected non-empty created_at")
 	assert.True(t, event.UpdatedAt.Set, "expected non-empty updated_at")
 }
@@ -265,6 +304,85 @@ func TestDeleteEvent_NotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
 
+func TestEventETag(t *testing.T) {
+	ts := setupTestServer(t)
+	resp := postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:     "Test Event",
+		StartTime: api.NewOptDateTime(mustTime("2026-03-15T10:00:00Z")),
+		EndTime:   api.NewOptDateTime(mustTime("2026-03-15T11:00:00Z")),
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeJSON[api.Event](t, resp)
+	createdETag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, createdETag)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events/" + created.ID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, createdETag, etag)
+
+	// Updating with the current ETag succeeds and changes it.
+	resp = doWithHeader(t, http.MethodPatch, ts.URL+"/api/v1/events/"+created.ID, "If-Match", etag, api.UpdateEventRequest{Title: api.NewOptString("First")})
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	newETag := resp.Header.Get("ETag")
+	assert.NotEqual(t, etag, newETag)
+
+	// A stale ETag fails, and nothing is changed.
+	resp = doWithHeader(t, http.MethodPatch, ts.URL+"/api/v1/events/"+created.ID, "If-Match", etag, api.UpdateEventRequest{Title: api.NewOptString("Second")})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = doWithHeader(t, http.MethodDelete, ts.URL+"/api/v1/events/"+created.ID, "If-Match", etag, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp, err = http.Get(ts.URL + "/api/v1/events/" + created.ID)
+	require.NoError(t, err)
+	event := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, "First", event.Title)
+
+	resp = doWithHeader(t, http.MethodDelete, ts.URL+"/api/v1/events/"+created.ID, "If-Match", newETag, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doWithHeader(t, http.MethodDelete, ts.URL+"/api/v1/events/"+created.ID, "If-Match", "*", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestEventETag_RecurrenceInstance(t *testing.T) {
+	ts := setupTestServer(t)
+	resp := postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:           "Daily Standup",
+		StartTime:       api.NewOptDateTime(mustTime("2026-03-01T09:00:00Z")),
+		EndTime:         api.NewOptDateTime(mustTime("2026-03-01T09:30:00Z")),
+		RecurrenceFreq:  api.NewOptCreateEventRequestRecurrenceFreq(api.CreateEventRequestRecurrenceFreqDAILY),
+		RecurrenceCount: api.NewOptInt(30),
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeJSON[api.Event](t, resp)
+	instanceURL := ts.URL + "/api/v1/events/" + url.PathEscape(created.ID+"_2026-03-05T09:00:00Z")
+
+	resp, err := http.Get(instanceURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+
+	resp = doWithHeader(t, http.MethodPatch, instanceURL, "If-Match", etag, api.UpdateEventRequest{Title: api.NewOptString("Moved Standup")})
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	overrideETag := resp.Header.Get("ETag")
+	assert.NotEqual(t, etag, overrideETag)
+
+	resp = doWithHeader(t, http.MethodPatch, instanceURL, "If-Match", etag, api.UpdateEventRequest{Title: api.NewOptString("Again")})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = doWithHeader(t, http.MethodPatch, instanceURL, "If-Match", overrideETag, api.UpdateEventRequest{Title: api.NewOptString("Again")})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
 // --- List and search tests ---
 
 func TestListEvents(t *testing.T) {
@@ -328,10 +446,321 @@ func TestSearchEvents(t *testing.T) {
 	events := decodeJSON[[]api.Event](t, resp)
 	assert.Len(t, events, 1)
 	assert.Equal(t, "Go Conference", events[0].Title)
+	assert.Equal(t, "Go <mark>Conference</mark>", events[0].Snippet.Value)
+}
+
+func TestSearchEventsQueryLanguage(t *testing.T) {
+	ts := setupTestServer(t)
+
+	postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:      "Planning",
+		StartTime:  api.NewOptDateTime(mustTime("2026-03-15T10:00:00Z")),
+		EndTime:    api.NewOptDateTime(mustTime("2026-03-15T11:00:00Z")),
+		Location:   api.NewOptString("Main office"),
+		Categories: api.NewOptString("work"),
+	}).Body.Close()
+	postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:     "Planting in the office garden",
+		StartTime: api.NewOptDateTime(mustTime("2025-03-15T10:00:00Z")),
+		EndTime:   api.NewOptDateTime(mustTime("2025-03-15T11:00:00Z")),
+	}).Body.Close()
+
+	for query, want := range map[string]int{
+		`plan*`:                  2,
+		`category:work`:          1,
+		`location:"main office"`: 1,
+		`plan* after:2026-01-01`: 1,
+		`office -garden`:         1,
+		`planning OR garden`:     2,
+		`"office garden"`:        1,
+		`"garden office"`:        0,
+	} {
+		resp, err := http.Get(ts.URL + "/api/v1/events?q=" + url.QueryEscape(query))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, query)
+		events := decodeJSON[[]api.Event](t, resp)
+		assert.Len(t, events, want, query)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?q=" + url.QueryEscape("plan* after:someday"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSearchExpandsRecurringEvents(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp := postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:           "Weekly Standup",
+		StartTime:       api.NewOptDateTime(mustTime("2026-03-02T09:00:00Z")),
+		EndTime:         api.NewOptDateTime(mustTime("2026-03-02T09:30:00Z")),
+		RecurrenceFreq:  api.NewOptCreateEventRequestRecurrenceFreq(api.CreateEventRequestRecurrenceFreqWEEKLY),
+		RecurrenceCount: api.NewOptInt(10),
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeJSON[api.Event](t, resp)
+	resp = patchJSON(t, ts.URL+"/api/v1/events/"+url.PathEscape(created.ID+"_2026-03-16T09:00:00Z"),
+		api.UpdateEventRequest{Title: api.NewOptString("Retro")})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	search := func(query string) []string {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/v1/events?" + query)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var starts []string
+		for _, e := range decodeJSON[[]api.Event](t, resp) {
+			starts = append(starts, e.StartTime.Value.Format(time.RFC3339))
+		}
+		return starts
+	}
+
+	assert.Equal(t, []string{"2026-03-02T09:00:00Z", "2026-03-09T09:00:00Z", "2026-03-23T09:00:00Z"},
+		search("q=standup&from=2026-03-01T00:00:00Z&to=2026-03-29T00:00:00Z"),
+		"instances in range, without the one that was renamed")
+	assert.Equal(t, []string{"2026-03-16T09:00:00Z"},
+		search("q=retro&from=2026-03-01T00:00:00Z&to=2026-03-29T00:00:00Z"))
+	assert.Equal(t, []string{"2026-03-23T09:00:00Z"},
+		search("q=standup&from=2026-03-10T00:00:00Z&to=2026-04-30T00:00:00Z&next_occurrence=true"))
+}
+
+func TestListEventsPagination(t *testing.T) {
+	ts := setupTestServer(t)
+	for day := 1; day <= 5; day++ {
+		start := time.Date(2026, 3, day, 10, 0, 0, 0, time.UTC)
+		postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+			Title:       fmt.Sprintf("Event %d", day),
+			Description: api.NewOptString("A long description"),
+			StartTime:   api.NewOptDateTime(start),
+			EndTime:     api.NewOptDateTime(start.Add(time.Hour)),
+		}).Body.Close()
+	}
+
+	base := ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z&limit=2&fields=start_time"
+	var titles []string
+	cursor := ""
+	for range 5 {
+		u := base
+		if cursor != "" {
+			u += "&cursor=" + url.QueryEscape(cursor)
+		}
+		resp, err := http.Get(u)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("X-Total-Count"))
+		cursor = resp.Header.Get("X-Next-Cursor")
+		for _, e := range decodeJSON[[]api.Event](t, resp) {
+			titles = append(titles, e.Title)
+			assert.True(t, e.StartTime.Set)
+			assert.False(t, e.Description.Set, "only the selected fields")
+			assert.False(t, e.CreatedAt.Set, "only the selected fields")
+		}
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"Event 1", "Event 2", "Event 3", "Event 4", "Event 5"}, titles)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?q=event&limit=4")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "5", resp.Header.Get("X-Total-Count"))
+	assert.NotEmpty(t, resp.Header.Get("X-Next-Cursor"))
+	assert.Len(t, decodeJSON[[]api.Event](t, resp), 4)
+
+	for _, query := range []string{"&fields=bogus", "&cursor=garbage!", "&limit=0", "&limit=5000"} {
+		resp, err := http.Get(ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
 }
 
 // --- All-day events ---
 
+func TestBatch(t *testing.T) {
+	ts := setupTestServer(t)
+	existing := createTestEvent(t, ts)
+	doomed := createTestEvent(t, ts)
+
+	resp := postJSON(t, ts.URL+"/api/v1/events/batch", map[string]any{
+		"operations": []map[string]any{
+			{"op": "create", "create": map[string]any{"title": "New", "all_day": false, "start_time": "2026-03-16T10:00:00Z", "end_time": "2026-03-16T11:00:00Z"}},
+			{"op": "update", "id": existing.ID, "update": map[string]any{"title": "Renamed"}},
+			{"op": "delete", "id": doomed.ID},
+		},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.BatchResult](t, resp)
+	assert.True(t, result.Committed)
+	require.Len(t, result.Results, 3)
+	assert.Equal(t, http.StatusCreated, result.Results[0].Status)
+	assert.Equal(t, "New", result.Results[0].Event.Value.Title)
+	assert.Equal(t, http.StatusOK, result.Results[1].Status)
+	assert.Equal(t, "Renamed", result.Results[1].Event.Value.Title)
+	assert.Equal(t, http.StatusNoContent, result.Results[2].Status)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events/" + doomed.ID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestBatch_RollsBackOnFailure(t *testing.T) {
+	ts := setupTestServer(t)
+	existing := createTestEvent(t, ts)
+
+	resp := postJSON(t, ts.URL+"/api/v1/events/batch", map[string]any{
+		"operations": []map[string]any{
+			{"op": "update", "id": existing.ID, "update": map[string]any{"title": "Renamed"}},
+			{"op": "create", "create": map[string]any{"title": "New", "all_day": false, "start_time": "2026-03-16T10:00:00Z", "end_time": "2026-03-16T11:00:00Z"}},
+			{"op": "delete", "id": "99999"},
+			{"op": "delete", "id": existing.ID},
+		},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.BatchResult](t, resp)
+	assert.False(t, result.Committed)
+	require.Len(t, result.Results, 4)
+	assert.Equal(t, http.StatusFailedDependency, result.Results[0].Status)
+	assert.Equal(t, http.StatusFailedDependency, result.Results[1].Status)
+	assert.Equal(t, http.StatusNotFound, result.Results[2].Status)
+	assert.Equal(t, http.StatusFailedDependency, result.Results[3].Status)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events/" + existing.ID)
+	require.NoError(t, err)
+	unchanged := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, "Test Event", unchanged.Title)
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Len(t, decodeJSON[[]api.Event](t, resp), 1, "the created event was rolled back")
+}
+
+func TestBulkUpdateAndDelete(t *testing.T) {
+	ts := setupTestServer(t)
+	ics := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Test//Test//EN
+BEGIN:VEVENT
+DTSTART:20260401T100000Z
+DTEND:20260401T110000Z
+SUMMARY:Planning
+CATEGORIES:work
+END:VEVENT
+END:VCALENDAR`
+	resp := postICS(t, ts.URL+"/api/v1/import?calendar=Work", ics)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err := http.Get(ts.URL + "/api/v1/calendars")
+	require.NoError(t, err)
+	var work api.Calendar
+	for _, cal := range decodeJSON[[]api.Calendar](t, resp) {
+		if cal.Name == "Work" {
+			work = cal
+		}
+	}
+	require.NotZero(t, work.ID)
+	march := createTestEvent(t, ts)
+	createTestEvent(t, ts)
+
+	// Move the default calendar events in March to the work calendar.
+	resp = postJSON(t, ts.URL+"/api/v1/events/bulk-update", map[string]any{
+		"filter": map[string]any{"calendar_id": []int64{0}, "from": "2026-03-01T00:00:00Z", "to": "2026-04-01T00:00:00Z"},
+		"update": map[string]any{"calendar_id": work.ID},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	updated := decodeJSON[api.BulkResult](t, resp)
+	assert.Equal(t, 2, updated.Count)
+	assert.Contains(t, updated.Ids, march.ID)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events/" + march.ID)
+	require.NoError(t, err)
+	moved := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, work.ID, moved.CalendarID.Value)
+	assert.Equal(t, "Work", moved.CalendarName.Value)
+
+	// Recolor a category.
+	resp = postJSON(t, ts.URL+"/api/v1/events/bulk-update", map[string]any{
+		"filter": map[string]any{"q": "category:work"},
+		"update": map[string]any{"color": "orange"},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, decodeJSON[api.BulkResult](t, resp).Count)
+
+	resp = postJSON(t, ts.URL+"/api/v1/events/bulk-delete", map[string]any{
+		"filter": map[string]any{"calendar_id": []int64{work.ID}},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, decodeJSON[api.BulkResult](t, resp).Count)
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-05-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Event](t, resp))
+}
+
+func TestBulkDelete_RecurringEvents(t *testing.T) {
+	ts := setupTestServer(t)
+	resp := postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:           "Weekly Standup",
+		StartTime:       api.NewOptDateTime(mustTime("2026-03-02T09:00:00Z")),
+		EndTime:         api.NewOptDateTime(mustTime("2026-03-02T09:30:00Z")),
+		RecurrenceFreq:  api.NewOptCreateEventRequestRecurrenceFreq(api.CreateEventRequestRecurrenceFreqWEEKLY),
+		RecurrenceCount: api.NewOptInt(10),
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeJSON[api.Event](t, resp)
+	resp = patchJSON(t, ts.URL+"/api/v1/events/"+url.PathEscape(created.ID+"_2026-03-16T09:00:00Z"),
+		api.UpdateEventRequest{Title: api.NewOptString("Retro")})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	bulkDelete := func(filter map[string]any) int {
+		t.Helper()
+		resp := postJSON(t, ts.URL+"/api/v1/events/bulk-delete", map[string]any{"filter": filter})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return decodeJSON[api.BulkResult](t, resp).Count
+	}
+	starts := func() []string {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-03-29T00:00:00Z")
+		require.NoError(t, err)
+		var result []string
+		for _, e := range decodeJSON[[]api.Event](t, resp) {
+			result = append(result, e.StartTime.Value.Format(time.RFC3339))
+		}
+		return result
+	}
+
+	// Only the override matches, so its instance is excluded from the series
+	// rather than reverting to the values of the series.
+	assert.Equal(t, 1, bulkDelete(map[string]any{"q": "retro", "from": "2026-03-15T00:00:00Z", "to": "2026-03-17T00:00:00Z"}))
+	assert.Equal(t, []string{"2026-03-02T09:00:00Z", "2026-03-09T09:00:00Z", "2026-03-23T09:00:00Z"}, starts())
+
+	assert.Zero(t, bulkDelete(map[string]any{"from": "2026-06-01T00:00:00Z", "to": "2026-07-01T00:00:00Z"}),
+		"no instances after the end of the series")
+	assert.Equal(t, 1, bulkDelete(map[string]any{"from": "2026-03-20T00:00:00Z", "to": "2026-03-25T00:00:00Z"}),
+		"the series is matched on an instance after its first")
+	assert.Empty(t, starts())
+}
+
+func TestBulkUpdate_ValidationErrors(t *testing.T) {
+	ts := setupTestServer(t)
+	createTestEvent(t, ts)
+
+	for name, body := range map[string]map[string]any{
+		"empty filter":     {"filter": map[string]any{}, "update": map[string]any{"color": "red"}},
+		"times":            {"filter": map[string]any{"q": "test"}, "update": map[string]any{"start_time": "2026-03-15T12:00:00Z"}},
+		"unknown calendar": {"filter": map[string]any{"q": "test"}, "update": map[string]any{"calendar_id": 42}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := postJSON(t, ts.URL+"/api/v1/events/bulk-update", body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
 func TestCreateAllDayEvent(t *testing.T) {
 	ts := setupTestServer(t)
 	body := api.CreateEventRequest{
@@ -411,6 +840,36 @@ func TestExportICal(t *testing.T) {
 	assert.True(t, strings.HasPrefix(ct, "text/calendar"), "content-type = %q", ct)
 }
 
+func TestExportICal_IfNoneMatch(t *testing.T) {
+	ts := setupTestServer(t)
+	created := createTestEvent(t, ts)
+
+	resp, err := http.Get(ts.URL + "/calendar.ics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	resp = doWithHeader(t, http.MethodGet, ts.URL+"/api/v1/events.ics", "If-None-Match", etag, nil)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, body)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	patchJSON(t, ts.URL+"/api/v1/events/"+created.ID, api.UpdateEventRequest{Title: api.NewOptString("Changed")}).Body.Close()
+	resp = doWithHeader(t, http.MethodGet, ts.URL+"/api/v1/events.ics", "If-None-Match", etag, nil)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "SUMMARY:Changed")
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+}
+
 func TestExportSingleEventICal(t *testing.T) {
 	ts := setupTestServer(t)
 	event := createTestEvent(t, ts)
@@ -427,6 +886,34 @@ func TestExportSingleEventICal(t *testing.T) {
 	assert.Contains(t, string(body), "SUMMARY:Test Event")
 }
 
+func TestExportJCalAndXCal(t *testing.T) {
+	ts := setupTestServer(t)
+	event := createTestEvent(t, ts)
+
+	for _, tc := range []struct {
+		url, accept, contentType, disposition, want string
+	}{
+		{"/api/v1/events.ics", "application/calendar+json", "application/calendar+json", "mycal.json", `["summary",{},"text","Test Event"]`},
+		{"/calendar.ics", "text/calendar;q=0.5, application/calendar+xml", "application/calendar+xml", "mycal.xml", "<summary><text>Test Event</text></summary>"},
+		{"/calendar.ics", "application/calendar+json;q=0.5, text/calendar", "text/calendar", "mycal.ics", "SUMMARY:Test Event"},
+		{"/calendar.ics", "application/json", "text/calendar", "mycal.ics", "SUMMARY:Test Event"},
+		{"/api/v1/events/" + event.ID + "/ics", "application/calendar+json", "application/calendar+json", "", `["summary",{},"text","Test Event"]`},
+		{"/api/v1/events/" + event.ID + "/ics", "application/calendar+xml", "application/calendar+xml", "", "<summary><text>Test Event</text></summary>"},
+	} {
+		resp := doWithHeader(t, http.MethodGet, ts.URL+tc.url, "Accept", tc.accept, nil)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, "%s %s", tc.url, tc.accept)
+		assert.Equal(t, tc.contentType, resp.Header.Get("Content-Type"), "%s %s", tc.url, tc.accept)
+		assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+		if tc.disposition != "" {
+			assert.Contains(t, resp.Header.Get("Content-Disposition"), tc.disposition)
+		}
+		assert.Contains(t, string(body), tc.want)
+	}
+}
+
 func TestExportSingleEventICal_NotFound(t *testing.T) {
 	ts := setupTestServer(t)
 
@@ -461,55 +948,358 @@ END:VCALENDAR`
 	assert.Equal(t, 2, result["imported"])
 }
 
-func TestImportSingleEvent(t *testing.T) {
+func TestImportJCal(t *testing.T) {
 	ts := setupTestServer(t)
-	ics := `BEGIN:VCALENDAR
-VERSION:2.0
-PRODID:-//Test//Test//EN
-BEGIN:VEVENT
-DTSTART:20260501T140000Z
-DTEND:20260501T150000Z
-SUMMARY:Single Import
-LOCATION:Office
-END:VEVENT
-END:VCALENDAR`
+	jcal := `["vcalendar", [["version", {}, "text", "2.0"]], [
+  ["vevent", [
+    ["dtstart", {"tzid": "Europe/Stockholm"}, "date-time", "2026-04-01T10:00:00"],
+    ["dtend", {"tzid": "Europe/Stockholm"}, "date-time", "2026-04-01T11:00:00"],
+    ["summary", {}, "text", "Imported from jCal"]
+  ], []]
+]]`
+
+	resp, err := http.Post(ts.URL+"/api/v1/import", "application/calendar+json", strings.NewReader(jcal))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, decodeJSON[map[string]int](t, resp)["imported"])
 
-	resp := postICS(t, ts.URL+"/api/v1/import-single", ics)
-	require.Equal(t, http.StatusCreated, resp.StatusCode)
-	event := decodeJSON[api.Event](t, resp)
-	assert.Equal(t, "Single Import", event.Title)
-	assert.Equal(t, "Office", event.Location.Value)
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-04-01T00:00:00Z&to=2026-04-02T00:00:00Z")
+	require.NoError(t, err)
+	events := decodeJSON[[]api.Event](t, resp)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Imported from jCal", events[0].Title)
+	assert.Equal(t, mustTime("2026-04-01T08:00:00Z"), events[0].StartTime.Value)
+
+	resp, err = http.Post(ts.URL+"/api/v1/import", "application/calendar+json", strings.NewReader(`{"not": "jcal"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
 
-// --- RECURRENCE-ID override tests ---
+// invitationMail is an email message with an invitation of the given method.
+func invitationMail(method, summary string) string {
+	return "From: organizer@example.com\r\n" +
+		"Subject: Invitation\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"You are invited.\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/calendar; method=" + method + "\r\n" +
+		"\r\n" +
+		"BEGIN:VCALENDAR\r\nMETHOD:" + method + "\r\nBEGIN:VEVENT\r\nUID:mail-1@example.com\r\n" +
+		"SUMMARY:" + summary + "\r\nDTSTART:20260601T090000Z\r\nDTEND:20260601T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n" +
+		"--b--\r\n"
+}
 
-func TestOverrideInstance(t *testing.T) {
+func TestImportMail(t *testing.T) {
 	ts := setupTestServer(t)
-
-	// Create a weekly recurring event
-	body := api.CreateEventRequest{
-		Title:           "Weekly Standup",
-		AllDay:          false,
-		StartTime:       api.NewOptDateTime(mustTime("2026-03-02T09:00:00Z")),
-		EndTime:         api.NewOptDateTime(mustTime("2026-03-02T09:30:00Z")),
-		RecurrenceFreq:  api.NewOptCreateEventRequestRecurrenceFreq(api.CreateEventRequestRecurrenceFreqWEEKLY),
-		RecurrenceCount: api.NewOptInt(10),
+	postMail := func(msg string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/api/v1/import/mail", "message/rfc822", strings.NewReader(msg))
+		require.NoError(t, err)
+		return resp
 	}
-	resp := postJSON(t, ts.URL+"/api/v1/events", body)
-	require.Equal(t, http.StatusCreated, resp.StatusCode)
-	created := decodeJSON[api.Event](t, resp)
 
-	// Override the 2nd instance (2026-03-09) using composite ID
-	compositeID := created.ID + "_2026-03-09T09:00:00Z"
-	resp = patchJSON(t, ts.URL+"/api/v1/events/"+url.PathEscape(compositeID),
-		api.UpdateEventRequest{Title: api.NewOptString("Modified Standup")})
+	resp := postMail(invitationMail("REQUEST", "Planning"))
 	require.Equal(t, http.StatusOK, resp.StatusCode)
-	override := decodeJSON[api.Event](t, resp)
-	assert.Equal(t, "Modified Standup", override.Title)
-	assert.True(t, override.RecurrenceParentID.Set, "expected non-nil recurrence_parent_id on override")
+	created := decodeJSON[api.MailImportResult](t, resp)
+	assert.Equal(t, 1, created.Calendars)
+	require.Len(t, created.Items, 1)
+	assert.Equal(t, api.MailImportItemActionCreated, created.Items[0].Action)
+	assert.Equal(t, "Planning", created.Items[0].Event.Value.Title)
 
-	// List events and verify the override replaces the original instance
-	listResp, err := http.Get(ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-03-22T00:00:00Z")
+	resp = postMail(invitationMail("REQUEST", "Planning, moved"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	updated := decodeJSON[api.MailImportResult](t, resp)
+	require.Len(t, updated.Items, 1)
+	assert.Equal(t, api.MailImportItemActionUpdated, updated.Items[0].Action)
+	assert.Equal(t, created.Items[0].Event.Value.ID, updated.Items[0].Event.Value.ID)
+
+	resp = postMail(invitationMail("REPLY", "Planning"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, api.MailImportItemActionSkipped, decodeJSON[api.MailImportResult](t, resp).Items[0].Action)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?from=2026-06-01T00:00:00Z&to=2026-06-02T00:00:00Z")
+	require.NoError(t, err)
+	events := decodeJSON[[]api.Event](t, resp)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Planning, moved", events[0].Title)
+
+	resp = postMail(invitationMail("CANCEL", "Planning, moved"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, api.MailImportItemActionCancelled, decodeJSON[api.MailImportResult](t, resp).Items[0].Action)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-06-01T00:00:00Z&to=2026-06-02T00:00:00Z")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Event](t, resp))
+
+	resp = postMail("From: me@example.com\r\nSubject: Hello\r\n\r\nNo invitation here.\r\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestImportCSV(t *testing.T) {
+	ts := setupTestServer(t)
+	csv := "What,Day,From,To\nLunch,17/02/2026,12:00,13:00\nParty,20/02/2026,20:00,23:30\n"
+	query := url.Values{
+		"column":   {"title=What", "start_date=Day", "start_time=From", "end_time=To"},
+		"timezone": {"Europe/Stockholm"},
+		"calendar": {"Imported"},
+	}
+
+	resp, err := http.Post(ts.URL+"/api/v1/import/csv?dry_run=true&"+query.Encode(), "text/csv", strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	preview := decodeJSON[api.CSVImportResult](t, resp)
+	assert.False(t, preview.Committed)
+	assert.Zero(t, preview.Imported)
+	assert.Equal(t, "DD/MM/YYYY", preview.DateFormat)
+	require.Len(t, preview.Rows, 2)
+	assert.Equal(t, 2, preview.Rows[0].Row)
+	assert.Equal(t, mustTime("2026-02-17T11:00:00Z"), preview.Rows[0].Event.Value.StartTime.Value)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-02-01T00:00:00Z&to=2026-03-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Event](t, resp), "a dry run imports nothing")
+
+	resp, err = http.Post(ts.URL+"/api/v1/import/csv?"+query.Encode(), "text/csv", strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.CSVImportResult](t, resp)
+	assert.True(t, result.Committed)
+	assert.Equal(t, 2, result.Imported)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-02-01T00:00:00Z&to=2026-03-01T00:00:00Z&calendar=Imported")
+	require.NoError(t, err)
+	events := decodeJSON[[]api.Event](t, resp)
+	require.Len(t, events, 2)
+	assert.Equal(t, "Party", events[1].Title)
+	assert.Equal(t, mustTime("2026-02-20T22:30:00Z"), events[1].EndTime.Value)
+}
+
+func TestImportCSV_InvalidRow(t *testing.T) {
+	ts := setupTestServer(t)
+	csv := "title,start_date\nGood,2026-02-17\n,2026-02-18\n"
+
+	resp, err := http.Post(ts.URL+"/api/v1/import/csv", "text/csv", strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.CSVImportResult](t, resp)
+	assert.False(t, result.Committed)
+	require.Len(t, result.Rows, 2)
+	assert.True(t, result.Rows[0].Event.Set)
+	assert.Equal(t, 3, result.Rows[1].Row)
+	assert.Contains(t, result.Rows[1].Error.Value, "title is required")
+
+	resp, err = http.Post(ts.URL+"/api/v1/import/csv?column=title", "text/csv", strings.NewReader(csv))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/import/csv", "text/csv", strings.NewReader("a,b\n1,2\n"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestExportCSV(t *testing.T) {
+	ts := setupTestServer(t)
+	createTestEvent(t, ts)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events.csv?from=2026-01-01T00:00:00Z&to=2027-01-01T00:00:00Z")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="mycal.csv"`, resp.Header.Get("Content-Disposition"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "id,title,description,all_day,"))
+	assert.Contains(t, lines[1], ",Test Event,")
+
+	resp2, err := http.Get(ts.URL + "/api/v1/events.csv")
+	require.NoError(t, err)
+	resp2.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+}
+
+const icsWithDroppedEvent = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Good\r\n" +
+	"DTSTART:20260501T140000Z\r\n" +
+	"DTEND:20260501T150000Z\r\n" +
+	"GEO:somewhere\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:No end\r\n" +
+	"DTSTART:20260502T140000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestImportDiagnostics(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp := postICS(t, ts.URL+"/api/v1/import?strict=true", icsWithDroppedEvent)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	rejected := decodeJSON[api.ImportValidation](t, resp)
+	assert.False(t, rejected.Valid)
+	assert.Equal(t, 1, rejected.Events)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?from=2026-05-01T00:00:00Z&to=2026-06-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Event](t, resp), "a strict import with errors imports nothing")
+
+	resp = postICS(t, ts.URL+"/api/v1/import", icsWithDroppedEvent)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.APIV1ImportPostOK](t, resp)
+	assert.Equal(t, 1, result.Imported.Value)
+	require.Len(t, result.Diagnostics, 2)
+	assert.Equal(t, api.ImportDiagnostic{
+		Line:     api.NewOptInt(7),
+		Property: "GEO",
+		Severity: api.ImportDiagnosticSeverityWarning,
+		Message:  `invalid GEO "somewhere" ignored, expected latitude;longitude`,
+	}, result.Diagnostics[0])
+	assert.Equal(t, api.ImportDiagnostic{
+		Line:     api.NewOptInt(9),
+		Property: "DTEND",
+		Severity: api.ImportDiagnosticSeverityError,
+		Message:  `event "No end" dropped: no valid DTEND or DURATION`,
+	}, result.Diagnostics[1])
+}
+
+func TestImportValidate(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp := postICS(t, ts.URL+"/api/v1/import/validate", icsWithDroppedEvent)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.ImportValidation](t, resp)
+	assert.False(t, result.Valid)
+	assert.Equal(t, 1, result.Events)
+	assert.Len(t, result.Diagnostics, 2)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?from=2026-05-01T00:00:00Z&to=2026-06-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Event](t, resp), "validation imports nothing")
+
+	jcal := `["vcalendar", [], [["vevent", [
+  ["summary", {}, "text", "Fine"],
+  ["dtstart", {}, "date-time", "2026-05-01T14:00:00Z"],
+  ["duration", {}, "duration", "PT1H"]
+], []]]]`
+	resp, err = http.Post(ts.URL+"/api/v1/import/validate", "application/calendar+json", strings.NewReader(jcal))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result = decodeJSON[api.ImportValidation](t, resp)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 1, result.Events)
+	assert.Empty(t, result.Diagnostics)
+}
+
+func TestImportInBatches(t *testing.T) {
+	ts := setupTestServer(t)
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n")
+	for i := 0; i < 1200; i++ {
+		fmt.Fprintf(&b, "BEGIN:VEVENT\r\nUID:batch-%d\r\nSUMMARY:Event %d\r\nDTSTART:20260510T%02d0000Z\r\nDURATION:PT30M\r\nEND:VEVENT\r\n", i, i, i%24)
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+
+	resp := postICS(t, ts.URL+"/api/v1/import", b.String())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1200, decodeJSON[api.APIV1ImportPostOK](t, resp).Imported.Value)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events?from=2026-05-10T00:00:00Z&to=2026-05-11T00:00:00Z")
+	require.NoError(t, err)
+	assert.Len(t, decodeJSON[[]api.Event](t, resp), 1200)
+
+	// A strict import is rolled back when an error comes after the first batches.
+	resp = postICS(t, ts.URL+"/api/v1/import?strict=true", strings.Replace(b.String(), "END:VCALENDAR",
+		"BEGIN:VEVENT\r\nSUMMARY:No start\r\nEND:VEVENT\r\nEND:VCALENDAR", 1))
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, 1200, decodeJSON[api.ImportValidation](t, resp).Events)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events?from=2026-05-10T00:00:00Z&to=2026-05-11T00:00:00Z")
+	require.NoError(t, err)
+	assert.Len(t, decodeJSON[[]api.Event](t, resp), 1200)
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	h := handler.LimitRequestBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}), 1024)
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	body := strings.Repeat("x", 2048)
+	resp, err := http.Post(ts.URL+"/api/v1/events", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/api/v1/import", "text/calendar", strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "iCalendar imports may be larger")
+}
+
+func TestImportSingleEvent(t *testing.T) {
+	ts := setupTestServer(t)
+	ics := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Test//Test//EN
+BEGIN:VEVENT
+DTSTART:20260501T140000Z
+DTEND:20260501T150000Z
+SUMMARY:Single Import
+LOCATION:Office
+END:VEVENT
+END:VCALENDAR`
+
+	resp := postICS(t, ts.URL+"/api/v1/import-single", ics)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	event := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, "Single Import", event.Title)
+	assert.Equal(t, "Office", event.Location.Value)
+}
+
+// --- RECURRENCE-ID override tests ---
+
+func TestOverrideInstance(t *testing.T) {
+	ts := setupTestServer(t)
+
+	// Create a weekly recurring event
+	body := api.CreateEventRequest{
+		Title:           "Weekly Standup",
+		AllDay:          false,
+		StartTime:       api.NewOptDateTime(mustTime("2026-03-02T09:00:00Z")),
+		EndTime:         api.NewOptDateTime(mustTime("2026-03-02T09:30:00Z")),
+		RecurrenceFreq:  api.NewOptCreateEventRequestRecurrenceFreq(api.CreateEventRequestRecurrenceFreqWEEKLY),
+		RecurrenceCount: api.NewOptInt(10),
+	}
+	resp := postJSON(t, ts.URL+"/api/v1/events", body)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeJSON[api.Event](t, resp)
+
+	// Override the 2nd instance (2026-03-09) using composite ID
+	compositeID := created.ID + "_2026-03-09T09:00:00Z"
+	resp = patchJSON(t, ts.URL+"/api/v1/events/"+url.PathEscape(compositeID),
+		api.UpdateEventRequest{Title: api.NewOptString("Modified Standup")})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	override := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, "Modified Standup", override.Title)
+	assert.True(t, override.RecurrenceParentID.Set, "expected non-nil recurrence_parent_id on override")
+
+	// List events and verify the override replaces the original instance
+	listResp, err := http.Get(ts.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-03-22T00:00:00Z")
 	require.NoError(t, err)
 	events := decodeJSON[[]api.Event](t, listResp)
 	found := false
@@ -824,3 +1614,517 @@ func TestUpdatePreferencesUnknownKey(t *testing.T) {
 	defer resp.Body.Close()
 	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
+
+// --- History ---
+
+func TestEventHistoryAndRestore(t *testing.T) {
+	ts := setupTestServer(t)
+	created := createTestEvent(t, ts)
+
+	data, err := marshalBody(api.UpdateEventRequest{Title: api.NewOptString("Clobbered")})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/v1/events/"+created.ID, bytes.NewReader(data))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events/" + created.ID + "/history")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	history := decodeJSON[[]api.EventHistoryEntry](t, resp)
+	require.Len(t, history, 2)
+	assert.Equal(t, api.EventHistoryEntryActionCreate, history[0].Action)
+	assert.Equal(t, api.EventHistoryEntrySourceAPI, history[0].Source)
+	assert.False(t, history[0].Old.Set)
+	assert.Equal(t, api.EventHistoryEntryActionUpdate, history[1].Action)
+	assert.Equal(t, api.EventHistoryEntrySourceUI, history[1].Source)
+	assert.Equal(t, "alice", history[1].Actor.Value)
+	assert.Equal(t, "Test Event", history[1].Old.Value.Title)
+	assert.Equal(t, "Clobbered", history[1].New.Value.Title)
+
+	resp = postJSON(t, fmt.Sprintf("%s/api/v1/events/%s/history/%d/restore", ts.URL, created.ID, history[1].ID), struct{}{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	restored := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, "Test Event", restored.Title)
+
+	resp = postJSON(t, fmt.Sprintf("%s/api/v1/events/%s/history/%d/restore", ts.URL, created.ID, history[0].ID), struct{}{})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRestoreDeletedEvent(t *testing.T) {
+	ts := setupTestServer(t)
+	created := createTestEvent(t, ts)
+
+	resp := doDelete(t, ts.URL+"/api/v1/events/"+created.ID)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events/" + created.ID + "/history")
+	require.NoError(t, err)
+	history := decodeJSON[[]api.EventHistoryEntry](t, resp)
+	require.Len(t, history, 2)
+	assert.Equal(t, api.EventHistoryEntryActionDelete, history[1].Action)
+
+	resp = postJSON(t, fmt.Sprintf("%s/api/v1/events/%s/history/%d/restore", ts.URL, created.ID, history[1].ID), struct{}{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	restored := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, created.ID, restored.ID)
+
+	resp, err = http.Get(ts.URL + "/api/v1/events/" + created.ID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// --- Sync ---
+
+func TestSync(t *testing.T) {
+	ts := setupTestServer(t)
+	first := createTestEvent(t, ts)
+
+	resp, err := http.Get(ts.URL + "/api/v1/sync")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	initial := decodeJSON[api.SyncResult](t, resp)
+	assert.Equal(t, []string{first.ID}, initial.Changed)
+	assert.Empty(t, initial.Deleted)
+	require.NotEmpty(t, initial.Token)
+
+	resp, err = http.Get(ts.URL + "/api/v1/sync?since=" + initial.Token)
+	require.NoError(t, err)
+	unchanged := decodeJSON[api.SyncResult](t, resp)
+	assert.Empty(t, unchanged.Changed)
+	assert.Empty(t, unchanged.Deleted)
+	assert.Equal(t, initial.Token, unchanged.Token)
+
+	second := createTestEvent(t, ts)
+	resp = doDelete(t, ts.URL+"/api/v1/events/"+first.ID)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/v1/sync?since=" + initial.Token)
+	require.NoError(t, err)
+	changes := decodeJSON[api.SyncResult](t, resp)
+	assert.Equal(t, []string{second.ID}, changes.Changed)
+	assert.Equal(t, []string{first.ID}, changes.Deleted)
+	assert.NotEqual(t, initial.Token, changes.Token)
+
+	resp, err = http.Get(ts.URL + "/api/v1/sync?since=999999")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/v1/sync?since=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// --- Change stream ---
+
+func TestWebhooks(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp := postJSON(t, ts.URL+"/api/v1/webhooks", map[string]any{
+		"url":         "https://93.184.215.14/hook",
+		"secret":      "0123456789abcdef",
+		"event_types": []string{"event.created", "event.deleted"},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	hook := decodeJSON[api.Webhook](t, resp)
+	assert.True(t, hook.Enabled)
+	assert.Equal(t, []api.WebhookEventType{api.WebhookEventTypeEventCreated, api.WebhookEventTypeEventDeleted}, hook.EventTypes)
+	hookURL := fmt.Sprintf("%s/api/v1/webhooks/%d", ts.URL, hook.ID)
+
+	resp = patchJSON(t, hookURL, map[string]any{"enabled": false})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	updated := decodeJSON[api.Webhook](t, resp)
+	assert.False(t, updated.Enabled)
+
+	resp, err := http.Get(ts.URL + "/api/v1/webhooks")
+	require.NoError(t, err)
+	hooks := decodeJSON[[]api.Webhook](t, resp)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, hook.ID, hooks[0].ID)
+
+	resp, err = http.Get(hookURL + "/deliveries")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, decodeJSON[[]api.WebhookDelivery](t, resp))
+
+	resp = doDelete(t, hookURL)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, err = http.Get(hookURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPublications(t *testing.T) {
+	ts := setupTestServer(t)
+
+	tomorrow := time.Now().UTC().Truncate(time.Hour).Add(24 * time.Hour)
+	wiki, _ := url.Parse("https://wiki.example.com/oncall")
+	resp := postJSON(t, ts.URL+"/api/v1/events", api.CreateEventRequest{
+		Title:       "On call: Alice",
+		Description: api.NewOptString("Phone <b>555-1234</b>"),
+		Location:    api.NewOptString("Home office"),
+		URL:         api.NewOptURI(*wiki),
+		StartTime:   api.NewOptDateTime(tomorrow),
+		EndTime:     api.NewOptDateTime(tomorrow.Add(2 * time.Hour)),
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+	resp = postICS(t, ts.URL+"/api/v1/import?calendar=Private", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:dentist\r\n"+
+		"DTSTART:"+tomorrow.Format("20060102T150405Z")+"\r\nDTEND:"+tomorrow.Add(time.Hour).Format("20060102T150405Z")+"\r\n"+
+		"SUMMARY:Private dentist\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = postJSON(t, ts.URL+"/api/v1/publications", map[string]any{"name": "Ops", "calendar_ids": []int64{9999}})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "unknown calendar")
+	resp = postJSON(t, ts.URL+"/api/v1/publications", map[string]any{"name": "Ops", "calendar_ids": []int64{0}, "time_zone": "Mars/Olympus"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "unknown time zone")
+
+	resp = postJSON(t, ts.URL+"/api/v1/publications", map[string]any{
+		"name":          "Ops <team>",
+		"calendar_ids":  []int64{0},
+		"hidden_fields": []string{"description", "location"},
+		"time_zone":     "Europe/Stockholm",
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	pub := decodeJSON[api.Publication](t, resp)
+	assert.True(t, pub.Enabled)
+	assert.Equal(t, []api.PublicationField{api.PublicationFieldDescription, api.PublicationFieldLocation}, pub.HiddenFields)
+	require.True(t, strings.HasPrefix(pub.URL, "public/"))
+	assert.Equal(t, pub.URL+".ics", pub.IcsURL)
+	pubURL := fmt.Sprintf("%s/api/v1/publications/%d", ts.URL, pub.ID)
+
+	resp, err := http.Get(ts.URL + "/" + pub.URL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	page := string(body)
+	assert.Contains(t, page, "<title>Ops &lt;team&gt;</title>")
+	assert.Contains(t, page, "On call: Alice")
+	assert.Contains(t, page, `style="border-left-color: dodgerblue"`, "the color of the calendar")
+	assert.Contains(t, page, `href="https://wiki.example.com/oncall"`)
+	assert.NotContains(t, page, "Private dentist", "other calendars are not published")
+	assert.NotContains(t, page, "555-1234")
+	assert.NotContains(t, page, "Home office")
+
+	resp, err = http.Get(ts.URL + "/" + pub.IcsURL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/calendar; charset=utf-8", resp.Header.Get("Content-Type"))
+	etag := resp.Header.Get("ETag")
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	feed := string(body)
+	assert.Contains(t, feed, "X-WR-CALNAME:Ops <team>")
+	assert.Contains(t, feed, "SUMMARY:On call: Alice")
+	assert.Contains(t, feed, "URL:https://wiki.example.com/oncall")
+	assert.NotContains(t, feed, "Private dentist")
+	assert.NotContains(t, feed, "DESCRIPTION")
+	assert.NotContains(t, feed, "LOCATION")
+
+	resp = doWithHeader(t, http.MethodGet, ts.URL+"/"+pub.IcsURL, "If-None-Match", etag, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp = patchJSON(t, pubURL, map[string]any{"hidden_fields": []string{}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, decodeJSON[api.Publication](t, resp).HiddenFields)
+	resp = doWithHeader(t, http.MethodGet, ts.URL+"/"+pub.IcsURL, "If-None-Match", etag, nil)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	feed = string(body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the feed changes with the publication")
+	assert.Contains(t, feed, "LOCATION:Home office")
+
+	resp = patchJSON(t, pubURL, map[string]any{"regenerate_token": true})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	regenerated := decodeJSON[api.Publication](t, resp)
+	assert.NotEqual(t, pub.URL, regenerated.URL)
+	for _, path := range []string{pub.URL, pub.IcsURL} {
+		resp, err = http.Get(ts.URL + "/" + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "the old token is revoked")
+	}
+
+	resp = patchJSON(t, pubURL, map[string]any{"enabled": false})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp, err = http.Get(ts.URL + "/" + regenerated.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "disabled publications are not served")
+
+	resp = doWithHeader(t, http.MethodPost, ts.URL+"/"+regenerated.URL, "Content-Type", "text/plain", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/public/agenda.css")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doDelete(t, pubURL)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, err = http.Get(ts.URL + "/api/v1/publications")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Publication](t, resp))
+}
+
+func TestFeedRules(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp := postJSON(t, ts.URL+"/api/v1/feeds", map[string]any{
+		"url":   "https://93.184.215.14/school.ics",
+		"rules": []map[string]any{{"field": "categories", "pattern": "Year 5", "action": "include"}, {"action": "transparent"}},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	feed := decodeJSON[api.Feed](t, resp)
+	require.Len(t, feed.Rules, 2)
+	assert.Equal(t, api.FeedRuleActionInclude, feed.Rules[0].Action)
+	assert.Equal(t, api.FeedRuleFieldSummary, feed.Rules[1].Field.Value)
+
+	resp = postJSON(t, fmt.Sprintf("%s/api/v1/feeds/%d/preview", ts.URL, feed.ID), map[string]any{})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "not fetched yet")
+
+	for name, rule := range map[string]map[string]any{
+		"invalid pattern": {"pattern": "(", "action": "exclude"},
+		"unknown action":  {"action": "delete"},
+		"no color":        {"action": "color"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := postJSON(t, ts.URL+"/api/v1/feeds", map[string]any{
+				"url":   "https://93.184.215.14/other.ics",
+				"rules": []map[string]any{rule},
+			})
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestFeedCredentialsNotReturned(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp := postJSON(t, ts.URL+"/api/v1/feeds", map[string]any{
+		"type":     "caldav",
+		"url":      "https://93.184.215.14/dav/calendars/user/events/",
+		"username": "user",
+		"password": "hunter2",
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	feed := decodeJSON[api.Feed](t, resp)
+	assert.Equal(t, api.FeedTypeCaldav, feed.Type.Value)
+	assert.Equal(t, "user", feed.Username.Value)
+	assert.Equal(t, api.FeedAuthBasic, feed.Auth.Value)
+
+	resp, err := http.Get(ts.URL + "/api/v1/feeds")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "hunter2")
+	assert.Contains(t, string(body), `"auth":"basic"`)
+
+	resp = postJSON(t, ts.URL+"/api/v1/feeds", map[string]any{
+		"url":     "https://93.184.215.14/team.ics",
+		"token":   "t0ken",
+		"headers": map[string]string{"x-api-key": "k3y"},
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	feed = decodeJSON[api.Feed](t, resp)
+	assert.Equal(t, api.FeedAuthBearer, feed.Auth.Value)
+	assert.Equal(t, []string{"X-Api-Key"}, feed.HeaderNames)
+
+	resp, err = http.Get(ts.URL + "/api/v1/feeds")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "t0ken")
+	assert.NotContains(t, string(body), "k3y")
+
+	resp = postJSON(t, ts.URL+"/api/v1/feeds", map[string]any{
+		"url":      "https://93.184.215.14/team.ics",
+		"token":    "t0ken",
+		"password": "hunter2",
+	})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCreateWebhook_ValidationErrors(t *testing.T) {
+	ts := setupTestServer(t)
+
+	for name, body := range map[string]map[string]any{
+		"private address": {"url": "http://127.0.0.1/hook", "secret": "0123456789abcdef", "event_types": []string{"event.created"}},
+		"short secret":    {"url": "https://93.184.215.14/hook", "secret": "short", "event_types": []string{"event.created"}},
+		"no event types":  {"url": "https://93.184.215.14/hook", "secret": "0123456789abcdef", "event_types": []string{}},
+		"unknown type":    {"url": "https://93.184.215.14/hook", "secret": "0123456789abcdef", "event_types": []string{"event.moved"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := postJSON(t, ts.URL+"/api/v1/webhooks", body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestChangeStream(t *testing.T) {
+	ts := setupTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/v1/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	created := createTestEvent(t, ts)
+
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	assert.Equal(t, "event: change", lines.Text())
+	require.True(t, lines.Scan())
+	assert.JSONEq(t, fmt.Sprintf(`{"kind":"event","action":"create","id":%s}`, created.ID), strings.TrimPrefix(lines.Text(), "data: "))
+	require.True(t, lines.Scan())
+	assert.Empty(t, lines.Text())
+}
+
+// --- Trash ---
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	ts := setupTestServer(t)
+	created := createTestEvent(t, ts)
+
+	resp := doDelete(t, ts.URL+"/api/v1/events/"+created.ID)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err := http.Get(ts.URL + "/api/v1/events/" + created.ID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/v1/trash")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	trash := decodeJSON[[]api.Event](t, resp)
+	require.Len(t, trash, 1)
+	assert.Equal(t, created.ID, trash[0].ID)
+	assert.True(t, trash[0].DeletedAt.Set)
+
+	resp = postJSON(t, ts.URL+"/api/v1/trash/"+created.ID+"/restore", struct{}{})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	restored := decodeJSON[api.Event](t, resp)
+	assert.Equal(t, "Test Event", restored.Title)
+	assert.False(t, restored.DeletedAt.Set)
+
+	resp = doDelete(t, ts.URL+"/api/v1/trash/"+created.ID)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "live events cannot be purged")
+
+	resp = doDelete(t, ts.URL+"/api/v1/events/"+created.ID)
+	resp.Body.Close()
+	resp = doDelete(t, ts.URL+"/api/v1/trash/"+created.ID)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/v1/trash")
+	require.NoError(t, err)
+	assert.Empty(t, decodeJSON[[]api.Event](t, resp))
+
+	resp = postJSON(t, ts.URL+"/api/v1/trash/"+created.ID+"/restore", struct{}{})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// --- Export / restore ---
+
+func TestExportAndRestore(t *testing.T) {
+	src := setupTestServer(t)
+	created := createTestEvent(t, src)
+
+	resp, err := http.Get(src.URL + "/api/v1/export")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	dump := decodeJSON[api.Dump](t, resp)
+	assert.Equal(t, 1, dump.Version)
+	require.Len(t, dump.Events, 1)
+	assert.Equal(t, created.Title, dump.Events[0].Title)
+
+	dest := setupTestServer(t)
+	resp = postJSON(t, dest.URL+"/api/v1/restore", dump)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	result := decodeJSON[api.DumpResult](t, resp)
+	assert.Equal(t, 1, result.Events)
+
+	resp, err = http.Get(dest.URL + "/api/v1/events?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z")
+	require.NoError(t, err)
+	events := decodeJSON[[]api.Event](t, resp)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Test Event", events[0].Title)
+
+	dump.Version = 99
+	resp = postJSON(t, dest.URL+"/api/v1/restore", dump)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestOpsRouter(t *testing.T) {
+	var readyErr error
+	ops := httptest.NewServer(handler.NewOpsRouter(func(ctx context.Context) error { return readyErr }, metrics.Default))
+	defer ops.Close()
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ops.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, _ := get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	readyErr = errors.New("database is read-only")
+	status, body := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.NotContains(t, body, "read-only", "the error is only logged")
+	status, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, status, "liveness does not depend on the database")
+
+	// Requests to the API are measured per operation and status code.
+	ts := setupTestServer(t)
+	createTestEvent(t, ts)
+	resp, err := http.Get(ts.URL + "/api/v1/events/99999")
+	require.NoError(t, err)
+	resp.Body.Close()
+	status, body = get("/metrics")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `mycal_http_request_duration_seconds_count{operation="APIV1EventsPost",code="201"}`)
+	assert.Contains(t, body, `mycal_http_request_duration_seconds_count{operation="APIV1EventsIDGet",code="404"}`)
+	assert.Contains(t, body, "# TYPE mycal_db_query_duration_seconds histogram")
+}
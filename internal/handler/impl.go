@@ -9,6 +9,8 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mikaelstaldal/go-server-common/httputil"
@@ -21,6 +23,9 @@ import (
 const (
 	maxSearchQueryLength = 200
 	maxImportSize        = 10 * 1024 * 1024 // 10 MiB
+	// MaxICalImportSize bounds iCalendar imports, which are decoded and
+	// imported as they are read rather than held in memory.
+	MaxICalImportSize = 256 * 1024 * 1024 // 256 MiB
 )
 
 type handlerImpl struct {
@@ -28,6 +33,21 @@ type handlerImpl struct {
 	prefSvc *service.PreferencesService
 	feedSvc *service.FeedService
 	calSvc  *service.CalendarService
+	dumpSvc *service.DumpService
+	hookSvc *service.WebhookService
+	pubSvc  *service.PublicationService
+}
+
+// events returns the event service acting on behalf of the request's actor.
+func (h *handlerImpl) events(ctx context.Context) *service.EventService {
+	return h.svc.As(actorFromContext(ctx))
+}
+
+// importer is like events, but attributes changes to the import source.
+func (h *handlerImpl) importer(ctx context.Context) *service.EventService {
+	actor := actorFromContext(ctx)
+	actor.Source = model.SourceImport
+	return h.svc.As(actor)
 }
 
 // httpError is a sentinel error carrying an explicit HTTP status code.
@@ -53,142 +73,40 @@ func (h *handlerImpl) NewError(_ context.Context, err error) *api.ErrorStatusCod
 	if errors.Is(err, service.ErrValidation) {
 		return &api.ErrorStatusCode{StatusCode: http.StatusBadRequest, Response: api.Error{Error: err.Error()}}
 	}
+	if errors.Is(err, service.ErrPreconditionFailed) {
+		return &api.ErrorStatusCode{StatusCode: http.StatusPreconditionFailed, Response: api.Error{Error: err.Error()}}
+	}
+	if errors.Is(err, service.ErrSyncTokenExpired) {
+		return &api.ErrorStatusCode{StatusCode: http.StatusGone, Response: api.Error{Error: err.Error()}}
+	}
 	log.Printf("internal error: %v", err)
 	return &api.ErrorStatusCode{StatusCode: http.StatusInternalServerError, Response: api.Error{Error: "internal server error"}}
 }
 
 // ---- Type conversion helpers ----
 
-func toOptDateTime(s string) api.OptDateTime {
-	if s != "" {
-		if t, err := time.Parse(time.RFC3339, s); err == nil {
-			return api.NewOptDateTime(t)
-		}
-	}
-	return api.OptDateTime{}
-}
-
-func toOptURI(s string) api.OptURI {
-	if s != "" {
-		if u, err := url.Parse(s); err == nil {
-			return api.NewOptURI(*u)
-		}
-	}
-	return api.OptURI{}
-}
-
-func modelEventToAPI(e *model.Event) *api.Event {
-	ae := &api.Event{
-		ID:    e.StringID,
-		Title: e.Title,
-	}
-	if e.AllDay {
-		ae.AllDay = api.NewOptBool(true)
-		if t, err := time.Parse(time.RFC3339, e.StartTime); err == nil {
-			ae.StartDate = api.NewOptDate(t)
-		}
-		if t, err := time.Parse(time.RFC3339, e.EndTime); err == nil {
-			ae.EndDate = api.NewOptDate(t)
-		}
-	} else {
-		if t, err := time.Parse(time.RFC3339, e.StartTime); err == nil {
-			ae.StartTime = api.NewOptDateTime(t)
-		}
-		if t, err := time.Parse(time.RFC3339, e.EndTime); err == nil {
-			ae.EndTime = api.NewOptDateTime(t)
-		}
-	}
-	if e.ParentID != "" {
-		ae.ParentID = api.NewOptString(e.ParentID)
-	}
-	if e.Description != "" {
-		ae.Description = api.NewOptString(e.Description)
-	}
-	if e.Color != "" {
-		ae.Color = api.NewOptString(e.Color)
-	}
-	if e.RecurrenceFreq != "" {
-		ae.RecurrenceFreq = api.NewOptEventRecurrenceFreq(api.EventRecurrenceFreq(e.RecurrenceFreq))
-	}
-	if e.RecurrenceCount != 0 {
-		ae.RecurrenceCount = api.NewOptInt(e.RecurrenceCount)
-	}
-	ae.RecurrenceUntil = toOptDateTime(e.RecurrenceUntil)
-	if e.RecurrenceInterval != 0 {
-		ae.RecurrenceInterval = api.NewOptInt(e.RecurrenceInterval)
-	}
-	if e.RecurrenceByDay != "" {
-		ae.RecurrenceByDay = api.NewOptString(e.RecurrenceByDay)
-	}
-	if e.RecurrenceByMonthDay != "" {
-		ae.RecurrenceByMonthday = api.NewOptString(e.RecurrenceByMonthDay)
-	}
-	if e.RecurrenceByMonth != "" {
-		ae.RecurrenceByMonth = api.NewOptString(e.RecurrenceByMonth)
-	}
-	if e.ExDates != "" {
-		ae.Exdates = api.NewOptString(e.ExDates)
-	}
-	if e.RDates != "" {
-		ae.Rdates = api.NewOptString(e.RDates)
-	}
-	if e.RecurrenceParentID != nil {
-		ae.RecurrenceParentID = api.NewOptNilInt64(*e.RecurrenceParentID)
-	}
-	if e.RecurrenceOriginalStart != "" {
-		ae.RecurrenceOriginalStart = toOptDateTime(e.RecurrenceOriginalStart)
-	}
-	if e.Duration != "" {
-		ae.Duration = api.NewOptString(e.Duration)
-	}
-	if e.Categories != "" {
-		ae.Categories = api.NewOptString(e.Categories)
-	}
-	ae.URL = toOptURI(e.URL)
-	if e.ReminderMinutes != 0 {
-		ae.ReminderMinutes = api.NewOptInt(e.ReminderMinutes)
-	}
-	if e.Location != "" {
-		ae.Location = api.NewOptString(e.Location)
-	}
-	if e.Latitude != nil {
-		ae.Latitude = api.NewOptNilFloat64(*e.Latitude)
-	}
-	if e.Longitude != nil {
-		ae.Longitude = api.NewOptNilFloat64(*e.Longitude)
-	}
-	ae.CalendarID = api.NewOptInt64(e.CalendarID)
-	if e.CalendarName != "" {
-		ae.CalendarName = api.NewOptString(e.CalendarName)
-	}
-	ae.CreatedAt = toOptDateTime(e.CreatedAt)
-	ae.UpdatedAt = toOptDateTime(e.UpdatedAt)
-	return ae
-}
-
-func modelFeedToAPI(f *model.Feed) *api.Feed {
-	feedURL, _ := url.Parse(f.URL)
-	af := &api.Feed{
-		ID:  f.ID,
-		URL: *feedURL,
+func modelHistoryEntryToAPI(entry *model.HistoryEntry) *api.EventHistoryEntry {
+	ah := &api.EventHistoryEntry{
+		ID:      entry.ID,
+		EventID: model.FormatEventID(entry.EventID, ""),
+		Action:  api.EventHistoryEntryAction(entry.Action),
+		Source:  api.EventHistoryEntrySource(entry.Source),
 	}
-	if f.CalendarID != 0 {
-		af.CalendarID = api.NewOptInt64(f.CalendarID)
+	if entry.Actor != "" {
+		ah.Actor = api.NewOptString(entry.Actor)
 	}
-	if f.CalendarName != "" {
-		af.CalendarName = api.NewOptString(f.CalendarName)
+	if entry.Old != nil {
+		entry.Old.SetStringID()
+		ah.Old = api.NewOptEvent(*service.EventToAPI(entry.Old))
 	}
-	if f.RefreshIntervalMinutes != 0 {
-		af.RefreshIntervalMinutes = api.NewOptInt(f.RefreshIntervalMinutes)
+	if entry.New != nil {
+		entry.New.SetStringID()
+		ah.New = api.NewOptEvent(*service.EventToAPI(entry.New))
 	}
-	af.LastRefreshedAt = toOptDateTime(f.LastRefreshedAt)
-	if f.LastError != "" {
-		af.LastError = api.NewOptString(f.LastError)
+	if t, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+		ah.CreatedAt = t
 	}
-	af.Enabled = api.NewOptBool(f.Enabled)
-	af.CreatedAt = toOptDateTime(f.CreatedAt)
-	af.UpdatedAt = toOptDateTime(f.UpdatedAt)
-	return af
+	return ah
 }
 
 func parseCalendarIDsFromParams(calendarIDs []int, calendarNames []string, calSvc *service.CalendarService) []int64 {
@@ -228,17 +146,31 @@ func getImportReaderFromURL(rawURL string) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
-func icsResponse(svc *service.EventService, calSvc *service.CalendarService, calendarIDs []int, calendarNames []string) (io.Reader, error) {
+// icsFeed returns the ETag of the iCalendar feed and, unless it matches
+// ifNoneMatch, a reader streaming the feed in the given format. Encoding runs
+// while the response is written; an error after the first bytes have been
+// sent can only abort the response.
+func icsFeed(svc *service.EventService, calSvc *service.CalendarService, format ical.Format, calendarIDs []int, calendarNames []string, ifNoneMatch api.OptString) (string, io.Reader, error) {
 	ids := parseCalendarIDsFromParams(calendarIDs, calendarNames, calSvc)
-	events, err := svc.ListAll(ids)
+	etag, err := svc.ICSETag(format, ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list events: %w", err)
-	}
-	var buf bytes.Buffer
-	if err := ical.Encode(&buf, events); err != nil {
-		return nil, fmt.Errorf("failed to encode iCal: %w", err)
-	}
-	return &buf, nil
+		return "", nil, err
+	}
+	if ifNoneMatch.Set && service.MatchETag(ifNoneMatch.Value, etag, true) {
+		return etag, nil, nil
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		if _, err := svc.WriteICS(pw, format, ids); err != nil {
+			if !errors.Is(err, io.ErrClosedPipe) { // not the client going away
+				log.Printf("encode iCal: %v", err)
+			}
+			pw.CloseWithError(err)
+			return
+		}
+		pw.Close()
+	}()
+	return etag, pr, nil
 }
 
 // ---- Handler implementations ----
@@ -287,7 +219,7 @@ func (h *handlerImpl) APIV1CalendarsIDPatch(ctx context.Context, req *api.Update
 	return &api.Calendar{ID: cal.ID, Name: cal.Name, Color: cal.Color}, nil
 }
 
-func (h *handlerImpl) APIV1EventsGet(ctx context.Context, params api.APIV1EventsGetParams) ([]api.Event, error) {
+func (h *handlerImpl) APIV1EventsGet(ctx context.Context, params api.APIV1EventsGetParams) (*api.APIV1EventsGetOKHeaders, error) {
 	q := ""
 	if params.Q.Set {
 		q = params.Q.Value
@@ -295,9 +227,14 @@ func (h *handlerImpl) APIV1EventsGet(ctx context.Context, params api.APIV1Events
 	if len(q) > maxSearchQueryLength {
 		return nil, badRequest("search query too long")
 	}
+	project, err := eventProjection(params.Fields)
+	if err != nil {
+		return nil, err
+	}
 
 	calendarIDs := parseCalendarIDsFromParams(params.CalendarID, params.Calendar, h.calSvc)
 
+	var page service.Page
 	if q != "" {
 		from, to := "", ""
 		if params.From.Set {
@@ -306,44 +243,68 @@ func (h *handlerImpl) APIV1EventsGet(ctx context.Context, params api.APIV1Events
 		if params.To.Set {
 			to = params.To.Value.UTC().Format(time.RFC3339)
 		}
-		events, err := h.svc.Search(q, from, to, calendarIDs)
+		events, err := h.svc.Search(q, from, to, calendarIDs, params.NextOccurrence.Value)
+		if err != nil {
+			return nil, err
+		}
+		if page, err = service.PaginateRanked(events, params.Limit.Value, params.Cursor.Value); err != nil {
+			return nil, err
+		}
+	} else {
+		if !params.From.Set || !params.To.Set {
+			return nil, badRequest("from and to query parameters are required")
+		}
+		from := params.From.Value.UTC().Format(time.RFC3339)
+		to := params.To.Value.UTC().Format(time.RFC3339)
+		events, err := h.svc.List(from, to, calendarIDs)
 		if err != nil {
 			return nil, err
 		}
-		return eventsToAPI(events), nil
+		if page, err = service.PaginateByTime(events, params.Limit.Value, params.Cursor.Value); err != nil {
+			return nil, err
+		}
 	}
 
-	if !params.From.Set || !params.To.Set {
-		return nil, badRequest("from and to query parameters are required")
+	result := &api.APIV1EventsGetOKHeaders{
+		XTotalCount: page.Total,
+		Response:    eventsToAPI(page.Events),
 	}
-	from := params.From.Value.UTC().Format(time.RFC3339)
-	to := params.To.Value.UTC().Format(time.RFC3339)
-	events, err := h.svc.List(from, to, calendarIDs)
-	if err != nil {
-		return nil, err
+	if page.NextCursor != "" {
+		result.XNextCursor = api.NewOptString(page.NextCursor)
+	}
+	if project != nil {
+		for i := range result.Response {
+			result.Response[i] = project(result.Response[i])
+		}
 	}
-	return eventsToAPI(events), nil
+	return result, nil
 }
 
 func eventsToAPI(events []model.Event) []api.Event {
 	result := make([]api.Event, len(events))
 	for i := range events {
 		events[i].SetStringID()
-		result[i] = *modelEventToAPI(&events[i])
+		result[i] = *service.EventToAPI(&events[i])
 	}
 	return result
 }
 
-func (h *handlerImpl) APIV1EventsPost(ctx context.Context, req *api.CreateEventRequest) (*api.Event, error) {
-	event, err := h.svc.Create(req)
+// eventWithETag converts an event for a response with its ETag header.
+func eventWithETag(event *model.Event) *api.EventHeaders {
+	etag := service.EventETag(event)
+	event.SetStringID()
+	return &api.EventHeaders{ETag: etag, Response: *service.EventToAPI(event)}
+}
+
+func (h *handlerImpl) APIV1EventsPost(ctx context.Context, req *api.CreateEventRequest) (*api.EventHeaders, error) {
+	event, err := h.events(ctx).Create(req)
 	if err != nil {
 		return nil, err
 	}
-	event.SetStringID()
-	return modelEventToAPI(event), nil
+	return eventWithETag(event), nil
 }
 
-func (h *handlerImpl) APIV1EventsIDGet(ctx context.Context, params api.APIV1EventsIDGetParams) (*api.Event, error) {
+func (h *handlerImpl) APIV1EventsIDGet(ctx context.Context, params api.APIV1EventsIDGetParams) (*api.EventHeaders, error) {
 	dbID, instanceStart, err := model.ParseEventID(params.ID)
 	if err != nil {
 		return nil, badRequest("invalid id")
@@ -357,26 +318,28 @@ func (h *handlerImpl) APIV1EventsIDGet(ctx context.Context, params api.APIV1Even
 	if err != nil {
 		return nil, err
 	}
-	event.SetStringID()
-	return modelEventToAPI(event), nil
+	return eventWithETag(event), nil
 }
 
-func (h *handlerImpl) APIV1EventsIDPatch(ctx context.Context, req *api.UpdateEventRequest, params api.APIV1EventsIDPatchParams) (*api.Event, error) {
+func (h *handlerImpl) APIV1EventsIDPatch(ctx context.Context, req *api.UpdateEventRequest, params api.APIV1EventsIDPatchParams) (*api.EventHeaders, error) {
 	dbID, instanceStart, err := model.ParseEventID(params.ID)
 	if err != nil {
 		return nil, badRequest("invalid id")
 	}
 	var event *model.Event
-	if instanceStart != "" {
-		event, err = h.svc.CreateOrUpdateOverride(dbID, instanceStart, req)
-	} else {
-		event, err = h.svc.Update(dbID, req)
-	}
+	err = h.events(ctx).IfMatch(dbID, instanceStart, params.IfMatch.Or(""), func(svc *service.EventService) error {
+		var err error
+		if instanceStart != "" {
+			event, err = svc.CreateOrUpdateOverride(dbID, instanceStart, req)
+		} else {
+			event, err = svc.Update(dbID, req)
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	event.SetStringID()
-	return modelEventToAPI(event), nil
+	return eventWithETag(event), nil
 }
 
 func (h *handlerImpl) APIV1EventsIDDelete(ctx context.Context, params api.APIV1EventsIDDeleteParams) (api.APIV1EventsIDDeleteRes, error) {
@@ -384,24 +347,189 @@ func (h *handlerImpl) APIV1EventsIDDelete(ctx context.Context, params api.APIV1E
 	if err != nil {
 		return nil, badRequest("invalid id")
 	}
-	if instanceStart != "" {
-		event, err := h.svc.AddExDate(dbID, instanceStart)
-		if err != nil {
-			return nil, err
+	var event *model.Event
+	err = h.events(ctx).IfMatch(dbID, instanceStart, params.IfMatch.Or(""), func(svc *service.EventService) error {
+		if instanceStart != "" {
+			var err error
+			event, err = svc.AddExDate(dbID, instanceStart)
+			return err
+		}
+		return svc.Delete(dbID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return &api.APIV1EventsIDDeleteNoContent{}, nil
+	}
+	event.SetStringID()
+	return service.EventToAPI(event), nil
+}
+
+func (h *handlerImpl) APIV1EventsBatchPost(ctx context.Context, req *api.BatchRequest) (*api.BatchResult, error) {
+	results, err := h.events(ctx).Batch(req.Operations)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.BatchResult{Committed: true, Results: make([]api.BatchOperationResult, len(results))}
+	for i, r := range results {
+		ar := &result.Results[i]
+		switch {
+		case r.Err != nil:
+			result.Committed = false
+			if errors.Is(r.Err, service.ErrBatchAborted) {
+				ar.Status = http.StatusFailedDependency
+				ar.Error = api.NewOptString(r.Err.Error())
+			} else {
+				e := h.NewError(ctx, r.Err)
+				ar.Status = e.StatusCode
+				ar.Error = api.NewOptString(e.Response.Error)
+			}
+		case r.Event == nil:
+			ar.Status = http.StatusNoContent
+		default:
+			ar.Status = http.StatusOK
+			if req.Operations[i].Op == api.BatchOperationOpCreate {
+				ar.Status = http.StatusCreated
+			}
+			r.Event.SetStringID()
+			ar.Event = api.NewOptEvent(*service.EventToAPI(r.Event))
 		}
-		event.SetStringID()
-		return modelEventToAPI(event), nil
 	}
-	if err := h.svc.Delete(dbID); err != nil {
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1EventsBulkUpdatePost(ctx context.Context, req *api.BulkUpdateRequest) (*api.BulkResult, error) {
+	events, err := h.events(ctx).BulkUpdate(&req.Filter, &req.Update)
+	if err != nil {
+		return nil, err
+	}
+	return bulkResult(events), nil
+}
+
+func (h *handlerImpl) APIV1EventsBulkDeletePost(ctx context.Context, req *api.BulkDeleteRequest) (*api.BulkResult, error) {
+	events, err := h.events(ctx).BulkDelete(&req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	return bulkResult(events), nil
+}
+
+func bulkResult(events []model.Event) *api.BulkResult {
+	result := &api.BulkResult{Count: len(events), Ids: make([]string, len(events))}
+	for i := range events {
+		result.Ids[i] = model.FormatEventID(events[i].ID, "")
+	}
+	return result
+}
+
+func (h *handlerImpl) APIV1EventsIDHistoryGet(ctx context.Context, params api.APIV1EventsIDHistoryGetParams) ([]api.EventHistoryEntry, error) {
+	dbID, err := h.resolveEventID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := h.svc.History(dbID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]api.EventHistoryEntry, len(entries))
+	for i := range entries {
+		result[i] = *modelHistoryEntryToAPI(&entries[i])
+	}
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1EventsIDHistoryHistoryIDRestorePost(ctx context.Context, params api.APIV1EventsIDHistoryHistoryIDRestorePostParams) (*api.Event, error) {
+	dbID, err := h.resolveEventID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	event, err := h.events(ctx).RestoreFromHistory(dbID, params.HistoryID)
+	if err != nil {
+		return nil, err
+	}
+	event.SetStringID()
+	return service.EventToAPI(event), nil
+}
+
+func (h *handlerImpl) APIV1ExportGet(ctx context.Context) (*api.Dump, error) {
+	return h.dumpSvc.Export()
+}
+
+func (h *handlerImpl) APIV1RestorePost(ctx context.Context, req *api.Dump) (*api.DumpResult, error) {
+	return h.dumpSvc.Restore(req)
+}
+
+func (h *handlerImpl) APIV1SyncGet(ctx context.Context, params api.APIV1SyncGetParams) (*api.SyncResult, error) {
+	result, err := h.svc.Sync(params.Since.Value)
+	if err != nil {
 		return nil, err
 	}
-	return &api.APIV1EventsIDDeleteNoContent{}, nil
+	return &api.SyncResult{
+		Changed: formatIDs(result.Changed),
+		Deleted: formatIDs(result.Deleted),
+		Token:   result.Token,
+	}, nil
 }
 
-func (h *handlerImpl) APIV1EventsIDIcsGet(ctx context.Context, params api.APIV1EventsIDIcsGetParams) (api.APIV1EventsIDIcsGetOK, error) {
+func formatIDs(ids []int64) []string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return s
+}
+
+func (h *handlerImpl) APIV1TrashGet(ctx context.Context) ([]api.Event, error) {
+	events, err := h.svc.Trash()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]api.Event, len(events))
+	for i := range events {
+		events[i].SetStringID()
+		result[i] = *service.EventToAPI(&events[i])
+	}
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1TrashIDRestorePost(ctx context.Context, params api.APIV1TrashIDRestorePostParams) (*api.Event, error) {
+	event, err := h.events(ctx).RestoreDeleted(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	event.SetStringID()
+	return service.EventToAPI(event), nil
+}
+
+func (h *handlerImpl) APIV1TrashIDDelete(ctx context.Context, params api.APIV1TrashIDDeleteParams) error {
+	return h.events(ctx).Purge(params.ID)
+}
+
+// resolveEventID maps an API event ID to the database ID of the stored row. A
+// composite ID resolves to its override; instances without one are not found.
+func (h *handlerImpl) resolveEventID(id string) (int64, error) {
+	dbID, instanceStart, err := model.ParseEventID(id)
+	if err != nil {
+		return 0, badRequest("invalid id")
+	}
+	if instanceStart == "" {
+		return dbID, nil
+	}
+	event, err := h.svc.GetInstance(dbID, instanceStart)
+	if err != nil {
+		return 0, err
+	}
+	if event.RecurrenceParentID == nil {
+		return 0, service.ErrNotFound
+	}
+	return event.ID, nil
+}
+
+func (h *handlerImpl) APIV1EventsIDIcsGet(ctx context.Context, params api.APIV1EventsIDIcsGetParams) (api.APIV1EventsIDIcsGetRes, error) {
 	dbID, instanceStart, err := model.ParseEventID(params.ID)
 	if err != nil {
-		return api.APIV1EventsIDIcsGetOK{}, badRequest("invalid id")
+		return nil, badRequest("invalid id")
 	}
 	var event *model.Event
 	if instanceStart != "" {
@@ -410,40 +538,125 @@ func (h *handlerImpl) APIV1EventsIDIcsGet(ctx context.Context, params api.APIV1E
 		event, err = h.svc.GetByID(dbID)
 	}
 	if err != nil {
-		return api.APIV1EventsIDIcsGetOK{}, err
+		return nil, err
 	}
+	format := formatFromContext(ctx)
 	var buf bytes.Buffer
-	if err := ical.Encode(&buf, []model.Event{*event}); err != nil {
-		return api.APIV1EventsIDIcsGetOK{}, fmt.Errorf("failed to encode iCal: %w", err)
+	if err := ical.EncodeFormat(&buf, format, []model.Event{*event}); err != nil {
+		return nil, fmt.Errorf("failed to encode iCal: %w", err)
+	}
+	switch format {
+	case ical.FormatJCal:
+		return &api.APIV1EventsIDIcsGetOKApplicationCalendarJSON{Data: &buf}, nil
+	case ical.FormatXCal:
+		return &api.APIV1EventsIDIcsGetOKApplicationCalendarXML{Data: &buf}, nil
+	default:
+		return &api.APIV1EventsIDIcsGetOKTextCalendar{Data: &buf}, nil
 	}
-	return api.APIV1EventsIDIcsGetOK{Data: &buf}, nil
 }
 
-func (h *handlerImpl) APIV1EventsIcsGet(ctx context.Context, params api.APIV1EventsIcsGetParams) (api.APIV1EventsIcsGetOK, error) {
-	reader, err := icsResponse(h.svc, h.calSvc, params.CalendarID, params.Calendar)
+func (h *handlerImpl) APIV1EventsIcsGet(ctx context.Context, params api.APIV1EventsIcsGetParams) (api.APIV1EventsIcsGetRes, error) {
+	format := formatFromContext(ctx)
+	etag, reader, err := icsFeed(h.svc, h.calSvc, format, params.CalendarID, params.Calendar, params.IfNoneMatch)
 	if err != nil {
-		return api.APIV1EventsIcsGetOK{}, err
+		return nil, err
+	}
+	switch {
+	case reader == nil:
+		return &api.APIV1EventsIcsGetNotModified{ETag: etag}, nil
+	case format == ical.FormatJCal:
+		return &api.APIV1EventsIcsGetOKApplicationCalendarJSONHeaders{ETag: etag, Response: api.APIV1EventsIcsGetOKApplicationCalendarJSON{Data: reader}}, nil
+	case format == ical.FormatXCal:
+		return &api.APIV1EventsIcsGetOKApplicationCalendarXMLHeaders{ETag: etag, Response: api.APIV1EventsIcsGetOKApplicationCalendarXML{Data: reader}}, nil
+	default:
+		return &api.APIV1EventsIcsGetOKTextCalendarHeaders{ETag: etag, Response: api.APIV1EventsIcsGetOKTextCalendar{Data: reader}}, nil
 	}
-	return api.APIV1EventsIcsGetOK{Data: reader}, nil
 }
 
-func (h *handlerImpl) APIV1ImportPost(ctx context.Context, req api.APIV1ImportPostReq, params api.APIV1ImportPostParams) (*api.APIV1ImportPostOK, error) {
-	var reader io.Reader
-	var cleanup func()
-
+// importSource returns the iCalendar data of the body of an import or
+// validation request, and its format. The caller must call cleanup.
+func importSource(req any) (reader io.Reader, format ical.Format, cleanup func(), err error) {
+	var u url.URL
 	switch r := req.(type) {
-	case *api.APIV1ImportPostReqTextCalendar:
-		reader = r.Data
-		cleanup = func() {}
+	case *api.APIV1ImportPostReqTextCalendar, *api.APIV1ImportValidatePostReqTextCalendar:
+		return r.(io.Reader), ical.FormatICal, func() {}, nil
+	case *api.APIV1ImportPostReqApplicationCalendarJSON, *api.APIV1ImportValidatePostReqApplicationCalendarJSON:
+		return r.(io.Reader), ical.FormatJCal, func() {}, nil
+	case *api.APIV1ImportPostReqApplicationCalendarXML, *api.APIV1ImportValidatePostReqApplicationCalendarXML:
+		return r.(io.Reader), ical.FormatXCal, func() {}, nil
 	case *api.APIV1ImportPostReqApplicationJSON:
-		body, err := getImportReaderFromURL(r.URL.String())
-		if err != nil {
-			return nil, err
-		}
-		reader = io.LimitReader(body, maxImportSize)
-		cleanup = func() { _ = body.Close() }
+		u = r.URL
+	case *api.APIV1ImportValidatePostReqApplicationJSON:
+		u = r.URL
 	default:
-		return nil, unsupported("Content-Type must be text/calendar or application/json")
+		return nil, "", nil, unsupported("Content-Type must be text/calendar, application/calendar+json, application/calendar+xml or application/json")
+	}
+	body, err := getImportReaderFromURL(u.String())
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return io.LimitReader(body, MaxICalImportSize), ical.FormatICal, func() { _ = body.Close() }, nil
+}
+
+// errImportInvalid stops a strict import of a document with errors.
+var errImportInvalid = errors.New("document has errors")
+
+// decoderSource is the service.EventSource of an import. It counts the
+// events, and tells errors reading the document from those of the import.
+type decoderSource struct {
+	dec    *ical.Decoder
+	strict bool // fail with errImportInvalid once the document has errors
+	events int
+	err    error // error reading the document
+}
+
+func (s *decoderSource) Next() (model.Event, error) {
+	e, err := s.dec.Next()
+	if err != nil && err != io.EOF {
+		s.err = err
+		return model.Event{}, err
+	}
+	if s.strict && s.dec.HasErrors() {
+		return model.Event{}, errImportInvalid
+	}
+	if err == nil {
+		s.events++
+	}
+	return e, err
+}
+
+// drain reads the rest of the document, to count its events and find all
+// its problems.
+func (s *decoderSource) drain() error {
+	s.strict = false
+	for {
+		if _, err := s.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func diagnosticsToAPI(diags []ical.Diagnostic) []api.ImportDiagnostic {
+	result := make([]api.ImportDiagnostic, len(diags))
+	for i, d := range diags {
+		result[i] = api.ImportDiagnostic{
+			Property: d.Property,
+			Severity: api.ImportDiagnosticSeverity(d.Severity),
+			Message:  d.Message,
+		}
+		if d.Line > 0 {
+			result[i].Line = api.NewOptInt(d.Line)
+		}
+	}
+	return result
+}
+
+func (h *handlerImpl) APIV1ImportPost(ctx context.Context, req api.APIV1ImportPostReq, params api.APIV1ImportPostParams) (api.APIV1ImportPostRes, error) {
+	reader, format, cleanup, err := importSource(req)
+	if err != nil {
+		return nil, err
 	}
 	defer cleanup()
 
@@ -452,15 +665,48 @@ func (h *handlerImpl) APIV1ImportPost(ctx context.Context, req api.APIV1ImportPo
 		calendarName = params.Calendar.Value
 	}
 
-	events, err := ical.Decode(reader)
+	// In strict mode the import is one transaction, rolled back on the
+	// first error in the document.
+	src := &decoderSource{dec: ical.NewFormatDecoder(reader, format), strict: params.Strict.Value}
+	imported, err := h.importer(ctx).ImportFrom(src, calendarName, params.Strict.Value)
+	if errors.Is(err, errImportInvalid) {
+		if err := src.drain(); err != nil {
+			return nil, badRequest("failed to parse iCalendar data: " + err.Error())
+		}
+		return &api.ImportValidation{Valid: false, Events: src.events, Diagnostics: diagnosticsToAPI(src.dec.Diagnostics())}, nil
+	}
+	if src.err != nil {
+		if imported > 0 {
+			return nil, badRequest(fmt.Sprintf("failed to parse iCalendar data after importing %d events: %v", imported, src.err))
+		}
+		return nil, badRequest("failed to parse iCalendar data: " + src.err.Error())
+	}
 	if err != nil {
-		return nil, badRequest("failed to parse iCalendar data")
+		return nil, err
 	}
-	imported, err := h.svc.Import(events, calendarName)
+	result := &api.APIV1ImportPostOK{Imported: api.NewOptInt(imported)}
+	if diags := src.dec.Diagnostics(); len(diags) > 0 {
+		result.Diagnostics = diagnosticsToAPI(diags)
+	}
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1ImportValidatePost(ctx context.Context, req api.APIV1ImportValidatePostReq) (*api.ImportValidation, error) {
+	reader, format, cleanup, err := importSource(req)
 	if err != nil {
 		return nil, err
 	}
-	return &api.APIV1ImportPostOK{Imported: api.NewOptInt(imported)}, nil
+	defer cleanup()
+
+	src := &decoderSource{dec: ical.NewFormatDecoder(reader, format)}
+	if err := src.drain(); err != nil {
+		return nil, badRequest("failed to parse iCalendar data: " + err.Error())
+	}
+	return &api.ImportValidation{
+		Valid:       !src.dec.HasErrors(),
+		Events:      src.events,
+		Diagnostics: diagnosticsToAPI(src.dec.Diagnostics()),
+	}, nil
 }
 
 func (h *handlerImpl) APIV1ImportSinglePost(ctx context.Context, req api.APIV1ImportSinglePostReq, params api.APIV1ImportSinglePostParams) (*api.Event, error) {
@@ -492,12 +738,95 @@ func (h *handlerImpl) APIV1ImportSinglePost(ctx context.Context, req api.APIV1Im
 	if err != nil {
 		return nil, badRequest("failed to parse iCalendar data")
 	}
-	event, err := h.svc.ImportSingle(events, calendarName)
+	event, err := h.importer(ctx).ImportSingle(events, calendarName)
 	if err != nil {
 		return nil, err
 	}
 	event.SetStringID()
-	return modelEventToAPI(event), nil
+	return service.EventToAPI(event), nil
+}
+
+func (h *handlerImpl) APIV1ImportCsvPost(ctx context.Context, req api.APIV1ImportCsvPostReq, params api.APIV1ImportCsvPostParams) (*api.CSVImportResult, error) {
+	opts := service.CSVImportOptions{
+		Calendar:   params.Calendar.Value,
+		DryRun:     params.DryRun.Value,
+		DateFormat: string(params.DateFormat.Value),
+	}
+	if len(params.Column) > 0 {
+		opts.Columns = make(map[string]string, len(params.Column))
+		for _, c := range params.Column {
+			field, header, ok := strings.Cut(c, "=")
+			if !ok || field == "" || header == "" {
+				return nil, badRequest("column must be field=Header")
+			}
+			opts.Columns[field] = header
+		}
+	}
+	if params.Timezone.Set {
+		loc, err := time.LoadLocation(params.Timezone.Value)
+		if err != nil {
+			return nil, badRequest("unknown timezone")
+		}
+		opts.Location = loc
+	}
+
+	result, err := h.importer(ctx).ImportCSV(io.LimitReader(req.Data, maxImportSize), opts)
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.CSVImportResult{
+		Committed:  result.Committed,
+		DateFormat: result.DateFormat,
+		Rows:       make([]api.CSVImportRow, len(result.Rows)),
+	}
+	for i, row := range result.Rows {
+		r := api.CSVImportRow{Row: row.Row}
+		if row.Err != nil {
+			r.Error = api.NewOptString(row.Err.Error())
+		} else {
+			row.Event.SetStringID()
+			r.Event = api.NewOptEvent(*service.EventToAPI(row.Event))
+		}
+		resp.Rows[i] = r
+	}
+	if result.Committed {
+		resp.Imported = len(result.Rows)
+	}
+	return resp, nil
+}
+
+func (h *handlerImpl) APIV1ImportMailPost(ctx context.Context, req api.APIV1ImportMailPostReq, params api.APIV1ImportMailPostParams) (*api.MailImportResult, error) {
+	result, err := h.importer(ctx).IngestMail(io.LimitReader(req.Data, maxImportSize), params.Calendar.Value)
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.MailImportResult{
+		Calendars: result.Calendars,
+		Items:     make([]api.MailImportItem, len(result.Items)),
+	}
+	for i, item := range result.Items {
+		it := api.MailImportItem{UID: item.UID, Action: api.MailImportItemAction(item.Action)}
+		if item.Event != nil {
+			item.Event.SetStringID()
+			it.Event = api.NewOptEvent(*service.EventToAPI(item.Event))
+		}
+		if item.Reason != "" {
+			it.Reason = api.NewOptString(item.Reason)
+		}
+		resp.Items[i] = it
+	}
+	return resp, nil
+}
+
+func (h *handlerImpl) APIV1EventsCsvGet(ctx context.Context, params api.APIV1EventsCsvGetParams) (api.APIV1EventsCsvGetOK, error) {
+	from := params.From.UTC().Format(time.RFC3339)
+	to := params.To.UTC().Format(time.RFC3339)
+	calendarIDs := parseCalendarIDsFromParams(params.CalendarID, params.Calendar, h.calSvc)
+	var buf bytes.Buffer
+	if _, err := h.svc.WriteCSV(&buf, from, to, calendarIDs); err != nil {
+		return api.APIV1EventsCsvGetOK{}, err
+	}
+	return api.APIV1EventsCsvGetOK{Data: &buf}, nil
 }
 
 func (h *handlerImpl) APIV1FeedsGet(ctx context.Context) ([]api.Feed, error) {
@@ -507,7 +836,7 @@ func (h *handlerImpl) APIV1FeedsGet(ctx context.Context) ([]api.Feed, error) {
 	}
 	result := make([]api.Feed, len(feeds))
 	for i := range feeds {
-		result[i] = *modelFeedToAPI(&feeds[i])
+		result[i] = *service.FeedToAPI(&feeds[i])
 	}
 	return result, nil
 }
@@ -517,7 +846,7 @@ func (h *handlerImpl) APIV1FeedsPost(ctx context.Context, req *api.CreateFeedReq
 	if err != nil {
 		return nil, err
 	}
-	return modelFeedToAPI(feed), nil
+	return service.FeedToAPI(feed), nil
 }
 
 func (h *handlerImpl) APIV1FeedsIDGet(ctx context.Context, params api.APIV1FeedsIDGetParams) (*api.Feed, error) {
@@ -525,7 +854,7 @@ func (h *handlerImpl) APIV1FeedsIDGet(ctx context.Context, params api.APIV1Feeds
 	if err != nil {
 		return nil, err
 	}
-	return modelFeedToAPI(feed), nil
+	return service.FeedToAPI(feed), nil
 }
 
 func (h *handlerImpl) APIV1FeedsIDPut(ctx context.Context, req *api.UpdateFeedRequest, params api.APIV1FeedsIDPutParams) (*api.Feed, error) {
@@ -533,7 +862,7 @@ func (h *handlerImpl) APIV1FeedsIDPut(ctx context.Context, req *api.UpdateFeedRe
 	if err != nil {
 		return nil, err
 	}
-	return modelFeedToAPI(feed), nil
+	return service.FeedToAPI(feed), nil
 }
 
 func (h *handlerImpl) APIV1FeedsIDDelete(ctx context.Context, params api.APIV1FeedsIDDeleteParams) error {
@@ -545,13 +874,123 @@ func (h *handlerImpl) APIV1FeedsIDRefreshPost(ctx context.Context, params api.AP
 	if err != nil {
 		return nil, err
 	}
-	return modelFeedToAPI(feed), nil
+	return service.FeedToAPI(feed), nil
+}
+
+func (h *handlerImpl) APIV1FeedsIDPreviewPost(ctx context.Context, req api.OptFeedPreviewRequest, params api.APIV1FeedsIDPreviewPostParams) (*api.FeedPreview, error) {
+	preview, err := h.feedSvc.Preview(params.ID, req.Value.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return service.FeedPreviewToAPI(preview), nil
 }
 
-func (h *handlerImpl) CalendarIcsGet(ctx context.Context, params api.CalendarIcsGetParams) (api.CalendarIcsGetOK, error) {
-	reader, err := icsResponse(h.svc, h.calSvc, params.CalendarID, params.Calendar)
+func (h *handlerImpl) APIV1WebhooksGet(ctx context.Context) ([]api.Webhook, error) {
+	hooks, err := h.hookSvc.List()
 	if err != nil {
-		return api.CalendarIcsGetOK{}, err
+		return nil, err
+	}
+	result := make([]api.Webhook, len(hooks))
+	for i := range hooks {
+		result[i] = *service.WebhookToAPI(&hooks[i])
+	}
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1WebhooksPost(ctx context.Context, req *api.CreateWebhookRequest) (*api.Webhook, error) {
+	hook, err := h.hookSvc.Create(req)
+	if err != nil {
+		return nil, err
+	}
+	return service.WebhookToAPI(hook), nil
+}
+
+func (h *handlerImpl) APIV1WebhooksIDGet(ctx context.Context, params api.APIV1WebhooksIDGetParams) (*api.Webhook, error) {
+	hook, err := h.hookSvc.GetByID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	return service.WebhookToAPI(hook), nil
+}
+
+func (h *handlerImpl) APIV1WebhooksIDPatch(ctx context.Context, req *api.UpdateWebhookRequest, params api.APIV1WebhooksIDPatchParams) (*api.Webhook, error) {
+	hook, err := h.hookSvc.Update(params.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	return service.WebhookToAPI(hook), nil
+}
+
+func (h *handlerImpl) APIV1WebhooksIDDelete(ctx context.Context, params api.APIV1WebhooksIDDeleteParams) error {
+	return h.hookSvc.Delete(params.ID)
+}
+
+func (h *handlerImpl) APIV1WebhooksIDDeliveriesGet(ctx context.Context, params api.APIV1WebhooksIDDeliveriesGetParams) ([]api.WebhookDelivery, error) {
+	deliveries, err := h.hookSvc.Deliveries(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]api.WebhookDelivery, len(deliveries))
+	for i := range deliveries {
+		result[i] = *service.DeliveryToAPI(&deliveries[i])
+	}
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1PublicationsGet(ctx context.Context) ([]api.Publication, error) {
+	pubs, err := h.pubSvc.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]api.Publication, len(pubs))
+	for i := range pubs {
+		result[i] = *service.PublicationToAPI(&pubs[i])
+	}
+	return result, nil
+}
+
+func (h *handlerImpl) APIV1PublicationsPost(ctx context.Context, req *api.CreatePublicationRequest) (*api.Publication, error) {
+	pub, err := h.pubSvc.Create(req)
+	if err != nil {
+		return nil, err
+	}
+	return service.PublicationToAPI(pub), nil
+}
+
+func (h *handlerImpl) APIV1PublicationsIDGet(ctx context.Context, params api.APIV1PublicationsIDGetParams) (*api.Publication, error) {
+	pub, err := h.pubSvc.GetByID(params.ID)
+	if err != nil {
+		return nil, err
+	}
+	return service.PublicationToAPI(pub), nil
+}
+
+func (h *handlerImpl) APIV1PublicationsIDPatch(ctx context.Context, req *api.UpdatePublicationRequest, params api.APIV1PublicationsIDPatchParams) (*api.Publication, error) {
+	pub, err := h.pubSvc.Update(params.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	return service.PublicationToAPI(pub), nil
+}
+
+func (h *handlerImpl) APIV1PublicationsIDDelete(ctx context.Context, params api.APIV1PublicationsIDDeleteParams) error {
+	return h.pubSvc.Delete(params.ID)
+}
+
+func (h *handlerImpl) CalendarIcsGet(ctx context.Context, params api.CalendarIcsGetParams) (api.CalendarIcsGetRes, error) {
+	format := formatFromContext(ctx)
+	etag, reader, err := icsFeed(h.svc, h.calSvc, format, params.CalendarID, params.Calendar, params.IfNoneMatch)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case reader == nil:
+		return &api.CalendarIcsGetNotModified{ETag: etag}, nil
+	case format == ical.FormatJCal:
+		return &api.CalendarIcsGetOKApplicationCalendarJSONHeaders{ETag: etag, Response: api.CalendarIcsGetOKApplicationCalendarJSON{Data: reader}}, nil
+	case format == ical.FormatXCal:
+		return &api.CalendarIcsGetOKApplicationCalendarXMLHeaders{ETag: etag, Response: api.CalendarIcsGetOKApplicationCalendarXML{Data: reader}}, nil
+	default:
+		return &api.CalendarIcsGetOKTextCalendarHeaders{ETag: etag, Response: api.CalendarIcsGetOKTextCalendar{Data: reader}}, nil
 	}
-	return api.CalendarIcsGetOK{Data: reader}, nil
 }
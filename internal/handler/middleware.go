@@ -1,20 +1,100 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/mikaelstaldal/go-server-common/httputil"
 	"github.com/mikaelstaldal/go-server-common/recovery"
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/metrics"
+	"github.com/mikaelstaldal/mycal/internal/model"
 )
 
+var requestDuration = metrics.Default.NewHistogramVec("mycal_http_request_duration_seconds",
+	"Duration of API requests, by operation and status code.", metrics.DefaultBuckets, "operation", "code")
+
 func withMiddleware(h http.Handler) http.Handler {
-	return recovery.Middleware(httputil.Gzip(apiCacheMiddleware(h)))
+	return recovery.Middleware(httputil.Gzip(apiCacheMiddleware(actorMiddleware(h))))
 }
 
-// apiCacheMiddleware prevents caching of dynamic API responses.
+// apiCacheMiddleware prevents caching of dynamic API responses. The iCalendar
+// feeds may be stored, but must be revalidated with their ETag.
 func apiCacheMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Cache-Control", "no-store")
+		if isCalendarFeed(r) {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+type actorKey struct{}
+
+// actorMiddleware stores who is making the request in the request context, for
+// the event history. The user name comes from HTTP basic auth (verified by the
+// auth middleware when enabled). Browsers mark the web UI's own fetches with
+// Sec-Fetch-Site: same-origin; everything else counts as an API client.
+func actorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := model.Actor{Source: model.SourceAPI}
+		if username, _, ok := r.BasicAuth(); ok {
+			actor.Name = username
+		}
+		if r.Header.Get("Sec-Fetch-Site") == "same-origin" {
+			actor.Source = model.SourceUI
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
+	})
+}
+
+func actorFromContext(ctx context.Context) model.Actor {
+	if actor, ok := ctx.Value(actorKey{}).(model.Actor); ok {
+		return actor
+	}
+	return model.Actor{Source: model.SourceAPI}
+}
+
+// metricsMiddleware records the duration of the requests for the operations
+// of server.
+func metricsMiddleware(server *api.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := server.FindPath(r.Method, r.URL)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		requestDuration.Observe(time.Since(start).Seconds(), route.Name(), strconv.Itoa(rec.status))
+	})
+}
+
+// statusRecorder remembers the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/metrics"
+)
+
+// readyTimeout bounds how long the readiness check waits for the database.
+const readyTimeout = 5 * time.Second
+
+// NewOpsRouter creates an HTTP handler for the liveness and readiness probes
+// and the metrics of registry. ready checks that the database can be used.
+// It is meant for a separate listener without authentication.
+func NewOpsRouter(ready func(ctx context.Context) error, registry *metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := ready(ctx); err != nil {
+			log.Printf("readiness check: %v", err)
+			writeProbe(w, http.StatusServiceUnavailable, "database unavailable")
+			return
+		}
+		writeProbe(w, http.StatusOK, "ok")
+	})
+	mux.Handle("GET /metrics", registry.Handler())
+	return mux
+}
+
+func writeProbe(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(msg + "\n"))
+}
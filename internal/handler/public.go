@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mikaelstaldal/go-server-common/httputil"
+	"github.com/mikaelstaldal/go-server-common/recovery"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/sanitize"
+	"github.com/mikaelstaldal/mycal/internal/service"
+)
+
+//go:embed public
+var publicFiles embed.FS
+
+var agendaTemplate = template.Must(template.ParseFS(publicFiles, "public/agenda.html"))
+
+// NewPublicRouter creates an HTTP handler for the published calendars: an
+// HTML agenda at /public/{token} and an iCalendar feed at
+// /public/{token}.ics. It is meant to be served without authentication, so
+// it only serves what the publications allow.
+func NewPublicRouter(pubSvc *service.PublicationService, calSvc *service.CalendarService) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /public/agenda.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		http.ServeFileFS(w, r, publicFiles, "public/agenda.css")
+	})
+	mux.HandleFunc("GET /public/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		token, feed := strings.CutSuffix(name, ".ics")
+		pub, err := pubSvc.Published(token)
+		if err != nil {
+			publicError(w, err)
+			return
+		}
+		if feed {
+			publicFeed(w, r, pubSvc, pub)
+		} else {
+			publicAgenda(w, pubSvc, calSvc, pub, token)
+		}
+	})
+	return recovery.Middleware(httputil.Gzip(mux))
+}
+
+func publicError(w http.ResponseWriter, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+	if errors.Is(err, service.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("public calendar: %v", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
+
+// publicFeed writes the iCalendar feed of a publication, in the format of the
+// Accept header.
+func publicFeed(w http.ResponseWriter, r *http.Request, pubSvc *service.PublicationService, pub *model.Publication) {
+	format := negotiateFormat(r.Header.Get("Accept"))
+	etag, err := pubSvc.ICSETag(format, pub)
+	if err != nil {
+		publicError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && service.MatchETag(inm, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", string(format)+"; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := pubSvc.WriteICS(w, format, pub); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		log.Printf("encode published iCal: %v", err)
+	}
+}
+
+// agendaPage is the data of the agenda template.
+type agendaPage struct {
+	Name      string
+	FeedURL   string
+	TimeZone  string
+	Days      []agendaDay
+	Truncated bool
+}
+
+type agendaDay struct {
+	Date   string
+	Events []agendaEvent
+}
+
+type agendaEvent struct {
+	Time        string
+	Title       string
+	Color       string
+	Location    string
+	URL         string
+	Categories  string
+	Description template.HTML
+}
+
+// publicAgenda renders the agenda page of a publication.
+func publicAgenda(w http.ResponseWriter, pubSvc *service.PublicationService, calSvc *service.CalendarService, pub *model.Publication, token string) {
+	events, truncated, err := pubSvc.Agenda(pub, time.Now())
+	if err != nil {
+		publicError(w, err)
+		return
+	}
+	calendars, err := calSvc.List()
+	if err != nil {
+		publicError(w, err)
+		return
+	}
+	colors := make(map[int64]string, len(calendars))
+	for _, cal := range calendars {
+		colors[cal.ID] = cal.Color
+	}
+
+	loc := service.PublicationLocation(pub)
+	page := agendaPage{Name: pub.Name, FeedURL: token + ".ics", TimeZone: loc.String(), Truncated: truncated}
+	today := time.Now().In(loc).Format(time.DateOnly)
+	for i := range events {
+		e := &events[i]
+		start, end, ok := eventTimes(e, loc)
+		if !ok {
+			continue
+		}
+		date := start.Format(time.DateOnly)
+		if date < today {
+			date = today // still going on
+		}
+		if len(page.Days) == 0 || page.Days[len(page.Days)-1].Date != date {
+			page.Days = append(page.Days, agendaDay{Date: date})
+		}
+		color := e.Color
+		if color == "" {
+			color = colors[e.CalendarID]
+		}
+		day := &page.Days[len(page.Days)-1]
+		day.Events = append(day.Events, agendaEvent{
+			Time:        agendaTime(e.AllDay, start, end),
+			Title:       e.Title,
+			Color:       color,
+			Location:    e.Location,
+			URL:         safeURL(e.URL),
+			Categories:  strings.ReplaceAll(e.Categories, ",", ", "),
+			Description: template.HTML(sanitize.HTML(e.Description)),
+		})
+	}
+	for i := range page.Days {
+		if t, err := time.Parse(time.DateOnly, page.Days[i].Date); err == nil {
+			page.Days[i].Date = t.Format("Monday 2 January 2006")
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := agendaTemplate.Execute(w, page); err != nil {
+		log.Printf("render agenda: %v", err)
+	}
+}
+
+// eventTimes returns the start and end of an event in loc. The dates of
+// all-day events are kept as they are, with the end made inclusive.
+func eventTimes(e *model.Event, loc *time.Location) (time.Time, time.Time, bool) {
+	start, err := time.Parse(time.RFC3339, e.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := time.Parse(time.RFC3339, e.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if e.AllDay {
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+		return start, end, true
+	}
+	return start.In(loc), end.In(loc), true
+}
+
+// agendaTime describes when an event is, like "10:00–11:00" or
+// "All day, until 8 March".
+func agendaTime(allDay bool, start, end time.Time) string {
+	sameDay := start.Format(time.DateOnly) == end.Format(time.DateOnly)
+	switch {
+	case allDay && (sameDay || end.Before(start)):
+		return "All day"
+	case allDay:
+		return "All day, until " + end.Format("2 January")
+	case sameDay:
+		return start.Format("15:04") + "–" + end.Format("15:04")
+	default:
+		return start.Format("15:04") + " – " + end.Format("2 January 15:04")
+	}
+}
+
+// safeURL returns rawURL if it is a web link, else "".
+func safeURL(rawURL string) string {
+	if strings.HasPrefix(rawURL, "https://") || strings.HasPrefix(rawURL, "http://") {
+		return rawURL
+	}
+	return ""
+}
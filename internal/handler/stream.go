@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/service"
+)
+
+const (
+	// streamKeepAlive is how often an idle change stream sends a comment, so
+	// that proxies keep the connection open and dead clients are noticed.
+	streamKeepAlive = 30 * time.Second
+	// streamWriteTimeout bounds each write to the change stream; the server's
+	// WriteTimeout would end the stream after a fixed time.
+	streamWriteTimeout = 10 * time.Second
+)
+
+type streamChange struct {
+	Kind   string `json:"kind"`
+	Action string `json:"action"`
+	ID     int64  `json:"id"`
+}
+
+// streamHandler serves GET /api/v1/stream, a Server-Sent Events stream with a
+// "change" event for every change published on bus. The stream ends when the
+// client falls behind or the server shuts down; clients should then reload
+// what they show before reconnecting.
+func streamHandler(bus *service.EventBus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		changes, unsubscribe := bus.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			var msg string
+			select {
+			case <-r.Context().Done():
+				return
+			case c, ok := <-changes:
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(streamChange{Kind: c.Kind, Action: c.Action, ID: c.ID})
+				msg = fmt.Sprintf("event: change\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				msg = ": keep-alive\n\n"
+			}
+			_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprint(w, msg); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
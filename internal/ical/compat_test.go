@@ -0,0 +1,113 @@
+package ical
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func decodeFixture(t *testing.T, name string) map[string]model.Event {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	require.NoError(t, err)
+	defer f.Close()
+	events, err := Decode(f)
+	require.NoError(t, err)
+	byTitle := make(map[string]model.Event, len(events))
+	for _, e := range events {
+		byTitle[e.Title] = e
+	}
+	require.Len(t, byTitle, len(events), "titles are unique")
+	return byTitle
+}
+
+func TestDecodeGoogleTakeout(t *testing.T) {
+	events := decodeFixture(t, "google-takeout.ics")
+	require.Len(t, events, 4, "events of all calendars")
+
+	assert.Equal(t, "2025-03-10T09:00:00Z", events["Dentist"].StartTime)
+	assert.True(t, events["National Day"].AllDay)
+	assert.Equal(t, "2025-06-06T00:00:00Z", events["National Day"].StartTime)
+	// Floating times are in the X-WR-TIMEZONE of their calendar: CEST and EDT
+	assert.Equal(t, "2025-07-04T16:00:00Z", events["Floating dinner"].StartTime)
+	assert.Equal(t, "2025-07-04T18:00:00Z", events["Floating dinner"].EndTime)
+	assert.Equal(t, "2025-07-04T22:00:00Z", events["Fireworks"].StartTime)
+	assert.Equal(t, "https://meet.google.com/abc-defg-hij", events["Fireworks"].URL)
+}
+
+func TestDecodeOutlook(t *testing.T) {
+	events := decodeFixture(t, "outlook.ics")
+	require.Len(t, events, 4)
+
+	// W. Europe Standard Time is Europe/Berlin, in CEST in June
+	review := events["Quarterly review"]
+	assert.Equal(t, "2025-06-12T12:00:00Z", review.StartTime)
+	assert.Equal(t, "2025-06-12T13:00:00Z", review.EndTime)
+	assert.Equal(t, 15, review.ReminderMinutes)
+
+	vacation := events["Vacation day"]
+	assert.True(t, vacation.AllDay)
+	assert.Equal(t, "2025-01-02T00:00:00Z", vacation.StartTime)
+	assert.Equal(t, "2025-01-03T00:00:00Z", vacation.EndTime)
+
+	// A quoted TZID with a colon, defined by a VTIMEZONE, with VALUE=DATE-TIME
+	standup := events["Standup with New York"]
+	assert.False(t, standup.AllDay)
+	assert.Equal(t, "2025-01-15T14:00:00Z", standup.StartTime)
+
+	// Pacific Standard Time without a VTIMEZONE, in PST and then PDT
+	call := events["Saturday call"]
+	assert.Equal(t, "2025-03-01T17:00:00Z", call.StartTime)
+	assert.Equal(t, "2025-03-15T16:00:00Z", call.ExDates)
+}
+
+func TestDecodeMultipleCalendarsWithSameTZID(t *testing.T) {
+	events := decodeFixture(t, "apple-multi.ics")
+	require.Len(t, events, 2)
+	assert.Equal(t, "2025-02-01T09:00:00Z", events["Home errand"].StartTime)
+	assert.Equal(t, "2025-02-01T15:00:00Z", events["Work errand"].StartTime)
+}
+
+func TestResolveTZID(t *testing.T) {
+	for tzid, want := range map[string]string{
+		"Europe/Stockholm":           "Europe/Stockholm",
+		`"Europe/Stockholm"`:         "Europe/Stockholm",
+		"W. Europe Standard Time":    "Europe/Berlin",
+		"Eastern Standard Time":      "America/New_York",
+		"Tokyo Standard Time":        "Asia/Tokyo",
+		"/mozilla.org/Europe/London": "Europe/London",
+	} {
+		loc := resolveTZID(tzid, nil)
+		if assert.NotNil(t, loc, tzid) {
+			assert.Equal(t, want, loc.String(), tzid)
+		}
+	}
+	assert.Nil(t, resolveTZID("Unknown Standard Time", nil))
+}
+
+func TestParsePropLineQuotedColon(t *testing.T) {
+	name, params, value := parsePropLine(`DTSTART;TZID="(UTC+01:00) Amsterdam, Berlin":20250101T100000`)
+	assert.Equal(t, "DTSTART", name)
+	assert.Equal(t, `TZID="(UTC+01:00) Amsterdam, Berlin"`, params)
+	assert.Equal(t, "20250101T100000", value)
+}
+
+func TestDecodeDateWithoutValueParam(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART:20250403\r\n" +
+		"DTEND:20250404\r\n" +
+		"SUMMARY:Holiday\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	events, err := Decode(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.True(t, events[0].AllDay)
+	assert.Equal(t, "2025-04-03T00:00:00Z", events[0].StartTime)
+}
@@ -0,0 +1,408 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// maxPendingEvents bounds the events a Decoder holds back because they use a
+// time zone that may be defined further down in their calendar.
+const maxPendingEvents = 1000
+
+// Decoder reads the events of an iCalendar document one at a time, so that a
+// large calendar can be imported with bounded memory. Time zones, including
+// VTIMEZONEs after the events that use them, apply to the events of the
+// VCALENDAR they are defined in.
+type Decoder struct {
+	lines   lineReader
+	diag    diagnostics
+	started bool   // whether the first line has been read
+	method  string // METHOD of the last VCALENDAR
+	err     error
+
+	// The VCALENDAR being read.
+	tzMap      map[string]*time.Location
+	calendarTZ numberedLine // X-WR-TIMEZONE not resolved yet, if text is set
+	seenTZ     bool         // whether the calendar has an X-WR-TIMEZONE
+	depth      int          // nesting of components outside VEVENT and VTIMEZONE
+	component  *rawComponent
+
+	pending []*rawComponent // events waiting for a time zone, in document order
+	ready   []model.Event
+}
+
+// rawComponent is the lines of a VEVENT or VTIMEZONE.
+type rawComponent struct {
+	name     string
+	start    int            // line number of BEGIN
+	props    []numberedLine // properties of the component itself
+	subProps []string       // properties of its VALARM, STANDARD or DAYLIGHT components
+	subDepth int
+}
+
+// NewDecoder returns a decoder of the text format.
+func NewDecoder(r io.Reader) *Decoder {
+	return newDecoder(&textLines{r: bufio.NewReader(r)})
+}
+
+// NewFormatDecoder returns a decoder of the given format. Unknown formats are
+// decoded as text. jCal and xCal documents are parsed whole on the first call
+// to Next; only the text format is streamed.
+func NewFormatDecoder(r io.Reader, format Format) *Decoder {
+	switch format {
+	case FormatJCal:
+		return newDecoder(&documentLines{read: func() ([]string, error) { return jcalLines(r) }})
+	case FormatXCal:
+		return newDecoder(&documentLines{read: func() ([]string, error) { return xcalLines(r) }})
+	default:
+		return NewDecoder(r)
+	}
+}
+
+func newDecoder(lines lineReader) *Decoder {
+	return &Decoder{lines: lines, tzMap: make(map[string]*time.Location)}
+}
+
+// Next returns the next event of the document. It returns io.EOF after the
+// last one, and another error if the document cannot be read. Events that
+// cannot be mapped to the model are skipped and reported in Diagnostics.
+func (d *Decoder) Next() (model.Event, error) {
+	for len(d.ready) == 0 {
+		if d.err != nil {
+			return model.Event{}, d.err
+		}
+		text, n, err := d.lines.next()
+		if err != nil {
+			if err == io.EOF {
+				d.end()
+			}
+			d.err = err
+			continue
+		}
+		d.line(text, n)
+	}
+	ev := d.ready[0]
+	d.ready[0] = model.Event{}
+	d.ready = d.ready[1:]
+	return ev, nil
+}
+
+// Diagnostics returns the problems found in the part of the document read so
+// far.
+func (d *Decoder) Diagnostics() []Diagnostic {
+	return d.diag.result()
+}
+
+// Method returns the METHOD of the VCALENDAR read last, such as REQUEST or
+// CANCEL in an invitation, or "" if it has none.
+func (d *Decoder) Method() string {
+	return d.method
+}
+
+// HasErrors reports whether any of the diagnostics so far is an error.
+func (d *Decoder) HasErrors() bool {
+	return d.diag.errors > 0
+}
+
+// decodeAll returns all the events of the document.
+func (d *Decoder) decodeAll() ([]model.Event, error) {
+	var events []model.Event
+	for {
+		ev, err := d.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+}
+
+// line handles one unfolded line starting at line number n.
+func (d *Decoder) line(text string, n int) {
+	upper := strings.ToUpper(strings.TrimSpace(text))
+	if !d.started {
+		d.started = true
+		if upper != "BEGIN:VCALENDAR" {
+			d.diag.add(n, "VCALENDAR", SeverityWarning, "document does not start with BEGIN:VCALENDAR")
+		}
+	}
+
+	if c := d.component; c != nil {
+		switch {
+		case upper == "END:"+c.name:
+			d.component = nil
+			d.endComponent(c)
+		case upper == "BEGIN:VEVENT", upper == "BEGIN:VCALENDAR", upper == "END:VCALENDAR":
+			// The component is not ended before the next one or its calendar
+			d.component = nil
+			if c.name == "VEVENT" {
+				d.diag.add(c.start, "VEVENT", SeverityError, "event dropped: no END:VEVENT")
+			}
+			d.line(text, n)
+		case strings.HasPrefix(upper, "BEGIN:"):
+			c.subDepth++
+		case strings.HasPrefix(upper, "END:"):
+			c.subDepth = max(c.subDepth-1, 0)
+		case c.subDepth > 0:
+			c.subProps = append(c.subProps, text)
+		default:
+			c.props = append(c.props, numberedLine{n, text})
+		}
+		return
+	}
+
+	switch {
+	case upper == "BEGIN:VCALENDAR":
+		d.endCalendar()
+		d.depth = 1
+		d.method = ""
+	case upper == "END:VCALENDAR":
+		d.endCalendar()
+	case upper == "BEGIN:VEVENT", upper == "BEGIN:VTIMEZONE":
+		d.component = &rawComponent{name: upper[len("BEGIN:"):], start: n}
+	case strings.HasPrefix(upper, "BEGIN:"):
+		d.depth++
+	case strings.HasPrefix(upper, "END:"):
+		d.depth--
+	default:
+		name, _, value := parsePropLine(strings.TrimSpace(text))
+		if d.depth > 1 {
+			break
+		}
+		switch strings.ToUpper(name) {
+		case "METHOD":
+			d.method = strings.ToUpper(strings.TrimSpace(value))
+		case "X-WR-TIMEZONE":
+			if !d.seenTZ {
+				d.seenTZ = true
+				d.calendarTZ = numberedLine{n, strings.TrimSpace(value)}
+				d.resolveCalendarTZ()
+			}
+		}
+	}
+}
+
+// endComponent handles a VEVENT or VTIMEZONE that has been read.
+func (d *Decoder) endComponent(c *rawComponent) {
+	if c.name == "VTIMEZONE" {
+		addVTimezone(c, d.tzMap, &d.diag)
+		d.resolveCalendarTZ()
+		d.release()
+		return
+	}
+	if len(d.pending) == 0 && !d.needsZone(c) {
+		d.parse(c)
+		return
+	}
+	d.pending = append(d.pending, c)
+	if len(d.pending) > maxPendingEvents {
+		d.parse(d.pending[0])
+		d.pending[0] = nil
+		d.pending = d.pending[1:]
+	}
+}
+
+// resolveCalendarTZ sets the zone of floating times from X-WR-TIMEZONE, once
+// it is known.
+func (d *Decoder) resolveCalendarTZ() {
+	if d.calendarTZ.text == "" {
+		return
+	}
+	if loc := resolveTZID(d.calendarTZ.text, d.tzMap); loc != nil {
+		d.tzMap[floatingTZID] = loc
+		d.calendarTZ = numberedLine{}
+		d.release()
+	}
+}
+
+// release parses the pending events that no longer wait for a time zone, in
+// order.
+func (d *Decoder) release() {
+	for len(d.pending) > 0 && !d.needsZone(d.pending[0]) {
+		d.parse(d.pending[0])
+		d.pending[0] = nil
+		d.pending = d.pending[1:]
+	}
+}
+
+// endCalendar parses the pending events of the VCALENDAR with the time zones
+// it has, and starts over for the next one.
+func (d *Decoder) endCalendar() {
+	if d.calendarTZ.text != "" {
+		d.diag.add(d.calendarTZ.n, "X-WR-TIMEZONE", SeverityWarning,
+			"unknown time zone %q, floating times are read as UTC", d.calendarTZ.text)
+	}
+	for _, c := range d.pending {
+		d.parse(c)
+	}
+	d.pending = nil
+	d.tzMap = make(map[string]*time.Location)
+	d.calendarTZ = numberedLine{}
+	d.seenTZ = false
+	d.depth = 0
+}
+
+// end handles the end of the document.
+func (d *Decoder) end() {
+	if !d.started {
+		d.diag.add(0, "VCALENDAR", SeverityWarning, "document does not start with BEGIN:VCALENDAR")
+	}
+	if c := d.component; c != nil && c.name == "VEVENT" {
+		d.diag.add(c.start, "VEVENT", SeverityError, "event dropped: no END:VEVENT")
+	}
+	d.component = nil
+	d.endCalendar()
+}
+
+func (d *Decoder) parse(c *rawComponent) {
+	if ev, ok := parseEvent(c.start, c.props, c.subProps, d.tzMap, &d.diag); ok {
+		d.ready = append(d.ready, ev)
+	}
+}
+
+// needsZone reports whether an event has a time in a time zone that is not
+// known yet, or a floating time while the calendar has no zone for those.
+func (d *Decoder) needsZone(c *rawComponent) bool {
+	for _, p := range c.props {
+		name, params, value := parsePropLine(p.text)
+		switch strings.ToUpper(name) {
+		case "DTSTART", "DTEND", "EXDATE", "RDATE", "RECURRENCE-ID":
+		case "RRULE":
+			value = rruleUntil(value)
+		default:
+			continue
+		}
+		if tzid := paramValue(params, "TZID"); tzid != "" {
+			if resolveTZID(tzid, d.tzMap) == nil {
+				return true
+			}
+		} else if d.tzMap[floatingTZID] == nil && isFloating(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// rruleUntil returns the UNTIL of an RRULE, or "".
+func rruleUntil(rrule string) string {
+	for _, part := range strings.Split(rrule, ";") {
+		if k, v, ok := strings.Cut(part, "="); ok && strings.EqualFold(k, "UNTIL") {
+			return v
+		}
+	}
+	return ""
+}
+
+// isFloating reports whether any of the comma-separated values is a
+// date-time without a UTC designator.
+func isFloating(value string) bool {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if strings.Contains(v, "T") && !strings.HasSuffix(v, "Z") {
+			return true
+		}
+	}
+	return false
+}
+
+// lineReader reads the unfolded lines of a document of the text format.
+type lineReader interface {
+	// next returns the next line and the line number it starts at, 0 if not
+	// from the text format. It returns io.EOF after the last line.
+	next() (text string, n int, err error)
+}
+
+// textLines reads lines of the text format and unfolds them per RFC 5545:
+// lines that start with a space or tab are continuations of the previous
+// line. Blank lines are skipped.
+type textLines struct {
+	r *bufio.Reader
+	n int // number of the last line read
+}
+
+func (t *textLines) next() (string, int, error) {
+	for {
+		line, err := t.readLine()
+		if err != nil {
+			return "", 0, err
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue // blank, or a continuation of nothing
+		}
+		start := t.n
+		var b strings.Builder
+		b.WriteString(line)
+		for {
+			if c, err := t.r.Peek(1); err != nil || (c[0] != ' ' && c[0] != '\t') {
+				break
+			}
+			cont, err := t.readLine()
+			if err != nil {
+				return "", 0, err
+			}
+			if b.Len()+len(cont)-1 > maxLineBytes {
+				return "", 0, fmt.Errorf("reading ical: line %d: longer than %d bytes", start, maxLineBytes)
+			}
+			b.WriteString(cont[1:])
+		}
+		return b.String(), start, nil
+	}
+}
+
+// readLine reads one line without its line ending.
+func (t *textLines) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := t.r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineBytes+len("\r\n") {
+			return "", fmt.Errorf("reading ical: line %d: longer than %d bytes", t.n+1, maxLineBytes)
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err == io.EOF {
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", fmt.Errorf("reading ical: line %d: %w", t.n+1, err)
+		}
+		break
+	}
+	t.n++
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// documentLines reads a jCal or xCal document, which is parsed whole, as
+// lines of the text format.
+type documentLines struct {
+	read  func() ([]string, error)
+	lines []string
+}
+
+func (s *documentLines) next() (string, int, error) {
+	if s.read != nil {
+		lines, err := s.read()
+		s.read = nil
+		if err != nil {
+			return "", 0, err
+		}
+		s.lines = lines
+	}
+	if len(s.lines) == 0 {
+		return "", 0, io.EOF
+	}
+	line := s.lines[0]
+	s.lines = s.lines[1:]
+	return line, 0, nil
+}
@@ -0,0 +1,152 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder_LateTimezone(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Local\r\n" +
+		"DTSTART;TZID=Office:20250315T100000\r\n" +
+		"DTEND;TZID=Office:20250315T110000\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Floating\r\n" +
+		"DTSTART:20250315T120000\r\n" +
+		"DTEND:20250315T130000\r\n" +
+		"END:VEVENT\r\n" +
+		"X-WR-TIMEZONE:Europe/Stockholm\r\n" +
+		"BEGIN:VTIMEZONE\r\n" +
+		"TZID:Office\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"TZOFFSETTO:+0300\r\n" +
+		"END:STANDARD\r\n" +
+		"END:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:UTC\r\n" +
+		"DTSTART:20250315T140000Z\r\n" +
+		"DTEND:20250315T150000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n" +
+		"BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Next calendar\r\n" +
+		"DTSTART;TZID=Office:20250315T100000\r\n" +
+		"DTEND;TZID=Office:20250315T110000\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	dec := NewDecoder(strings.NewReader(input))
+	var got []string
+	for {
+		ev, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, ev.Title+" "+ev.StartTime)
+	}
+	assert.Equal(t, []string{
+		"Local 2025-03-15T07:00:00Z",
+		"Floating 2025-03-15T11:00:00Z",
+		"UTC 2025-03-15T14:00:00Z",
+		"Next calendar 2025-03-15T10:00:00Z",
+	}, got, "in document order, with the time zones of their own calendar")
+
+	var diags []string
+	for _, d := range dec.Diagnostics() {
+		diags = append(diags, d.String())
+	}
+	assert.Contains(t, diags, `line 13: VTIMEZONE: warning: unknown time zone "Office", using the fixed offset +0300 without daylight saving time`)
+	assert.Contains(t, diags, `line 28: DTSTART: warning: unknown time zone "Office", read as UTC`)
+}
+
+// eventStream generates a calendar of n events as it is read, and counts the
+// bytes read.
+type eventStream struct {
+	n, next int
+	read    int
+	pending string
+}
+
+func (s *eventStream) Read(p []byte) (int, error) {
+	for s.pending == "" {
+		switch {
+		case s.next == 0:
+			s.pending = "BEGIN:VCALENDAR\r\nX-WR-TIMEZONE:Europe/Stockholm\r\n"
+		case s.next <= s.n:
+			s.pending = fmt.Sprintf("BEGIN:VEVENT\r\nUID:%d\r\nSUMMARY:Event %d with a description th\r\n at is folded\r\n"+
+				"DTSTART:20250315T100000\r\nDTEND:20250315T110000\r\nEND:VEVENT\r\n", s.next, s.next)
+		case s.next == s.n+1:
+			s.pending = "END:VCALENDAR\r\n"
+		default:
+			return 0, io.EOF
+		}
+		s.next++
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	s.read += n
+	return n, nil
+}
+
+func TestDecoder_Streams(t *testing.T) {
+	stream := &eventStream{n: 100000}
+	dec := NewDecoder(stream)
+
+	ev, err := dec.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "Event 1 with a description that is folded", ev.Title)
+	assert.Less(t, stream.read, 64*1024, "the first event is returned before the rest is read")
+
+	count := 1
+	for {
+		_, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		count++
+		if count == 50000 {
+			assert.Less(t, stream.read, stream.n*150, "events are returned as they are read")
+		}
+	}
+	assert.Equal(t, 100000, count)
+	assert.Empty(t, dec.Diagnostics())
+}
+
+func TestDecoder_LineTooLong(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\nDESCRIPTION:" + strings.Repeat("x", maxLineBytes) + "\r\nEND:VCALENDAR\r\n"
+	_, err := Decode(strings.NewReader(input))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+
+	folded := "BEGIN:VCALENDAR\r\nDESCRIPTION:" + strings.Repeat(strings.Repeat("x", 70)+"\r\n ", maxLineBytes/60) + "\r\nEND:VCALENDAR\r\n"
+	_, err = Decode(strings.NewReader(folded))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestDecoder_DiagnosticsBounded(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	for i := 0; i < maxDiagnostics+10; i++ {
+		b.WriteString("BEGIN:VEVENT\r\nDTSTART:20250315T100000Z\r\nEND:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+
+	_, diags, err := DecodeDiagnostics(strings.NewReader(b.String()), FormatICal)
+	require.NoError(t, err)
+	require.Len(t, diags, maxDiagnostics+1)
+	last := diags[maxDiagnostics]
+	assert.Equal(t, SeverityError, last.Severity)
+	assert.Equal(t, "10 more problems not listed", last.Message)
+	assert.True(t, HasErrors(diags))
+}
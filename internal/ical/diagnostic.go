@@ -0,0 +1,97 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// Severity is how serious a Diagnostic is.
+type Severity string
+
+const (
+	// SeverityWarning is for a property that was ignored or approximated.
+	SeverityWarning Severity = "warning"
+	// SeverityError is for an event or a document that could not be read.
+	SeverityError Severity = "error"
+)
+
+// Diagnostic is a problem found while decoding an iCalendar document.
+type Diagnostic struct {
+	Line     int    // line of the text format where the property or component starts; 0 for jCal and xCal
+	Property string // name of the property or component
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s: %s", d.Line, d.Property, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Property, d.Severity, d.Message)
+}
+
+// maxDiagnostics bounds the diagnostics kept for a document, so that a large
+// file full of problems does not fill the memory with them.
+const maxDiagnostics = 1000
+
+// diagnostics collects Diagnostics while decoding.
+type diagnostics struct {
+	list          []Diagnostic
+	errors        int  // number of errors, including those not in list
+	omitted       int  // number of diagnostics not in list
+	omittedErrors bool // whether any of them is an error
+}
+
+// add records a diagnostic at the given line number, 0 if not known.
+func (d *diagnostics) add(line int, property string, severity Severity, format string, args ...any) {
+	if severity == SeverityError {
+		d.errors++
+	}
+	if len(d.list) >= maxDiagnostics {
+		d.omitted++
+		d.omittedErrors = d.omittedErrors || severity == SeverityError
+		return
+	}
+	d.list = append(d.list, Diagnostic{Line: line, Property: property, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// result returns the diagnostics, ending with a count of those not kept.
+func (d *diagnostics) result() []Diagnostic {
+	if d.omitted == 0 {
+		return d.list
+	}
+	severity := SeverityWarning
+	if d.omittedErrors {
+		severity = SeverityError
+	}
+	return append(d.list[:len(d.list):len(d.list)], Diagnostic{
+		Property: "VCALENDAR",
+		Severity: severity,
+		Message:  fmt.Sprintf("%d more problems not listed", d.omitted),
+	})
+}
+
+// HasErrors reports whether any of the diagnostics is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeDiagnostics decodes an iCalendar document in the given format like
+// DecodeFormat, and also returns the problems found, such as events that were
+// dropped, unknown time zones and properties that could not be parsed. An
+// error is returned only if the document cannot be read at all.
+func DecodeDiagnostics(r io.Reader, format Format) ([]model.Event, []Diagnostic, error) {
+	dec := NewFormatDecoder(r, format)
+	events, err := dec.decodeAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, dec.Diagnostics(), nil
+}
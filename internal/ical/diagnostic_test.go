@@ -0,0 +1,95 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeDiagnostics(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" + // 1
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" + // 3
+		"UID:no-summary\r\n" +
+		"DTSTART:20250315T100000Z\r\n" +
+		"DTEND:20250315T110000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" + // 8
+		"SUMMARY:No end\r\n" +
+		"DTSTART:20250315T100000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" + // 12
+		"SUMMARY:Imported with warnings\r\n" +
+		"DTSTART;TZID=Mars/Olympus:20250315T100000\r\n" +
+		"DTEND;TZID=Mars/Olympus:20250315T110000\r\n" +
+		"GEO:north;south\r\n" +
+		"RRULE:FREQ=WEEKLY;COUNT=ten;\r\n" +
+		" BYSETPOS=1\r\n" + // folded onto line 17
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" + // 20
+		"SUMMARY:Bad start\r\n" +
+		"DTSTART:tomorrow\r\n" +
+		"DTEND:20250315T110000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	events, diags, err := DecodeDiagnostics(strings.NewReader(input), FormatICal)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Imported with warnings", events[0].Title)
+	assert.Equal(t, "WEEKLY", events[0].RecurrenceFreq)
+	assert.True(t, HasErrors(diags))
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		`line 3: SUMMARY: error: event "no-summary" dropped: no SUMMARY`,
+		`line 8: DTEND: error: event "No end" dropped: no valid DTEND or DURATION`,
+		`line 14: DTSTART: warning: unknown time zone "Mars/Olympus", read as UTC`,
+		`line 15: DTEND: warning: unknown time zone "Mars/Olympus", read as UTC`,
+		`line 16: GEO: warning: invalid GEO "north;south" ignored, expected latitude;longitude`,
+		`line 17: RRULE: warning: invalid COUNT "ten" ignored`,
+		`line 17: RRULE: warning: BYSETPOS is not supported, the recurrence may differ`,
+		`line 22: DTSTART: warning: invalid date or date-time "tomorrow" ignored`,
+		`line 22: DTSTART: error: event "Bad start" dropped: no valid DTSTART`,
+	}, got)
+}
+
+func TestDecodeDiagnostics_Clean(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"X-WR-TIMEZONE:Europe/Stockholm\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Fine\r\n" +
+		"DTSTART:20250315T100000\r\n" +
+		"DURATION:PT1H\r\n" +
+		"RRULE:FREQ=WEEKLY;WKST=MO;BYDAY=MO,WE\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	events, diags, err := DecodeDiagnostics(strings.NewReader(input), FormatICal)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Empty(t, diags)
+}
+
+func TestDecodeDiagnostics_Truncated(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Cut off\r\n" +
+		"DTSTART:20250315T100000Z\r\n"
+	_, diags, err := DecodeDiagnostics(strings.NewReader(input), FormatICal)
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, Diagnostic{Line: 2, Property: "VEVENT", Severity: SeverityError, Message: "event dropped: no END:VEVENT"}, diags[0])
+}
+
+func TestDecodeDiagnostics_JCal(t *testing.T) {
+	input := `["vcalendar", [], [["vevent", [["dtstart", {}, "date-time", "2025-03-15T10:00:00Z"]], []]]]`
+	_, diags, err := DecodeDiagnostics(strings.NewReader(input), FormatJCal)
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "SUMMARY: error: event dropped: no SUMMARY", diags[0].String())
+}
@@ -13,160 +13,317 @@ import (
 	"github.com/mikaelstaldal/mycal/internal/sanitize"
 )
 
+// Format is a representation of iCalendar data, named by its media type.
+type Format string
+
+const (
+	FormatICal Format = "text/calendar"             // RFC 5545
+	FormatJCal Format = "application/calendar+json" // RFC 7265
+	FormatXCal Format = "application/calendar+xml"  // RFC 6321
+)
+
 // Encode writes events as an iCalendar (RFC 5545) document to w.
 func Encode(w io.Writer, events []model.Event) error {
-	var b strings.Builder
-	b.WriteString("BEGIN:VCALENDAR\r\n")
-	b.WriteString("VERSION:2.0\r\n")
-	b.WriteString("PRODID:-//mycal//mycal//EN\r\n")
-	b.WriteString("CALSCALE:GREGORIAN\r\n")
-	b.WriteString("METHOD:PUBLISH\r\n")
-	b.WriteString("X-WR-CALNAME:mycal\r\n")
-
-	for _, e := range events {
-		start, err := time.Parse(time.RFC3339, e.StartTime)
-		if err != nil {
-			continue
-		}
-		end, err := time.Parse(time.RFC3339, e.EndTime)
-		if err != nil {
-			continue
+	return EncodeFormat(w, FormatICal, events)
+}
+
+// EncodeFormat writes events as an iCalendar document in the given format
+// to w.
+func EncodeFormat(w io.Writer, format Format, events []model.Event) error {
+	enc := NewFormatEncoder(w, format)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
 		}
+	}
+	return enc.Close()
+}
 
-		b.WriteString("BEGIN:VEVENT\r\n")
+// Encoder writes an iCalendar document one event at a time, so that a
+// calendar can be streamed without holding all of it in memory. The calendar
+// header is written before the first event and the footer by Close.
+type Encoder struct {
+	// Name is the name of the calendar (X-WR-CALNAME), "mycal" if empty. It
+	// must be set before the first event is encoded.
+	Name string
+
+	w       *bufio.Writer
+	syntax  syntax
+	started bool
+}
 
-		// UID: overrides share parent's UID
-		if e.RecurrenceParentID != nil {
-			fmt.Fprintf(&b, "UID:event-%d@mycal\r\n", *e.RecurrenceParentID)
-		} else {
-			fmt.Fprintf(&b, "UID:event-%d@mycal\r\n", e.ID)
-		}
+// syntax writes the components of a calendar in one of the formats.
+type syntax interface {
+	// header writes the start of the calendar and its properties.
+	header(w *bufio.Writer, cal *component) error
+	// component writes one component of the calendar.
+	component(w *bufio.Writer, c *component) error
+	// footer writes the end of the calendar.
+	footer(w *bufio.Writer, cal *component) error
+}
 
-		// RECURRENCE-ID for overrides
-		if e.RecurrenceParentID != nil && e.RecurrenceOriginalStart != "" {
-			if origTime, err := time.Parse(time.RFC3339, e.RecurrenceOriginalStart); err == nil {
-				if e.AllDay {
-					fmt.Fprintf(&b, "RECURRENCE-ID;VALUE=DATE:%s\r\n", origTime.UTC().Format("20060102"))
-				} else {
-					fmt.Fprintf(&b, "RECURRENCE-ID:%s\r\n", formatICalTime(origTime))
-				}
-			}
-		}
+// NewEncoder returns an encoder of the text format.
+func NewEncoder(w io.Writer) *Encoder {
+	return NewFormatEncoder(w, FormatICal)
+}
+
+// NewFormatEncoder returns an encoder of the given format. Unknown formats
+// are encoded as text.
+func NewFormatEncoder(w io.Writer, format Format) *Encoder {
+	var s syntax
+	switch format {
+	case FormatJCal:
+		s = &jcalSyntax{}
+	case FormatXCal:
+		s = &xcalSyntax{}
+	default:
+		s = textSyntax{}
+	}
+	return &Encoder{w: bufio.NewWriter(w), syntax: s}
+}
+
+// calendarComponent is the VCALENDAR component, without its events.
+func calendarComponent(name string) *component {
+	if name == "" {
+		name = "mycal"
+	}
+	cal := &component{name: "VCALENDAR"}
+	cal.add("VERSION", "", "2.0")
+	cal.add("PRODID", "", "-//mycal//mycal//EN")
+	cal.add("CALSCALE", "", "GREGORIAN")
+	cal.add("METHOD", "", "PUBLISH")
+	cal.add("X-WR-CALNAME", "", escapeText(name))
+	return cal
+}
+
+func (enc *Encoder) writeHeader() error {
+	if enc.started {
+		return nil
+	}
+	enc.started = true
+	return enc.syntax.header(enc.w, calendarComponent(enc.Name))
+}
+
+// Encode writes one event. Events with unparseable times are skipped.
+func (enc *Encoder) Encode(e *model.Event) error {
+	if err := enc.writeHeader(); err != nil {
+		return err
+	}
+	c, ok := eventComponent(e)
+	if !ok {
+		return nil
+	}
+	return enc.syntax.component(enc.w, c)
+}
+
+// Close writes the end of the calendar and flushes. It does not close the
+// underlying writer.
+func (enc *Encoder) Close() error {
+	if err := enc.writeHeader(); err != nil {
+		return err
+	}
+	if err := enc.syntax.footer(enc.w, calendarComponent(enc.Name)); err != nil {
+		return err
+	}
+	return enc.w.Flush()
+}
+
+// contentLine is a property as in the text format: params are joined like
+// "TZID=Europe/Stockholm;VALUE=DATE" and the value is escaped.
+type contentLine struct {
+	name, params, value string
+}
+
+func (l contentLine) String() string {
+	if l.params != "" {
+		return l.name + ";" + l.params + ":" + l.value
+	}
+	return l.name + ":" + l.value
+}
+
+// component is an iCalendar component, such as VEVENT, with its properties
+// and subcomponents. All formats are mapped to and from the model through it.
+type component struct {
+	name  string
+	props []contentLine
+	subs  []*component
+}
 
-		if e.AllDay {
-			fmt.Fprintf(&b, "DTSTART;VALUE=DATE:%s\r\n", start.UTC().Format("20060102"))
-			if e.Duration != "" {
-				fmt.Fprintf(&b, "DURATION:%s\r\n", e.Duration)
+func (c *component) add(name, params, value string) {
+	c.props = append(c.props, contentLine{name, params, value})
+}
+
+// lines returns the component as unfolded lines of the text format.
+func (c *component) lines() []string {
+	lines := []string{"BEGIN:" + c.name}
+	for _, p := range c.props {
+		lines = append(lines, p.String())
+	}
+	for _, sub := range c.subs {
+		lines = append(lines, sub.lines()...)
+	}
+	return append(lines, "END:"+c.name)
+}
+
+// textSyntax is the text format of RFC 5545.
+type textSyntax struct{}
+
+func (textSyntax) header(w *bufio.Writer, cal *component) error {
+	lines := []string{"BEGIN:" + cal.name}
+	for _, p := range cal.props {
+		lines = append(lines, p.String())
+	}
+	return writeFolded(w, lines)
+}
+
+func (textSyntax) component(w *bufio.Writer, c *component) error {
+	return writeFolded(w, c.lines())
+}
+
+func (textSyntax) footer(w *bufio.Writer, cal *component) error {
+	return writeFolded(w, []string{"END:" + cal.name})
+}
+
+// eventComponent maps e to a VEVENT, unless the times of e are unparseable.
+func eventComponent(e *model.Event) (*component, bool) {
+	start, err := time.Parse(time.RFC3339, e.StartTime)
+	if err != nil {
+		return nil, false
+	}
+	end, err := time.Parse(time.RFC3339, e.EndTime)
+	if err != nil {
+		return nil, false
+	}
+
+	c := &component{name: "VEVENT"}
+
+	// UID: overrides share parent's UID
+	if e.RecurrenceParentID != nil {
+		c.add("UID", "", fmt.Sprintf("event-%d@mycal", *e.RecurrenceParentID))
+	} else {
+		c.add("UID", "", fmt.Sprintf("event-%d@mycal", e.ID))
+	}
+
+	// RECURRENCE-ID for overrides
+	if e.RecurrenceParentID != nil && e.RecurrenceOriginalStart != "" {
+		if origTime, err := time.Parse(time.RFC3339, e.RecurrenceOriginalStart); err == nil {
+			if e.AllDay {
+				c.add("RECURRENCE-ID", "VALUE=DATE", origTime.UTC().Format("20060102"))
 			} else {
-				fmt.Fprintf(&b, "DTEND;VALUE=DATE:%s\r\n", end.UTC().Format("20060102"))
+				c.add("RECURRENCE-ID", "", formatICalTime(origTime))
 			}
+		}
+	}
+
+	if e.AllDay {
+		c.add("DTSTART", "VALUE=DATE", start.UTC().Format("20060102"))
+		if e.Duration != "" {
+			c.add("DURATION", "", e.Duration)
 		} else {
-			fmt.Fprintf(&b, "DTSTART:%s\r\n", formatICalTime(start))
-			if e.Duration != "" {
-				fmt.Fprintf(&b, "DURATION:%s\r\n", e.Duration)
-			} else {
-				fmt.Fprintf(&b, "DTEND:%s\r\n", formatICalTime(end))
-			}
+			c.add("DTEND", "VALUE=DATE", end.UTC().Format("20060102"))
+		}
+	} else {
+		c.add("DTSTART", "", formatICalTime(start))
+		if e.Duration != "" {
+			c.add("DURATION", "", e.Duration)
+		} else {
+			c.add("DTEND", "", formatICalTime(end))
 		}
-		fmt.Fprintf(&b, "SUMMARY:%s\r\n", escapeText(e.Title))
-		if e.Description != "" {
-			fmt.Fprintf(&b, "DESCRIPTION:%s\r\n", escapeText(e.Description))
+	}
+	c.add("SUMMARY", "", escapeText(e.Title))
+	if e.Description != "" {
+		c.add("DESCRIPTION", "", escapeText(e.Description))
+	}
+	if e.Location != "" {
+		c.add("LOCATION", "", escapeText(e.Location))
+	}
+	if e.Latitude != nil && e.Longitude != nil {
+		c.add("GEO", "", fmt.Sprintf("%f;%f", *e.Latitude, *e.Longitude))
+	}
+	if e.Categories != "" {
+		c.add("CATEGORIES", "", escapeText(e.Categories))
+	}
+	if e.URL != "" {
+		c.add("URL", "", stripCRLF(e.URL))
+	}
+	if e.Color != "" {
+		c.add("COLOR", "", stripCRLF(e.Color))
+	}
+	if e.Transparent {
+		c.add("TRANSP", "", "TRANSPARENT")
+	}
+	if e.RecurrenceFreq != "" {
+		rrule := "FREQ=" + stripCRLF(e.RecurrenceFreq)
+		if e.RecurrenceInterval > 1 {
+			rrule += fmt.Sprintf(";INTERVAL=%d", e.RecurrenceInterval)
 		}
-		if e.Location != "" {
-			fmt.Fprintf(&b, "LOCATION:%s\r\n", escapeText(e.Location))
+		if e.RecurrenceCount > 0 {
+			rrule += fmt.Sprintf(";COUNT=%d", e.RecurrenceCount)
 		}
-		if e.Latitude != nil && e.Longitude != nil {
-			fmt.Fprintf(&b, "GEO:%f;%f\r\n", *e.Latitude, *e.Longitude)
+		if e.RecurrenceUntil != "" {
+			if t, err := time.Parse(time.RFC3339, e.RecurrenceUntil); err == nil {
+				rrule += ";UNTIL=" + formatICalTime(t)
+			}
 		}
-		if e.Categories != "" {
-			fmt.Fprintf(&b, "CATEGORIES:%s\r\n", escapeText(e.Categories))
+		if e.RecurrenceByDay != "" {
+			rrule += ";BYDAY=" + stripCRLF(e.RecurrenceByDay)
 		}
-		if e.URL != "" {
-			fmt.Fprintf(&b, "URL:%s\r\n", stripCRLF(e.URL))
+		if e.RecurrenceByMonthDay != "" {
+			rrule += ";BYMONTHDAY=" + stripCRLF(e.RecurrenceByMonthDay)
 		}
-		if e.Color != "" {
-			fmt.Fprintf(&b, "COLOR:%s\r\n", stripCRLF(e.Color))
+		if e.RecurrenceByMonth != "" {
+			rrule += ";BYMONTH=" + stripCRLF(e.RecurrenceByMonth)
 		}
-		if e.RecurrenceFreq != "" {
-			rrule := "RRULE:FREQ=" + stripCRLF(e.RecurrenceFreq)
-			if e.RecurrenceInterval > 1 {
-				rrule += fmt.Sprintf(";INTERVAL=%d", e.RecurrenceInterval)
-			}
-			if e.RecurrenceCount > 0 {
-				rrule += fmt.Sprintf(";COUNT=%d", e.RecurrenceCount)
-			}
-			if e.RecurrenceUntil != "" {
-				if t, err := time.Parse(time.RFC3339, e.RecurrenceUntil); err == nil {
-					rrule += ";UNTIL=" + formatICalTime(t)
-				}
-			}
-			if e.RecurrenceByDay != "" {
-				rrule += ";BYDAY=" + stripCRLF(e.RecurrenceByDay)
-			}
-			if e.RecurrenceByMonthDay != "" {
-				rrule += ";BYMONTHDAY=" + stripCRLF(e.RecurrenceByMonthDay)
-			}
-			if e.RecurrenceByMonth != "" {
-				rrule += ";BYMONTH=" + stripCRLF(e.RecurrenceByMonth)
-			}
-			b.WriteString(rrule + "\r\n")
-		}
-		if e.ExDates != "" {
-			for _, exd := range strings.Split(e.ExDates, ",") {
-				exd = strings.TrimSpace(exd)
-				if t, err := time.Parse(time.RFC3339, exd); err == nil {
-					if e.AllDay {
-						fmt.Fprintf(&b, "EXDATE;VALUE=DATE:%s\r\n", t.UTC().Format("20060102"))
-					} else {
-						fmt.Fprintf(&b, "EXDATE:%s\r\n", formatICalTime(t))
-					}
+		c.add("RRULE", "", rrule)
+	}
+	if e.ExDates != "" {
+		for _, exd := range strings.Split(e.ExDates, ",") {
+			exd = strings.TrimSpace(exd)
+			if t, err := time.Parse(time.RFC3339, exd); err == nil {
+				if e.AllDay {
+					c.add("EXDATE", "VALUE=DATE", t.UTC().Format("20060102"))
+				} else {
+					c.add("EXDATE", "", formatICalTime(t))
 				}
 			}
 		}
-		if e.RDates != "" {
-			for _, rd := range strings.Split(e.RDates, ",") {
-				rd = strings.TrimSpace(rd)
-				if t, err := time.Parse(time.RFC3339, rd); err == nil {
-					if e.AllDay {
-						fmt.Fprintf(&b, "RDATE;VALUE=DATE:%s\r\n", t.UTC().Format("20060102"))
-					} else {
-						fmt.Fprintf(&b, "RDATE:%s\r\n", formatICalTime(t))
-					}
+	}
+	if e.RDates != "" {
+		for _, rd := range strings.Split(e.RDates, ",") {
+			rd = strings.TrimSpace(rd)
+			if t, err := time.Parse(time.RFC3339, rd); err == nil {
+				if e.AllDay {
+					c.add("RDATE", "VALUE=DATE", t.UTC().Format("20060102"))
+				} else {
+					c.add("RDATE", "", formatICalTime(t))
 				}
 			}
 		}
-		if e.ReminderMinutes > 0 {
-			b.WriteString("BEGIN:VALARM\r\n")
-			b.WriteString("ACTION:DISPLAY\r\n")
-			fmt.Fprintf(&b, "TRIGGER:-PT%dM\r\n", e.ReminderMinutes)
-			fmt.Fprintf(&b, "DESCRIPTION:Reminder: %s\r\n", escapeText(e.Title))
-			b.WriteString("END:VALARM\r\n")
-		}
-		if e.CreatedAt != "" {
-			if t, err := time.Parse(time.RFC3339, e.CreatedAt); err == nil {
-				fmt.Fprintf(&b, "CREATED:%s\r\n", formatICalTime(t))
-			}
+	}
+	if e.ReminderMinutes > 0 {
+		alarm := &component{name: "VALARM"}
+		alarm.add("ACTION", "", "DISPLAY")
+		alarm.add("TRIGGER", "", fmt.Sprintf("-PT%dM", e.ReminderMinutes))
+		alarm.add("DESCRIPTION", "", "Reminder: "+escapeText(e.Title))
+		c.subs = append(c.subs, alarm)
+	}
+	if e.CreatedAt != "" {
+		if t, err := time.Parse(time.RFC3339, e.CreatedAt); err == nil {
+			c.add("CREATED", "", formatICalTime(t))
 		}
-		if e.UpdatedAt != "" {
-			if t, err := time.Parse(time.RFC3339, e.UpdatedAt); err == nil {
-				fmt.Fprintf(&b, "LAST-MODIFIED:%s\r\n", formatICalTime(t))
-				fmt.Fprintf(&b, "DTSTAMP:%s\r\n", formatICalTime(t))
-			}
+	}
+	if e.UpdatedAt != "" {
+		if t, err := time.Parse(time.RFC3339, e.UpdatedAt); err == nil {
+			c.add("LAST-MODIFIED", "", formatICalTime(t))
+			c.add("DTSTAMP", "", formatICalTime(t))
 		}
-		b.WriteString("END:VEVENT\r\n")
 	}
-
-	b.WriteString("END:VCALENDAR\r\n")
-	return foldICalContent(w, b.String())
+	return c, true
 }
 
-// foldICalContent applies RFC 5545 §3.1 line folding to a complete iCal document,
-// writing each folded line directly to w.
-func foldICalContent(w io.Writer, s string) error {
-	for _, line := range strings.Split(s, "\r\n") {
-		if line == "" {
-			continue
-		}
+// writeFolded writes content lines to w, folded per RFC 5545 §3.1.
+func writeFolded(w io.Writer, lines []string) error {
+	for _, line := range lines {
 		if _, err := io.WriteString(w, foldLine(line)); err != nil {
 			return err
 		}
@@ -200,117 +357,65 @@ func formatICalTime(t time.Time) string {
 
 // Decode parses an iCalendar document and returns the events found.
 func Decode(r io.Reader) ([]model.Event, error) {
-	lines, err := unfoldLines(r)
-	if err != nil {
-		return nil, fmt.Errorf("reading ical: %w", err)
-	}
-
-	tzMap := parseVTimezones(lines)
-
-	var events []model.Event
-	var inEvent bool
-	var inAlarm bool
-	var props []string
-	var alarmProps []string
-
-	for _, line := range lines {
-		upper := strings.ToUpper(strings.TrimSpace(line))
-		if upper == "BEGIN:VEVENT" {
-			inEvent = true
-			props = nil
-			alarmProps = nil
-			continue
-		}
-		if upper == "END:VEVENT" {
-			inEvent = false
-			if ev, ok := parseEvent(props, alarmProps, tzMap); ok {
-				events = append(events, ev)
-			}
-			continue
-		}
-		if upper == "BEGIN:VALARM" {
-			inAlarm = true
-			continue
-		}
-		if upper == "END:VALARM" {
-			inAlarm = false
-			continue
-		}
-		if inEvent {
-			if inAlarm {
-				alarmProps = append(alarmProps, line)
-			} else {
-				props = append(props, line)
-			}
-		}
-	}
+	return NewDecoder(r).decodeAll()
+}
 
-	return events, nil
+// DecodeFormat parses an iCalendar document in the given format and returns
+// the events found. Unknown formats are parsed as text.
+func DecodeFormat(r io.Reader, format Format) ([]model.Event, error) {
+	return NewFormatDecoder(r, format).decodeAll()
 }
 
-// parseVTimezones scans for VTIMEZONE blocks and builds a map of TZID → *time.Location.
-func parseVTimezones(lines []string) map[string]*time.Location {
-	tzMap := make(map[string]*time.Location)
-	var inTZ, inSubComp bool
-	var tzid string
-	var offsetTo string
+// numberedLine is an unfolded line with the line number it starts at, 0 if
+// not from the text format.
+type numberedLine struct {
+	n    int
+	text string
+}
 
-	for _, line := range lines {
-		upper := strings.ToUpper(strings.TrimSpace(line))
-		if upper == "BEGIN:VTIMEZONE" {
-			inTZ = true
-			tzid = ""
-			offsetTo = ""
-			continue
-		}
-		if upper == "END:VTIMEZONE" {
-			if tzid != "" {
-				// First try to extract an IANA name from the TZID
-				if loc := tryExtractIANAFromTZID(tzid); loc != nil {
-					tzMap[tzid] = loc
-				} else if offsetTo != "" {
-					// Fall back to fixed offset from TZOFFSETTO
-					if loc := parseUTCOffset(offsetTo); loc != nil {
-						tzMap[tzid] = loc
-					}
-				}
-			}
-			inTZ = false
-			continue
-		}
-		if !inTZ {
-			continue
-		}
-		if upper == "BEGIN:STANDARD" || upper == "BEGIN:DAYLIGHT" {
-			inSubComp = true
-			continue
-		}
-		if upper == "END:STANDARD" || upper == "END:DAYLIGHT" {
-			inSubComp = false
-			continue
-		}
-		name, _, value := parsePropLine(line)
-		switch strings.ToUpper(name) {
-		case "TZID":
+// addVTimezone adds the location of a VTIMEZONE to tzMap.
+func addVTimezone(c *rawComponent, tzMap map[string]*time.Location, diag *diagnostics) {
+	var tzid, offsetTo string
+	for _, p := range c.props {
+		if name, _, value := parsePropLine(p.text); strings.EqualFold(name, "TZID") {
 			tzid = value
-		case "TZOFFSETTO":
-			if inSubComp && offsetTo == "" {
-				// Use the first TZOFFSETTO found (typically from STANDARD)
-				offsetTo = value
-			}
 		}
 	}
-	return tzMap
+	for _, line := range c.subProps {
+		// Use the first TZOFFSETTO found (typically from STANDARD)
+		if name, _, value := parsePropLine(line); strings.EqualFold(name, "TZOFFSETTO") && offsetTo == "" {
+			offsetTo = value
+		}
+	}
+	if tzid == "" {
+		diag.add(c.start, "VTIMEZONE", SeverityWarning, "VTIMEZONE without TZID ignored")
+		return
+	}
+	// First try to extract an IANA name from the TZID
+	if loc := tryExtractIANAFromTZID(tzid); loc != nil {
+		tzMap[tzid] = loc
+	} else if loc := parseUTCOffset(offsetTo); loc != nil {
+		// Fall back to fixed offset from TZOFFSETTO
+		tzMap[tzid] = loc
+		diag.add(c.start, "VTIMEZONE", SeverityWarning,
+			"unknown time zone %q, using the fixed offset %s without daylight saving time", tzid, offsetTo)
+	} else {
+		diag.add(c.start, "VTIMEZONE", SeverityWarning, "unknown time zone %q without a valid TZOFFSETTO", tzid)
+	}
 }
 
 // tryExtractIANAFromTZID tries to find an IANA timezone name within a path-style TZID
 // like "/citadel.org/20250101_1/Europe/Stockholm" by trying progressively shorter
-// suffixes with time.LoadLocation.
+// suffixes with time.LoadLocation. Windows names like "W. Europe Standard Time"
+// are looked up in windowsZones.
 func tryExtractIANAFromTZID(tzid string) *time.Location {
 	// First try the TZID directly
 	if loc, err := time.LoadLocation(tzid); err == nil {
 		return loc
 	}
+	if loc := windowsLocation(tzid); loc != nil {
+		return loc
+	}
 	// Try path suffixes: for "/citadel.org/20250101_1/Europe/Stockholm",
 	// try "Europe/Stockholm", then "Stockholm"
 	parts := strings.Split(tzid, "/")
@@ -348,31 +453,13 @@ func parseUTCOffset(offset string) *time.Location {
 	return time.FixedZone("UTC"+offset, totalSeconds)
 }
 
-// unfoldLines reads iCal content and handles line unfolding per RFC 5545:
-// lines that start with a space or tab are continuations of the previous line.
+// maxLineBytes bounds an unfolded line, so that a stream without line breaks
+// is not read into memory.
 const maxLineBytes = 1 << 20 // 1 MB — well above any reasonable unfolded iCal line
 
-func unfoldLines(r io.Reader) ([]string, error) {
-	var lines []string
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Remove trailing \r if present
-		line = strings.TrimRight(line, "\r")
-		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
-			// Continuation line: append to previous
-			if len(lines) > 0 {
-				lines[len(lines)-1] += line[1:]
-			}
-		} else {
-			lines = append(lines, line)
-		}
-	}
-	return lines, scanner.Err()
-}
-
-func parseEvent(props []string, alarmProps []string, tzMap map[string]*time.Location) (model.Event, bool) {
+// parseEvent maps the properties of the VEVENT starting at line start to the
+// model. Events without SUMMARY, DTSTART or an end are dropped.
+func parseEvent(start int, props []numberedLine, alarmProps []string, tzMap map[string]*time.Location, diag *diagnostics) (model.Event, bool) {
 	var summary, description, dtstart, dtend string
 	var uid string
 	var recurrenceID string
@@ -385,11 +472,28 @@ func parseEvent(props []string, alarmProps []string, tzMap map[string]*time.Loca
 	var googleConference string
 	var duration string
 	var color string
+	var transparent bool
+	var dtstartValue, dtendValue string
 	allDay := false
+	outlookAllDay := false
+
+	var dtstartIndex, dtendIndex, durationIndex int
 
 	for _, prop := range props {
-		name, params, value := parsePropLine(prop)
-		switch strings.ToUpper(name) {
+		name, params, value := parsePropLine(prop.text)
+		name = strings.ToUpper(name)
+		// parseTime is parseICalTime, reporting unknown time zones and unparseable values
+		parseTime := func(value string) string {
+			if tzid := paramValue(params, "TZID"); tzid != "" && resolveTZID(tzid, tzMap) == nil {
+				diag.add(prop.n, name, SeverityWarning, "unknown time zone %q, read as %s", tzid, floatingZoneName(tzMap))
+			}
+			t := parseICalTime(value, params, tzMap)
+			if t == "" {
+				diag.add(prop.n, name, SeverityWarning, "invalid date or date-time %q ignored", value)
+			}
+			return t
+		}
+		switch name {
 		case "UID":
 			uid = value
 		case "SUMMARY":
@@ -409,45 +513,79 @@ func parseEvent(props []string, alarmProps []string, tzMap map[string]*time.Loca
 					}
 				}
 			}
+			if latitude == nil {
+				diag.add(prop.n, name, SeverityWarning, "invalid GEO %q ignored, expected latitude;longitude", value)
+			}
 		case "CATEGORIES":
 			categories = sanitize.HTML(unescapeText(value))
 		case "URL":
-			if model.ValidateURL(value) == nil {
+			if err := model.ValidateURL(value); err == nil {
 				eventURL = value
+			} else {
+				diag.add(prop.n, name, SeverityWarning, "%s, ignored", err.Error())
 			}
 		case "X-GOOGLE-CONFERENCE":
 			if model.ValidateURL(value) == nil {
 				googleConference = value
 			}
+		case "TRANSP":
+			transparent = strings.EqualFold(strings.TrimSpace(value), "TRANSPARENT")
 		case "COLOR":
 			color = strings.ToLower(strings.TrimSpace(value))
 			if err := model.ValidateColor(color); err != nil {
+				diag.add(prop.n, name, SeverityWarning, "%s, ignored", err.Error())
 				color = ""
 			}
 		case "DTSTART":
-			upperParams := strings.ToUpper(params)
-			if strings.Contains(upperParams, "VALUE=DATE") {
+			if isDateValue(params, value) {
 				allDay = true
 			}
-			dtstart = parseICalTime(value, params, tzMap)
+			dtstartValue, dtstartIndex = value, prop.n
+			dtstart = parseTime(value)
 		case "DTEND":
-			dtend = parseICalTime(value, params, tzMap)
+			dtendValue, dtendIndex = value, prop.n
+			dtend = parseTime(value)
+		case "X-MICROSOFT-CDO-ALLDAYEVENT", "X-MICROSOFT-MSNCALENDAR-ALLDAYEVENT":
+			outlookAllDay = strings.EqualFold(strings.TrimSpace(value), "TRUE")
 		case "DURATION":
-			duration = value
+			duration, durationIndex = value, prop.n
 		case "RRULE":
-			rrule = parseRRule(value, tzMap)
+			var problems []string
+			rrule, problems = parseRRule(value, tzMap)
+			for _, problem := range problems {
+				diag.add(prop.n, name, SeverityWarning, "%s", problem)
+			}
 		case "EXDATE":
-			parsed := parseICalTime(value, params, tzMap)
-			if parsed != "" {
-				exdates = append(exdates, parsed)
+			for _, v := range strings.Split(value, ",") {
+				if parsed := parseTime(v); parsed != "" {
+					exdates = append(exdates, parsed)
+				}
 			}
 		case "RDATE":
-			parsed := parseICalTime(value, params, tzMap)
-			if parsed != "" {
-				rdates = append(rdates, parsed)
+			for _, v := range strings.Split(value, ",") {
+				if parsed := parseTime(v); parsed != "" {
+					rdates = append(rdates, parsed)
+				}
 			}
 		case "RECURRENCE-ID":
-			recurrenceID = parseICalTime(value, params, tzMap)
+			recurrenceID = parseTime(value)
+		}
+	}
+	// event names the event in diagnostics
+	event := "event"
+	if uid != "" {
+		event = fmt.Sprintf("event %q", uid)
+	}
+	if summary != "" {
+		event = fmt.Sprintf("event %q", summary)
+	}
+
+	// Outlook marks all-day events with midnight date-times in its own property
+	if outlookAllDay && !allDay && dtstart != "" {
+		allDay = true
+		dtstart = localDate(dtstartValue)
+		if dtend != "" {
+			dtend = localDate(dtendValue)
 		}
 	}
 
@@ -456,7 +594,12 @@ func parseEvent(props []string, alarmProps []string, tzMap map[string]*time.Loca
 		eventURL = googleConference
 	}
 
-	if summary == "" || dtstart == "" {
+	if summary == "" {
+		diag.add(start, "SUMMARY", SeverityError, "%s dropped: no SUMMARY", event)
+		return model.Event{}, false
+	}
+	if dtstart == "" {
+		diag.add(max(start, dtstartIndex), "DTSTART", SeverityError, "%s dropped: no valid DTSTART", event)
 		return model.Event{}, false
 	}
 
@@ -468,10 +611,13 @@ func parseEvent(props []string, alarmProps []string, tzMap map[string]*time.Loca
 			if err == nil {
 				dtend = start.Add(dur).Format(time.RFC3339)
 			}
+		} else {
+			diag.add(durationIndex, "DURATION", SeverityWarning, "invalid DURATION %q ignored", duration)
 		}
 	}
 
 	if dtend == "" {
+		diag.add(max(start, dtendIndex), "DTEND", SeverityError, "%s dropped: no valid DTEND or DURATION", event)
 		return model.Event{}, false
 	}
 
@@ -497,6 +643,7 @@ func parseEvent(props []string, alarmProps []string, tzMap map[string]*time.Loca
 		Categories:           categories,
 		URL:                  eventURL,
 		ReminderMinutes:      reminderMinutes,
+		Transparent:          transparent,
 		Location:             location,
 		Latitude:             latitude,
 		Longitude:            longitude,
@@ -578,25 +725,42 @@ type rruleResult struct {
 	ByMonth    string
 }
 
-func parseRRule(value string, tzMap map[string]*time.Location) rruleResult {
+// supportedFreqs are the values of FREQ that recurrences are expanded for.
+var supportedFreqs = map[string]bool{"DAILY": true, "WEEKLY": true, "MONTHLY": true, "YEARLY": true}
+
+// parseRRule parses the parts of an RRULE that the model supports, and
+// returns the problems with the rest of it.
+func parseRRule(value string, tzMap map[string]*time.Location) (rruleResult, []string) {
 	var r rruleResult
+	var problems []string
 	for _, part := range strings.Split(value, ";") {
 		kv := strings.SplitN(part, "=", 2)
 		if len(kv) != 2 {
+			problems = append(problems, fmt.Sprintf("invalid part %q ignored", part))
 			continue
 		}
-		switch strings.ToUpper(kv[0]) {
+		switch key := strings.ToUpper(kv[0]); key {
 		case "FREQ":
 			r.Freq = strings.ToUpper(kv[1])
+			if !supportedFreqs[r.Freq] {
+				problems = append(problems, fmt.Sprintf("FREQ=%s is not supported", r.Freq))
+			}
 		case "COUNT":
 			if count, err := strconv.Atoi(kv[1]); err == nil {
 				r.Count = count
+			} else {
+				problems = append(problems, fmt.Sprintf("invalid COUNT %q ignored", kv[1]))
 			}
 		case "UNTIL":
 			r.Until = parseICalTime(kv[1], "", tzMap)
+			if r.Until == "" {
+				problems = append(problems, fmt.Sprintf("invalid UNTIL %q ignored", kv[1]))
+			}
 		case "INTERVAL":
 			if interval, err := strconv.Atoi(kv[1]); err == nil {
 				r.Interval = interval
+			} else {
+				problems = append(problems, fmt.Sprintf("invalid INTERVAL %q ignored", kv[1]))
 			}
 		case "BYDAY":
 			r.ByDay = strings.ToUpper(kv[1])
@@ -604,16 +768,35 @@ func parseRRule(value string, tzMap map[string]*time.Location) rruleResult {
 			r.ByMonthDay = kv[1]
 		case "BYMONTH":
 			r.ByMonth = kv[1]
+		case "WKST":
+			// Only changes weekly rules with an interval and BYDAY; ignored
+		default:
+			problems = append(problems, fmt.Sprintf("%s is not supported, the recurrence may differ", key))
 		}
 	}
-	return r
+	if r.Freq == "" {
+		problems = append(problems, "no FREQ, the event does not recur")
+	}
+	return r, problems
 }
 
 // parsePropLine splits "DTSTART;TZID=Europe/Stockholm:20060102T150405" into
 // name="DTSTART", params="TZID=Europe/Stockholm", value="20060102T150405".
 func parsePropLine(line string) (name, params, value string) {
-	// Split at first colon that's not inside params
-	colonIdx := strings.Index(line, ":")
+	// Split at first colon that's not inside params, where it may be quoted as in
+	// TZID="(UTC+01:00) Amsterdam, Berlin"
+	colonIdx := -1
+	quoted := false
+	for i := 0; i < len(line) && colonIdx < 0; i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colonIdx = i
+			}
+		}
+	}
 	semiIdx := strings.Index(line, ";")
 
 	if colonIdx < 0 {
@@ -634,8 +817,7 @@ func parsePropLine(line string) (name, params, value string) {
 
 func parseICalTime(value, params string, tzMap map[string]*time.Location) string {
 	// Check for VALUE=DATE (all-day event)
-	upperParams := strings.ToUpper(params)
-	if strings.Contains(upperParams, "VALUE=DATE") {
+	if strings.EqualFold(paramValue(params, "VALUE"), "DATE") {
 		t, err := time.Parse("20060102", value)
 		if err != nil {
 			return ""
@@ -643,17 +825,13 @@ func parseICalTime(value, params string, tzMap map[string]*time.Location) string
 		return t.UTC().Format(time.RFC3339)
 	}
 
-	// Check for TZID
+	// Check for TZID, falling back to the calendar's X-WR-TIMEZONE
 	var loc *time.Location
-	for _, part := range strings.Split(params, ";") {
-		if strings.HasPrefix(strings.ToUpper(part), "TZID=") {
-			tzName := part[5:]
-			if l, err := time.LoadLocation(tzName); err == nil {
-				loc = l
-			} else if tzMap != nil {
-				loc = tzMap[tzName]
-			}
-		}
+	if tzid := paramValue(params, "TZID"); tzid != "" {
+		loc = resolveTZID(tzid, tzMap)
+	}
+	if loc == nil {
+		loc = tzMap[floatingTZID]
 	}
 
 	// Try UTC format: 20060102T150405Z
@@ -57,6 +57,42 @@ func TestEncode(t *testing.T) {
 	assert.Equal(t, 2, strings.Count(output, "BEGIN:VEVENT"))
 }
 
+func TestEncoder(t *testing.T) {
+	events := []model.Event{
+		{ID: 1, Title: "First", StartTime: "2026-02-17T14:00:00Z", EndTime: "2026-02-17T15:00:00Z"},
+		{ID: 2, Title: "Broken", StartTime: "not a time", EndTime: "2026-02-17T15:00:00Z"},
+		{ID: 3, Title: "Second " + strings.Repeat("long ", 30), StartTime: "2026-02-18T14:00:00Z", EndTime: "2026-02-18T15:00:00Z"},
+	}
+	var all bytes.Buffer
+	require.NoError(t, Encode(&all, events))
+
+	var streamed bytes.Buffer
+	enc := NewEncoder(&streamed)
+	for i := range events {
+		require.NoError(t, enc.Encode(&events[i]))
+	}
+	require.NoError(t, enc.Close())
+	assert.Equal(t, all.String(), streamed.String())
+	assert.Equal(t, 2, strings.Count(streamed.String(), "BEGIN:VEVENT"), "unparseable events are skipped")
+
+	decoded, err := Decode(&streamed)
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	assert.Equal(t, events[2].Title, decoded[1].Title)
+
+	var empty bytes.Buffer
+	require.NoError(t, NewEncoder(&empty).Close())
+	assert.True(t, strings.HasPrefix(empty.String(), "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(empty.String(), "END:VCALENDAR\r\n"))
+	assert.Contains(t, empty.String(), "X-WR-CALNAME:mycal\r\n")
+
+	var named bytes.Buffer
+	enc = NewEncoder(&named)
+	enc.Name = "On-call, Ops"
+	require.NoError(t, enc.Close())
+	assert.Contains(t, named.String(), "X-WR-CALNAME:On-call\\, Ops\r\n")
+}
+
 func TestEncodeWithLocation(t *testing.T) {
 	lat := 59.3293
 	lon := 18.0686
@@ -106,6 +142,24 @@ END:VCALENDAR`
 	assert.InDelta(t, 18.0686, *ev.Longitude, 0.001)
 }
 
+func TestEncodeDecodeTransparent(t *testing.T) {
+	events := []model.Event{
+		{ID: 1, Title: "Holiday", StartTime: "2026-02-02T10:00:00Z", EndTime: "2026-02-02T11:00:00Z", Transparent: true},
+		{ID: 2, Title: "Meeting", StartTime: "2026-02-02T10:00:00Z", EndTime: "2026-02-02T11:00:00Z"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, events))
+	output := buf.String()
+	assert.Equal(t, 1, strings.Count(output, "TRANSP:TRANSPARENT"))
+
+	decoded, err := Decode(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	assert.True(t, decoded[0].Transparent)
+	assert.False(t, decoded[1].Transparent)
+}
+
 func TestEncodeDecodeRRuleInterval(t *testing.T) {
 	events := []model.Event{
 		{
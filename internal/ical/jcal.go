@@ -0,0 +1,265 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// jcalSyntax is the JSON format of RFC 7265: the calendar is an array of its
+// name, properties and components, as is each component within it.
+type jcalSyntax struct {
+	n int // components written
+}
+
+func (s *jcalSyntax) header(w *bufio.Writer, cal *component) error {
+	props, err := jcalProperties(cal)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "[%q,%s,[", strings.ToLower(cal.name), props)
+	return err
+}
+
+func (s *jcalSyntax) component(w *bufio.Writer, c *component) error {
+	b, err := jcalComponent(c)
+	if err != nil {
+		return err
+	}
+	if s.n > 0 {
+		w.WriteString(",")
+	}
+	s.n++
+	w.WriteString("\n")
+	_, err = w.Write(b)
+	return err
+}
+
+func (s *jcalSyntax) footer(w *bufio.Writer, cal *component) error {
+	_, err := w.WriteString("]]\n")
+	return err
+}
+
+// jcalComponent returns the component as a jCal array.
+func jcalComponent(c *component) ([]byte, error) {
+	props, err := jcalProperties(c)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]json.RawMessage, len(c.subs))
+	for i, sub := range c.subs {
+		if subs[i], err = jcalComponent(sub); err != nil {
+			return nil, err
+		}
+	}
+	return marshalJSON([]any{strings.ToLower(c.name), props, subs})
+}
+
+func jcalProperties(c *component) (json.RawMessage, error) {
+	props := make([]json.RawMessage, len(c.props))
+	for i, l := range c.props {
+		var err error
+		if props[i], err = jcalProperty(toProperty(l)); err != nil {
+			return nil, err
+		}
+	}
+	return marshalJSON(props)
+}
+
+// jcalProperty returns a property as a jCal array of its name, parameters,
+// value type and values.
+func jcalProperty(p property) (json.RawMessage, error) {
+	params := make(map[string]string, len(p.params))
+	for _, pa := range p.params {
+		params[pa.name] = pa.value
+	}
+	prop := []any{p.name, params, p.typ}
+	switch {
+	case p.typ == "recur":
+		rule := make([]byte, 0, 64)
+		rule = append(rule, '{')
+		for i, part := range p.recur {
+			if i > 0 {
+				rule = append(rule, ',')
+			}
+			rule = strconv.AppendQuote(rule, part.name)
+			rule = append(rule, ':')
+			values := make([]any, len(part.values))
+			for j, v := range part.values {
+				values[j] = jcalScalar(v, integerRecurParts[part.name])
+			}
+			var b []byte
+			var err error
+			if len(values) == 1 {
+				b, err = marshalJSON(values[0])
+			} else {
+				b, err = marshalJSON(values)
+			}
+			if err != nil {
+				return nil, err
+			}
+			rule = append(rule, b...)
+		}
+		prop = append(prop, json.RawMessage(append(rule, '}')))
+	case p.name == "geo":
+		geo := make([]any, len(p.values))
+		for i, v := range p.values {
+			geo[i] = jcalScalar(v, true)
+		}
+		prop = append(prop, geo)
+	default:
+		numeric := p.typ == "integer" || p.typ == "float"
+		for _, v := range p.values {
+			prop = append(prop, jcalScalar(v, numeric))
+		}
+	}
+	return marshalJSON(prop)
+}
+
+// jcalScalar returns v as a JSON number if it is numeric and a number,
+// otherwise as a string.
+func jcalScalar(v string, numeric bool) any {
+	if numeric {
+		if _, err := strconv.ParseFloat(v, 64); err == nil && json.Valid([]byte(v)) {
+			return json.Number(v)
+		}
+	}
+	return v
+}
+
+// marshalJSON is json.Marshal without escaping of HTML characters.
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// DecodeJCal parses a jCal (RFC 7265) document and returns the events found.
+// The document is a vcalendar array, or an array of them.
+func DecodeJCal(r io.Reader) ([]model.Event, error) {
+	return NewFormatDecoder(r, FormatJCal).decodeAll()
+}
+
+// jcalLines reads a jCal document as unfolded lines of the text format.
+func jcalLines(r io.Reader) ([]string, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var root []any
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("reading jcal: %w", err)
+	}
+	calendars := root
+	if len(root) > 0 {
+		if _, ok := root[0].(string); ok {
+			calendars = []any{root}
+		}
+	}
+	var lines []string
+	for _, v := range calendars {
+		cal, err := parseJCalComponent(v)
+		if err != nil {
+			return nil, fmt.Errorf("reading jcal: %w", err)
+		}
+		lines = append(lines, cal.lines()...)
+	}
+	return lines, nil
+}
+
+var errJCalSyntax = errors.New("not a jCal component")
+
+func parseJCalComponent(v any) (*component, error) {
+	arr, ok := v.([]any)
+	if !ok || len(arr) != 3 {
+		return nil, errJCalSyntax
+	}
+	name, ok := arr[0].(string)
+	props, ok2 := arr[1].([]any)
+	subs, ok3 := arr[2].([]any)
+	if !ok || !ok2 || !ok3 {
+		return nil, errJCalSyntax
+	}
+	c := &component{name: strings.ToUpper(name)}
+	for _, pv := range props {
+		p, err := parseJCalProperty(pv)
+		if err != nil {
+			return nil, err
+		}
+		c.props = append(c.props, p.contentLine())
+	}
+	for _, sv := range subs {
+		sub, err := parseJCalComponent(sv)
+		if err != nil {
+			return nil, err
+		}
+		c.subs = append(c.subs, sub)
+	}
+	return c, nil
+}
+
+func parseJCalProperty(v any) (property, error) {
+	arr, ok := v.([]any)
+	if !ok || len(arr) < 4 {
+		return property{}, fmt.Errorf("not a jCal property: %v", v)
+	}
+	name, ok := arr[0].(string)
+	params, ok2 := arr[1].(map[string]any)
+	typ, ok3 := arr[2].(string)
+	if !ok || !ok2 || !ok3 {
+		return property{}, fmt.Errorf("not a jCal property: %v", v)
+	}
+	p := property{name: strings.ToLower(name), typ: strings.ToLower(typ)}
+	for _, k := range sortedKeys(params) {
+		p.params = append(p.params, param{strings.ToLower(k), strings.Join(jcalStrings(params[k]), ",")})
+	}
+	for _, value := range arr[3:] {
+		if rule, ok := value.(map[string]any); ok {
+			for _, k := range sortedKeys(rule) {
+				p.recur = append(p.recur, recurPart{strings.ToLower(k), jcalStrings(rule[k])})
+			}
+			continue
+		}
+		p.values = append(p.values, jcalStrings(value)...)
+	}
+	return p, nil
+}
+
+// jcalStrings returns a JSON value, or the elements of an array, as strings.
+func jcalStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case json.Number:
+		return []string{v.String()}
+	case bool:
+		return []string{strings.ToUpper(strconv.FormatBool(v))}
+	case []any:
+		var s []string
+		for _, e := range v {
+			s = append(s, jcalStrings(e)...)
+		}
+		return s
+	default:
+		return nil
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
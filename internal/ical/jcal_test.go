@@ -0,0 +1,190 @@
+package ical
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func roundTripEvents() []model.Event {
+	lat, lon := 59.3293, 18.0686
+	return []model.Event{
+		{
+			ID:                 1,
+			Title:              "Team <Meeting>, weekly",
+			Description:        "Line 1\nLine 2; with \\ backslash",
+			StartTime:          "2026-02-17T14:00:00Z",
+			EndTime:            "2026-02-17T15:00:00Z",
+			Location:           "Stockholm",
+			Latitude:           &lat,
+			Longitude:          &lon,
+			Categories:         "work,team",
+			URL:                "https://example.com/meeting?a=1&b=2",
+			Color:              "dodgerblue",
+			RecurrenceFreq:     "WEEKLY",
+			RecurrenceInterval: 2,
+			RecurrenceUntil:    "2026-06-30T00:00:00Z",
+			RecurrenceByDay:    "TU,TH",
+			ExDates:            "2026-03-03T14:00:00Z,2026-03-17T14:00:00Z",
+			RDates:             "2026-03-05T14:00:00Z",
+			ReminderMinutes:    15,
+			CreatedAt:          "2026-02-17T10:00:00Z",
+			UpdatedAt:          "2026-02-17T10:00:00Z",
+		},
+		{
+			ID:              2,
+			Title:           "Holiday",
+			StartTime:       "2026-04-03T00:00:00Z",
+			EndTime:         "2026-04-04T00:00:00Z",
+			AllDay:          true,
+			RecurrenceFreq:  "YEARLY",
+			RecurrenceCount: 5,
+			ExDates:         "2027-04-03T00:00:00Z",
+		},
+		{
+			ID:        3,
+			Title:     "Workshop",
+			StartTime: "2026-05-04T08:00:00Z",
+			EndTime:   "2026-05-04T11:30:00Z",
+			Duration:  "PT3H30M",
+		},
+	}
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	var text bytes.Buffer
+	require.NoError(t, Encode(&text, roundTripEvents()))
+	want, err := Decode(&text)
+	require.NoError(t, err)
+	require.Len(t, want, 3)
+
+	for _, format := range []Format{FormatJCal, FormatXCal} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, EncodeFormat(&buf, format, roundTripEvents()))
+			got, err := DecodeFormat(&buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestEncodeJCal(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, EncodeFormat(&buf, FormatJCal, roundTripEvents()[:2]))
+	require.True(t, json.Valid(buf.Bytes()), buf.String())
+
+	var cal []any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &cal))
+	require.Len(t, cal, 3)
+	assert.Equal(t, "vcalendar", cal[0])
+	assert.Contains(t, cal[1], []any{"version", map[string]any{}, "text", "2.0"})
+	events := cal[2].([]any)
+	require.Len(t, events, 2)
+
+	timed := events[0].([]any)
+	assert.Equal(t, "vevent", timed[0])
+	props := timed[1].([]any)
+	assert.Contains(t, props, []any{"dtstart", map[string]any{}, "date-time", "2026-02-17T14:00:00Z"})
+	assert.Contains(t, props, []any{"summary", map[string]any{}, "text", "Team <Meeting>, weekly"})
+	assert.Contains(t, props, []any{"geo", map[string]any{}, "float", []any{59.3293, 18.0686}})
+	assert.Contains(t, props, []any{"rrule", map[string]any{}, "recur", map[string]any{
+		"freq": "WEEKLY", "interval": 2.0, "until": "2026-06-30T00:00:00Z", "byday": []any{"TU", "TH"},
+	}})
+	assert.Contains(t, props, []any{"exdate", map[string]any{}, "date-time", "2026-03-03T14:00:00Z"})
+	alarm := timed[2].([]any)[0].([]any)
+	assert.Equal(t, "valarm", alarm[0])
+	assert.Contains(t, alarm[1], []any{"trigger", map[string]any{}, "duration", "-PT15M"})
+
+	allDay := events[1].([]any)[1].([]any)
+	assert.Contains(t, allDay, []any{"dtstart", map[string]any{}, "date", "2026-04-03"})
+	assert.Contains(t, allDay, []any{"rrule", map[string]any{}, "recur", map[string]any{"freq": "YEARLY", "count": 5.0}})
+}
+
+func TestEncoderJCal_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewFormatEncoder(&buf, FormatJCal).Close())
+	var cal []any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &cal))
+	assert.Equal(t, []any{}, cal[2])
+}
+
+func TestDecodeJCal(t *testing.T) {
+	// The example of RFC 7265 §B.2, with a time zone and a VALARM.
+	input := `["vcalendar",
+  [
+    ["calscale", {}, "text", "GREGORIAN"],
+    ["prodid", {}, "text", "-//Example Inc.//Example Calendar//EN"],
+    ["version", {}, "text", "2.0"]
+  ],
+  [
+    ["vtimezone",
+      [["tzid", {}, "text", "US/Eastern"]],
+      [["standard", [["tzoffsetto", {}, "utc-offset", "-05:00"]], []]]
+    ],
+    ["vevent",
+      [
+        ["dtstamp", {}, "date-time", "2008-02-05T19:12:24Z"],
+        ["dtstart", {"tzid": "US/Eastern"}, "date-time", "2008-10-06T09:00:00"],
+        ["duration", {}, "duration", "PT1H"],
+        ["summary", {}, "text", "Meeting, with \\ a comma"],
+        ["categories", {}, "text", "work", "meeting"],
+        ["geo", {}, "float", [37.386013, -122.082932]],
+        ["rrule", {}, "recur", {"freq": "WEEKLY", "byday": ["MO", "WE"], "until": "2008-12-31T00:00:00Z"}],
+        ["exdate", {}, "date-time", "2008-10-08T13:00:00Z", "2008-10-13T13:00:00Z"],
+        ["uid", {}, "text", "4088E990AD89CB3DBB484909"]
+      ],
+      [
+        ["valarm", [["action", {}, "text", "DISPLAY"], ["trigger", {}, "duration", "-PT1H"]], []]
+      ]
+    ],
+    ["vevent",
+      [
+        ["dtstart", {}, "date", "2008-12-24"],
+        ["dtend", {}, "date", "2008-12-25"],
+        ["summary", {}, "text", "Christmas Eve"]
+      ],
+      []
+    ]
+  ]
+]`
+	events, err := DecodeJCal(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	e := events[0]
+	assert.Equal(t, "Meeting, with \\ a comma", e.Title)
+	assert.Equal(t, "2008-10-06T13:00:00Z", e.StartTime)
+	assert.Equal(t, "2008-10-06T14:00:00Z", e.EndTime)
+	assert.Equal(t, "work,meeting", e.Categories)
+	require.NotNil(t, e.Latitude)
+	assert.InDelta(t, 37.386013, *e.Latitude, 1e-9)
+	assert.InDelta(t, -122.082932, *e.Longitude, 1e-9)
+	assert.Equal(t, "WEEKLY", e.RecurrenceFreq)
+	assert.Equal(t, "MO,WE", e.RecurrenceByDay)
+	assert.Equal(t, "2008-12-31T00:00:00Z", e.RecurrenceUntil)
+	assert.Equal(t, "2008-10-08T13:00:00Z,2008-10-13T13:00:00Z", e.ExDates)
+	assert.Equal(t, 60, e.ReminderMinutes)
+	assert.Equal(t, "4088E990AD89CB3DBB484909", e.ImportUID)
+
+	assert.True(t, events[1].AllDay)
+	assert.Equal(t, "2008-12-24T00:00:00Z", events[1].StartTime)
+}
+
+func TestDecodeJCal_Invalid(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`{"vcalendar": []}`,
+		`["vcalendar", {}, []]`,
+		`["vcalendar", [["summary", {}]], []]`,
+	} {
+		_, err := DecodeJCal(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,256 @@
+package ical
+
+import (
+	"sort"
+	"strings"
+)
+
+// property is a property as jCal and xCal represent it: with a value type
+// and typed values instead of one escaped text. It is converted to and from
+// a contentLine, so that all formats share the mapping to the model.
+type property struct {
+	name   string // lower case
+	params []param
+	typ    string // value type, such as "date-time"
+	// values are unescaped, with dates and times in the extended ISO 8601
+	// form ("2006-01-02T15:04:05Z"). GEO has the latitude and longitude.
+	values []string
+	recur  []recurPart // the parts of a "recur" value
+}
+
+type param struct {
+	name  string // lower case
+	value string
+}
+
+// recurPart is a rule part of a recurrence rule, such as BYDAY=MO,WE.
+type recurPart struct {
+	name   string // lower case
+	values []string
+}
+
+// defaultTypes are the value types of the properties that are not text,
+// unless overridden with a VALUE parameter.
+var defaultTypes = map[string]string{
+	"DTSTART":       "date-time",
+	"DTEND":         "date-time",
+	"DUE":           "date-time",
+	"RECURRENCE-ID": "date-time",
+	"EXDATE":        "date-time",
+	"RDATE":         "date-time",
+	"CREATED":       "date-time",
+	"LAST-MODIFIED": "date-time",
+	"DTSTAMP":       "date-time",
+	"COMPLETED":     "date-time",
+	"DURATION":      "duration",
+	"TRIGGER":       "duration",
+	"RRULE":         "recur",
+	"GEO":           "float",
+	"URL":           "uri",
+	"TZURL":         "uri",
+	"ATTACH":        "uri",
+	"ORGANIZER":     "cal-address",
+	"ATTENDEE":      "cal-address",
+	"TZOFFSETFROM":  "utc-offset",
+	"TZOFFSETTO":    "utc-offset",
+	"SEQUENCE":      "integer",
+	"PRIORITY":      "integer",
+}
+
+// multiValued are the text properties whose values are separated by unescaped
+// commas.
+var multiValued = map[string]bool{"CATEGORIES": true, "RESOURCES": true}
+
+// integerRecurParts are the rule parts with integer values.
+var integerRecurParts = map[string]bool{
+	"count": true, "interval": true, "bysecond": true, "byminute": true, "byhour": true,
+	"bymonthday": true, "byyearday": true, "byweekno": true, "bymonth": true, "bysetpos": true,
+}
+
+// defaultType returns the value type of a property without a VALUE
+// parameter. Unknown extension properties are "unknown", as in RFC 7265 §5.
+func defaultType(name string) string {
+	if typ, ok := defaultTypes[name]; ok {
+		return typ
+	}
+	if strings.HasPrefix(name, "X-") {
+		return "unknown"
+	}
+	return "text"
+}
+
+// toProperty converts a property in the text format.
+func toProperty(l contentLine) property {
+	name := strings.ToUpper(l.name)
+	p := property{name: strings.ToLower(name), typ: defaultType(name)}
+	for _, kv := range splitParams(l.params) {
+		k, v, _ := strings.Cut(kv, "=")
+		v = strings.Trim(v, `"`)
+		if strings.EqualFold(k, "VALUE") {
+			p.typ = strings.ToLower(v)
+			continue
+		}
+		p.params = append(p.params, param{strings.ToLower(k), v})
+	}
+	switch p.typ {
+	case "recur":
+		for _, part := range strings.Split(l.value, ";") {
+			k, v, ok := strings.Cut(part, "=")
+			if !ok {
+				continue
+			}
+			values := strings.Split(v, ",")
+			if strings.EqualFold(k, "UNTIL") {
+				values = []string{extendedTime(v)}
+			}
+			p.recur = append(p.recur, recurPart{strings.ToLower(k), values})
+		}
+	case "date", "date-time", "period":
+		for _, v := range strings.Split(l.value, ",") {
+			p.values = append(p.values, extendedTime(v))
+		}
+	case "utc-offset":
+		if len(l.value) == 5 || len(l.value) == 7 {
+			p.values = []string{l.value[:3] + ":" + l.value[3:5] + l.value[5:]}
+		} else {
+			p.values = []string{l.value}
+		}
+	case "text":
+		if multiValued[name] {
+			for _, v := range splitText(l.value) {
+				p.values = append(p.values, unescapeText(v))
+			}
+		} else {
+			p.values = []string{unescapeText(l.value)}
+		}
+	default:
+		if name == "GEO" {
+			p.values = strings.SplitN(l.value, ";", 2)
+		} else {
+			p.values = []string{l.value}
+		}
+	}
+	return p
+}
+
+// contentLine converts the property to the text format.
+func (p *property) contentLine() contentLine {
+	name := strings.ToUpper(p.name)
+	var params []string
+	for _, pa := range p.params {
+		params = append(params, strings.ToUpper(pa.name)+"="+quoteParam(pa.value))
+	}
+	if p.typ != "unknown" && p.typ != defaultType(name) {
+		params = append(params, "VALUE="+strings.ToUpper(p.typ))
+	}
+
+	var value string
+	switch p.typ {
+	case "recur":
+		// FREQ first, as some parsers expect
+		parts := append([]recurPart(nil), p.recur...)
+		sort.SliceStable(parts, func(i, j int) bool { return parts[i].name == "freq" && parts[j].name != "freq" })
+		var rule []string
+		for _, part := range parts {
+			v := strings.Join(part.values, ",")
+			if part.name == "until" {
+				v = basicTime(v)
+			}
+			rule = append(rule, strings.ToUpper(part.name)+"="+v)
+		}
+		value = strings.Join(rule, ";")
+	case "date", "date-time", "period":
+		values := make([]string, len(p.values))
+		for i, v := range p.values {
+			values[i] = basicTime(v)
+		}
+		value = strings.Join(values, ",")
+	case "utc-offset":
+		value = strings.ReplaceAll(strings.Join(p.values, ""), ":", "")
+	case "text":
+		values := make([]string, len(p.values))
+		for i, v := range p.values {
+			values[i] = escapeText(v)
+		}
+		value = strings.Join(values, ",")
+	default:
+		if name == "GEO" {
+			value = strings.Join(p.values, ";")
+		} else {
+			value = strings.Join(p.values, ",")
+		}
+	}
+	return contentLine{name, strings.Join(params, ";"), stripCRLF(value)}
+}
+
+// splitParams splits "TZID=Europe/Stockholm;VALUE=DATE" at the semicolons
+// that are not quoted.
+func splitParams(params string) []string {
+	if params == "" {
+		return nil
+	}
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, params[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, params[start:])
+}
+
+// quoteParam quotes a parameter value that contains separators, and removes
+// the characters a parameter value cannot contain.
+func quoteParam(v string) string {
+	v = strings.NewReplacer(`"`, "", "\r", "", "\n", "").Replace(v)
+	if strings.ContainsAny(v, ";:,") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// splitText splits an escaped text value at the commas that are not escaped.
+func splitText(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// extendedTime converts a date ("20060102"), date-time ("20060102T150405Z")
+// or period of them to the extended form used by jCal and xCal. Other
+// values are returned as they are.
+func extendedTime(v string) string {
+	if start, end, ok := strings.Cut(v, "/"); ok {
+		return extendedTime(start) + "/" + extendedTime(end)
+	}
+	if len(v) < 8 || strings.Trim(v[:8], "0123456789") != "" {
+		return v
+	}
+	date := v[:4] + "-" + v[4:6] + "-" + v[6:8]
+	if len(v) >= 15 && v[8] == 'T' && strings.Trim(v[9:15], "0123456789") == "" {
+		return date + "T" + v[9:11] + ":" + v[11:13] + ":" + v[13:15] + v[15:]
+	}
+	return date + v[8:]
+}
+
+// basicTime converts a date, date-time or period in the extended form to the
+// text format.
+func basicTime(v string) string {
+	return strings.NewReplacer("-", "", ":", "").Replace(v)
+}
@@ -0,0 +1,229 @@
+package ical
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+const xcalNamespace = "urn:ietf:params:xml:ns:icalendar-2.0"
+
+// xcalSyntax is the XML format of RFC 6321: each component is an element
+// with its properties and components in child elements, and each value is in
+// an element named by its type.
+type xcalSyntax struct{}
+
+func (xcalSyntax) header(w *bufio.Writer, cal *component) error {
+	w.WriteString(xml.Header)
+	w.WriteString(`<icalendar xmlns="` + xcalNamespace + `">` + "\n")
+	w.WriteString("<" + strings.ToLower(cal.name) + ">")
+	writeXCalProperties(w, cal)
+	_, err := w.WriteString("<components>\n")
+	return err
+}
+
+func (xcalSyntax) component(w *bufio.Writer, c *component) error {
+	writeXCalComponent(w, c)
+	_, err := w.WriteString("\n")
+	return err
+}
+
+func (xcalSyntax) footer(w *bufio.Writer, cal *component) error {
+	_, err := w.WriteString("</components></" + strings.ToLower(cal.name) + ">\n</icalendar>\n")
+	return err
+}
+
+func writeXCalComponent(w *bufio.Writer, c *component) {
+	name := strings.ToLower(c.name)
+	w.WriteString("<" + name + ">")
+	writeXCalProperties(w, c)
+	if len(c.subs) > 0 {
+		w.WriteString("<components>")
+		for _, sub := range c.subs {
+			writeXCalComponent(w, sub)
+		}
+		w.WriteString("</components>")
+	}
+	w.WriteString("</" + name + ">")
+}
+
+func writeXCalProperties(w *bufio.Writer, c *component) {
+	if len(c.props) == 0 {
+		return
+	}
+	w.WriteString("<properties>")
+	for _, l := range c.props {
+		writeXCalProperty(w, toProperty(l))
+	}
+	w.WriteString("</properties>")
+}
+
+func writeXCalProperty(w *bufio.Writer, p property) {
+	w.WriteString("<" + p.name + ">")
+	if len(p.params) > 0 {
+		w.WriteString("<parameters>")
+		for _, pa := range p.params {
+			w.WriteString("<" + pa.name + ">")
+			writeXCalElement(w, "text", pa.value)
+			w.WriteString("</" + pa.name + ">")
+		}
+		w.WriteString("</parameters>")
+	}
+	switch {
+	case p.typ == "recur":
+		w.WriteString("<recur>")
+		for _, part := range p.recur {
+			for _, v := range part.values {
+				writeXCalElement(w, part.name, v)
+			}
+		}
+		w.WriteString("</recur>")
+	case p.name == "geo" && len(p.values) == 2:
+		writeXCalElement(w, "latitude", p.values[0])
+		writeXCalElement(w, "longitude", p.values[1])
+	default:
+		for _, v := range p.values {
+			writeXCalElement(w, p.typ, v)
+		}
+	}
+	w.WriteString("</" + p.name + ">")
+}
+
+func writeXCalElement(w *bufio.Writer, name, text string) {
+	w.WriteString("<" + name + ">")
+	_ = xml.EscapeText(w, []byte(text))
+	w.WriteString("</" + name + ">")
+}
+
+// xmlNode is an element of an XML document, by its local name.
+type xmlNode struct {
+	name     string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// parseXML reads the XML document from r into a tree of elements.
+func parseXML(r io.Reader) (*xmlNode, error) {
+	dec := xml.NewDecoder(r)
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: tok.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(tok)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+	return root, nil
+}
+
+// DecodeXCal parses an xCal (RFC 6321) document and returns the events found.
+func DecodeXCal(r io.Reader) ([]model.Event, error) {
+	return NewFormatDecoder(r, FormatXCal).decodeAll()
+}
+
+// xcalLines reads an xCal document as unfolded lines of the text format.
+func xcalLines(r io.Reader) ([]string, error) {
+	root, err := parseXML(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading xcal: %w", err)
+	}
+	calendars := []*xmlNode{root}
+	if root.name == "icalendar" {
+		calendars = root.children
+	} else if root.name != "vcalendar" {
+		return nil, fmt.Errorf("reading xcal: unexpected root element %q", root.name)
+	}
+	var lines []string
+	for _, n := range calendars {
+		lines = append(lines, parseXCalComponent(n).lines()...)
+	}
+	return lines, nil
+}
+
+func parseXCalComponent(n *xmlNode) *component {
+	c := &component{name: strings.ToUpper(n.name)}
+	if props := n.child("properties"); props != nil {
+		for _, pn := range props.children {
+			p := parseXCalProperty(pn)
+			c.props = append(c.props, p.contentLine())
+		}
+	}
+	if subs := n.child("components"); subs != nil {
+		for _, sn := range subs.children {
+			c.subs = append(c.subs, parseXCalComponent(sn))
+		}
+	}
+	return c
+}
+
+func parseXCalProperty(n *xmlNode) property {
+	p := property{name: strings.ToLower(n.name), typ: "unknown"}
+	for _, vn := range n.children {
+		switch vn.name {
+		case "parameters":
+			for _, pn := range vn.children {
+				var values []string
+				for _, v := range pn.children {
+					values = append(values, v.text.String())
+				}
+				p.params = append(p.params, param{strings.ToLower(pn.name), strings.Join(values, ",")})
+			}
+		case "latitude", "longitude":
+			p.typ = "float"
+			p.values = append(p.values, strings.TrimSpace(vn.text.String()))
+		case "recur":
+			p.typ = "recur"
+			for _, part := range vn.children {
+				name := strings.ToLower(part.name)
+				value := strings.TrimSpace(part.text.String())
+				if len(p.recur) > 0 && p.recur[len(p.recur)-1].name == name {
+					last := &p.recur[len(p.recur)-1]
+					last.values = append(last.values, value)
+				} else {
+					p.recur = append(p.recur, recurPart{name, []string{value}})
+				}
+			}
+		default:
+			p.typ = strings.ToLower(vn.name)
+			p.values = append(p.values, vn.text.String())
+		}
+	}
+	return p
+}
@@ -0,0 +1,113 @@
+package ical
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeXCal(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, EncodeFormat(&buf, FormatXCal, roundTripEvents()[:2]))
+	out := buf.String()
+
+	// well-formed
+	dec := xml.NewDecoder(strings.NewReader(out))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err, out)
+	}
+
+	assert.True(t, strings.HasPrefix(out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<icalendar xmlns="urn:ietf:params:xml:ns:icalendar-2.0">`))
+	assert.Contains(t, out, "<version><text>2.0</text></version>")
+	assert.Contains(t, out, "<dtstart><date-time>2026-02-17T14:00:00Z</date-time></dtstart>")
+	assert.Contains(t, out, "<summary><text>Team &lt;Meeting&gt;, weekly</text></summary>")
+	assert.Contains(t, out, "<geo><latitude>59.329300</latitude><longitude>18.068600</longitude></geo>")
+	assert.Contains(t, out, "<rrule><recur><freq>WEEKLY</freq><interval>2</interval>"+
+		"<until>2026-06-30T00:00:00Z</until><byday>TU</byday><byday>TH</byday></recur></rrule>")
+	assert.Contains(t, out, "<components><valarm><properties><action><text>DISPLAY</text></action>")
+	assert.Contains(t, out, "<dtstart><date>2026-04-03</date></dtstart>")
+}
+
+func TestDecodeXCal(t *testing.T) {
+	// Based on the example of RFC 6321 §B.2.
+	input := `<?xml version="1.0" encoding="utf-8"?>
+<icalendar xmlns="urn:ietf:params:xml:ns:icalendar-2.0">
+  <vcalendar>
+    <properties>
+      <prodid><text>-//Example Inc.//Example Calendar//EN</text></prodid>
+      <version><text>2.0</text></version>
+    </properties>
+    <components>
+      <vtimezone>
+        <properties><tzid><text>US/Eastern</text></tzid></properties>
+        <components>
+          <standard><properties><tzoffsetto><utc-offset>-05:00</utc-offset></tzoffsetto></properties></standard>
+        </components>
+      </vtimezone>
+      <vevent>
+        <properties>
+          <dtstamp><date-time>2008-02-05T19:12:24Z</date-time></dtstamp>
+          <dtstart>
+            <parameters><tzid><text>US/Eastern</text></tzid></parameters>
+            <date-time>2008-10-06T09:00:00</date-time>
+          </dtstart>
+          <dtend>
+            <parameters><tzid><text>US/Eastern</text></tzid></parameters>
+            <date-time>2008-10-06T10:00:00</date-time>
+          </dtend>
+          <summary><text>Planning &amp; review; part 1</text></summary>
+          <geo><latitude>37.386013</latitude><longitude>-122.082932</longitude></geo>
+          <rrule>
+            <recur><freq>MONTHLY</freq><count>10</count><byday>1MO</byday><byday>3MO</byday></recur>
+          </rrule>
+          <uid><text>4088E990AD89CB3DBB484909</text></uid>
+        </properties>
+        <components>
+          <valarm>
+            <properties>
+              <action><text>DISPLAY</text></action>
+              <trigger><duration>-PT30M</duration></trigger>
+            </properties>
+          </valarm>
+        </components>
+      </vevent>
+    </components>
+  </vcalendar>
+</icalendar>`
+	events, err := DecodeXCal(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	e := events[0]
+	assert.Equal(t, "Planning &amp; review; part 1", e.Title, "text is sanitized as in the text format")
+	assert.Equal(t, "2008-10-06T13:00:00Z", e.StartTime)
+	assert.Equal(t, "2008-10-06T14:00:00Z", e.EndTime)
+	require.NotNil(t, e.Latitude)
+	assert.InDelta(t, 37.386013, *e.Latitude, 1e-9)
+	assert.Equal(t, "MONTHLY", e.RecurrenceFreq)
+	assert.Equal(t, 10, e.RecurrenceCount)
+	assert.Equal(t, "1MO,3MO", e.RecurrenceByDay)
+	assert.Equal(t, 30, e.ReminderMinutes)
+	assert.Equal(t, "4088E990AD89CB3DBB484909", e.ImportUID)
+}
+
+func TestDecodeXCal_Invalid(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`<icalendar><vcalendar>`,
+		`<html><body/></html>`,
+	} {
+		_, err := DecodeXCal(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "operation", "code")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency\nin seconds.", []float64{0.1, 1}, "operation")
+	r.NewGaugeFunc("test_items", "Items.", []string{"name"}, func() ([]Sample, error) {
+		return []Sample{{[]string{`b"\`}, 2}, {[]string{"a"}, 1}}, nil
+	})
+
+	requests.Inc("get", "200")
+	requests.Inc("get", "200")
+	requests.Inc("get", "404")
+	latency.Observe(0.05, "get")
+	latency.Observe(0.5, "get")
+	latency.Observe(5, "get")
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP test_items Items.
+# TYPE test_items gauge
+test_items{name="a"} 1
+test_items{name="b\"\\"} 2
+# HELP test_latency_seconds Latency\nin seconds.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{operation="get",le="0.1"} 1
+test_latency_seconds_bucket{operation="get",le="1"} 2
+test_latency_seconds_bucket{operation="get",le="+Inf"} 3
+test_latency_seconds_sum{operation="get"} 5.55
+test_latency_seconds_count{operation="get"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{operation="get",code="200"} 2
+test_requests_total{operation="get",code="404"} 1
+`, rec.Body.String())
+}
+
+func TestRegistry_Errors(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test.")
+	assert.Panics(t, func() { r.NewCounterVec("test_total", "Again.") })
+	assert.Panics(t, func() { c.Inc("unexpected") })
+
+	r.NewGaugeFunc("test_gauge", "Test.", nil, func() ([]Sample, error) { return nil, errors.New("boom") })
+	var sb strings.Builder
+	require.ErrorContains(t, r.Write(&sb), "boom")
+}
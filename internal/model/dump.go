@@ -0,0 +1,26 @@
+package model
+
+// DumpVersion is the version of the JSON dump format written by export. Restore
+// accepts dumps up to this version.
+const DumpVersion = 1
+
+// Dump is the full contents of an instance: calendars, events (including
+// recurrence overrides), feed subscriptions and preferences. IDs are the ones
+// of the exporting instance and are remapped on restore. The secrets of feeds
+// are not included.
+type Dump struct {
+	Version     int
+	ExportedAt  string
+	Calendars   []Calendar
+	Events      []Event
+	Feeds       []Feed
+	Preferences map[string]string
+}
+
+// DumpResult counts what a restore added.
+type DumpResult struct {
+	Calendars   int
+	Events      int
+	Feeds       int
+	Preferences int
+}
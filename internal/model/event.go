@@ -33,6 +33,7 @@ type Event struct {
 	Categories              string
 	URL                     string
 	ReminderMinutes         int
+	Transparent             bool // does not block time (TRANSP:TRANSPARENT)
 	Location                string
 	Latitude                *float64
 	Longitude               *float64
@@ -41,6 +42,9 @@ type Event struct {
 	IcsUID                  string
 	CreatedAt               string
 	UpdatedAt               string
+	DeletedAt               string // set while the event is in the trash
+	Revision                int64  // incremented by every update
+	Snippet                 string // highlighted excerpt, set on search results
 	ImportUID               string // transient field for iCal import UID matching
 }
 
@@ -1,7 +1,48 @@
 package model
 
+// Feed types.
+const (
+	FeedTypeICS    = "ics"    // an iCalendar file fetched over HTTP
+	FeedTypeCalDAV = "caldav" // a CalDAV calendar collection
+)
+
+// Feed authentication types.
+const (
+	FeedAuthNone   = ""
+	FeedAuthBasic  = "basic"  // Username and FeedCredentials.Password
+	FeedAuthBearer = "bearer" // FeedCredentials.Token
+)
+
+// Feed rule fields, that the pattern of a rule is matched against.
+const (
+	FeedRuleSummary    = "summary"
+	FeedRuleCategories = "categories"
+	FeedRuleLocation   = "location"
+)
+
+// Feed rule actions.
+const (
+	FeedRuleInclude     = "include" // import only the events matched by an include rule
+	FeedRuleExclude     = "exclude"
+	FeedRuleRename      = "rename" // Value is the new title, with $1 for the first submatch
+	FeedRuleColor       = "color"  // Value is a color
+	FeedRuleDropAlarms  = "drop_alarms"
+	FeedRuleTransparent = "transparent"
+	FeedRuleShift       = "shift" // Value is an ISO 8601 duration, optionally negative
+)
+
+// FeedRule transforms the events of a feed matched by Pattern, a regular
+// expression, before they are imported. An empty pattern matches every event.
+type FeedRule struct {
+	Field   string `json:"field"`
+	Pattern string `json:"pattern,omitempty"`
+	Action  string `json:"action"`
+	Value   string `json:"value,omitempty"`
+}
+
 type Feed struct {
 	ID                     int64
+	Type                   string
 	URL                    string
 	CalendarID             int64
 	CalendarName           string
@@ -9,6 +50,25 @@ type Feed struct {
 	LastRefreshedAt        string
 	LastError              string
 	Enabled                bool
-	CreatedAt              string
-	UpdatedAt              string
+	AuthType               string
+	Username               string
+	// HeaderNames are the names of the custom headers in the credentials.
+	HeaderNames []string
+	// Credentials are the FeedCredentials, sealed with the secret key.
+	Credentials string
+	// CollectionURL is the CalDAV calendar collection discovered from URL.
+	CollectionURL string
+	// SyncToken is the CalDAV sync token of the last refresh.
+	SyncToken string
+	// Rules are applied in order to the events of the feed.
+	Rules     []FeedRule
+	CreatedAt string
+	UpdatedAt string
+}
+
+// FeedCredentials are the secrets of a feed, stored encrypted.
+type FeedCredentials struct {
+	Password string            `json:"password,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
 }
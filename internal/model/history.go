@@ -0,0 +1,36 @@
+package model
+
+// Change actions recorded in the event history.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Change sources recorded in the event history.
+const (
+	SourceUI     = "ui"
+	SourceAPI    = "api"
+	SourceFeed   = "feed"
+	SourceImport = "import"
+)
+
+// Actor identifies who made a change and through which channel.
+type Actor struct {
+	Name   string
+	Source string
+}
+
+// HistoryEntry is one recorded change to an event. Old is nil for creations
+// and New is nil for deletions.
+type HistoryEntry struct {
+	ID        int64
+	EventID   int64
+	Action    string
+	Actor     string
+	Source    string
+	Old       *Event
+	New       *Event
+	CreatedAt string
+}
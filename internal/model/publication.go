@@ -0,0 +1,27 @@
+package model
+
+// Fields of events that can be hidden from a publication.
+const (
+	PublicationDescription = "description"
+	PublicationLocation    = "location"
+	PublicationURL         = "url"
+	PublicationCategories  = "categories"
+)
+
+// PublicationFields lists every field that can be hidden from a publication.
+var PublicationFields = []string{PublicationDescription, PublicationLocation, PublicationURL, PublicationCategories}
+
+// Publication makes the events of some calendars readable without
+// authentication, as an HTML agenda and an iCalendar feed, by anyone who knows
+// Token.
+type Publication struct {
+	ID           int64
+	Token        string
+	Name         string
+	CalendarIDs  []int64
+	HiddenFields []string // fields left out of the published events
+	TimeZone     string   // IANA time zone of the agenda page
+	Enabled      bool
+	CreatedAt    string
+	UpdatedAt    string
+}
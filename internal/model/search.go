@@ -0,0 +1,49 @@
+package model
+
+// Search fields that a term can be restricted to.
+const (
+	SearchFieldTitle       = "title"
+	SearchFieldDescription = "description"
+	SearchFieldLocation    = "location"
+	SearchFieldCategories  = "categories"
+)
+
+// SearchQuery is a parsed search query. An event matches when it matches every
+// clause and none of the excluded terms, and starts within [After, Before).
+type SearchQuery struct {
+	Clauses []SearchClause
+	Exclude []SearchTerm
+	After   string // RFC 3339, empty for no bound
+	Before  string // RFC 3339, empty for no bound
+}
+
+// SearchClause matches when any of its terms match.
+type SearchClause []SearchTerm
+
+// SearchTerm is a word or phrase, optionally restricted to one field.
+type SearchTerm struct {
+	Field  string // one of the SearchField constants, empty for any field
+	Text   string
+	Prefix bool // match words starting with the last word of Text
+}
+
+// IsEmpty reports whether the query has nothing to match on.
+func (q SearchQuery) IsEmpty() bool {
+	return len(q.Clauses) == 0
+}
+
+// EventFilter selects stored events for a bulk operation. An event matches
+// when it is in one of the calendars, overlaps [From, To) and matches the
+// query. A recurring series matches as a whole when any of its instances
+// overlaps [From, To). Empty fields match everything.
+type EventFilter struct {
+	CalendarIDs []int64
+	From        string // RFC 3339
+	To          string // RFC 3339
+	Query       SearchQuery
+}
+
+// IsEmpty reports whether the filter matches every event.
+func (f EventFilter) IsEmpty() bool {
+	return len(f.CalendarIDs) == 0 && f.From == "" && f.To == "" && f.Query.IsEmpty() && f.Query.After == "" && f.Query.Before == ""
+}
@@ -0,0 +1,16 @@
+package model
+
+// EventChange is the latest change of an event in the change log. Seq
+// increases with every change, across all events.
+type EventChange struct {
+	Seq     int64
+	EventID int64
+	Deleted bool
+}
+
+// SyncResult lists the events changed since a sync token.
+type SyncResult struct {
+	Changed []int64
+	Deleted []int64
+	Token   string
+}
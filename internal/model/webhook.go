@@ -0,0 +1,47 @@
+package model
+
+// Webhook event types.
+const (
+	WebhookEventCreated      = "event.created"
+	WebhookEventUpdated      = "event.updated"
+	WebhookEventDeleted      = "event.deleted"
+	WebhookFeedRefreshFailed = "feed.refresh_failed"
+)
+
+// WebhookEventTypes lists every webhook event type.
+var WebhookEventTypes = []string{WebhookEventCreated, WebhookEventUpdated, WebhookEventDeleted, WebhookFeedRefreshFailed}
+
+// Webhook is a subscription to be notified of changes by HTTP POST requests
+// to URL, signed with Secret.
+type Webhook struct {
+	ID         int64
+	URL        string
+	Secret     string
+	EventTypes []string
+	Enabled    bool
+	CreatedAt  string
+	UpdatedAt  string
+}
+
+// Webhook delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one notification to a webhook, queued until it has been
+// delivered or has failed too many times.
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int64
+	EventType     string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt string
+	LastStatus    int // HTTP status of the last attempt, 0 if there was no response
+	LastError     string
+	CreatedAt     string
+	DeliveredAt   string
+}
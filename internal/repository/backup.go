@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backupPrefix and backupSuffix frame the timestamp in the names of the
+// scheduled backups written by BackupToDir.
+const (
+	backupPrefix = "mycal-"
+	backupSuffix = ".sqlite"
+)
+
+// Backup writes a consistent snapshot of db to dest using VACUUM INTO, which is
+// safe while the server is running. The snapshot is written next to dest and
+// renamed into place, so an existing file at dest is only replaced once the
+// backup is complete.
+func Backup(db *sql.DB, dest string) error {
+	tmp := dest + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := db.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("vacuum into %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// BackupToDir writes a timestamped backup of db into dir and then removes the
+// oldest backups so that at most keep remain (keep <= 0 keeps all). It returns
+// the path of the new backup.
+func BackupToDir(db *sql.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := backupPrefix + time.Now().UTC().Format("20060102T150405Z") + backupSuffix
+	dest := filepath.Join(dir, name)
+	if err := Backup(db, dest); err != nil {
+		return "", err
+	}
+	if keep <= 0 {
+		return dest, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dest, err
+	}
+	var backups []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), backupSuffix) {
+			backups = append(backups, e.Name())
+		}
+	}
+	// The timestamp format sorts chronologically.
+	slices.Sort(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return dest, err
+		}
+		backups = backups[1:]
+	}
+	return dest, nil
+}
+
+// CheckBackup verifies that path is an intact mycal database that this version
+// can open, and returns its schema version. Backups from older versions are
+// accepted since they are migrated on the next start.
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}).String())
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%s is not a SQLite database: %w", path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%s is corrupt: %s", path, result)
+	}
+	if !tableExists(db, "events") {
+		return 0, fmt.Errorf("%s is not a mycal database", path)
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("read user_version: %w", err)
+	}
+	if version > schemaVersion {
+		return 0, fmt.Errorf("%s has schema version %d, but this version of mycal only supports up to %d", path, version, schemaVersion)
+	}
+	return version, nil
+}
+
+// RestoreBackup replaces the database at dest with the backup at src after
+// checking it with CheckBackup. The replaced database is kept as
+// dest + ".pre-restore". It fails if dest is in use, such as by a running
+// server, since the database is locked exclusively for the restore.
+func RestoreBackup(src, dest string) error {
+	if _, err := CheckBackup(src); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		db, err := lockExclusive(dest)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		// Snapshot through SQLite rather than copying the file, so changes still
+		// in the write-ahead log are included.
+		if err := Backup(db, dest+".pre-restore"); err != nil {
+			return fmt.Errorf("save current database: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Copy first, in case src is the backup that is about to be overwritten.
+	tmp := dest + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// A leftover write-ahead log belongs to the old database and must not be
+	// applied on top of the restored one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dest + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dest)
+}
+
+// lockExclusive opens the database at path with a single connection that
+// holds an exclusive lock on it until it is closed, so that no other
+// connection can read or write it meanwhile. It fails at once if the database
+// is in use.
+func lockExclusive(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: path}).String())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	// In exclusive locking mode, the lock taken by a transaction is kept after
+	// it ends.
+	for _, stmt := range []string{"PRAGMA busy_timeout = 0", "PRAGMA locking_mode = EXCLUSIVE", "BEGIN EXCLUSIVE", "COMMIT"} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s is in use, stop the server before restoring: %w", path, err)
+		}
+	}
+	return db, nil
+}
+
+func copyFile(src, dest string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func newFileRepo(t *testing.T, path string) (*sql.DB, *SQLiteRepository) {
+	t.Helper()
+	db, err := OpenDB(path, 5000)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	repo, err := NewSQLiteRepository(db)
+	require.NoError(t, err)
+	return db, repo
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "mycal.sqlite")
+	db, repo := newFileRepo(t, dbPath)
+	require.NoError(t, repo.Create(&model.Event{Title: "Kept", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}))
+
+	// Back up through a read-only connection while the database is open for writing.
+	ro, err := sql.Open("sqlite", dbPath+"?mode=ro")
+	require.NoError(t, err)
+	backupPath := filepath.Join(dir, "backup.sqlite")
+	require.NoError(t, Backup(ro, backupPath))
+	require.NoError(t, ro.Close())
+
+	version, err := CheckBackup(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, schemaVersion, version)
+
+	require.NoError(t, repo.Create(&model.Event{Title: "Lost", StartTime: "2026-03-16T10:00:00Z", EndTime: "2026-03-16T11:00:00Z"}))
+	require.NoError(t, db.Close())
+
+	require.NoError(t, RestoreBackup(backupPath, dbPath))
+	assert.FileExists(t, dbPath+".pre-restore")
+
+	_, repo = newFileRepo(t, dbPath)
+	events, err := repo.ListAll(nil)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Kept", events[0].Title)
+}
+
+func TestRestoreBackupRefusesDatabaseInUse(t *testing.T) {
+	dir := t.TempDir()
+	// Characters that have a meaning in a URI must not break the file names.
+	db, _ := newFileRepo(t, filepath.Join(dir, "backup.sqlite"))
+	require.NoError(t, db.Close())
+	backupPath := filepath.Join(dir, "backup #1?.sqlite")
+	require.NoError(t, os.Rename(filepath.Join(dir, "backup.sqlite"), backupPath))
+	_, err := CheckBackup(backupPath)
+	require.NoError(t, err)
+
+	dbPath := filepath.Join(dir, "mycal.sqlite")
+	_, repo := newFileRepo(t, dbPath)
+	require.NoError(t, repo.Create(&model.Event{Title: "Live", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}))
+
+	assert.ErrorContains(t, RestoreBackup(backupPath, dbPath), "in use")
+	assert.NoFileExists(t, dbPath+".pre-restore")
+	events, err := repo.ListAll(nil)
+	require.NoError(t, err)
+	assert.Len(t, events, 1, "the database is left alone")
+}
+
+func TestCheckBackupRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "future.sqlite")
+	db, _ := newFileRepo(t, path)
+	_, err := db.Exec("PRAGMA user_version = 999")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = CheckBackup(path)
+	assert.ErrorContains(t, err, "schema version 999")
+	assert.Error(t, RestoreBackup(path, filepath.Join(t.TempDir(), "mycal.sqlite")))
+}
+
+func TestCheckBackupRejectsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	notSQLite := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(notSQLite, []byte("hello, this is not a database file at all"), 0600))
+	_, err := CheckBackup(notSQLite)
+	assert.Error(t, err)
+
+	otherDB := filepath.Join(dir, "other.sqlite")
+	db, err := sql.Open("sqlite", otherDB)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE things (id INTEGER)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	_, err = CheckBackup(otherDB)
+	assert.ErrorContains(t, err, "not a mycal database")
+}
+
+func TestBackupToDirRotates(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := newFileRepo(t, filepath.Join(dir, "mycal.sqlite"))
+	backupDir := filepath.Join(dir, "backups")
+	require.NoError(t, os.MkdirAll(backupDir, 0700))
+	for _, name := range []string{"mycal-20260101T000000Z.sqlite", "mycal-20260102T000000Z.sqlite", "mycal-20260103T000000Z.sqlite", "unrelated.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(backupDir, name), nil, 0600))
+	}
+
+	dest, err := BackupToDir(db, backupDir, 2)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(backupDir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"mycal-20260103T000000Z.sqlite", filepath.Base(dest), "unrelated.txt"}, names)
+}
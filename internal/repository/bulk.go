@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// FindEvents returns up to limit stored events matching the filter, in start
+// time order, skipping the first offset of them. Recurring series are returned as stored and overrides as
+// separate rows. Like in Search, a recurring series is kept when it starts
+// before the end of the range; whether any of its instances fall within the
+// range is up to the caller to find out.
+func (r *SQLiteRepository) FindEvents(filter model.EventFilter, limit, offset int) ([]model.Event, error) {
+	var sb strings.Builder
+	var args []any
+
+	sb.WriteString(`SELECT ` + selectColumnsBase + fromEventsJoin)
+	if !filter.Query.IsEmpty() {
+		sb.WriteString(` JOIN events_fts ON e.id = events_fts.rowid WHERE events_fts MATCH ?`)
+		args = append(args, ftsQuery(filter.Query))
+	} else {
+		sb.WriteString(` WHERE 1=1`)
+	}
+	sb.WriteString(notDeleted)
+	if filter.To != "" {
+		sb.WriteString(` AND e.start_time < ?`)
+		args = append(args, filter.To)
+	}
+	if filter.From != "" {
+		sb.WriteString(` AND (e.recurrence_freq != '' OR e.end_time > ?)`)
+		args = append(args, filter.From)
+	}
+	if filter.Query.After != "" {
+		sb.WriteString(` AND (e.recurrence_freq != '' OR e.start_time >= ?)`)
+		args = append(args, filter.Query.After)
+	}
+	if filter.Query.Before != "" {
+		sb.WriteString(` AND e.start_time < ?`)
+		args = append(args, filter.Query.Before)
+	}
+	filterSQL, filterArgs := calendarIDFilter(filter.CalendarIDs)
+	sb.WriteString(filterSQL)
+	args = append(args, filterArgs...)
+	sb.WriteString(` ORDER BY e.start_time, e.id LIMIT ? OFFSET ?`)
+	args = append(args, limit, offset)
+
+	rows, err := r.q.Query(sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
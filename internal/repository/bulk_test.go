@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestInTx(t *testing.T) {
+	repo := newTestRepo(t)
+	kept := createTestEvent(t, repo, "Kept", "", "2026-03-15T10:00:00Z", "2026-03-15T11:00:00Z")
+
+	failure := errors.New("failure")
+	err := repo.InTx(func(tx EventRepository) error {
+		e := &model.Event{Title: "Rolled back", StartTime: "2026-03-16T10:00:00Z", EndTime: "2026-03-16T11:00:00Z"}
+		require.NoError(t, tx.Create(e))
+		require.NoError(t, tx.Delete(kept.ID))
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	events, err := repo.ListAll(nil)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, kept.ID, events[0].ID)
+
+	var created int64
+	err = repo.InTx(func(tx EventRepository) error {
+		e := &model.Event{Title: "Committed", StartTime: "2026-03-16T10:00:00Z", EndTime: "2026-03-16T11:00:00Z"}
+		if err := tx.Create(e); err != nil {
+			return err
+		}
+		created = e.ID
+		// Methods with transactions of their own join the enclosing one.
+		if err := tx.Delete(kept.ID); err != nil {
+			return err
+		}
+		return tx.Restore(kept.ID)
+	})
+	require.NoError(t, err)
+	events, err = repo.ListAll(nil)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	got, err := repo.GetByID(created)
+	require.NoError(t, err)
+	assert.Equal(t, "Committed", got.Title)
+}
+
+func TestFindEvents(t *testing.T) {
+	repo := newTestRepo(t)
+	cal := &model.Calendar{Name: "Work", Color: "red"}
+	require.NoError(t, repo.CreateCalendar(cal))
+	march := createTestEvent(t, repo, "Planning", "", "2026-03-15T10:00:00Z", "2026-03-15T11:00:00Z")
+	april := createTestEvent(t, repo, "Review", "", "2026-04-15T10:00:00Z", "2026-04-15T11:00:00Z")
+	april.CalendarID = cal.ID
+	april.Categories = "work"
+	require.NoError(t, repo.Update(april))
+
+	ids := func(events []model.Event) []int64 {
+		var result []int64
+		for _, e := range events {
+			result = append(result, e.ID)
+		}
+		return result
+	}
+
+	events, err := repo.FindEvents(model.EventFilter{From: "2026-03-01T00:00:00Z", To: "2026-04-01T00:00:00Z"}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{march.ID}, ids(events))
+
+	events, err = repo.FindEvents(model.EventFilter{CalendarIDs: []int64{cal.ID}}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{april.ID}, ids(events))
+
+	query := model.SearchQuery{Clauses: []model.SearchClause{{{Field: model.SearchFieldCategories, Text: "work"}}}}
+	events, err = repo.FindEvents(model.EventFilter{Query: query, To: "2026-04-01T00:00:00Z"}, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	events, err = repo.FindEvents(model.EventFilter{Query: query}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{april.ID}, ids(events))
+
+	events, err = repo.FindEvents(model.EventFilter{From: "2026-01-01T00:00:00Z"}, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{march.ID}, ids(events), "limited, in start time order")
+	events, err = repo.FindEvents(model.EventFilter{From: "2026-01-01T00:00:00Z"}, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{april.ID}, ids(events), "next page")
+
+	series := &model.Event{Title: "Standup", StartTime: "2026-02-02T09:00:00Z", EndTime: "2026-02-02T09:30:00Z", RecurrenceFreq: "WEEKLY"}
+	require.NoError(t, repo.Create(series))
+	events, err = repo.FindEvents(model.EventFilter{From: "2026-03-01T00:00:00Z", To: "2026-04-01T00:00:00Z"}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{series.ID, march.ID}, ids(events), "series starting before the range are kept")
+}
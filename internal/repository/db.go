@@ -1,8 +1,9 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 
 	"github.com/mikaelstaldal/go-server-common/sqlite"
 )
@@ -10,9 +11,10 @@ import (
 // OpenDB opens the SQLite database at path, enables foreign keys, sets the
 // busy_timeout pragma (0 = skip), applies any extraPragmas, and runs pending
 // schema migrations. Connection setup (DSN, pragmas, WAL mode) is delegated to
-// the shared sqlite package; the imperative v1 schema migration — which
-// reconciles pre-user_version legacy databases and so cannot be expressed as a
-// flat statement list — is applied by initSchema.
+// the shared sqlite package; the schema is migrated by initSchema from the
+// registry in migrations.go, since the v1 step — which reconciles
+// pre-user_version legacy databases — cannot be expressed as a flat statement
+// list.
 func OpenDB(path string, busyTimeout int, extraPragmas ...string) (*sql.DB, error) {
 	// Passing no migrations leaves migration to initSchema while still letting
 	// the shared package build the DSN, bake in pragmas, and enable WAL mode.
@@ -29,76 +31,40 @@ func OpenDB(path string, busyTimeout int, extraPragmas ...string) (*sql.DB, erro
 	return db, nil
 }
 
-// execQuerier is satisfied by both *sql.DB and *sql.Tx so migration helpers can
-// run against either.
-type execQuerier interface {
-	Exec(query string, args ...any) (sql.Result, error)
-	QueryRow(query string, args ...any) *sql.Row
-}
-
-// initSchema applies pending schema migrations using PRAGMA user_version.
-// Each if-block is independent so multiple migrations can apply in one startup.
-// When the database is already at the latest version no statements run, so it is
-// safe to call against a read-only connection.
-func initSchema(db *sql.DB) error {
-	var version int
-	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
-		return fmt.Errorf("read user_version: %w", err)
+// EnsureWritable checks that the database can be reached and is not
+// read-only.
+func EnsureWritable(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
 	}
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(conn)
 
-	if version < 1 {
-		// A pre-existing events table means this database was created before the
-		// user_version scheme; it may carry legacy columns that need reconciling.
-		legacy := tableExists(db, "events")
-
-		tx, err := db.Begin()
-		if err != nil {
-			return fmt.Errorf("begin migration to v1: %w", err)
-		}
-		defer tx.Rollback()
-
-		for _, stmt := range schemaV1 {
-			if _, err := tx.Exec(stmt); err != nil {
-				preview := stmt
-				if len(preview) > 60 {
-					preview = preview[:60]
-				}
-				return fmt.Errorf("schema v1 %q: %w", preview, err)
-			}
-		}
-
-		// Sync the FTS index with the existing events before reconcileLegacy runs
-		// any UPDATE: the update triggers delete-then-insert each touched row in
-		// events_fts, which corrupts the index if the row was never indexed. A
-		// no-op on a fresh, empty database.
-		if _, err := tx.Exec(`INSERT INTO events_fts(events_fts) VALUES('rebuild')`); err != nil {
-			return fmt.Errorf("rebuild events_fts: %w", err)
-		}
-
-		if legacy {
-			if err := reconcileLegacy(tx); err != nil {
-				return fmt.Errorf("reconcile legacy schema: %w", err)
+	return conn.Raw(func(c any) error {
+		if d, ok := c.(interface{ IsReadOnly(string) (bool, error) }); ok {
+			// Use "main" for the primary database schema
+			isReadOnly, err := d.IsReadOnly("main")
+			if err != nil {
+				return err
 			}
-		}
-
-		// Indexes on ics_uid/calendar_id must come after reconcileLegacy, which
-		// adds those columns to legacy tables that predate them.
-		for _, stmt := range schemaV1Indexes {
-			if _, err := tx.Exec(stmt); err != nil {
-				return fmt.Errorf("schema v1 index %q: %w", stmt, err)
+			if isReadOnly {
+				return errors.New("database is read-only")
 			}
+			return nil
 		}
 
-		if _, err := tx.Exec("PRAGMA user_version = 1"); err != nil {
-			return fmt.Errorf("set user_version = 1: %w", err)
-		}
-
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("commit migration to v1: %w", err)
-		}
-	}
+		return errors.New("cannot check if database is read-only")
+	})
+}
 
-	return nil
+// execQuerier is satisfied by both *sql.DB and *sql.Tx so migration helpers can
+// run against either.
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
 // tableExists reports whether a table with the given name is present.
@@ -269,3 +235,175 @@ var schemaV1Indexes = []string{
 	`CREATE INDEX IF NOT EXISTS idx_events_calendar_id ON events(calendar_id)`,
 	`CREATE INDEX IF NOT EXISTS idx_feeds_calendar_id ON feeds(calendar_id)`,
 }
+
+// schemaV2 adds the per-event change history (version 1 → 2). Snapshots are
+// stored as JSON so the table does not need to follow later column additions.
+// There is no foreign key on event_id since history outlives deleted events.
+var schemaV2 = []string{
+	`CREATE TABLE IF NOT EXISTS event_history (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id   INTEGER NOT NULL,
+		action     TEXT NOT NULL,
+		actor      TEXT NOT NULL DEFAULT '',
+		source     TEXT NOT NULL DEFAULT '',
+		old_values TEXT NOT NULL DEFAULT '',
+		new_values TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_event_history_event_id ON event_history(event_id)`,
+}
+
+// schemaV3 adds the deleted_at tombstone used by the trash (version 2 → 3). An
+// empty string means the event is live.
+var schemaV3 = []string{
+	`ALTER TABLE events ADD COLUMN deleted_at TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS idx_events_deleted_at ON events(deleted_at)`,
+}
+
+// schemaV4 adds location and categories to the full-text index (version 3 → 4).
+// An external-content FTS5 table cannot gain columns, so the index and its
+// triggers are recreated and rebuilt from the events table.
+var schemaV4 = []string{
+	`DROP TRIGGER IF EXISTS events_ai`,
+	`DROP TRIGGER IF EXISTS events_ad`,
+	`DROP TRIGGER IF EXISTS events_au`,
+	`DROP TABLE IF EXISTS events_fts`,
+	`CREATE VIRTUAL TABLE events_fts USING fts5(
+		title, description, location, categories, content='events', content_rowid='id'
+	)`,
+	`CREATE TRIGGER events_ai AFTER INSERT ON events BEGIN
+		INSERT INTO events_fts(rowid, title, description, location, categories) VALUES (new.id, new.title, new.description, new.location, new.categories);
+	END`,
+	`CREATE TRIGGER events_ad AFTER DELETE ON events BEGIN
+		INSERT INTO events_fts(events_fts, rowid, title, description, location, categories) VALUES('delete', old.id, old.title, old.description, old.location, old.categories);
+	END`,
+	`CREATE TRIGGER events_au AFTER UPDATE ON events BEGIN
+		INSERT INTO events_fts(events_fts, rowid, title, description, location, categories) VALUES('delete', old.id, old.title, old.description, old.location, old.categories);
+		INSERT INTO events_fts(rowid, title, description, location, categories) VALUES (new.id, new.title, new.description, new.location, new.categories);
+	END`,
+	`INSERT INTO events_fts(events_fts) VALUES('rebuild')`,
+}
+
+// schemaV5 adds the change log for incremental sync (version 4 → 5). Each
+// event has one row, which the triggers replace on every change so that its
+// seq is the latest; AUTOINCREMENT keeps seq increasing even across deletes.
+// Overrides are logged as changes of their recurring event, and deleted is
+// set when the event is gone or in the trash.
+var schemaV5 = []string{
+	`CREATE TABLE event_changes (
+		seq      INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL UNIQUE,
+		deleted  INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TRIGGER event_changes_ai AFTER INSERT ON events BEGIN
+		DELETE FROM event_changes WHERE event_id = COALESCE(new.recurrence_parent_id, new.id);
+		INSERT INTO event_changes (event_id, deleted) VALUES (COALESCE(new.recurrence_parent_id, new.id),
+			NOT EXISTS (SELECT 1 FROM events WHERE id = COALESCE(new.recurrence_parent_id, new.id) AND deleted_at = ''));
+	END`,
+	`CREATE TRIGGER event_changes_au AFTER UPDATE ON events BEGIN
+		DELETE FROM event_changes WHERE event_id = COALESCE(new.recurrence_parent_id, new.id);
+		INSERT INTO event_changes (event_id, deleted) VALUES (COALESCE(new.recurrence_parent_id, new.id),
+			NOT EXISTS (SELECT 1 FROM events WHERE id = COALESCE(new.recurrence_parent_id, new.id) AND deleted_at = ''));
+	END`,
+	`CREATE TRIGGER event_changes_ad AFTER DELETE ON events BEGIN
+		DELETE FROM event_changes WHERE event_id = COALESCE(old.recurrence_parent_id, old.id);
+		INSERT INTO event_changes (event_id, deleted) VALUES (COALESCE(old.recurrence_parent_id, old.id),
+			NOT EXISTS (SELECT 1 FROM events WHERE id = COALESCE(old.recurrence_parent_id, old.id) AND deleted_at = ''));
+	END`,
+	`INSERT INTO event_changes (event_id, deleted)
+		SELECT id, deleted_at != '' FROM events WHERE recurrence_parent_id IS NULL ORDER BY id`,
+}
+
+// schemaV6 adds webhook subscriptions and their delivery queue (version 5 →
+// 6). event_types is a comma-separated list. Deliveries keep their payload, so
+// that retries send exactly what was queued.
+var schemaV6 = []string{
+	`CREATE TABLE webhooks (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		url         TEXT NOT NULL,
+		secret      TEXT NOT NULL,
+		event_types TEXT NOT NULL DEFAULT '',
+		enabled     INTEGER NOT NULL DEFAULT 1,
+		created_at  TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+		updated_at  TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+	)`,
+	`CREATE TABLE webhook_deliveries (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id      INTEGER NOT NULL,
+		event_type      TEXT NOT NULL,
+		payload         TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT 'pending',
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+		last_status     INTEGER NOT NULL DEFAULT 0,
+		last_error      TEXT NOT NULL DEFAULT '',
+		created_at      TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+		delivered_at    TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`,
+	`CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id)`,
+}
+
+// schemaV7 adds a revision counter to events (version 6 → 7), for optimistic
+// concurrency control. It starts at 1 and is incremented by every update.
+var schemaV7 = []string{
+	`ALTER TABLE events ADD COLUMN revision INTEGER NOT NULL DEFAULT 1`,
+}
+
+// schemaV8 adds CalDAV feeds (version 7 → 8). credentials holds the secrets
+// of a feed encrypted, never in plain text.
+var schemaV8 = []string{
+	`ALTER TABLE feeds ADD COLUMN type TEXT NOT NULL DEFAULT 'ics'`,
+	`ALTER TABLE feeds ADD COLUMN username TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE feeds ADD COLUMN credentials TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE feeds ADD COLUMN collection_url TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE feeds ADD COLUMN sync_token TEXT NOT NULL DEFAULT ''`,
+}
+
+// schemaV9 adds authentication to all feeds (version 8 → 9): basic, which the
+// CalDAV feeds that have credentials use, or bearer, and custom headers. Only
+// the names of the headers are stored in plain text, comma-separated.
+var schemaV9 = []string{
+	`ALTER TABLE feeds ADD COLUMN auth_type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE feeds ADD COLUMN header_names TEXT NOT NULL DEFAULT ''`,
+	`UPDATE feeds SET auth_type = 'basic' WHERE username != '' OR credentials != ''`,
+}
+
+// schemaV10 adds transparent events and feed rules (version 9 → 10). rules is
+// a JSON array. feed_documents keeps the document of the last refresh of each
+// feed, to preview rules against.
+var schemaV10 = []string{
+	`ALTER TABLE events ADD COLUMN transparent INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE feeds ADD COLUMN rules TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE feed_documents (
+		feed_id    INTEGER PRIMARY KEY,
+		data       BLOB NOT NULL,
+		fetched_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+	)`,
+}
+
+// schemaV11 adds publications, read-only public views of calendars (version
+// 10 → 11). calendar_ids and hidden_fields are comma-separated.
+var schemaV11 = []string{
+	`CREATE TABLE publications (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		token         TEXT NOT NULL UNIQUE,
+		name          TEXT NOT NULL,
+		calendar_ids  TEXT NOT NULL,
+		hidden_fields TEXT NOT NULL DEFAULT '',
+		time_zone     TEXT NOT NULL DEFAULT 'UTC',
+		enabled       INTEGER NOT NULL DEFAULT 1,
+		created_at    TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+		updated_at    TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+	)`,
+}
+
+// schemaV12 keeps the hrefs of the objects read from each CalDAV feed
+// (version 11 → 12), which are not read again.
+var schemaV12 = []string{
+	`CREATE TABLE feed_objects (
+		feed_id INTEGER NOT NULL,
+		href    TEXT NOT NULL,
+		PRIMARY KEY (feed_id, href)
+	)`,
+}
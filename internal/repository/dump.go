@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// ExportDump reads calendars, events, feeds and preferences in a single read
+// transaction so the dump is consistent. Events in the trash are left out.
+func (r *SQLiteRepository) ExportDump() (*model.Dump, error) {
+	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	dump := &model.Dump{
+		Version:     model.DumpVersion,
+		ExportedAt:  time.Now().UTC().Format(time.RFC3339),
+		Calendars:   []model.Calendar{},
+		Events:      []model.Event{},
+		Feeds:       []model.Feed{},
+		Preferences: map[string]string{},
+	}
+
+	rows, err := tx.Query(`SELECT id, name, color FROM calendars ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c model.Calendar
+		if err := rows.Scan(&c.ID, &c.Name, &c.Color); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dump.Calendars = append(dump.Calendars, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT ` + selectColumnsBase + fromEventsJoin + ` WHERE 1=1` + notDeleted + ` ORDER BY e.id`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dump.Events = append(dump.Events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT id, type, url, calendar_id, refresh_interval_minutes, last_refreshed_at, last_error, enabled, username, rules, created_at, updated_at FROM feeds ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f model.Feed
+		var rules string
+		if err := rows.Scan(&f.ID, &f.Type, &f.URL, &f.CalendarID, &f.RefreshIntervalMinutes, &f.LastRefreshedAt, &f.LastError, &f.Enabled, &f.Username, &rules, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if rules != "" {
+			if err := json.Unmarshal([]byte(rules), &f.Rules); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("feed %d: %w", f.ID, err)
+			}
+		}
+		dump.Feeds = append(dump.Feeds, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT key, value FROM preferences`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dump.Preferences[k] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return dump, tx.Commit()
+}
+
+// RestoreDump adds the contents of a dump in a single transaction, so either
+// everything is restored or nothing is. Calendars are matched by name and
+// reused, the default calendar (ID 0) included. Events and feeds get new IDs;
+// references to calendars and to the parents of recurrence overrides are
+// remapped accordingly. Feeds whose URL is already subscribed are skipped.
+// Preferences overwrite existing values. The IDs in dump are updated in place
+// to the new ones.
+func (r *SQLiteRepository) RestoreDump(dump *model.Dump) (*model.DumpResult, error) {
+	result := &model.DumpResult{}
+	if err := r.transaction(func(tx *sql.Tx) error { return restoreDump(tx, dump, result) }); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func restoreDump(tx *sql.Tx, dump *model.Dump, result *model.DumpResult) error {
+	var err error
+	calendarIDs := map[int64]int64{0: 0}
+	for i := range dump.Calendars {
+		cal := &dump.Calendars[i]
+		var id int64
+		if cal.ID == 0 {
+			_, err = tx.Exec(`UPDATE calendars SET color = ? WHERE id = 0`, cal.Color)
+		} else {
+			err = tx.QueryRow(`SELECT id FROM calendars WHERE name = ?`, cal.Name).Scan(&id)
+			if errors.Is(err, sql.ErrNoRows) {
+				err = tx.QueryRow(`INSERT INTO calendars (name, color) VALUES (?, ?) RETURNING id`, cal.Name, cal.Color).Scan(&id)
+				result.Calendars++
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("calendar %q: %w", cal.Name, err)
+		}
+		calendarIDs[cal.ID] = id
+		cal.ID = id
+	}
+	mapCalendar := func(id int64) (int64, error) {
+		newID, ok := calendarIDs[id]
+		if !ok {
+			return 0, fmt.Errorf("unknown calendar %d", id)
+		}
+		return newID, nil
+	}
+
+	// Parents before overrides, so the parent IDs are known when the overrides
+	// are inserted.
+	eventIDs := make(map[int64]int64, len(dump.Events))
+	for _, overrides := range []bool{false, true} {
+		for i := range dump.Events {
+			e := &dump.Events[i]
+			if (e.RecurrenceParentID != nil) != overrides {
+				continue
+			}
+			oldID := e.ID
+			if e.CalendarID, err = mapCalendar(e.CalendarID); err != nil {
+				return fmt.Errorf("event %d: %w", oldID, err)
+			}
+			if e.RecurrenceParentID != nil {
+				parentID, ok := eventIDs[*e.RecurrenceParentID]
+				if !ok {
+					return fmt.Errorf("event %d: override of unknown event %d", oldID, *e.RecurrenceParentID)
+				}
+				e.RecurrenceParentID = &parentID
+			}
+			createdAt, updatedAt := e.CreatedAt, e.UpdatedAt
+			if err := tx.QueryRow(insertEventSQL, insertEventArgs(nil, e)...).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt, &e.Revision); err != nil {
+				return fmt.Errorf("event %d: %w", oldID, err)
+			}
+			if createdAt != "" && updatedAt != "" {
+				if _, err := tx.Exec(`UPDATE events SET created_at = ?, updated_at = ? WHERE id = ?`, createdAt, updatedAt, e.ID); err != nil {
+					return fmt.Errorf("event %d: %w", oldID, err)
+				}
+				e.CreatedAt, e.UpdatedAt = createdAt, updatedAt
+			}
+			eventIDs[oldID] = e.ID
+			result.Events++
+		}
+	}
+
+	for i := range dump.Feeds {
+		f := &dump.Feeds[i]
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM feeds WHERE url = ?`, f.URL).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		if f.CalendarID, err = mapCalendar(f.CalendarID); err != nil {
+			return fmt.Errorf("feed %d: %w", f.ID, err)
+		}
+		rules, err := feedRules(f.Rules)
+		if err != nil {
+			return fmt.Errorf("feed %q: %w", f.URL, err)
+		}
+		// The password is not in the dump, but a username still means basic
+		// authentication, as for a feed created with a username only.
+		authType := model.FeedAuthNone
+		if f.Username != "" {
+			authType = model.FeedAuthBasic
+		}
+		if err := tx.QueryRow(
+			`INSERT INTO feeds (type, url, calendar_id, refresh_interval_minutes, last_refreshed_at, last_error, enabled, auth_type, username, rules) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at`,
+			feedType(f.Type), f.URL, f.CalendarID, f.RefreshIntervalMinutes, f.LastRefreshedAt, f.LastError, f.Enabled, authType, f.Username, rules,
+		).Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			return fmt.Errorf("feed %q: %w", f.URL, err)
+		}
+		result.Feeds++
+	}
+
+	for k, v := range dump.Preferences {
+		if _, err := tx.Exec(`INSERT INTO preferences (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, k, v); err != nil {
+			return err
+		}
+		result.Preferences++
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestExportAndRestoreDump(t *testing.T) {
+	src := newTestRepo(t)
+	work := &model.Calendar{Name: "Work", Color: "tomato"}
+	require.NoError(t, src.CreateCalendar(work))
+	parent, override := createSeries(t, src)
+	parent.CalendarID = work.ID
+	require.NoError(t, src.Update(parent))
+	trashed := &model.Event{Title: "Trashed", StartTime: "2026-03-05T10:00:00Z", EndTime: "2026-03-05T11:00:00Z"}
+	require.NoError(t, src.Create(trashed))
+	require.NoError(t, src.Delete(trashed.ID))
+	rules := []model.FeedRule{{Field: model.FeedRuleSummary, Pattern: "^Lunch", Action: model.FeedRuleExclude}}
+	require.NoError(t, src.CreateFeed(&model.Feed{URL: "https://example.com/work.ics", CalendarID: work.ID, RefreshIntervalMinutes: 60, Enabled: true, Rules: rules,
+		AuthType: model.FeedAuthBasic, Username: "me", Credentials: "sealed"}))
+	require.NoError(t, src.SetPreference("someKey", "someValue"))
+
+	dump, err := src.ExportDump()
+	require.NoError(t, err)
+	assert.Equal(t, model.DumpVersion, dump.Version)
+	assert.Len(t, dump.Calendars, 2)
+	assert.Len(t, dump.Events, 2, "events in the trash are not exported")
+	assert.Len(t, dump.Feeds, 1)
+	assert.Equal(t, "someValue", dump.Preferences["someKey"])
+
+	// Restore into an instance that already has events and a calendar with a
+	// different ID, so every ID has to be remapped.
+	dest := newTestRepo(t)
+	require.NoError(t, dest.CreateCalendar(&model.Calendar{Name: "Home", Color: "green"}))
+	for range 3 {
+		require.NoError(t, dest.Create(&model.Event{Title: "Existing", StartTime: "2026-01-01T10:00:00Z", EndTime: "2026-01-01T11:00:00Z"}))
+	}
+
+	result, err := dest.RestoreDump(dump)
+	require.NoError(t, err)
+	assert.Equal(t, &model.DumpResult{Calendars: 1, Events: 2, Feeds: 1, Preferences: 1}, result)
+
+	destWork, err := dest.GetCalendarByName("Work")
+	require.NoError(t, err)
+	require.NotNil(t, destWork)
+	assert.NotEqual(t, work.ID, destWork.ID)
+	assert.Equal(t, "tomato", destWork.Color)
+
+	recurring, err := dest.ListRecurring("2026-04-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	require.Len(t, recurring, 1)
+	newParent := recurring[0]
+	assert.NotEqual(t, parent.ID, newParent.ID)
+	assert.Equal(t, destWork.ID, newParent.CalendarID)
+	assert.Equal(t, parent.CreatedAt, newParent.CreatedAt)
+
+	newOverride, err := dest.GetOverride(newParent.ID, override.RecurrenceOriginalStart)
+	require.NoError(t, err)
+	require.NotNil(t, newOverride, "override is linked to the remapped parent")
+	assert.Equal(t, override.Title, newOverride.Title)
+
+	feeds, err := dest.ListFeeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, destWork.ID, feeds[0].CalendarID)
+	assert.Equal(t, rules, feeds[0].Rules)
+	assert.Equal(t, model.FeedAuthBasic, feeds[0].AuthType, "a username means basic authentication")
+	assert.Equal(t, "me", feeds[0].Username)
+	assert.Empty(t, feeds[0].Credentials, "secrets are not in a dump")
+
+	// Restoring again reuses the calendar and skips the subscribed feed.
+	dump, err = src.ExportDump()
+	require.NoError(t, err)
+	result, err = dest.RestoreDump(dump)
+	require.NoError(t, err)
+	assert.Zero(t, result.Calendars)
+	assert.Zero(t, result.Feeds)
+}
+
+func TestRestoreDumpIsAtomic(t *testing.T) {
+	repo := newTestRepo(t)
+	missingParent := int64(42)
+	dump := &model.Dump{
+		Version: model.DumpVersion,
+		Events: []model.Event{
+			{ID: 1, Title: "Fine", StartTime: "2026-03-05T10:00:00Z", EndTime: "2026-03-05T11:00:00Z"},
+			{ID: 2, Title: "Orphan", StartTime: "2026-03-05T10:00:00Z", EndTime: "2026-03-05T11:00:00Z", RecurrenceParentID: &missingParent, RecurrenceOriginalStart: "2026-03-05T10:00:00Z"},
+		},
+	}
+
+	_, err := repo.RestoreDump(dump)
+	assert.ErrorContains(t, err, "override of unknown event 42")
+
+	all, err := repo.ListAll(nil)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
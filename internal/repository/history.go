@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// History repository methods
+
+func (r *SQLiteRepository) AddHistory(entry *model.HistoryEntry) error {
+	oldValues, err := marshalSnapshot(entry.Old)
+	if err != nil {
+		return err
+	}
+	newValues, err := marshalSnapshot(entry.New)
+	if err != nil {
+		return err
+	}
+	return r.q.QueryRow(
+		`INSERT INTO event_history (event_id, action, actor, source, old_values, new_values) VALUES (?, ?, ?, ?, ?, ?) RETURNING id, created_at`,
+		entry.EventID, entry.Action, entry.Actor, entry.Source, oldValues, newValues,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+func (r *SQLiteRepository) ListHistory(eventID int64) ([]model.HistoryEntry, error) {
+	rows, err := r.q.Query(
+		`SELECT id, event_id, action, actor, source, old_values, new_values, created_at FROM event_history WHERE event_id = ? ORDER BY id`, eventID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		h, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, h)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLiteRepository) GetHistoryEntry(id int64) (*model.HistoryEntry, error) {
+	h, err := scanHistoryEntry(r.q.QueryRow(
+		`SELECT id, event_id, action, actor, source, old_values, new_values, created_at FROM event_history WHERE id = ?`, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func scanHistoryEntry(scanner interface{ Scan(...any) error }) (model.HistoryEntry, error) {
+	var h model.HistoryEntry
+	var oldValues, newValues string
+	if err := scanner.Scan(&h.ID, &h.EventID, &h.Action, &h.Actor, &h.Source, &oldValues, &newValues, &h.CreatedAt); err != nil {
+		return h, err
+	}
+	var err error
+	if h.Old, err = unmarshalSnapshot(oldValues); err != nil {
+		return h, err
+	}
+	if h.New, err = unmarshalSnapshot(newValues); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// marshalSnapshot encodes an event snapshot as JSON; nil is stored as an empty string.
+func marshalSnapshot(e *model.Event) (string, error) {
+	if e == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func unmarshalSnapshot(s string) (*model.Event, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var e model.Event
+	if err := json.Unmarshal([]byte(s), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
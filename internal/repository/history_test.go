@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	repo := newTestRepo(t)
+	old := &model.Event{ID: 7, Title: "Before", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}
+	updated := *old
+	updated.Title = "After"
+
+	entry := &model.HistoryEntry{EventID: 7, Action: model.ActionUpdate, Actor: "alice", Source: model.SourceUI, Old: old, New: &updated}
+	require.NoError(t, repo.AddHistory(entry))
+	assert.NotZero(t, entry.ID)
+	assert.NotEmpty(t, entry.CreatedAt)
+	require.NoError(t, repo.AddHistory(&model.HistoryEntry{EventID: 7, Action: model.ActionDelete, Source: model.SourceAPI, Old: &updated}))
+	require.NoError(t, repo.AddHistory(&model.HistoryEntry{EventID: 8, Action: model.ActionCreate, Source: model.SourceFeed, New: old}))
+
+	entries, err := repo.ListHistory(7)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, model.ActionUpdate, entries[0].Action)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, model.SourceUI, entries[0].Source)
+	require.NotNil(t, entries[0].Old)
+	assert.Equal(t, "Before", entries[0].Old.Title)
+	require.NotNil(t, entries[0].New)
+	assert.Equal(t, "After", entries[0].New.Title)
+	assert.Equal(t, model.ActionDelete, entries[1].Action)
+	assert.Nil(t, entries[1].New)
+
+	got, err := repo.GetHistoryEntry(entry.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, int64(7), got.EventID)
+
+	missing, err := repo.GetHistoryEntry(9999)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestCreateKeepsExplicitID(t *testing.T) {
+	repo := newTestRepo(t)
+	e := &model.Event{ID: 42, Title: "Restored", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}
+	require.NoError(t, repo.Create(e))
+	assert.Equal(t, int64(42), e.ID)
+
+	got, err := repo.GetByID(42)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "Restored", got.Title)
+}
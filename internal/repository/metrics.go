@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/metrics"
+)
+
+var queryDuration = metrics.Default.NewHistogramVec("mycal_db_query_duration_seconds",
+	"Duration of SQLite statements run by the repository, by kind of statement (query or exec).",
+	[]float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "kind")
+
+// timedQuerier records the duration of every statement run through q. The
+// duration of a query is until its first row is ready, not until all rows
+// have been read.
+type timedQuerier struct {
+	q execQuerier
+}
+
+func (t timedQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	defer observeQuery("exec", time.Now())
+	return t.q.Exec(query, args...)
+}
+
+func (t timedQuerier) Query(query string, args ...any) (*sql.Rows, error) {
+	defer observeQuery("query", time.Now())
+	return t.q.Query(query, args...)
+}
+
+func (t timedQuerier) QueryRow(query string, args ...any) *sql.Row {
+	defer observeQuery("query", time.Now())
+	return t.q.QueryRow(query, args...)
+}
+
+func observeQuery(kind string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), kind)
+}
+
+// RegisterMetrics registers the gauges that are read from the database on
+// every scrape.
+func (r *SQLiteRepository) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("mycal_events", "Number of events per calendar, not counting the trash.",
+		[]string{"calendar_id", "calendar"}, r.countEventsByCalendar)
+}
+
+func (r *SQLiteRepository) countEventsByCalendar() ([]metrics.Sample, error) {
+	rows, err := r.q.Query(`SELECT cal.id, cal.name, COUNT(e.id) FROM calendars cal
+		LEFT JOIN events e ON e.calendar_id = cal.id AND e.deleted_at = ''
+		GROUP BY cal.id ORDER BY cal.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []metrics.Sample
+	for rows.Next() {
+		var id int64
+		var name string
+		var count float64
+		if err := rows.Scan(&id, &name, &count); err != nil {
+			return nil, err
+		}
+		samples = append(samples, metrics.Sample{LabelValues: []string{strconv.FormatInt(id, 10), name}, Value: count})
+	}
+	return samples, rows.Err()
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/metrics"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestEventMetrics(t *testing.T) {
+	repo := newTestRepo(t)
+	work := &model.Calendar{Name: "Work", Color: "orange"}
+	require.NoError(t, repo.CreateCalendar(work))
+	createTestEvent(t, repo, "A", "", "2026-03-15T10:00:00Z", "2026-03-15T11:00:00Z")
+	deleted := createTestEvent(t, repo, "B", "", "2026-03-16T10:00:00Z", "2026-03-16T11:00:00Z")
+	require.NoError(t, repo.Delete(deleted.ID))
+	for _, title := range []string{"C", "D"} {
+		e := &model.Event{Title: title, StartTime: "2026-03-17T10:00:00Z", EndTime: "2026-03-17T11:00:00Z", CalendarID: work.ID}
+		require.NoError(t, repo.Create(e))
+	}
+
+	registry := metrics.NewRegistry()
+	repo.RegisterMetrics(registry)
+	var sb strings.Builder
+	require.NoError(t, registry.Write(&sb))
+	assert.Contains(t, sb.String(), `mycal_events{calendar_id="0",calendar="Default"} 1`+"\n")
+	assert.Contains(t, sb.String(), fmt.Sprintf(`mycal_events{calendar_id="%d",calendar="Work"} 2`, work.ID)+"\n")
+}
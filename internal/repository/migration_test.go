@@ -2,7 +2,9 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,53 +21,7 @@ func TestMigrateLegacyDatabase(t *testing.T) {
 	// ics_uid absent, user_version left at 0.
 	raw, err := sql.Open("sqlite", dbPath)
 	require.NoError(t, err)
-	_, err = raw.Exec(`
-		CREATE TABLE events (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			title TEXT NOT NULL,
-			description TEXT NOT NULL DEFAULT '',
-			start_time TEXT NOT NULL,
-			end_time TEXT NOT NULL,
-			all_day INTEGER NOT NULL DEFAULT 0,
-			color TEXT NOT NULL DEFAULT '',
-			recurrence_freq TEXT NOT NULL DEFAULT '',
-			recurrence_count INTEGER NOT NULL DEFAULT 0,
-			recurrence_until TEXT NOT NULL DEFAULT '',
-			recurrence_interval INTEGER NOT NULL DEFAULT 0,
-			recurrence_by_day TEXT NOT NULL DEFAULT '',
-			recurrence_by_monthday TEXT NOT NULL DEFAULT '',
-			recurrence_by_month TEXT NOT NULL DEFAULT '',
-			exdates TEXT NOT NULL DEFAULT '',
-			rdates TEXT NOT NULL DEFAULT '',
-			recurrence_parent_id INTEGER,
-			recurrence_original_start TEXT NOT NULL DEFAULT '',
-			duration TEXT NOT NULL DEFAULT '',
-			categories TEXT NOT NULL DEFAULT '',
-			url TEXT NOT NULL DEFAULT '',
-			reminder_minutes INTEGER NOT NULL DEFAULT 0,
-			location TEXT NOT NULL DEFAULT '',
-			latitude REAL,
-			longitude REAL,
-			calendar_name TEXT NOT NULL DEFAULT '',
-			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
-			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
-		);
-		CREATE TABLE preferences (key TEXT PRIMARY KEY, value TEXT NOT NULL DEFAULT '');
-		CREATE TABLE feeds (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			url TEXT NOT NULL,
-			calendar_name TEXT NOT NULL DEFAULT '',
-			refresh_interval_minutes INTEGER NOT NULL DEFAULT 60,
-			last_refreshed_at TEXT NOT NULL DEFAULT '',
-			last_error TEXT NOT NULL DEFAULT '',
-			enabled INTEGER NOT NULL DEFAULT 1,
-			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
-			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
-		);
-		INSERT INTO events (title, start_time, end_time, calendar_name) VALUES ('Work meeting', '2026-03-15T10:00:00Z', '2026-03-15T11:00:00Z', 'Work');
-		INSERT INTO feeds (url, calendar_name) VALUES ('https://example.com/cal.ics', 'Work');
-		INSERT INTO preferences (key, value) VALUES ('defaultEventColor', 'tomato');
-	`)
+	_, err = raw.Exec(legacyV0Schema)
 	require.NoError(t, err)
 	require.NoError(t, raw.Close())
 
@@ -76,7 +32,7 @@ func TestMigrateLegacyDatabase(t *testing.T) {
 
 	var version int
 	require.NoError(t, db.QueryRow("PRAGMA user_version").Scan(&version))
-	assert.Equal(t, 1, version, "should be stamped at v1")
+	assert.Equal(t, schemaVersion, version, "should be stamped at the latest version")
 
 	// calendar_name dropped from both tables.
 	assert.False(t, columnExists(db, "events", "calendar_name"))
@@ -108,7 +64,7 @@ func TestMigrateLegacyDatabase(t *testing.T) {
 	assert.Zero(t, prefCount)
 }
 
-// TestFreshDatabaseIsVersioned verifies a brand-new database lands at v1.
+// TestFreshDatabaseIsVersioned verifies a brand-new database lands at the latest version.
 func TestFreshDatabaseIsVersioned(t *testing.T) {
 	db, err := OpenDB(filepath.Join(t.TempDir(), "fresh.sqlite"), 5000)
 	require.NoError(t, err)
@@ -116,10 +72,240 @@ func TestFreshDatabaseIsVersioned(t *testing.T) {
 
 	var version int
 	require.NoError(t, db.QueryRow("PRAGMA user_version").Scan(&version))
-	assert.Equal(t, 1, version)
+	assert.Equal(t, schemaVersion, version)
 
 	// WAL mode is active on a file-backed database.
 	var mode string
 	require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&mode))
 	assert.Equal(t, "wal", mode)
 }
+
+// TestUpgradeFixtureThroughEveryVersion upgrades the legacy fixture one
+// migration at a time and checks the schema and the data after each step.
+func TestUpgradeFixtureThroughEveryVersion(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "fixture.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(legacyV0Schema)
+	require.NoError(t, err)
+
+	checks := map[int]func(t *testing.T){
+		1: func(t *testing.T) {
+			assert.True(t, tableExists(db, "calendars"))
+			assert.True(t, columnExists(db, "events", "calendar_id"))
+			assert.False(t, columnExists(db, "events", "calendar_name"))
+		},
+		2: func(t *testing.T) {
+			assert.True(t, tableExists(db, "event_history"))
+		},
+		3: func(t *testing.T) {
+			assert.True(t, columnExists(db, "events", "deleted_at"))
+		},
+		4: func(t *testing.T) {
+			assert.True(t, columnExists(db, "events_fts", "location"))
+			var n int
+			require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM events_fts WHERE events_fts MATCH 'meeting'`).Scan(&n))
+			assert.Equal(t, 1, n, "existing events are indexed")
+		},
+		5: func(t *testing.T) {
+			var n int
+			require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM event_changes WHERE deleted = 0`).Scan(&n))
+			assert.Equal(t, 1, n, "existing events are in the change log")
+		},
+		6: func(t *testing.T) {
+			assert.True(t, tableExists(db, "webhooks"))
+			assert.True(t, tableExists(db, "webhook_deliveries"))
+		},
+		7: func(t *testing.T) {
+			var revision int
+			require.NoError(t, db.QueryRow(`SELECT revision FROM events WHERE title = 'Work meeting'`).Scan(&revision))
+			assert.Equal(t, 1, revision, "existing events start at revision 1")
+		},
+		8: func(t *testing.T) {
+			var feedType string
+			require.NoError(t, db.QueryRow(`SELECT type FROM feeds`).Scan(&feedType))
+			assert.Equal(t, "ics", feedType, "existing feeds are .ics feeds")
+			assert.True(t, columnExists(db, "feeds", "credentials"))
+		},
+		9: func(t *testing.T) {
+			var authType string
+			require.NoError(t, db.QueryRow(`SELECT auth_type FROM feeds`).Scan(&authType))
+			assert.Equal(t, "", authType, "feeds without credentials have no authentication")
+		},
+		10: func(t *testing.T) {
+			var transparent bool
+			require.NoError(t, db.QueryRow(`SELECT transparent FROM events LIMIT 1`).Scan(&transparent))
+			assert.False(t, transparent)
+			var rules string
+			require.NoError(t, db.QueryRow(`SELECT rules FROM feeds`).Scan(&rules))
+			assert.Empty(t, rules)
+		},
+		11: func(t *testing.T) {
+			assert.True(t, tableExists(db, "publications"))
+		},
+		12: func(t *testing.T) {
+			assert.True(t, tableExists(db, "feed_objects"))
+		},
+	}
+	require.Len(t, checks, len(migrations), "add a check for the new migration")
+
+	for n := 1; n <= len(migrations); n++ {
+		t.Run(migrations[n-1].name, func(t *testing.T) {
+			require.NoError(t, migrate(db, migrations[:n]))
+
+			version, err := readUserVersion(db)
+			require.NoError(t, err)
+			assert.Equal(t, n, version)
+
+			applied, err := AppliedMigrations(db)
+			require.NoError(t, err)
+			require.Len(t, applied, n)
+			for i, m := range applied {
+				assert.Equal(t, migrations[i].info(), m)
+			}
+
+			checks[n](t)
+
+			var title string
+			require.NoError(t, db.QueryRow(`SELECT e.title FROM events e JOIN calendars c ON c.id = e.calendar_id WHERE c.name = 'Work'`).Scan(&title))
+			assert.Equal(t, "Work meeting", title, "data survives every step")
+		})
+	}
+
+	// Running the full registry again is a no-op.
+	require.NoError(t, migrate(db, migrations))
+}
+
+func TestMigrationChecksumMismatch(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	require.NoError(t, migrate(db, migrations))
+
+	changed := slices.Clone(migrations)
+	changed[1].statements = append(slices.Clone(changed[1].statements), `CREATE INDEX idx_extra ON event_history(actor)`)
+	err = migrate(db, changed)
+	assert.ErrorContains(t, err, "migration 2 (event history) has changed")
+}
+
+func TestFailingMigrationRollsBack(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	require.NoError(t, migrate(db, migrations))
+
+	broken := append(slices.Clone(migrations), migration{
+		version: len(migrations) + 1,
+		name:    "broken",
+		statements: []string{
+			`CREATE TABLE half_done (id INTEGER PRIMARY KEY)`,
+			`ALTER TABLE no_such_table ADD COLUMN x TEXT`,
+		},
+	})
+	err = migrate(db, broken)
+	assert.ErrorContains(t, err, fmt.Sprintf("migration %d (broken)", len(broken)))
+
+	version, err := readUserVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, schemaVersion, version)
+	assert.False(t, tableExists(db, "half_done"), "the failed step is rolled back")
+	applied, err := AppliedMigrations(db)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+}
+
+func TestDryRunMigrations(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "dryrun.sqlite")
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(legacyV0Schema)
+	require.NoError(t, err)
+	require.NoError(t, migrate(db, migrations[:1]))
+
+	current, pending, err := DryRunMigrations(db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+	require.Len(t, pending, len(migrations)-1)
+	assert.Equal(t, "event history", pending[0].Name)
+
+	version, err := readUserVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version, "a dry run changes nothing")
+	assert.False(t, tableExists(db, "event_history"))
+
+	require.NoError(t, migrate(db, migrations))
+	current, pending, err = DryRunMigrations(db)
+	require.NoError(t, err)
+	assert.Equal(t, schemaVersion, current)
+	assert.Empty(t, pending)
+}
+
+// TestRecordMigrationsOfOlderDatabase verifies that a database migrated before
+// schema_migrations existed gets its applied steps recorded.
+func TestRecordMigrationsOfOlderDatabase(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	require.NoError(t, migrate(db, migrations))
+	_, err = db.Exec(`DROP TABLE schema_migrations`)
+	require.NoError(t, err)
+
+	require.NoError(t, migrate(db, migrations))
+	applied, err := AppliedMigrations(db)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+}
+
+// legacyV0Schema is a database from before the user_version scheme: the
+// obsolete calendar_name columns, no calendar_id or ics_uid, user_version 0.
+const legacyV0Schema = `
+		CREATE TABLE events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			start_time TEXT NOT NULL,
+			end_time TEXT NOT NULL,
+			all_day INTEGER NOT NULL DEFAULT 0,
+			color TEXT NOT NULL DEFAULT '',
+			recurrence_freq TEXT NOT NULL DEFAULT '',
+			recurrence_count INTEGER NOT NULL DEFAULT 0,
+			recurrence_until TEXT NOT NULL DEFAULT '',
+			recurrence_interval INTEGER NOT NULL DEFAULT 0,
+			recurrence_by_day TEXT NOT NULL DEFAULT '',
+			recurrence_by_monthday TEXT NOT NULL DEFAULT '',
+			recurrence_by_month TEXT NOT NULL DEFAULT '',
+			exdates TEXT NOT NULL DEFAULT '',
+			rdates TEXT NOT NULL DEFAULT '',
+			recurrence_parent_id INTEGER,
+			recurrence_original_start TEXT NOT NULL DEFAULT '',
+			duration TEXT NOT NULL DEFAULT '',
+			categories TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			reminder_minutes INTEGER NOT NULL DEFAULT 0,
+			location TEXT NOT NULL DEFAULT '',
+			latitude REAL,
+			longitude REAL,
+			calendar_name TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+		);
+		CREATE TABLE preferences (key TEXT PRIMARY KEY, value TEXT NOT NULL DEFAULT '');
+		CREATE TABLE feeds (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			calendar_name TEXT NOT NULL DEFAULT '',
+			refresh_interval_minutes INTEGER NOT NULL DEFAULT 60,
+			last_refreshed_at TEXT NOT NULL DEFAULT '',
+			last_error TEXT NOT NULL DEFAULT '',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+		);
+		INSERT INTO events (title, start_time, end_time, calendar_name) VALUES ('Work meeting', '2026-03-15T10:00:00Z', '2026-03-15T11:00:00Z', 'Work');
+		INSERT INTO feeds (url, calendar_name) VALUES ('https://example.com/cal.ics', 'Work');
+		INSERT INTO preferences (key, value) VALUES ('defaultEventColor', 'tomato');
+`
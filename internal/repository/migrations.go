@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// migration is one numbered, forward-only schema change. Each step runs in its
+// own transaction together with the bump of PRAGMA user_version and its row in
+// schema_migrations, so a failing step leaves the database at the previous
+// version.
+type migration struct {
+	version int
+	name    string
+	// statements are executed in order, unless apply is set. Steps that need
+	// more than a flat statement list provide apply; their statements are then
+	// only used for the checksum.
+	statements []string
+	apply      func(tx *sql.Tx) error
+}
+
+// migrations is the registry of every schema change, in order. Append new
+// steps at the end and never edit a step that has been released: the
+// checksums of applied steps are verified on every start.
+var migrations = []migration{
+	{version: 1, name: "initial schema", statements: slices.Concat(schemaV1, schemaV1Indexes), apply: migrateV1},
+	{version: 2, name: "event history", statements: schemaV2},
+	{version: 3, name: "trash", statements: schemaV3},
+	{version: 4, name: "search location and categories", statements: schemaV4},
+	{version: 5, name: "event change log", statements: schemaV5},
+	{version: 6, name: "webhooks", statements: schemaV6},
+	{version: 7, name: "event revisions", statements: schemaV7},
+	{version: 8, name: "caldav feeds", statements: schemaV8},
+	{version: 9, name: "feed authentication", statements: schemaV9},
+	{version: 10, name: "feed rules", statements: schemaV10},
+	{version: 11, name: "publications", statements: schemaV11},
+	{version: 12, name: "caldav feed objects", statements: schemaV12},
+}
+
+// schemaVersion is the user_version of a database with every migration applied.
+var schemaVersion = migrations[len(migrations)-1].version
+
+// MigrationInfo describes a migration step.
+type MigrationInfo struct {
+	Version  int
+	Name     string
+	Checksum string
+}
+
+// checksum identifies the contents of a migration step.
+func (m migration) checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %s\n", m.version, m.name)
+	for _, stmt := range m.statements {
+		h.Write([]byte(stmt))
+		h.Write([]byte("\n;\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m migration) info() MigrationInfo {
+	return MigrationInfo{Version: m.version, Name: m.name, Checksum: m.checksum()}
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	checksum   TEXT NOT NULL,
+	applied_at TEXT NOT NULL DEFAULT ''
+)`
+
+// initSchema applies pending schema migrations from the registry. When the
+// database is already at the latest version and its applied migrations are
+// recorded, no statements run, so it is safe to call against a read-only
+// connection.
+func initSchema(db *sql.DB) error {
+	return migrate(db, migrations)
+}
+
+// migrate verifies the applied steps of registry against the database and then
+// applies the pending ones, each in its own transaction.
+func migrate(db *sql.DB, registry []migration) error {
+	version, err := checkMigrations(db, registry)
+	if err != nil {
+		return err
+	}
+	for _, m := range registry[version:] {
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DryRunMigrations reports the migrations that OpenDB would apply to db, after
+// trying them all in a transaction that is rolled back. The database is left
+// unchanged; errors are those that the real migration would run into.
+func DryRunMigrations(db *sql.DB) (current int, pending []MigrationInfo, err error) {
+	current, err = readUserVersion(db)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := validateRegistry(migrations, current); err != nil {
+		return current, nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return current, nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := verifyChecksums(tx, migrations, current); err != nil {
+		return current, nil, err
+	}
+	for _, m := range migrations[current:] {
+		if err := runMigration(tx, m); err != nil {
+			return current, pending, err
+		}
+		pending = append(pending, m.info())
+	}
+	return current, pending, nil
+}
+
+// AppliedMigrations returns the migrations recorded in the database, oldest first.
+func AppliedMigrations(db *sql.DB) ([]MigrationInfo, error) {
+	if !tableExists(db, "schema_migrations") {
+		return nil, nil
+	}
+	rows, err := db.Query(`SELECT version, name, checksum FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []MigrationInfo
+	for rows.Next() {
+		var m MigrationInfo
+		if err := rows.Scan(&m.Version, &m.Name, &m.Checksum); err != nil {
+			return nil, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+func readUserVersion(q execQuerier) (int, error) {
+	var version int
+	if err := q.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("read user_version: %w", err)
+	}
+	return version, nil
+}
+
+// validateRegistry checks that the steps are numbered 1, 2, 3, ... and that the
+// database is not newer than the registry.
+func validateRegistry(registry []migration, version int) error {
+	for i, m := range registry {
+		if m.version != i+1 {
+			return fmt.Errorf("migration registry: step %d has version %d", i+1, m.version)
+		}
+	}
+	if version > len(registry) {
+		return fmt.Errorf("database schema version %d is newer than this version of mycal supports (%d)", version, len(registry))
+	}
+	return nil
+}
+
+// checkMigrations returns the current version after verifying the checksums of
+// the applied steps.
+func checkMigrations(db *sql.DB, registry []migration) (int, error) {
+	version, err := readUserVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if err := validateRegistry(registry, version); err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, nil
+	}
+
+	missing, err := verifyChecksums(db, registry, version)
+	if err != nil {
+		return 0, err
+	}
+	if len(missing) == 0 {
+		return version, nil
+	}
+
+	// Databases migrated before schema_migrations existed have no record of
+	// their steps; record them now.
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(createSchemaMigrations); err != nil {
+		return 0, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	for _, m := range missing {
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`, m.version, m.name, m.checksum()); err != nil {
+			return 0, fmt.Errorf("record migration %d: %w", m.version, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("record migrations: %w", err)
+	}
+	return version, nil
+}
+
+// verifyChecksums compares the recorded steps up to version with the registry.
+// It returns the applied steps that have no record.
+func verifyChecksums(q execQuerier, registry []migration, version int) ([]migration, error) {
+	recorded := make(map[int]string)
+	if tableExists(q, "schema_migrations") {
+		rows, err := q.Query(`SELECT version, checksum FROM schema_migrations`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var v int
+			var sum string
+			if err := rows.Scan(&v, &sum); err != nil {
+				return nil, err
+			}
+			recorded[v] = sum
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var missing []migration
+	for _, m := range registry[:version] {
+		sum, ok := recorded[m.version]
+		if !ok {
+			missing = append(missing, m)
+			continue
+		}
+		if sum != m.checksum() {
+			return nil, fmt.Errorf("migration %d (%s) has changed since it was applied to this database", m.version, m.name)
+		}
+	}
+	return missing, nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin migration to v%d: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	if err := runMigration(tx, m); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration to v%d: %w", m.version, err)
+	}
+	return nil
+}
+
+// runMigration applies a step, records it and stamps its version, all within tx.
+func runMigration(tx *sql.Tx, m migration) error {
+	if m.apply != nil {
+		if err := m.apply(tx); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	} else {
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %d (%s) %q: %w", m.version, m.name, statementPreview(stmt), err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(createSchemaMigrations); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, strftime('%Y-%m-%dT%H:%M:%SZ','now'))`,
+		m.version, m.name, m.checksum()); err != nil {
+		return fmt.Errorf("record migration %d: %w", m.version, err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return fmt.Errorf("set user_version = %d: %w", m.version, err)
+	}
+	return nil
+}
+
+func statementPreview(stmt string) string {
+	stmt = strings.Join(strings.Fields(stmt), " ")
+	if len(stmt) > 60 {
+		stmt = stmt[:60]
+	}
+	return stmt
+}
+
+// migrateV1 creates the initial schema. A pre-existing events table means the
+// database was created before the user_version scheme; it may carry legacy
+// columns that need reconciling.
+func migrateV1(tx *sql.Tx) error {
+	legacy := tableExists(tx, "events")
+
+	for _, stmt := range schemaV1 {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("%q: %w", statementPreview(stmt), err)
+		}
+	}
+
+	// Sync the FTS index with the existing events before reconcileLegacy runs
+	// any UPDATE: the update triggers delete-then-insert each touched row in
+	// events_fts, which corrupts the index if the row was never indexed. A
+	// no-op on a fresh, empty database.
+	if _, err := tx.Exec(`INSERT INTO events_fts(events_fts) VALUES('rebuild')`); err != nil {
+		return fmt.Errorf("rebuild events_fts: %w", err)
+	}
+
+	if legacy {
+		if err := reconcileLegacy(tx); err != nil {
+			return fmt.Errorf("reconcile legacy schema: %w", err)
+		}
+	}
+
+	// Indexes on ics_uid/calendar_id must come after reconcileLegacy, which
+	// adds those columns to legacy tables that predate them.
+	for _, stmt := range schemaV1Indexes {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("index %q: %w", stmt, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// Publication repository methods
+
+const publicationColumns = `id, token, name, calendar_ids, hidden_fields, time_zone, enabled, created_at, updated_at`
+
+func (r *SQLiteRepository) CreatePublication(pub *model.Publication) error {
+	return r.q.QueryRow(
+		`INSERT INTO publications (token, name, calendar_ids, hidden_fields, time_zone, enabled) VALUES (?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at`,
+		pub.Token, pub.Name, joinIDs(pub.CalendarIDs), strings.Join(pub.HiddenFields, ","), pub.TimeZone, pub.Enabled,
+	).Scan(&pub.ID, &pub.CreatedAt, &pub.UpdatedAt)
+}
+
+func (r *SQLiteRepository) GetPublicationByID(id int64) (*model.Publication, error) {
+	return r.getPublication(`SELECT `+publicationColumns+` FROM publications WHERE id = ?`, id)
+}
+
+func (r *SQLiteRepository) GetPublicationByToken(token string) (*model.Publication, error) {
+	return r.getPublication(`SELECT `+publicationColumns+` FROM publications WHERE token = ?`, token)
+}
+
+func (r *SQLiteRepository) getPublication(query string, arg any) (*model.Publication, error) {
+	pub, err := scanPublication(r.q.QueryRow(query, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pub, nil
+}
+
+func (r *SQLiteRepository) ListPublications() ([]model.Publication, error) {
+	rows, err := r.q.Query(`SELECT ` + publicationColumns + ` FROM publications ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pubs []model.Publication
+	for rows.Next() {
+		pub, err := scanPublication(rows)
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, pub)
+	}
+	return pubs, rows.Err()
+}
+
+func (r *SQLiteRepository) UpdatePublication(pub *model.Publication) error {
+	return r.q.QueryRow(
+		`UPDATE publications SET token=?, name=?, calendar_ids=?, hidden_fields=?, time_zone=?, enabled=?, updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now') WHERE id=? RETURNING updated_at`,
+		pub.Token, pub.Name, joinIDs(pub.CalendarIDs), strings.Join(pub.HiddenFields, ","), pub.TimeZone, pub.Enabled, pub.ID,
+	).Scan(&pub.UpdatedAt)
+}
+
+func (r *SQLiteRepository) DeletePublication(id int64) error {
+	result, err := r.q.Exec(`DELETE FROM publications WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanPublication(scanner interface{ Scan(...any) error }) (model.Publication, error) {
+	var pub model.Publication
+	var calendarIDs, hiddenFields string
+	if err := scanner.Scan(&pub.ID, &pub.Token, &pub.Name, &calendarIDs, &hiddenFields, &pub.TimeZone, &pub.Enabled, &pub.CreatedAt, &pub.UpdatedAt); err != nil {
+		return pub, err
+	}
+	for _, s := range strings.Split(calendarIDs, ",") {
+		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+			pub.CalendarIDs = append(pub.CalendarIDs, id)
+		}
+	}
+	if hiddenFields != "" {
+		pub.HiddenFields = strings.Split(hiddenFields, ",")
+	}
+	return pub, nil
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
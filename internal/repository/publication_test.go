@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestPublicationCRUD(t *testing.T) {
+	repo := newTestRepo(t)
+
+	pub := &model.Publication{
+		Token:        "TOKEN1",
+		Name:         "On-call",
+		CalendarIDs:  []int64{0, 3},
+		HiddenFields: []string{model.PublicationDescription, model.PublicationLocation},
+		TimeZone:     "Europe/Stockholm",
+		Enabled:      true,
+	}
+	require.NoError(t, repo.CreatePublication(pub))
+	assert.NotZero(t, pub.ID)
+	assert.NotEmpty(t, pub.CreatedAt)
+
+	got, err := repo.GetPublicationByID(pub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pub, got)
+	got, err = repo.GetPublicationByToken("TOKEN1")
+	require.NoError(t, err)
+	assert.Equal(t, pub, got)
+	got, err = repo.GetPublicationByToken("OTHER")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	pub.Token = "TOKEN2"
+	pub.HiddenFields = nil
+	pub.Enabled = false
+	require.NoError(t, repo.UpdatePublication(pub))
+	pubs, err := repo.ListPublications()
+	require.NoError(t, err)
+	require.Len(t, pubs, 1)
+	assert.Equal(t, "TOKEN2", pubs[0].Token)
+	assert.Nil(t, pubs[0].HiddenFields)
+	assert.Equal(t, []int64{0, 3}, pubs[0].CalendarIDs)
+	assert.False(t, pubs[0].Enabled)
+
+	require.NoError(t, repo.DeletePublication(pub.ID))
+	got, err = repo.GetPublicationByID(pub.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	assert.ErrorIs(t, repo.DeletePublication(pub.ID), sql.ErrNoRows)
+}
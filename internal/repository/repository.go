@@ -5,16 +5,27 @@ import "github.com/mikaelstaldal/mycal/internal/model"
 type EventRepository interface {
 	List(from, to string, calendarIDs []int64) ([]model.Event, error)
 	ListAll(calendarIDs []int64) ([]model.Event, error)
+	EachEvent(calendarIDs []int64, fn func(e *model.Event) error) error
 	ListRecurring(to string, calendarIDs []int64) ([]model.Event, error)
-	Search(query, from, to string, calendarIDs []int64) ([]model.Event, error)
+	Search(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error)
 	GetByID(id int64) (*model.Event, error)
 	Create(event *model.Event) error
 	Update(event *model.Event) error
 	Delete(id int64) error
 	ListOverrides(parentIDs []int64, from, to string) ([]model.Event, error)
 	GetOverride(parentID int64, originalStart string) (*model.Event, error)
-	DeleteByParentID(parentID int64) error
+	ListDeleted() ([]model.Event, error)
+	ListDeletedBefore(before string) ([]model.Event, error)
+	GetDeleted(id int64) (*model.Event, error)
+	Restore(id int64) error
+	Purge(id int64) error
+	PurgeDeletedBefore(before string) (int64, error)
+	GetByIcsUID(uid string) (*model.Event, error)
 	FilterExistingIcsUIDs(uids []string) (map[string]bool, error)
+	ListChanges(since int64) ([]model.EventChange, int64, error)
+	LatestChange() (int64, error)
+	FindEvents(filter model.EventFilter, limit, offset int) ([]model.Event, error)
+	InTx(fn func(repo EventRepository) error) error
 }
 
 type FeedRepository interface {
@@ -23,6 +34,10 @@ type FeedRepository interface {
 	ListFeeds() ([]model.Feed, error)
 	UpdateFeed(feed *model.Feed) error
 	DeleteFeed(id int64) error
+	SaveFeedDocument(feedID int64, data []byte) error
+	GetFeedDocument(feedID int64) ([]byte, string, error)
+	ListFeedObjects(feedID int64) ([]string, error)
+	AddFeedObjects(feedID int64, hrefs []string) error
 }
 
 type PreferencesRepository interface {
@@ -40,3 +55,37 @@ type CalendarRepository interface {
 	UpdateCalendar(cal *model.Calendar) error
 	DeleteCalendarIfUnused(id int64) error
 }
+
+type HistoryRepository interface {
+	AddHistory(entry *model.HistoryEntry) error
+	ListHistory(eventID int64) ([]model.HistoryEntry, error)
+	GetHistoryEntry(id int64) (*model.HistoryEntry, error)
+}
+
+type WebhookRepository interface {
+	CreateWebhook(hook *model.Webhook) error
+	GetWebhookByID(id int64) (*model.Webhook, error)
+	ListWebhooks() ([]model.Webhook, error)
+	UpdateWebhook(hook *model.Webhook) error
+	DeleteWebhook(id int64) error
+	EnqueueDelivery(delivery *model.WebhookDelivery) error
+	ListDueDeliveries(now string, limit int) ([]model.WebhookDelivery, error)
+	UpdateDelivery(delivery *model.WebhookDelivery) error
+	ListDeliveries(webhookID int64, limit int) ([]model.WebhookDelivery, error)
+	PurgeDeliveriesBefore(before string) (int64, error)
+}
+
+type PublicationRepository interface {
+	CreatePublication(pub *model.Publication) error
+	GetPublicationByID(id int64) (*model.Publication, error)
+	GetPublicationByToken(token string) (*model.Publication, error)
+	ListPublications() ([]model.Publication, error)
+	UpdatePublication(pub *model.Publication) error
+	DeletePublication(id int64) error
+}
+
+type DumpRepository interface {
+	ExportDump() (*model.Dump, error)
+	RestoreDump(dump *model.Dump) (*model.DumpResult, error)
+	InTx(fn func(repo EventRepository) error) error
+}
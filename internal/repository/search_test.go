@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,6 +20,15 @@ func setupTestRepo(t *testing.T) *SQLiteRepository {
 	return repo
 }
 
+// textQuery searches for each word of text, like an unstructured query.
+func textQuery(text string) model.SearchQuery {
+	var q model.SearchQuery
+	for _, w := range strings.Fields(text) {
+		q.Clauses = append(q.Clauses, model.SearchClause{{Text: w}})
+	}
+	return q
+}
+
 func createTestEvent(t *testing.T, repo *SQLiteRepository, title, desc, start, end string) *model.Event {
 	t.Helper()
 	e := &model.Event{
@@ -37,7 +47,7 @@ func TestSearchByTitle(t *testing.T) {
 	createTestEvent(t, repo, "Team Meeting", "Weekly sync", "2026-02-18T10:00:00Z", "2026-02-18T11:00:00Z")
 	createTestEvent(t, repo, "Lunch Break", "Cafeteria", "2026-02-18T12:00:00Z", "2026-02-18T13:00:00Z")
 
-	results, err := repo.Search("meeting", "", "", nil)
+	results, err := repo.Search(textQuery("meeting"), "", "", nil)
 	require.NoError(t, err)
 	require.Len(t, results, 1)
 	assert.Equal(t, "Team Meeting", results[0].Title)
@@ -48,7 +58,7 @@ func TestSearchByDescription(t *testing.T) {
 	createTestEvent(t, repo, "Event A", "Important discussion about budgets", "2026-02-18T10:00:00Z", "2026-02-18T11:00:00Z")
 	createTestEvent(t, repo, "Event B", "Casual chat", "2026-02-18T12:00:00Z", "2026-02-18T13:00:00Z")
 
-	results, err := repo.Search("budgets", "", "", nil)
+	results, err := repo.Search(textQuery("budgets"), "", "", nil)
 	require.NoError(t, err)
 	require.Len(t, results, 1)
 	assert.Equal(t, "Event A", results[0].Title)
@@ -59,7 +69,7 @@ func TestSearchWithTimeRange(t *testing.T) {
 	createTestEvent(t, repo, "Morning Meeting", "Standup", "2026-02-18T09:00:00Z", "2026-02-18T10:00:00Z")
 	createTestEvent(t, repo, "Afternoon Meeting", "Review", "2026-02-18T15:00:00Z", "2026-02-18T16:00:00Z")
 
-	results, err := repo.Search("meeting", "2026-02-18T14:00:00Z", "2026-02-18T17:00:00Z", nil)
+	results, err := repo.Search(textQuery("meeting"), "2026-02-18T14:00:00Z", "2026-02-18T17:00:00Z", nil)
 	require.NoError(t, err)
 	require.Len(t, results, 1)
 	assert.Equal(t, "Afternoon Meeting", results[0].Title)
@@ -73,11 +83,11 @@ func TestSearchAfterUpdate(t *testing.T) {
 	err := repo.Update(e)
 	require.NoError(t, err)
 
-	results, err := repo.Search("Old", "", "", nil)
+	results, err := repo.Search(textQuery("Old"), "", "", nil)
 	require.NoError(t, err)
 	assert.Empty(t, results)
 
-	results, err = repo.Search("New", "", "", nil)
+	results, err = repo.Search(textQuery("New"), "", "", nil)
 	require.NoError(t, err)
 	assert.Len(t, results, 1)
 }
@@ -89,7 +99,7 @@ func TestSearchAfterDelete(t *testing.T) {
 	err := repo.Delete(e.ID)
 	require.NoError(t, err)
 
-	results, err := repo.Search("Deletable", "", "", nil)
+	results, err := repo.Search(textQuery("Deletable"), "", "", nil)
 	require.NoError(t, err)
 	assert.Empty(t, results)
 }
@@ -98,12 +108,12 @@ func TestSearchSpecialCharacters(t *testing.T) {
 	repo := setupTestRepo(t)
 	createTestEvent(t, repo, `Event with "quotes"`, "Has special chars: AND OR NOT", "2026-02-18T10:00:00Z", "2026-02-18T11:00:00Z")
 
-	results, err := repo.Search(`"quotes"`, "", "", nil)
+	results, err := repo.Search(textQuery(`"quotes"`), "", "", nil)
 	require.NoError(t, err)
 	assert.Len(t, results, 1)
 
 	// FTS5 operators should be safely quoted
-	_, err = repo.Search("AND OR NOT", "", "", nil)
+	_, err = repo.Search(textQuery("AND OR NOT"), "", "", nil)
 	require.NoError(t, err)
 	// Should not error even with FTS5 operator-like terms
 }
@@ -112,7 +122,95 @@ func TestSearchEmptyQuery(t *testing.T) {
 	repo := setupTestRepo(t)
 	createTestEvent(t, repo, "Some Event", "Description", "2026-02-18T10:00:00Z", "2026-02-18T11:00:00Z")
 
-	results, err := repo.Search("", "", "", nil)
+	results, err := repo.Search(textQuery(""), "", "", nil)
 	require.NoError(t, err)
 	assert.Nil(t, results)
 }
+
+func TestSearchLocationAndCategories(t *testing.T) {
+	repo := setupTestRepo(t)
+	office := &model.Event{Title: "Planning", StartTime: "2026-02-18T10:00:00Z", EndTime: "2026-02-18T11:00:00Z", Location: "Main office", Categories: "work,planning"}
+	require.NoError(t, repo.Create(office))
+	home := &model.Event{Title: "Plants", Description: "Water the office plants", StartTime: "2026-02-19T10:00:00Z", EndTime: "2026-02-19T11:00:00Z", Location: "Home", Categories: "home"}
+	require.NoError(t, repo.Create(home))
+
+	results, err := repo.Search(textQuery("office"), "", "", nil)
+	require.NoError(t, err)
+	assert.Len(t, results, 2, "location is searched")
+
+	results, err = repo.Search(model.SearchQuery{Clauses: []model.SearchClause{{{Field: model.SearchFieldLocation, Text: "office"}}}}, "", "", nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, office.ID, results[0].ID)
+
+	results, err = repo.Search(model.SearchQuery{Clauses: []model.SearchClause{{{Field: model.SearchFieldCategories, Text: "work"}}}}, "", "", nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, office.ID, results[0].ID)
+}
+
+func TestSearchOperators(t *testing.T) {
+	repo := setupTestRepo(t)
+	planning := createTestEvent(t, repo, "Sprint planning", "Plan the next sprint", "2026-02-18T10:00:00Z", "2026-02-18T11:00:00Z")
+	review := createTestEvent(t, repo, "Sprint review", "Demo of the sprint", "2026-03-18T10:00:00Z", "2026-03-18T11:00:00Z")
+
+	tests := []struct {
+		name  string
+		query model.SearchQuery
+		want  []int64
+	}{
+		{"prefix", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "plan", Prefix: true}}}}, []int64{planning.ID}},
+		{"phrase", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "sprint review"}}}}, []int64{review.ID}},
+		{"phrase in wrong order", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "review sprint"}}}}, nil},
+		{"or", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "demo"}, {Text: "planning"}}}}, []int64{planning.ID, review.ID}},
+		{"exclude", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "sprint"}}}, Exclude: []model.SearchTerm{{Text: "demo"}}}, []int64{planning.ID}},
+		{"after", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "sprint"}}}, After: "2026-03-01T00:00:00Z"}, []int64{review.ID}},
+		{"before", model.SearchQuery{Clauses: []model.SearchClause{{{Text: "sprint"}}}, Before: "2026-03-01T00:00:00Z"}, []int64{planning.ID}},
+		{"operators are literal", model.SearchQuery{Clauses: []model.SearchClause{{{Text: `NEAR(" OR *`}}}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := repo.Search(tt.query, "", "", nil)
+			require.NoError(t, err)
+			var ids []int64
+			for _, e := range results {
+				ids = append(ids, e.ID)
+			}
+			assert.ElementsMatch(t, tt.want, ids)
+		})
+	}
+}
+
+func TestSearchRankingAndSnippet(t *testing.T) {
+	repo := setupTestRepo(t)
+	createTestEvent(t, repo, "Lunch", "Talk about the budget over lunch, then more about other things entirely", "2026-02-20T10:00:00Z", "2026-02-20T11:00:00Z")
+	inTitle := createTestEvent(t, repo, "Budget meeting", "", "2026-02-18T10:00:00Z", "2026-02-18T11:00:00Z")
+
+	results, err := repo.Search(textQuery("budget"), "", "", nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, inTitle.ID, results[0].ID, "a title match ranks first, although it is older")
+	assert.Equal(t, SnippetMatchStart+"Budget"+SnippetMatchEnd+" meeting", results[0].Snippet)
+	assert.Contains(t, results[1].Snippet, SnippetMatchStart+"budget"+SnippetMatchEnd)
+}
+
+func TestSearchKeepsRecurringSeriesStartedBeforeRange(t *testing.T) {
+	repo := setupTestRepo(t)
+	series := &model.Event{Title: "Weekly review", StartTime: "2026-01-05T10:00:00Z", EndTime: "2026-01-05T11:00:00Z", RecurrenceFreq: "WEEKLY"}
+	require.NoError(t, repo.Create(series))
+	createTestEvent(t, repo, "One-off review", "", "2026-01-06T10:00:00Z", "2026-01-06T11:00:00Z")
+
+	results, err := repo.Search(textQuery("review"), "2026-03-01T00:00:00Z", "2026-04-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1, "the series is left for the caller to expand")
+	assert.Equal(t, series.ID, results[0].ID)
+
+	results, err = repo.Search(model.SearchQuery{Clauses: textQuery("review").Clauses, After: "2026-03-01T00:00:00Z"}, "", "", nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, series.ID, results[0].ID)
+
+	results, err = repo.Search(textQuery("review"), "", "2026-01-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	assert.Empty(t, results, "the series starts after the range")
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"strings"
 
@@ -11,23 +12,64 @@ import (
 
 type SQLiteRepository struct {
 	db *sql.DB
+	q  execQuerier // db, or tx in a repository from InTx
+	tx *sql.Tx
 }
 
 // NewSQLiteRepository wraps an already-opened database. Schema migrations are
 // run by OpenDB, not here, so this can wrap a read-only connection too.
 func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
-	return &SQLiteRepository{db: db}, nil
+	return &SQLiteRepository{db: db, q: timedQuerier{db}}, nil
 }
 
-const selectColumnsBase = `e.id, e.title, e.description, e.start_time, e.end_time, e.all_day, e.color, e.recurrence_freq, e.recurrence_count, e.recurrence_until, e.recurrence_interval, e.recurrence_by_day, e.recurrence_by_monthday, e.recurrence_by_month, e.exdates, e.rdates, e.recurrence_parent_id, e.recurrence_original_start, e.duration, e.categories, e.url, e.reminder_minutes, e.location, e.latitude, e.longitude, e.calendar_id, COALESCE(cal.name, ''), e.ics_uid, e.created_at, e.updated_at`
+// InTx calls fn with a repository that does all its reads and writes in one
+// transaction, which is committed if fn returns nil and rolled back otherwise.
+func (r *SQLiteRepository) InTx(fn func(repo EventRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLiteRepository{db: r.db, q: timedQuerier{tx}, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// transaction runs fn in a transaction of its own, or in the enclosing one in
+// a repository from InTx.
+func (r *SQLiteRepository) transaction(fn func(tx *sql.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const selectColumnsBase = `e.id, e.title, e.description, e.start_time, e.end_time, e.all_day, e.color, e.recurrence_freq, e.recurrence_count, e.recurrence_until, e.recurrence_interval, e.recurrence_by_day, e.recurrence_by_monthday, e.recurrence_by_month, e.exdates, e.rdates, e.recurrence_parent_id, e.recurrence_original_start, e.duration, e.categories, e.url, e.reminder_minutes, e.transparent, e.location, e.latitude, e.longitude, e.calendar_id, COALESCE(cal.name, ''), e.ics_uid, e.created_at, e.updated_at, e.deleted_at, e.revision`
 
 const fromEventsJoin = ` FROM events e LEFT JOIN calendars cal ON e.calendar_id = cal.id`
 
+// notDeleted hides tombstoned events, which are only visible through ListDeleted.
+const notDeleted = ` AND e.deleted_at = ''`
+
 func scanEvent(scanner interface{ Scan(...any) error }) (model.Event, error) {
 	var e model.Event
 	var lat, lon sql.NullFloat64
 	var parentID sql.NullInt64
-	err := scanner.Scan(&e.ID, &e.Title, &e.Description, &e.StartTime, &e.EndTime, &e.AllDay, &e.Color, &e.RecurrenceFreq, &e.RecurrenceCount, &e.RecurrenceUntil, &e.RecurrenceInterval, &e.RecurrenceByDay, &e.RecurrenceByMonthDay, &e.RecurrenceByMonth, &e.ExDates, &e.RDates, &parentID, &e.RecurrenceOriginalStart, &e.Duration, &e.Categories, &e.URL, &e.ReminderMinutes, &e.Location, &lat, &lon, &e.CalendarID, &e.CalendarName, &e.IcsUID, &e.CreatedAt, &e.UpdatedAt)
+	err := scanner.Scan(&e.ID, &e.Title, &e.Description, &e.StartTime, &e.EndTime, &e.AllDay, &e.Color, &e.RecurrenceFreq, &e.RecurrenceCount, &e.RecurrenceUntil, &e.RecurrenceInterval, &e.RecurrenceByDay, &e.RecurrenceByMonthDay, &e.RecurrenceByMonth, &e.ExDates, &e.RDates, &parentID, &e.RecurrenceOriginalStart, &e.Duration, &e.Categories, &e.URL, &e.ReminderMinutes, &e.Transparent, &e.Location, &lat, &lon, &e.CalendarID, &e.CalendarName, &e.IcsUID, &e.CreatedAt, &e.UpdatedAt, &e.DeletedAt, &e.Revision)
 	if lat.Valid {
 		e.Latitude = &lat.Float64
 	}
@@ -60,8 +102,8 @@ func (r *SQLiteRepository) List(from, to string, calendarIDs []int64) ([]model.E
 	filterSQL, filterArgs := calendarIDFilter(calendarIDs)
 	args := []any{to, from}
 	args = append(args, filterArgs...)
-	rows, err := r.db.Query(
-		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.start_time < ? AND e.end_time > ? AND e.recurrence_freq = '' AND e.recurrence_parent_id IS NULL`+filterSQL+` ORDER BY e.start_time, e.created_at`,
+	rows, err := r.q.Query(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.start_time < ? AND e.end_time > ? AND e.recurrence_freq = '' AND e.recurrence_parent_id IS NULL`+notDeleted+filterSQL+` ORDER BY e.start_time, e.created_at`,
 		args...,
 	)
 	if err != nil {
@@ -81,54 +123,125 @@ func (r *SQLiteRepository) List(from, to string, calendarIDs []int64) ([]model.E
 }
 
 func (r *SQLiteRepository) ListAll(calendarIDs []int64) ([]model.Event, error) {
+	var events []model.Event
+	err := r.EachEvent(calendarIDs, func(e *model.Event) error {
+		events = append(events, *e)
+		return nil
+	})
+	return events, err
+}
+
+// EachEvent calls fn with every stored event, in the order of ListAll, while
+// reading them from the database, so that they never all have to be in memory.
+// Iteration stops at the first error from fn, which is returned.
+func (r *SQLiteRepository) EachEvent(calendarIDs []int64, fn func(e *model.Event) error) error {
 	filterSQL, filterArgs := calendarIDFilter(calendarIDs)
-	query := `SELECT ` + selectColumnsBase + fromEventsJoin + ` WHERE 1=1` + filterSQL + ` ORDER BY e.start_time, e.created_at`
-	rows, err := r.db.Query(query, filterArgs...)
+	query := `SELECT ` + selectColumnsBase + fromEventsJoin + ` WHERE 1=1` + notDeleted + filterSQL + ` ORDER BY e.start_time, e.created_at`
+	rows, err := r.q.Query(query, filterArgs...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var events []model.Event
 	for rows.Next() {
 		e, err := scanEvent(rows)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
 		}
-		events = append(events, e)
 	}
-	return events, rows.Err()
+	return rows.Err()
+}
+
+// Weights of the events_fts columns (title, description, location,
+// categories) when ranking search results.
+const searchRank = `bm25(events_fts, 10.0, 1.0, 4.0, 4.0)`
+
+// Search snippets mark the matched words with these control characters, which
+// cannot occur in sanitized event text, so the caller can highlight them
+// after escaping the rest.
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// ftsColumns maps search fields to events_fts columns.
+var ftsColumns = map[string]string{
+	model.SearchFieldTitle:       "title",
+	model.SearchFieldDescription: "description",
+	model.SearchFieldLocation:    "location",
+	model.SearchFieldCategories:  "categories",
+}
+
+// ftsTerm renders a term as a quoted FTS5 phrase, so that FTS5 operators in
+// the text are matched literally.
+func ftsTerm(t model.SearchTerm) string {
+	s := `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+	if t.Prefix {
+		s += ` *`
+	}
+	if col, ok := ftsColumns[t.Field]; ok {
+		s = col + ` : ` + s
+	}
+	return s
 }
 
-func sanitizeFTSQuery(query string) string {
-	terms := strings.Fields(query)
-	quoted := make([]string, 0, len(terms))
-	for _, t := range terms {
-		escaped := strings.ReplaceAll(t, `"`, `""`)
-		quoted = append(quoted, `"`+escaped+`"`)
+// ftsQuery renders a search query as an FTS5 MATCH expression.
+func ftsQuery(q model.SearchQuery) string {
+	parts := make([]string, 0, len(q.Clauses))
+	for _, clause := range q.Clauses {
+		terms := make([]string, len(clause))
+		for i, t := range clause {
+			terms[i] = ftsTerm(t)
+		}
+		parts = append(parts, `(`+strings.Join(terms, ` OR `)+`)`)
 	}
-	return strings.Join(quoted, " ")
+	expr := strings.Join(parts, ` AND `)
+	for _, t := range q.Exclude {
+		expr = `(` + expr + `) NOT ` + ftsTerm(t)
+	}
+	return expr
 }
 
-func (r *SQLiteRepository) Search(query, from, to string, calendarIDs []int64) ([]model.Event, error) {
-	ftsQuery := sanitizeFTSQuery(query)
-	if ftsQuery == "" {
+// Search returns the events matching a search query, best match first. The
+// Snippet of each event holds an excerpt of its best matching field, with the
+// matches between SnippetMatchStart and SnippetMatchEnd. Recurring parents are
+// returned as stored, and overrides as separate rows.
+func (r *SQLiteRepository) Search(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error) {
+	if query.IsEmpty() {
 		return nil, nil
 	}
 
 	var sb strings.Builder
 	var args []any
 
-	sb.WriteString(`SELECT ` + selectColumnsBase + `
+	sb.WriteString(`SELECT ` + selectColumnsBase + `, snippet(events_fts, -1, ?, ?, '…', 12)
 		FROM events e
 		LEFT JOIN calendars cal ON e.calendar_id = cal.id
-		JOIN events_fts f ON e.id = f.rowid
-		WHERE events_fts MATCH ?`)
-	args = append(args, ftsQuery)
+		JOIN events_fts ON e.id = events_fts.rowid
+		WHERE events_fts MATCH ?` + notDeleted)
+	args = append(args, SnippetMatchStart, SnippetMatchEnd, ftsQuery(query))
 
-	if from != "" && to != "" {
-		sb.WriteString(` AND e.start_time < ? AND e.end_time > ?`)
-		args = append(args, to, from)
+	// A recurring event is kept when its series starts before the end of the
+	// range; whether any of its instances fall within the range is up to the
+	// caller to find out.
+	if to != "" {
+		sb.WriteString(` AND e.start_time < ?`)
+		args = append(args, to)
+	}
+	if from != "" {
+		sb.WriteString(` AND (e.recurrence_freq != '' OR e.end_time > ?)`)
+		args = append(args, from)
+	}
+	if query.After != "" {
+		sb.WriteString(` AND (e.recurrence_freq != '' OR e.start_time >= ?)`)
+		args = append(args, query.After)
+	}
+	if query.Before != "" {
+		sb.WriteString(` AND e.start_time < ?`)
+		args = append(args, query.Before)
 	}
 
 	filterSQL, filterArgs := calendarIDFilter(calendarIDs)
@@ -137,9 +250,9 @@ func (r *SQLiteRepository) Search(query, from, to string, calendarIDs []int64) (
 		args = append(args, filterArgs...)
 	}
 
-	sb.WriteString(` ORDER BY e.start_time DESC`)
+	sb.WriteString(` ORDER BY ` + searchRank + `, e.start_time DESC`)
 
-	rows, err := r.db.Query(sb.String(), args...)
+	rows, err := r.q.Query(sb.String(), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -147,18 +260,30 @@ func (r *SQLiteRepository) Search(query, from, to string, calendarIDs []int64) (
 
 	var events []model.Event
 	for rows.Next() {
-		e, err := scanEvent(rows)
+		var snippet string
+		e, err := scanEvent(scanWithExtra{rows, []any{&snippet}})
 		if err != nil {
 			return nil, err
 		}
+		e.Snippet = snippet
 		events = append(events, e)
 	}
 	return events, rows.Err()
 }
 
+// scanWithExtra scans the event columns followed by extra selected columns.
+type scanWithExtra struct {
+	rows  *sql.Rows
+	extra []any
+}
+
+func (s scanWithExtra) Scan(dest ...any) error {
+	return s.rows.Scan(append(dest, s.extra...)...)
+}
+
 func (r *SQLiteRepository) GetByID(id int64) (*model.Event, error) {
-	e, err := scanEvent(r.db.QueryRow(
-		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.id = ?`, id,
+	e, err := scanEvent(r.q.QueryRow(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.id = ?`+notDeleted, id,
 	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -169,16 +294,27 @@ func (r *SQLiteRepository) GetByID(id int64) (*model.Event, error) {
 	return &e, nil
 }
 
+const insertEventSQL = `INSERT INTO events (id, title, description, start_time, end_time, all_day, color, recurrence_freq, recurrence_count, recurrence_until, recurrence_interval, recurrence_by_day, recurrence_by_monthday, recurrence_by_month, exdates, rdates, recurrence_parent_id, recurrence_original_start, duration, categories, url, reminder_minutes, transparent, location, latitude, longitude, calendar_id, ics_uid, revision) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at, revision`
+
+func insertEventArgs(id any, event *model.Event) []any {
+	return []any{id, event.Title, event.Description, event.StartTime, event.EndTime, event.AllDay, event.Color, event.RecurrenceFreq, event.RecurrenceCount, event.RecurrenceUntil, event.RecurrenceInterval, event.RecurrenceByDay, event.RecurrenceByMonthDay, event.RecurrenceByMonth, event.ExDates, event.RDates, event.RecurrenceParentID, event.RecurrenceOriginalStart, event.Duration, event.Categories, event.URL, event.ReminderMinutes, event.Transparent, event.Location, event.Latitude, event.Longitude, event.CalendarID, event.IcsUID, event.Revision + 1}
+}
+
+// Create inserts the event and fills in its generated fields. A non-zero
+// event.ID is kept, which is how deleted events are restored under their old ID.
+// The revision continues from event.Revision, so that a restored event does not
+// get the revision of an earlier version.
 func (r *SQLiteRepository) Create(event *model.Event) error {
-	err := r.db.QueryRow(
-		`INSERT INTO events (title, description, start_time, end_time, all_day, color, recurrence_freq, recurrence_count, recurrence_until, recurrence_interval, recurrence_by_day, recurrence_by_monthday, recurrence_by_month, exdates, rdates, recurrence_parent_id, recurrence_original_start, duration, categories, url, reminder_minutes, location, latitude, longitude, calendar_id, ics_uid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at`,
-		event.Title, event.Description, event.StartTime, event.EndTime, event.AllDay, event.Color, event.RecurrenceFreq, event.RecurrenceCount, event.RecurrenceUntil, event.RecurrenceInterval, event.RecurrenceByDay, event.RecurrenceByMonthDay, event.RecurrenceByMonth, event.ExDates, event.RDates, event.RecurrenceParentID, event.RecurrenceOriginalStart, event.Duration, event.Categories, event.URL, event.ReminderMinutes, event.Location, event.Latitude, event.Longitude, event.CalendarID, event.IcsUID,
-	).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt)
+	var id any
+	if event.ID != 0 {
+		id = event.ID
+	}
+	err := r.q.QueryRow(insertEventSQL, insertEventArgs(id, event)...).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt, &event.Revision)
 	if err != nil {
 		return err
 	}
 	if event.CalendarID != 0 {
-		return r.db.QueryRow(
+		return r.q.QueryRow(
 			`SELECT COALESCE(name, '') FROM calendars WHERE id = ?`, event.CalendarID,
 		).Scan(&event.CalendarName)
 	}
@@ -186,19 +322,19 @@ func (r *SQLiteRepository) Create(event *model.Event) error {
 }
 
 func (r *SQLiteRepository) Update(event *model.Event) error {
-	return r.db.QueryRow(
-		`UPDATE events SET title=?, description=?, start_time=?, end_time=?, all_day=?, color=?, recurrence_freq=?, recurrence_count=?, recurrence_until=?, recurrence_interval=?, recurrence_by_day=?, recurrence_by_monthday=?, recurrence_by_month=?, exdates=?, rdates=?, recurrence_parent_id=?, recurrence_original_start=?, duration=?, categories=?, url=?, reminder_minutes=?, location=?, latitude=?, longitude=?, calendar_id=?, ics_uid=?,
-		updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now') WHERE id=? RETURNING updated_at`,
-		event.Title, event.Description, event.StartTime, event.EndTime, event.AllDay, event.Color, event.RecurrenceFreq, event.RecurrenceCount, event.RecurrenceUntil, event.RecurrenceInterval, event.RecurrenceByDay, event.RecurrenceByMonthDay, event.RecurrenceByMonth, event.ExDates, event.RDates, event.RecurrenceParentID, event.RecurrenceOriginalStart, event.Duration, event.Categories, event.URL, event.ReminderMinutes, event.Location, event.Latitude, event.Longitude, event.CalendarID, event.IcsUID, event.ID,
-	).Scan(&event.UpdatedAt)
+	return r.q.QueryRow(
+		`UPDATE events SET title=?, description=?, start_time=?, end_time=?, all_day=?, color=?, recurrence_freq=?, recurrence_count=?, recurrence_until=?, recurrence_interval=?, recurrence_by_day=?, recurrence_by_monthday=?, recurrence_by_month=?, exdates=?, rdates=?, recurrence_parent_id=?, recurrence_original_start=?, duration=?, categories=?, url=?, reminder_minutes=?, transparent=?, location=?, latitude=?, longitude=?, calendar_id=?, ics_uid=?,
+		updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now'), revision=revision+1 WHERE id=? RETURNING updated_at, revision`,
+		event.Title, event.Description, event.StartTime, event.EndTime, event.AllDay, event.Color, event.RecurrenceFreq, event.RecurrenceCount, event.RecurrenceUntil, event.RecurrenceInterval, event.RecurrenceByDay, event.RecurrenceByMonthDay, event.RecurrenceByMonth, event.ExDates, event.RDates, event.RecurrenceParentID, event.RecurrenceOriginalStart, event.Duration, event.Categories, event.URL, event.ReminderMinutes, event.Transparent, event.Location, event.Latitude, event.Longitude, event.CalendarID, event.IcsUID, event.ID,
+	).Scan(&event.UpdatedAt, &event.Revision)
 }
 
 func (r *SQLiteRepository) ListRecurring(to string, calendarIDs []int64) ([]model.Event, error) {
 	filterSQL, filterArgs := calendarIDFilter(calendarIDs)
 	args := []any{to}
 	args = append(args, filterArgs...)
-	rows, err := r.db.Query(
-		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.recurrence_freq != '' AND e.start_time < ? AND e.recurrence_parent_id IS NULL`+filterSQL+` ORDER BY e.start_time, e.created_at`,
+	rows, err := r.q.Query(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.recurrence_freq != '' AND e.start_time < ? AND e.recurrence_parent_id IS NULL`+notDeleted+filterSQL+` ORDER BY e.start_time, e.created_at`,
 		args...,
 	)
 	if err != nil {
@@ -217,8 +353,11 @@ func (r *SQLiteRepository) ListRecurring(to string, calendarIDs []int64) ([]mode
 	return events, rows.Err()
 }
 
+// Delete moves the event to the trash, together with any overrides of it. All
+// rows get the same deleted_at so Restore can bring them back as a unit.
 func (r *SQLiteRepository) Delete(id int64) error {
-	result, err := r.db.Exec(`DELETE FROM events WHERE id = ?`, id)
+	result, err := r.q.Exec(`UPDATE events SET deleted_at = strftime('%Y-%m-%dT%H:%M:%SZ','now')
+		WHERE (id = ? OR recurrence_parent_id = ?) AND deleted_at = ''`, id, id)
 	if err != nil {
 		return err
 	}
@@ -232,6 +371,117 @@ func (r *SQLiteRepository) Delete(id int64) error {
 	return nil
 }
 
+// ListDeleted returns the events in the trash, most recently deleted first.
+// Overrides are left out since they are restored and purged with their parent.
+func (r *SQLiteRepository) ListDeleted() ([]model.Event, error) {
+	return r.listDeleted(``)
+}
+
+// ListDeletedBefore returns the events in the trash that were deleted before
+// the given time, like ListDeleted.
+func (r *SQLiteRepository) ListDeletedBefore(before string) ([]model.Event, error) {
+	return r.listDeleted(` AND e.deleted_at < ?`, before)
+}
+
+// GetDeleted returns the event in the trash with the given ID, or nil if there
+// is none.
+func (r *SQLiteRepository) GetDeleted(id int64) (*model.Event, error) {
+	e, err := scanEvent(r.q.QueryRow(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.id = ? AND e.deleted_at != ''`, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *SQLiteRepository) listDeleted(cond string, args ...any) ([]model.Event, error) {
+	rows, err := r.q.Query(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.deleted_at != '' AND e.recurrence_parent_id IS NULL`+cond+` ORDER BY e.deleted_at DESC, e.id DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Restore takes an event out of the trash, together with the overrides that
+// were deleted along with it. Overrides deleted on their own earlier stay in
+// the trash.
+func (r *SQLiteRepository) Restore(id int64) error {
+	return r.transaction(func(tx *sql.Tx) error {
+		var deletedAt string
+		err := tx.QueryRow(`SELECT deleted_at FROM events WHERE id = ? AND deleted_at != ''`, id).Scan(&deletedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE events SET deleted_at = '' WHERE id = ? OR (recurrence_parent_id = ? AND deleted_at = ?)`, id, id, deletedAt)
+		return err
+	})
+}
+
+// Purge permanently removes an event in the trash and all its overrides.
+func (r *SQLiteRepository) Purge(id int64) error {
+	return r.transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM events WHERE id = ? AND deleted_at != ''`, id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.Exec(`DELETE FROM events WHERE recurrence_parent_id = ?`, id)
+		return err
+	})
+}
+
+// PurgeDeletedBefore permanently removes events that were moved to the trash
+// before the given time, and returns how many rows were removed.
+func (r *SQLiteRepository) PurgeDeletedBefore(before string) (int64, error) {
+	// Overrides go with their parent even if they are still live, which can
+	// only happen for overrides of a parent that was itself purged.
+	var total int64
+	err := r.transaction(func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			`DELETE FROM events WHERE recurrence_parent_id IN (SELECT id FROM events WHERE deleted_at != '' AND deleted_at < ?)`,
+			`DELETE FROM events WHERE deleted_at != '' AND deleted_at < ?`,
+		} {
+			result, err := tx.Exec(stmt, before)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 func (r *SQLiteRepository) ListOverrides(parentIDs []int64, from, to string) ([]model.Event, error) {
 	if len(parentIDs) == 0 {
 		return nil, nil
@@ -245,11 +495,11 @@ func (r *SQLiteRepository) ListOverrides(parentIDs []int64, from, to string) ([]
 	// Include overrides whose new time overlaps the window, or whose original
 	// occurrence falls within the window (so we can suppress the generated instance).
 	query := `SELECT ` + selectColumnsBase + fromEventsJoin +
-		` WHERE e.recurrence_parent_id IN (` + strings.Join(placeholders, ",") + `)` +
+		` WHERE e.recurrence_parent_id IN (` + strings.Join(placeholders, ",") + `)` + notDeleted +
 		` AND ((e.start_time < ? AND e.end_time > ?) OR (e.recurrence_original_start >= ? AND e.recurrence_original_start < ?))` +
 		` ORDER BY e.start_time, e.created_at`
 	args = append(args, to, from, from, to)
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -267,8 +517,8 @@ func (r *SQLiteRepository) ListOverrides(parentIDs []int64, from, to string) ([]
 }
 
 func (r *SQLiteRepository) GetOverride(parentID int64, originalStart string) (*model.Event, error) {
-	e, err := scanEvent(r.db.QueryRow(
-		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.recurrence_parent_id = ? AND e.recurrence_original_start = ?`, parentID, originalStart,
+	e, err := scanEvent(r.q.QueryRow(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.recurrence_parent_id = ? AND e.recurrence_original_start = ?`+notDeleted, parentID, originalStart,
 	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -279,9 +529,19 @@ func (r *SQLiteRepository) GetOverride(parentID int64, originalStart string) (*m
 	return &e, nil
 }
 
-func (r *SQLiteRepository) DeleteByParentID(parentID int64) error {
-	_, err := r.db.Exec(`DELETE FROM events WHERE recurrence_parent_id = ?`, parentID)
-	return err
+// GetByIcsUID returns the event, not an override, imported with the given
+// iCalendar UID, the first one if imported more than once, or nil.
+func (r *SQLiteRepository) GetByIcsUID(uid string) (*model.Event, error) {
+	e, err := scanEvent(r.q.QueryRow(
+		`SELECT `+selectColumnsBase+fromEventsJoin+` WHERE e.ics_uid = ? AND e.recurrence_parent_id IS NULL`+notDeleted+` ORDER BY e.id LIMIT 1`, uid,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
 }
 
 func (r *SQLiteRepository) FilterExistingIcsUIDs(uids []string) (map[string]bool, error) {
@@ -294,8 +554,8 @@ func (r *SQLiteRepository) FilterExistingIcsUIDs(uids []string) (map[string]bool
 		placeholders[i] = "?"
 		args[i] = uid
 	}
-	query := "SELECT ics_uid FROM events WHERE ics_uid IN (" + strings.Join(placeholders, ",") + ")"
-	rows, err := r.db.Query(query, args...)
+	query := "SELECT ics_uid FROM events WHERE deleted_at = '' AND ics_uid IN (" + strings.Join(placeholders, ",") + ")"
+	rows, err := r.q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -313,10 +573,51 @@ func (r *SQLiteRepository) FilterExistingIcsUIDs(uids []string) (map[string]bool
 
 // Feed repository methods
 
+const feedColumns = `f.id, f.type, f.url, f.calendar_id, COALESCE(c.name, ''), f.refresh_interval_minutes, f.last_refreshed_at, f.last_error, f.enabled, ` +
+	`f.auth_type, f.username, f.header_names, f.credentials, f.collection_url, f.sync_token, f.rules, f.created_at, f.updated_at`
+
+// feedType returns the type of a feed to store; the type defaults to .ics.
+func feedType(t string) string {
+	if t == "" {
+		return model.FeedTypeICS
+	}
+	return t
+}
+
+// feedRules returns the rules of a feed to store, as JSON.
+func feedRules(rules []model.FeedRule) (string, error) {
+	if len(rules) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(rules)
+	return string(data), err
+}
+
+func scanFeed(scanner interface{ Scan(...any) error }) (model.Feed, error) {
+	var f model.Feed
+	var headerNames, rules string
+	err := scanner.Scan(&f.ID, &f.Type, &f.URL, &f.CalendarID, &f.CalendarName, &f.RefreshIntervalMinutes, &f.LastRefreshedAt, &f.LastError, &f.Enabled,
+		&f.AuthType, &f.Username, &headerNames, &f.Credentials, &f.CollectionURL, &f.SyncToken, &rules, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return f, err
+	}
+	if headerNames != "" {
+		f.HeaderNames = strings.Split(headerNames, ",")
+	}
+	if rules != "" {
+		err = json.Unmarshal([]byte(rules), &f.Rules)
+	}
+	return f, err
+}
+
 func (r *SQLiteRepository) CreateFeed(feed *model.Feed) error {
-	result, err := r.db.Exec(
-		`INSERT INTO feeds (url, calendar_id, refresh_interval_minutes, enabled) VALUES (?, ?, ?, ?)`,
-		feed.URL, feed.CalendarID, feed.RefreshIntervalMinutes, feed.Enabled,
+	rules, err := feedRules(feed.Rules)
+	if err != nil {
+		return err
+	}
+	result, err := r.q.Exec(
+		`INSERT INTO feeds (type, url, calendar_id, refresh_interval_minutes, enabled, auth_type, username, header_names, credentials, collection_url, sync_token, rules) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		feedType(feed.Type), feed.URL, feed.CalendarID, feed.RefreshIntervalMinutes, feed.Enabled, feed.AuthType, feed.Username, strings.Join(feed.HeaderNames, ","), feed.Credentials, feed.CollectionURL, feed.SyncToken, rules,
 	)
 	if err != nil {
 		return err
@@ -326,17 +627,16 @@ func (r *SQLiteRepository) CreateFeed(feed *model.Feed) error {
 		return err
 	}
 	feed.ID = id
-	return r.db.QueryRow(
+	return r.q.QueryRow(
 		`SELECT f.created_at, f.updated_at, COALESCE(c.name, '') FROM feeds f LEFT JOIN calendars c ON f.calendar_id = c.id WHERE f.id = ?`, id,
 	).Scan(&feed.CreatedAt, &feed.UpdatedAt, &feed.CalendarName)
 
 }
 
 func (r *SQLiteRepository) GetFeedByID(id int64) (*model.Feed, error) {
-	var f model.Feed
-	err := r.db.QueryRow(
-		`SELECT f.id, f.url, f.calendar_id, COALESCE(c.name, ''), f.refresh_interval_minutes, f.last_refreshed_at, f.last_error, f.enabled, f.created_at, f.updated_at FROM feeds f LEFT JOIN calendars c ON f.calendar_id = c.id WHERE f.id = ?`, id,
-	).Scan(&f.ID, &f.URL, &f.CalendarID, &f.CalendarName, &f.RefreshIntervalMinutes, &f.LastRefreshedAt, &f.LastError, &f.Enabled, &f.CreatedAt, &f.UpdatedAt)
+	f, err := scanFeed(r.q.QueryRow(
+		`SELECT `+feedColumns+` FROM feeds f LEFT JOIN calendars c ON f.calendar_id = c.id WHERE f.id = ?`, id,
+	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -347,8 +647,8 @@ func (r *SQLiteRepository) GetFeedByID(id int64) (*model.Feed, error) {
 }
 
 func (r *SQLiteRepository) ListFeeds() ([]model.Feed, error) {
-	rows, err := r.db.Query(
-		`SELECT f.id, f.url, f.calendar_id, COALESCE(c.name, ''), f.refresh_interval_minutes, f.last_refreshed_at, f.last_error, f.enabled, f.created_at, f.updated_at FROM feeds f LEFT JOIN calendars c ON f.calendar_id = c.id ORDER BY f.created_at`,
+	rows, err := r.q.Query(
+		`SELECT ` + feedColumns + ` FROM feeds f LEFT JOIN calendars c ON f.calendar_id = c.id ORDER BY f.created_at`,
 	)
 	if err != nil {
 		return nil, err
@@ -357,8 +657,8 @@ func (r *SQLiteRepository) ListFeeds() ([]model.Feed, error) {
 
 	var feeds []model.Feed
 	for rows.Next() {
-		var f model.Feed
-		if err := rows.Scan(&f.ID, &f.URL, &f.CalendarID, &f.CalendarName, &f.RefreshIntervalMinutes, &f.LastRefreshedAt, &f.LastError, &f.Enabled, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		f, err := scanFeed(rows)
+		if err != nil {
 			return nil, err
 		}
 		feeds = append(feeds, f)
@@ -367,35 +667,99 @@ func (r *SQLiteRepository) ListFeeds() ([]model.Feed, error) {
 }
 
 func (r *SQLiteRepository) UpdateFeed(feed *model.Feed) error {
-	_, err := r.db.Exec(
-		`UPDATE feeds SET url=?, calendar_id=?, refresh_interval_minutes=?, last_refreshed_at=?, last_error=?, enabled=?, updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now') WHERE id=?`,
-		feed.URL, feed.CalendarID, feed.RefreshIntervalMinutes, feed.LastRefreshedAt, feed.LastError, feed.Enabled, feed.ID,
+	rules, err := feedRules(feed.Rules)
+	if err != nil {
+		return err
+	}
+	_, err = r.q.Exec(
+		`UPDATE feeds SET type=?, url=?, calendar_id=?, refresh_interval_minutes=?, last_refreshed_at=?, last_error=?, enabled=?, auth_type=?, username=?, header_names=?, credentials=?, collection_url=?, sync_token=?, rules=?, updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now') WHERE id=?`,
+		feedType(feed.Type), feed.URL, feed.CalendarID, feed.RefreshIntervalMinutes, feed.LastRefreshedAt, feed.LastError, feed.Enabled, feed.AuthType, feed.Username, strings.Join(feed.HeaderNames, ","), feed.Credentials, feed.CollectionURL, feed.SyncToken, rules, feed.ID,
 	)
 	if err != nil {
 		return err
 	}
-	return r.db.QueryRow(
+	return r.q.QueryRow(
 		`SELECT f.updated_at, COALESCE(c.name, '') FROM feeds f LEFT JOIN calendars c ON f.calendar_id = c.id WHERE f.id = ?`, feed.ID,
 	).Scan(&feed.UpdatedAt, &feed.CalendarName)
 }
 
 func (r *SQLiteRepository) DeleteFeed(id int64) error {
-	result, err := r.db.Exec(`DELETE FROM feeds WHERE id = ?`, id)
-	if err != nil {
+	return r.transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM feeds WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := tx.Exec(`DELETE FROM feed_documents WHERE feed_id = ?`, id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM feed_objects WHERE feed_id = ?`, id)
 		return err
+	})
+}
+
+// SaveFeedDocument keeps the document of the last refresh of a feed, replacing
+// the one before.
+func (r *SQLiteRepository) SaveFeedDocument(feedID int64, data []byte) error {
+	_, err := r.q.Exec(
+		`INSERT INTO feed_documents (feed_id, data) VALUES (?, ?)
+		ON CONFLICT (feed_id) DO UPDATE SET data = excluded.data, fetched_at = strftime('%Y-%m-%dT%H:%M:%SZ','now')`,
+		feedID, data,
+	)
+	return err
+}
+
+// GetFeedDocument returns the document of the last refresh of a feed and when
+// it was fetched, or nil if there is none.
+func (r *SQLiteRepository) GetFeedDocument(feedID int64) ([]byte, string, error) {
+	var data []byte
+	var fetchedAt string
+	err := r.q.QueryRow(`SELECT data, fetched_at FROM feed_documents WHERE feed_id = ?`, feedID).Scan(&data, &fetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", nil
 	}
-	n, err := result.RowsAffected()
+	return data, fetchedAt, err
+}
+
+// ListFeedObjects returns the hrefs of the CalDAV objects read from a feed.
+func (r *SQLiteRepository) ListFeedObjects(feedID int64) ([]string, error) {
+	rows, err := r.q.Query(`SELECT href FROM feed_objects WHERE feed_id = ?`, feedID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if n == 0 {
-		return sql.ErrNoRows
+	defer rows.Close()
+
+	var hrefs []string
+	for rows.Next() {
+		var href string
+		if err := rows.Scan(&href); err != nil {
+			return nil, err
+		}
+		hrefs = append(hrefs, href)
 	}
-	return nil
+	return hrefs, rows.Err()
+}
+
+// AddFeedObjects adds hrefs to the CalDAV objects read from a feed.
+func (r *SQLiteRepository) AddFeedObjects(feedID int64, hrefs []string) error {
+	return r.transaction(func(tx *sql.Tx) error {
+		for _, href := range hrefs {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO feed_objects (feed_id, href) VALUES (?, ?)`, feedID, href); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (r *SQLiteRepository) GetAllPreferences() (map[string]string, error) {
-	rows, err := r.db.Query(`SELECT key, value FROM preferences`)
+	rows, err := r.q.Query(`SELECT key, value FROM preferences`)
 	if err != nil {
 		return nil, err
 	}
@@ -414,7 +778,7 @@ func (r *SQLiteRepository) GetAllPreferences() (map[string]string, error) {
 
 func (r *SQLiteRepository) GetPreference(key string) (string, bool, error) {
 	var value string
-	err := r.db.QueryRow(`SELECT value FROM preferences WHERE key = ?`, key).Scan(&value)
+	err := r.q.QueryRow(`SELECT value FROM preferences WHERE key = ?`, key).Scan(&value)
 	if errors.Is(err, sql.ErrNoRows) {
 		return "", false, nil
 	}
@@ -425,19 +789,19 @@ func (r *SQLiteRepository) GetPreference(key string) (string, bool, error) {
 }
 
 func (r *SQLiteRepository) SetPreference(key, value string) error {
-	_, err := r.db.Exec(`INSERT INTO preferences (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	_, err := r.q.Exec(`INSERT INTO preferences (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
 	return err
 }
 
 func (r *SQLiteRepository) DeletePreference(key string) error {
-	_, err := r.db.Exec(`DELETE FROM preferences WHERE key = ?`, key)
+	_, err := r.q.Exec(`DELETE FROM preferences WHERE key = ?`, key)
 	return err
 }
 
 // Calendar repository methods
 
 func (r *SQLiteRepository) ListCalendars() ([]model.Calendar, error) {
-	rows, err := r.db.Query(`SELECT id, name, color FROM calendars ORDER BY id`)
+	rows, err := r.q.Query(`SELECT id, name, color FROM calendars ORDER BY id`)
 	if err != nil {
 		return nil, err
 	}
@@ -456,7 +820,7 @@ func (r *SQLiteRepository) ListCalendars() ([]model.Calendar, error) {
 
 func (r *SQLiteRepository) GetCalendarByID(id int64) (*model.Calendar, error) {
 	var c model.Calendar
-	err := r.db.QueryRow(`SELECT id, name, color FROM calendars WHERE id = ?`, id).Scan(&c.ID, &c.Name, &c.Color)
+	err := r.q.QueryRow(`SELECT id, name, color FROM calendars WHERE id = ?`, id).Scan(&c.ID, &c.Name, &c.Color)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -468,7 +832,7 @@ func (r *SQLiteRepository) GetCalendarByID(id int64) (*model.Calendar, error) {
 
 func (r *SQLiteRepository) GetCalendarByName(name string) (*model.Calendar, error) {
 	var c model.Calendar
-	err := r.db.QueryRow(`SELECT id, name, color FROM calendars WHERE name = ?`, name).Scan(&c.ID, &c.Name, &c.Color)
+	err := r.q.QueryRow(`SELECT id, name, color FROM calendars WHERE name = ?`, name).Scan(&c.ID, &c.Name, &c.Color)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -479,7 +843,7 @@ func (r *SQLiteRepository) GetCalendarByName(name string) (*model.Calendar, erro
 }
 
 func (r *SQLiteRepository) CreateCalendar(cal *model.Calendar) error {
-	result, err := r.db.Exec(`INSERT INTO calendars (name, color) VALUES (?, ?)`, cal.Name, cal.Color)
+	result, err := r.q.Exec(`INSERT INTO calendars (name, color) VALUES (?, ?)`, cal.Name, cal.Color)
 	if err != nil {
 		return err
 	}
@@ -492,12 +856,12 @@ func (r *SQLiteRepository) CreateCalendar(cal *model.Calendar) error {
 }
 
 func (r *SQLiteRepository) UpdateCalendar(cal *model.Calendar) error {
-	_, err := r.db.Exec(`UPDATE calendars SET name = ?, color = ? WHERE id = ?`, cal.Name, cal.Color, cal.ID)
+	_, err := r.q.Exec(`UPDATE calendars SET name = ?, color = ? WHERE id = ?`, cal.Name, cal.Color, cal.ID)
 	return err
 }
 
 func (r *SQLiteRepository) DeleteCalendarIfUnused(id int64) error {
-	_, err := r.db.Exec(`DELETE FROM calendars WHERE id = ? AND id != 0
+	_, err := r.q.Exec(`DELETE FROM calendars WHERE id = ? AND id != 0
 		AND NOT EXISTS (SELECT 1 FROM events WHERE calendar_id = ?)
 		AND NOT EXISTS (SELECT 1 FROM feeds WHERE calendar_id = ?)`, id, id, id)
 	return err
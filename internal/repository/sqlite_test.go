@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -61,6 +62,36 @@ func TestList(t *testing.T) {
 	assert.Equal(t, "Feb Event", got[0].Title)
 }
 
+func TestEachEvent(t *testing.T) {
+	repo := newTestRepo(t)
+	for _, title := range []string{"One", "Two", "Three"} {
+		err := repo.Create(&model.Event{Title: title, StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"})
+		require.NoError(t, err)
+	}
+	all, err := repo.ListAll(nil)
+	require.NoError(t, err)
+
+	var titles []string
+	err = repo.EachEvent(nil, func(e *model.Event) error {
+		titles = append(titles, e.Title)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, titles, len(all))
+	for i := range all {
+		assert.Equal(t, all[i].Title, titles[i])
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.EachEvent(nil, func(e *model.Event) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
 func TestUpdate(t *testing.T) {
 	repo := newTestRepo(t)
 	e := &model.Event{
@@ -77,6 +108,24 @@ func TestUpdate(t *testing.T) {
 	assert.Equal(t, "Updated", got.Title)
 }
 
+func TestUpdateIncrementsRevision(t *testing.T) {
+	repo := newTestRepo(t)
+	e := createTestEvent(t, repo, "Original", "", "2026-03-15T10:00:00Z", "2026-03-15T11:00:00Z")
+	assert.Equal(t, int64(1), e.Revision)
+
+	e.Title = "Updated"
+	require.NoError(t, repo.Update(e))
+	assert.Equal(t, int64(2), e.Revision)
+	got, err := repo.GetByID(e.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got.Revision)
+
+	// A stale revision in the event does not matter.
+	e.Revision = 1
+	require.NoError(t, repo.Update(e))
+	assert.Equal(t, int64(3), e.Revision)
+}
+
 func TestDelete(t *testing.T) {
 	repo := newTestRepo(t)
 	e := &model.Event{
@@ -92,6 +141,25 @@ func TestDelete(t *testing.T) {
 	assert.Nil(t, got)
 }
 
+func TestGetByIcsUID(t *testing.T) {
+	repo := newTestRepo(t)
+	parent := &model.Event{Title: "Weekly", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z", RecurrenceFreq: "WEEKLY", IcsUID: "uid-1"}
+	require.NoError(t, repo.Create(parent))
+	override := &model.Event{Title: "Moved", StartTime: "2026-03-22T12:00:00Z", EndTime: "2026-03-22T13:00:00Z", IcsUID: "uid-1",
+		RecurrenceParentID: &parent.ID, RecurrenceOriginalStart: "2026-03-22T10:00:00Z"}
+	require.NoError(t, repo.Create(override))
+
+	got, err := repo.GetByIcsUID("uid-1")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, parent.ID, got.ID)
+
+	require.NoError(t, repo.Delete(parent.ID))
+	got, err = repo.GetByIcsUID("uid-1")
+	require.NoError(t, err)
+	assert.Nil(t, got, "deleted events are not found")
+}
+
 func TestDeleteNotFound(t *testing.T) {
 	repo := newTestRepo(t)
 	err := repo.Delete(999)
@@ -191,3 +259,59 @@ func TestCreateWithoutCoordinates(t *testing.T) {
 	assert.Nil(t, got.Latitude)
 	assert.Nil(t, got.Longitude)
 }
+
+func TestTransparentEvent(t *testing.T) {
+	repo := newTestRepo(t)
+	e := &model.Event{Title: "Holiday", StartTime: "2026-03-15T00:00:00Z", EndTime: "2026-03-16T00:00:00Z", AllDay: true, Transparent: true}
+	require.NoError(t, repo.Create(e))
+
+	got, err := repo.GetByID(e.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Transparent)
+
+	got.Transparent = false
+	require.NoError(t, repo.Update(got))
+	got, err = repo.GetByID(e.ID)
+	require.NoError(t, err)
+	assert.False(t, got.Transparent)
+}
+
+func TestFeedRulesAndDocument(t *testing.T) {
+	repo := newTestRepo(t)
+	feed := &model.Feed{URL: "https://example.com/school.ics", RefreshIntervalMinutes: 60, Enabled: true,
+		Rules: []model.FeedRule{{Field: model.FeedRuleCategories, Pattern: "U12", Action: model.FeedRuleInclude}}}
+	require.NoError(t, repo.CreateFeed(feed))
+
+	got, err := repo.GetFeedByID(feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, feed.Rules, got.Rules)
+	got.Rules = nil
+	require.NoError(t, repo.UpdateFeed(got))
+	got, err = repo.GetFeedByID(feed.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.Rules)
+
+	data, _, err := repo.GetFeedDocument(feed.ID)
+	require.NoError(t, err)
+	assert.Nil(t, data, "not fetched yet")
+	require.NoError(t, repo.SaveFeedDocument(feed.ID, []byte("first")))
+	require.NoError(t, repo.SaveFeedDocument(feed.ID, []byte("second")))
+	data, fetchedAt, err := repo.GetFeedDocument(feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	assert.NotEmpty(t, fetchedAt)
+
+	require.NoError(t, repo.AddFeedObjects(feed.ID, []string{"https://dav.test/a.ics", "https://dav.test/b.ics"}))
+	require.NoError(t, repo.AddFeedObjects(feed.ID, []string{"https://dav.test/b.ics"}))
+	hrefs, err := repo.ListFeedObjects(feed.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"https://dav.test/a.ics", "https://dav.test/b.ics"}, hrefs)
+
+	require.NoError(t, repo.DeleteFeed(feed.ID))
+	data, _, err = repo.GetFeedDocument(feed.ID)
+	require.NoError(t, err)
+	assert.Nil(t, data, "deleted with the feed")
+	hrefs, err = repo.ListFeedObjects(feed.ID)
+	require.NoError(t, err)
+	assert.Empty(t, hrefs, "deleted with the feed")
+}
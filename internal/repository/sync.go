@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// ListChanges returns the latest change of each event changed after the
+// sequence number since, in order, together with the latest sequence number
+// in the change log.
+func (r *SQLiteRepository) ListChanges(since int64) ([]model.EventChange, int64, error) {
+	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var latest int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM event_changes`).Scan(&latest); err != nil {
+		return nil, 0, err
+	}
+	rows, err := tx.Query(`SELECT seq, event_id, deleted FROM event_changes WHERE seq > ? ORDER BY seq`, since)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var changes []model.EventChange
+	for rows.Next() {
+		var c model.EventChange
+		if err := rows.Scan(&c.Seq, &c.EventID, &c.Deleted); err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, latest, rows.Err()
+}
+
+// LatestChange returns the latest sequence number in the change log, which
+// increases whenever an event is created, changed or deleted.
+func (r *SQLiteRepository) LatestChange() (int64, error) {
+	var latest int64
+	err := r.q.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM event_changes`).Scan(&latest)
+	return latest, err
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestListChanges(t *testing.T) {
+	repo := newTestRepo(t)
+
+	changes, latest, err := repo.ListChanges(0)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Zero(t, latest)
+
+	a := createTestEvent(t, repo, "A", "", "2026-03-15T10:00:00Z", "2026-03-15T11:00:00Z")
+	b := createTestEvent(t, repo, "B", "", "2026-03-16T10:00:00Z", "2026-03-16T11:00:00Z")
+	_, token, err := repo.ListChanges(0)
+	require.NoError(t, err)
+
+	// Only the latest change of each event is listed, in order.
+	a.Title = "A2"
+	require.NoError(t, repo.Update(a))
+	require.NoError(t, repo.Delete(b.ID))
+	changes, latest, err = repo.ListChanges(token)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, a.ID, changes[0].EventID)
+	assert.False(t, changes[0].Deleted)
+	assert.Equal(t, b.ID, changes[1].EventID)
+	assert.True(t, changes[1].Deleted, "an event in the trash is deleted")
+	assert.Equal(t, changes[1].Seq, latest)
+	assert.Greater(t, changes[0].Seq, token)
+
+	// Restoring and purging are changes too.
+	require.NoError(t, repo.Restore(b.ID))
+	changes, _, err = repo.ListChanges(latest)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.False(t, changes[0].Deleted)
+	seq, err := repo.LatestChange()
+	require.NoError(t, err)
+	assert.Equal(t, changes[0].Seq, seq)
+	require.NoError(t, repo.Delete(b.ID))
+	require.NoError(t, repo.Purge(b.ID))
+	changes, latest, err = repo.ListChanges(latest)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, b.ID, changes[0].EventID)
+	assert.True(t, changes[0].Deleted)
+
+	// Overrides are changes of their recurring event.
+	series := &model.Event{Title: "Weekly", StartTime: "2026-03-02T09:00:00Z", EndTime: "2026-03-02T10:00:00Z", RecurrenceFreq: "WEEKLY"}
+	require.NoError(t, repo.Create(series))
+	_, latest, err = repo.ListChanges(latest)
+	require.NoError(t, err)
+	override := &model.Event{
+		Title: "Moved", StartTime: "2026-03-09T11:00:00Z", EndTime: "2026-03-09T12:00:00Z",
+		RecurrenceParentID: &series.ID, RecurrenceOriginalStart: "2026-03-09T09:00:00Z",
+	}
+	require.NoError(t, repo.Create(override))
+	changes, _, err = repo.ListChanges(latest)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, series.ID, changes[0].EventID)
+	assert.False(t, changes[0].Deleted)
+
+	// Deleting the series with its override leaves it deleted.
+	require.NoError(t, repo.Delete(series.ID))
+	require.NoError(t, repo.Purge(series.ID))
+	changes, _, err = repo.ListChanges(latest)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, series.ID, changes[0].EventID)
+	assert.True(t, changes[0].Deleted)
+}
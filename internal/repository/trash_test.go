@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// createSeries creates a weekly recurring event with one override.
+func createSeries(t *testing.T, repo *SQLiteRepository) (parent, override *model.Event) {
+	t.Helper()
+	parent = &model.Event{Title: "Standup", StartTime: "2026-03-02T09:00:00Z", EndTime: "2026-03-02T09:15:00Z", RecurrenceFreq: "WEEKLY"}
+	require.NoError(t, repo.Create(parent))
+	override = &model.Event{Title: "Standup (moved)", StartTime: "2026-03-09T10:00:00Z", EndTime: "2026-03-09T10:15:00Z",
+		RecurrenceParentID: &parent.ID, RecurrenceOriginalStart: "2026-03-09T09:00:00Z"}
+	require.NoError(t, repo.Create(override))
+	return parent, override
+}
+
+func TestDeleteHidesEventAndOverrides(t *testing.T) {
+	repo := newTestRepo(t)
+	parent, override := createSeries(t, repo)
+	single := &model.Event{Title: "Standup review", StartTime: "2026-03-03T10:00:00Z", EndTime: "2026-03-03T11:00:00Z"}
+	require.NoError(t, repo.Create(single))
+
+	require.NoError(t, repo.Delete(parent.ID))
+	require.NoError(t, repo.Delete(single.ID))
+
+	got, err := repo.GetByID(parent.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	got, err = repo.GetOverride(parent.ID, override.RecurrenceOriginalStart)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	recurring, err := repo.ListRecurring("2026-04-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	assert.Empty(t, recurring)
+	overrides, err := repo.ListOverrides([]int64{parent.ID}, "2026-03-01T00:00:00Z", "2026-04-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+	listed, err := repo.List("2026-03-01T00:00:00Z", "2026-04-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+	all, err := repo.ListAll(nil)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+	found, err := repo.Search(textQuery("Standup"), "", "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	assert.ErrorIs(t, repo.Delete(parent.ID), sql.ErrNoRows, "already in the trash")
+
+	trash, err := repo.ListDeleted()
+	require.NoError(t, err)
+	require.Len(t, trash, 2, "overrides are not listed on their own")
+	for _, e := range trash {
+		assert.NotEmpty(t, e.DeletedAt)
+	}
+}
+
+func TestRestoreBringsBackOverrides(t *testing.T) {
+	repo := newTestRepo(t)
+	parent, override := createSeries(t, repo)
+	require.NoError(t, repo.Delete(parent.ID))
+
+	require.NoError(t, repo.Restore(parent.ID))
+
+	got, err := repo.GetByID(parent.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Empty(t, got.DeletedAt)
+	got, err = repo.GetOverride(parent.ID, override.RecurrenceOriginalStart)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, override.ID, got.ID)
+
+	assert.ErrorIs(t, repo.Restore(parent.ID), sql.ErrNoRows, "no longer in the trash")
+}
+
+func TestRestoreKeepsOverridesDeletedEarlier(t *testing.T) {
+	repo := newTestRepo(t)
+	parent, override := createSeries(t, repo)
+	require.NoError(t, repo.Delete(override.ID))
+	// Backdate the override's tombstone so it differs from the parent's.
+	_, err := repo.db.Exec(`UPDATE events SET deleted_at = '2026-01-01T00:00:00Z' WHERE id = ?`, override.ID)
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(parent.ID))
+
+	require.NoError(t, repo.Restore(parent.ID))
+
+	got, err := repo.GetOverride(parent.ID, override.RecurrenceOriginalStart)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestPurge(t *testing.T) {
+	repo := newTestRepo(t)
+	parent, override := createSeries(t, repo)
+
+	assert.ErrorIs(t, repo.Purge(parent.ID), sql.ErrNoRows, "live events cannot be purged")
+
+	got, err := repo.GetDeleted(parent.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got, "not in the trash")
+	require.NoError(t, repo.Delete(parent.ID))
+	got, err = repo.GetDeleted(parent.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.NotEmpty(t, got.DeletedAt)
+	require.NoError(t, repo.Purge(parent.ID))
+
+	var n int
+	require.NoError(t, repo.db.QueryRow(`SELECT COUNT(*) FROM events WHERE id IN (?, ?)`, parent.ID, override.ID).Scan(&n))
+	assert.Zero(t, n)
+	assert.ErrorIs(t, repo.Restore(parent.ID), sql.ErrNoRows)
+}
+
+func TestPurgeDeletedBefore(t *testing.T) {
+	repo := newTestRepo(t)
+	parent, _ := createSeries(t, repo)
+	recent := &model.Event{Title: "Recent", StartTime: "2026-03-03T10:00:00Z", EndTime: "2026-03-03T11:00:00Z"}
+	require.NoError(t, repo.Create(recent))
+	live := &model.Event{Title: "Live", StartTime: "2026-03-04T10:00:00Z", EndTime: "2026-03-04T11:00:00Z"}
+	require.NoError(t, repo.Create(live))
+
+	require.NoError(t, repo.Delete(parent.ID))
+	_, err := repo.db.Exec(`UPDATE events SET deleted_at = '2026-01-01T00:00:00Z' WHERE deleted_at != ''`)
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(recent.ID))
+
+	old, err := repo.ListDeletedBefore("2026-02-01T00:00:00Z")
+	require.NoError(t, err)
+	require.Len(t, old, 1)
+	assert.Equal(t, parent.ID, old[0].ID)
+
+	n, err := repo.PurgeDeletedBefore("2026-02-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n, "the series and its override")
+
+	trash, err := repo.ListDeleted()
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "Recent", trash[0].Title)
+	got, err := repo.GetByID(live.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, got)
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// Webhook repository methods
+
+const webhookColumns = `id, url, secret, event_types, enabled, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateWebhook(hook *model.Webhook) error {
+	return r.q.QueryRow(
+		`INSERT INTO webhooks (url, secret, event_types, enabled) VALUES (?, ?, ?, ?) RETURNING id, created_at, updated_at`,
+		hook.URL, hook.Secret, strings.Join(hook.EventTypes, ","), hook.Enabled,
+	).Scan(&hook.ID, &hook.CreatedAt, &hook.UpdatedAt)
+}
+
+func (r *SQLiteRepository) GetWebhookByID(id int64) (*model.Webhook, error) {
+	hook, err := scanWebhook(r.q.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (r *SQLiteRepository) ListWebhooks() ([]model.Webhook, error) {
+	rows, err := r.q.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []model.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (r *SQLiteRepository) UpdateWebhook(hook *model.Webhook) error {
+	err := r.q.QueryRow(
+		`UPDATE webhooks SET url=?, secret=?, event_types=?, enabled=?, updated_at=strftime('%Y-%m-%dT%H:%M:%SZ','now') WHERE id=? RETURNING updated_at`,
+		hook.URL, hook.Secret, strings.Join(hook.EventTypes, ","), hook.Enabled, hook.ID,
+	).Scan(&hook.UpdatedAt)
+	return err
+}
+
+// DeleteWebhook deletes a webhook together with its queued and past
+// deliveries.
+func (r *SQLiteRepository) DeleteWebhook(id int64) error {
+	return r.transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+		return err
+	})
+}
+
+func scanWebhook(scanner interface{ Scan(...any) error }) (model.Webhook, error) {
+	var hook model.Webhook
+	var eventTypes string
+	if err := scanner.Scan(&hook.ID, &hook.URL, &hook.Secret, &eventTypes, &hook.Enabled, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+		return hook, err
+	}
+	if eventTypes != "" {
+		hook.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return hook, nil
+}
+
+const deliveryColumns = `id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_status, last_error, created_at, delivered_at`
+
+// EnqueueDelivery adds a pending delivery, due now unless NextAttemptAt is set.
+func (r *SQLiteRepository) EnqueueDelivery(delivery *model.WebhookDelivery) error {
+	delivery.Status = model.DeliveryPending
+	return r.q.QueryRow(
+		`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, next_attempt_at)
+		VALUES (?, ?, ?, COALESCE(NULLIF(?, ''), strftime('%Y-%m-%dT%H:%M:%SZ','now')))
+		RETURNING id, next_attempt_at, created_at`,
+		delivery.WebhookID, delivery.EventType, delivery.Payload, delivery.NextAttemptAt,
+	).Scan(&delivery.ID, &delivery.NextAttemptAt, &delivery.CreatedAt)
+}
+
+// ListDueDeliveries returns up to limit pending deliveries whose next attempt
+// is due at now, oldest first.
+func (r *SQLiteRepository) ListDueDeliveries(now string, limit int) ([]model.WebhookDelivery, error) {
+	return r.queryDeliveries(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		model.DeliveryPending, now, limit,
+	)
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt.
+func (r *SQLiteRepository) UpdateDelivery(delivery *model.WebhookDelivery) error {
+	_, err := r.q.Exec(
+		`UPDATE webhook_deliveries SET status=?, attempts=?, next_attempt_at=?, last_status=?, last_error=?, delivered_at=? WHERE id=?`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastStatus, delivery.LastError, delivery.DeliveredAt, delivery.ID,
+	)
+	return err
+}
+
+// ListDeliveries returns the latest deliveries of a webhook, most recent first.
+func (r *SQLiteRepository) ListDeliveries(webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	return r.queryDeliveries(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`,
+		webhookID, limit,
+	)
+}
+
+// PurgeDeliveriesBefore removes the delivered and failed deliveries created
+// before the given time, and returns how many were removed.
+func (r *SQLiteRepository) PurgeDeliveriesBefore(before string) (int64, error) {
+	result, err := r.q.Exec(`DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`, model.DeliveryPending, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *SQLiteRepository) queryDeliveries(query string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := r.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
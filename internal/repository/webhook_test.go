@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestWebhookCRUD(t *testing.T) {
+	repo := newTestRepo(t)
+
+	hook := &model.Webhook{
+		URL:        "https://example.com/hook",
+		Secret:     "0123456789abcdef",
+		EventTypes: []string{model.WebhookEventCreated, model.WebhookEventDeleted},
+		Enabled:    true,
+	}
+	require.NoError(t, repo.CreateWebhook(hook))
+	assert.NotZero(t, hook.ID)
+	assert.NotEmpty(t, hook.CreatedAt)
+
+	got, err := repo.GetWebhookByID(hook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, hook, got)
+
+	hook.EventTypes = []string{model.WebhookFeedRefreshFailed}
+	hook.Enabled = false
+	require.NoError(t, repo.UpdateWebhook(hook))
+	hooks, err := repo.ListWebhooks()
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, []string{model.WebhookFeedRefreshFailed}, hooks[0].EventTypes)
+	assert.False(t, hooks[0].Enabled)
+
+	require.NoError(t, repo.DeleteWebhook(hook.ID))
+	got, err = repo.GetWebhookByID(hook.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	assert.ErrorIs(t, repo.DeleteWebhook(hook.ID), sql.ErrNoRows)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	repo := newTestRepo(t)
+	hook := &model.Webhook{URL: "https://example.com/hook", Secret: "0123456789abcdef", EventTypes: []string{model.WebhookEventCreated}, Enabled: true}
+	require.NoError(t, repo.CreateWebhook(hook))
+
+	now := &model.WebhookDelivery{WebhookID: hook.ID, EventType: model.WebhookEventCreated, Payload: `{"n":1}`}
+	require.NoError(t, repo.EnqueueDelivery(now))
+	assert.Equal(t, model.DeliveryPending, now.Status)
+	assert.NotEmpty(t, now.NextAttemptAt)
+	later := &model.WebhookDelivery{WebhookID: hook.ID, EventType: model.WebhookEventCreated, Payload: `{"n":2}`, NextAttemptAt: "2100-01-01T00:00:00Z"}
+	require.NoError(t, repo.EnqueueDelivery(later))
+
+	due, err := repo.ListDueDeliveries("2099-01-01T00:00:00Z", 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, now.ID, due[0].ID)
+	assert.Equal(t, `{"n":1}`, due[0].Payload)
+
+	due[0].Status = model.DeliveryDelivered
+	due[0].Attempts = 1
+	due[0].LastStatus = 204
+	due[0].DeliveredAt = "2026-03-15T10:00:00Z"
+	require.NoError(t, repo.UpdateDelivery(&due[0]))
+	due, err = repo.ListDueDeliveries("2099-01-01T00:00:00Z", 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "delivered deliveries are not due")
+
+	deliveries, err := repo.ListDeliveries(hook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, later.ID, deliveries[0].ID, "most recent first")
+	assert.Equal(t, model.DeliveryDelivered, deliveries[1].Status)
+	assert.Equal(t, 204, deliveries[1].LastStatus)
+
+	// Only completed deliveries are purged.
+	n, err := repo.PurgeDeliveriesBefore("2100-01-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	deliveries, err = repo.ListDeliveries(hook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, later.ID, deliveries[0].ID)
+
+	// Deleting the webhook deletes its deliveries.
+	require.NoError(t, repo.DeleteWebhook(hook.ID))
+	deliveries, err = repo.ListDeliveries(hook.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
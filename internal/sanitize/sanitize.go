@@ -2,7 +2,10 @@ package sanitize
 
 import "github.com/microcosm-cc/bluemonday"
 
-var policy *bluemonday.Policy
+var (
+	policy      *bluemonday.Policy
+	stripPolicy = bluemonday.StrictPolicy()
+)
 
 func init() {
 	policy = bluemonday.NewPolicy()
@@ -36,3 +39,9 @@ func init() {
 func HTML(s string) string {
 	return policy.Sanitize(s)
 }
+
+// StripTags removes all HTML tags, keeping only the text. The result is still
+// HTML, with special characters escaped.
+func StripTags(s string) string {
+	return stripPolicy.Sanitize(s)
+}
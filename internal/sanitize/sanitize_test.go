@@ -89,3 +89,8 @@ func TestHTML(t *testing.T) {
 		})
 	}
 }
+
+func TestStripTags(t *testing.T) {
+	assert.Equal(t, "bold and a &lt; b", StripTags(`<b>bold</b> and a < b<script>x</script>`))
+	assert.Equal(t, "keep \x02match\x03", StripTags("keep \x02match\x03"))
+}
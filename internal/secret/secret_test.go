@@ -0,0 +1,56 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBox(t *testing.T) {
+	key := make([]byte, KeySize)
+	box, err := NewBox(key)
+	require.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("hunter2"))
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "hunter2")
+	again, err := box.Seal([]byte("hunter2"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "each value has its own nonce")
+
+	plaintext, err := box.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(plaintext))
+
+	key[0] = 1
+	other, err := NewBox(key)
+	require.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = box.Open("hunter2")
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = NewBox(make([]byte, 16))
+	assert.Error(t, err)
+}
+
+func TestLoadOrCreateKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.key")
+	key, err := LoadOrCreateKeyFile(path)
+	require.NoError(t, err)
+	assert.Len(t, key, KeySize)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	again, err := LoadOrCreateKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	require.NoError(t, os.WriteFile(path, []byte("c2hvcnQ=\n"), 0600))
+	_, err = LoadOrCreateKeyFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+)
+
+// maxBulkEvents is how many events a filter-based bulk operation may change.
+const maxBulkEvents = 1000
+
+// bulkPageSize is the number of stored events read at a time to find the
+// events of a filter-based bulk operation.
+const bulkPageSize = 500
+
+// ErrBatchAborted is the result of the operations of a batch that were not
+// applied because another operation failed.
+var ErrBatchAborted = errors.New("not applied")
+
+// errBatchFailed rolls back the transaction of a batch with a failed operation.
+var errBatchFailed = errors.New("batch operation failed")
+
+// BatchResult is the outcome of one operation of a batch.
+type BatchResult struct {
+	Event *model.Event // the created or updated event, nil for deletions
+	Err   error
+}
+
+// inTx calls fn with a copy of the service that makes all its changes in one
+// repository transaction. The changes are recorded in the history and
+// published once the transaction is committed.
+func (s *EventService) inTx(fn func(tx *EventService) error) error {
+	return s.history.inTx(s.repo, func(repo repository.EventRepository, h historyRecorder) error {
+		tx := *s
+		tx.repo = repo
+		// Look up calendars in the transaction too, rather than on another
+		// connection while this one holds the write lock.
+		if calRepo, ok := repo.(repository.CalendarRepository); ok {
+			tx.calRepo = calRepo
+		}
+		tx.history = h
+		return fn(&tx)
+	})
+}
+
+// inTxResult is inTx for a function with a result.
+func inTxResult[T any](s *EventService, fn func(tx *EventService) (T, error)) (T, error) {
+	var result T
+	err := s.inTx(func(tx *EventService) error {
+		var err error
+		result, err = fn(tx)
+		return err
+	})
+	return result, err
+}
+
+// Batch runs the operations in order in one transaction, and returns the
+// result of each. If an operation fails with ErrValidation or ErrNotFound,
+// nothing is applied: the failed operation gets its error and all the others
+// ErrBatchAborted. Other errors are returned as is.
+func (s *EventService) Batch(ops []api.BatchOperation) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	failed := -1
+	err := s.inTx(func(tx *EventService) error {
+		for i := range ops {
+			event, err := tx.batchOperation(&ops[i])
+			if err != nil {
+				if !errors.Is(err, ErrValidation) && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				results[i].Err = err
+				failed = i
+				return errBatchFailed
+			}
+			results[i].Event = event
+		}
+		return nil
+	})
+	if failed >= 0 {
+		for i := range results {
+			if i != failed {
+				results[i] = BatchResult{Err: fmt.Errorf("%w: operation %d failed", ErrBatchAborted, failed)}
+			}
+		}
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *EventService) batchOperation(op *api.BatchOperation) (*model.Event, error) {
+	if op.Op == api.BatchOperationOpCreate {
+		if !op.Create.Set {
+			return nil, fmt.Errorf("%w: create operation without create", ErrValidation)
+		}
+		return s.Create(&op.Create.Value)
+	}
+
+	if !op.ID.Set {
+		return nil, fmt.Errorf("%w: %s operation without id", ErrValidation, op.Op)
+	}
+	id, instanceStart, err := model.ParseEventID(op.ID.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id", ErrValidation)
+	}
+	switch op.Op {
+	case api.BatchOperationOpUpdate:
+		if !op.Update.Set {
+			return nil, fmt.Errorf("%w: update operation without update", ErrValidation)
+		}
+		if instanceStart != "" {
+			return s.CreateOrUpdateOverride(id, instanceStart, &op.Update.Value)
+		}
+		return s.Update(id, &op.Update.Value)
+	case api.BatchOperationOpDelete:
+		if instanceStart != "" {
+			return s.AddExDate(id, instanceStart)
+		}
+		return nil, s.Delete(id)
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrValidation, op.Op)
+}
+
+// eventFilter converts an API filter, which must have at least one condition.
+func eventFilter(f *api.EventFilter) (model.EventFilter, error) {
+	var filter model.EventFilter
+	if f.CalendarID != nil {
+		filter.CalendarIDs = f.CalendarID
+	}
+	if f.From.Set {
+		filter.From = f.From.Value.UTC().Format(time.RFC3339)
+	}
+	if f.To.Set {
+		filter.To = f.To.Value.UTC().Format(time.RFC3339)
+	}
+	if f.Q.Set {
+		q, err := ParseSearchQuery(f.Q.Value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Query = q
+	}
+	if filter.IsEmpty() {
+		return filter, fmt.Errorf("%w: filter must have at least one condition", ErrValidation)
+	}
+	return filter, nil
+}
+
+// findForBulk returns the events matching a filter, or a validation error if
+// there are more than maxBulkEvents. A recurring series matches when any of
+// its instances is within the time range of the filter.
+func (s *EventService) findForBulk(f *api.EventFilter) ([]model.Event, error) {
+	filter, err := eventFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	// The repository keeps every series starting before the end of the range,
+	// so the events are read a page at a time until enough of them match.
+	w := newSearchWindow(filter.Query, filter.From, filter.To)
+	lo, hi := w.start(), w.end()
+	if !lo.IsZero() && hi.IsZero() {
+		hi = lo.Add(searchNextOccurrenceHorizon)
+	}
+	var events []model.Event
+	for offset := 0; len(events) <= maxBulkEvents; offset += bulkPageSize {
+		page, err := s.repo.FindEvents(filter, bulkPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range page {
+			if lo.IsZero() || !e.IsRecurring() || slices.ContainsFunc(s.occurrences.expand(e, lo, hi), w.contains) {
+				events = append(events, e)
+			}
+		}
+		if len(page) < bulkPageSize {
+			break
+		}
+	}
+	if len(events) > maxBulkEvents {
+		return nil, fmt.Errorf("%w: filter matches more than %d events", ErrValidation, maxBulkEvents)
+	}
+	return events, nil
+}
+
+// BulkUpdate applies the same update to every event matching the filter, in
+// one transaction, and returns the updated events. The times of events cannot
+// be changed this way.
+func (s *EventService) BulkUpdate(f *api.EventFilter, req *api.UpdateEventRequest) ([]model.Event, error) {
+	if req.StartTime.Set || req.EndTime.Set || req.StartDate.Set || req.EndDate.Set || req.Duration.Set || req.AllDay.Set {
+		return nil, fmt.Errorf("%w: times cannot be changed by a bulk update", ErrValidation)
+	}
+	var updated []model.Event
+	err := s.inTx(func(tx *EventService) error {
+		events, err := tx.findForBulk(f)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			event, err := tx.Update(e.ID, req)
+			if err != nil {
+				return fmt.Errorf("event %d: %w", e.ID, err)
+			}
+			updated = append(updated, *event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		updated = []model.Event{}
+	}
+	return updated, nil
+}
+
+// BulkDelete moves every event matching the filter to the trash, in one
+// transaction, and returns the deleted events. Overrides of a deleted
+// recurring event go with it. An override whose recurring event is not
+// deleted is excluded from it instead, like AddExDate does.
+func (s *EventService) BulkDelete(f *api.EventFilter) ([]model.Event, error) {
+	var deleted []model.Event
+	err := s.inTx(func(tx *EventService) error {
+		events, err := tx.findForBulk(f)
+		if err != nil {
+			return err
+		}
+		parents := map[int64]bool{}
+		for _, e := range events {
+			parents[e.ID] = true
+		}
+		for _, e := range events {
+			if e.RecurrenceParentID != nil {
+				if parents[*e.RecurrenceParentID] {
+					continue
+				}
+				if _, err := tx.AddExDate(*e.RecurrenceParentID, e.RecurrenceOriginalStart); err != nil {
+					return fmt.Errorf("event %d: %w", e.ID, err)
+				}
+			} else if err := tx.Delete(e.ID); err != nil {
+				return fmt.Errorf("event %d: %w", e.ID, err)
+			}
+			deleted = append(deleted, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		deleted = []model.Event{}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestBatch_PublishesAfterCommit(t *testing.T) {
+	var historyDuringTx, publishedDuringTx int
+	histRepo := &mockHistoryRepo{}
+	bus := NewEventBus()
+	changes, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	repo := &mockRepo{
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Old", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}, nil
+		},
+		createFn: func(e *model.Event) error {
+			e.ID = 10
+			historyDuringTx = len(histRepo.entries)
+			publishedDuringTx = len(changes)
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, histRepo, bus)
+
+	results, err := svc.Batch([]api.BatchOperation{
+		{Op: api.BatchOperationOpUpdate, ID: api.NewOptString("1"), Update: api.NewOptUpdateEventRequest(api.UpdateEventRequest{Title: optString("New")})},
+		{Op: api.BatchOperationOpCreate, Create: api.NewOptCreateEventRequest(api.CreateEventRequest{Title: "Created", StartTime: optDateTime("2026-02-02T10:00:00Z"), EndTime: optDateTime("2026-02-02T11:00:00Z")})},
+		{Op: api.BatchOperationOpDelete, ID: api.NewOptString("2")},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+	}
+	assert.Equal(t, "New", results[0].Event.Title)
+	assert.Equal(t, int64(10), results[1].Event.ID)
+	assert.Nil(t, results[2].Event)
+
+	assert.Equal(t, 1, historyDuringTx, "history is recorded in the transaction")
+	assert.Zero(t, publishedDuringTx, "changes are published after the commit")
+	require.Len(t, histRepo.entries, 3)
+	assert.Equal(t, model.ActionUpdate, histRepo.entries[0].Action)
+	assert.Equal(t, model.ActionCreate, histRepo.entries[1].Action)
+	assert.Equal(t, model.ActionDelete, histRepo.entries[2].Action)
+	assert.Equal(t, model.ActionUpdate, (<-changes).Action)
+}
+
+func TestBatch_FailedOperation(t *testing.T) {
+	bus := NewEventBus()
+	changes, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	repo := &mockRepo{
+		deleteFn: func(id int64) error {
+			if id == 2 {
+				return sql.ErrNoRows
+			}
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, bus)
+
+	results, err := svc.Batch([]api.BatchOperation{
+		{Op: api.BatchOperationOpDelete, ID: api.NewOptString("1")},
+		{Op: api.BatchOperationOpDelete, ID: api.NewOptString("2")},
+		{Op: api.BatchOperationOpUpdate, ID: api.NewOptString("3")},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.ErrorIs(t, results[0].Err, ErrBatchAborted)
+	assert.ErrorIs(t, results[1].Err, ErrNotFound)
+	assert.ErrorIs(t, results[2].Err, ErrBatchAborted)
+	assert.Empty(t, changes, "nothing is published for a rolled back batch")
+}
+
+func TestBatch_InvalidOperations(t *testing.T) {
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, nil, nil)
+	for name, op := range map[string]api.BatchOperation{
+		"create without create": {Op: api.BatchOperationOpCreate},
+		"update without id":     {Op: api.BatchOperationOpUpdate, Update: api.NewOptUpdateEventRequest(api.UpdateEventRequest{})},
+		"update without update": {Op: api.BatchOperationOpUpdate, ID: api.NewOptString("1")},
+		"invalid id":            {Op: api.BatchOperationOpDelete, ID: api.NewOptString("abc")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			results, err := svc.Batch([]api.BatchOperation{op})
+			require.NoError(t, err)
+			assert.ErrorIs(t, results[0].Err, ErrValidation)
+		})
+	}
+}
+
+func TestBatch_InternalError(t *testing.T) {
+	failure := errors.New("disk full")
+	repo := &mockRepo{deleteFn: func(id int64) error { return failure }}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+
+	_, err := svc.Batch([]api.BatchOperation{{Op: api.BatchOperationOpDelete, ID: api.NewOptString("1")}})
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestBulkUpdate_Validation(t *testing.T) {
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, nil, nil)
+
+	_, err := svc.BulkUpdate(&api.EventFilter{}, &api.UpdateEventRequest{Color: optString("red")})
+	assert.ErrorIs(t, err, ErrValidation, "empty filter")
+
+	_, err = svc.BulkUpdate(&api.EventFilter{Q: optString("work")}, &api.UpdateEventRequest{StartTime: optDateTime("2026-02-01T10:00:00Z")})
+	assert.ErrorIs(t, err, ErrValidation, "times")
+}
+
+func TestBulkDelete_SkipsOverridesOfDeletedParents(t *testing.T) {
+	parentID, otherParentID := int64(1), int64(4)
+	override := model.Event{ID: 5, RecurrenceParentID: &otherParentID, RecurrenceOriginalStart: "2026-03-09T09:00:00Z"}
+	var deleted []int64
+	var updated *model.Event
+	repo := &mockRepo{
+		findEventsFn: func(filter model.EventFilter, limit, offset int) ([]model.Event, error) {
+			assert.Equal(t, []int64{3}, filter.CalendarIDs)
+			return []model.Event{{ID: 2, RecurrenceParentID: &parentID}, {ID: 1}, override}, nil
+		},
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, RecurrenceFreq: "WEEKLY", StartTime: "2026-03-02T09:00:00Z", EndTime: "2026-03-02T09:30:00Z"}, nil
+		},
+		getOverrideFn: func(parentID int64, originalStart string) (*model.Event, error) {
+			return &override, nil
+		},
+		updateFn: func(e *model.Event) error {
+			updated = e
+			return nil
+		},
+		deleteFn: func(id int64) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+
+	events, err := svc.BulkDelete(&api.EventFilter{CalendarID: []int64{3}})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, []int64{1, 5}, deleted)
+	require.NotNil(t, updated, "the instance of an override without its parent is excluded")
+	assert.Equal(t, otherParentID, updated.ID)
+	assert.Equal(t, "2026-03-09T09:00:00Z", updated.ExDates)
+}
+
+func TestBulkDelete_ManyRecurringEventsOutsideRange(t *testing.T) {
+	var stored []model.Event
+	for i := range maxBulkEvents + 200 {
+		stored = append(stored, model.Event{ID: int64(i + 1), StartTime: "2025-01-06T09:00:00Z", EndTime: "2025-01-06T10:00:00Z", RecurrenceFreq: "WEEKLY", RecurrenceCount: 3})
+	}
+	stored = append(stored, model.Event{ID: 5000, StartTime: "2026-03-10T09:00:00Z", EndTime: "2026-03-10T10:00:00Z"})
+	var deleted []int64
+	repo := &mockRepo{
+		findEventsFn: func(filter model.EventFilter, limit, offset int) ([]model.Event, error) {
+			return stored[min(offset, len(stored)):min(offset+limit, len(stored))], nil
+		},
+		deleteFn: func(id int64) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+
+	events, err := svc.BulkDelete(&api.EventFilter{From: optDateTime("2026-03-01T00:00:00Z"), To: optDateTime("2026-04-01T00:00:00Z")})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, []int64{5000}, deleted)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// Kinds of things whose changes are published on the event bus.
+const (
+	KindEvent    = "event"
+	KindCalendar = "calendar"
+	KindFeed     = "feed"
+)
+
+// ActionRefreshFailed is published for a feed whose refresh failed, in
+// addition to the update of the feed with the error.
+const ActionRefreshFailed = "refresh_failed"
+
+// subscriberBuffer is how many changes a subscriber may fall behind before it
+// is disconnected.
+const subscriberBuffer = 64
+
+// Change announces that something was created, updated or deleted.
+type Change struct {
+	Kind   string // KindEvent, KindCalendar or KindFeed
+	Action string // model.ActionCreate, model.ActionUpdate, model.ActionDelete or ActionRefreshFailed
+	ID     int64
+	// Event is the changed event, as it was before a deletion, for changes
+	// recorded in the event history.
+	Event *model.Event
+	// Feed is the changed feed, except for deletions.
+	Feed *model.Feed
+}
+
+// EventBus fans out the changes made through the services to subscribers,
+// such as the clients of the change stream. A nil *EventBus discards
+// everything published on it.
+type EventBus struct {
+	mu       sync.Mutex
+	subs     map[chan Change]struct{}
+	handlers []func(Change)
+	closed   bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: map[chan Change]struct{}{}}
+}
+
+// Subscribe returns a channel that receives every change published from now
+// on, and a function to unsubscribe. The channel is closed when the
+// subscriber is unsubscribed, falls too far behind, or the bus is closed; the
+// subscriber should then assume it has missed changes.
+func (b *EventBus) Subscribe() (<-chan Change, func()) {
+	ch := make(chan Change, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(ch)
+	}
+}
+
+// OnChange registers fn to be called with every change, before Publish
+// returns. Unlike subscribers, handlers never miss a change, so they must be
+// quick.
+func (b *EventBus) OnChange(fn func(Change)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// Publish sends a change to all subscribers without blocking, and calls the
+// handlers.
+func (b *EventBus) Publish(c Change) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	for ch := range b.subs {
+		select {
+		case ch <- c:
+		default:
+			b.remove(ch)
+		}
+	}
+	handlers := b.handlers
+	b.mu.Unlock()
+	for _, fn := range handlers {
+		fn(c)
+	}
+}
+
+// Close closes the channels of all subscribers, so that long-lived streams
+// end, e.g. on server shutdown.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		b.remove(ch)
+	}
+}
+
+func (b *EventBus) remove(ch chan Change) {
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// eventChange returns the change to announce for a change recorded in the
+// event history. A restore brings back a deleted event or reverts an update.
+func eventChange(action string, eventID int64, old, new *model.Event) Change {
+	if action == model.ActionRestore {
+		action = model.ActionUpdate
+		if old == nil {
+			action = model.ActionCreate
+		}
+	}
+	event := new
+	if event == nil {
+		event = old
+	}
+	return Change{Kind: KindEvent, Action: action, ID: eventID, Event: event}
+}
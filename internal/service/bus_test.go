@@ -0,0 +1,131 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	a, unsubscribeA := bus.Subscribe()
+	b, unsubscribeB := bus.Subscribe()
+
+	change := Change{Kind: KindEvent, Action: model.ActionCreate, ID: 1}
+	bus.Publish(change)
+	assert.Equal(t, change, <-a)
+	assert.Equal(t, change, <-b)
+
+	unsubscribeA()
+	_, ok := <-a
+	assert.False(t, ok, "channel is closed on unsubscribe")
+	unsubscribeA() // unsubscribing twice is harmless
+
+	bus.Close()
+	_, ok = <-b
+	assert.False(t, ok, "channel is closed with the bus")
+	unsubscribeB()
+
+	c, _ := bus.Subscribe()
+	_, ok = <-c
+	assert.False(t, ok, "subscribing to a closed bus gives a closed channel")
+}
+
+func TestEventBus_DisconnectsSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	for i := range subscriberBuffer + 1 {
+		bus.Publish(Change{Kind: KindEvent, Action: model.ActionUpdate, ID: int64(i)})
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Equal(t, subscriberBuffer, n)
+}
+
+func TestEventBus_Nil(t *testing.T) {
+	var bus *EventBus
+	bus.Publish(Change{Kind: KindEvent, Action: model.ActionCreate, ID: 1})
+}
+
+func TestEventService_PublishesChanges(t *testing.T) {
+	repo := &mockRepo{
+		createFn: func(e *model.Event) error {
+			e.ID = 7
+			return nil
+		},
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Old", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}, nil
+		},
+	}
+	bus := NewEventBus()
+	changes, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	svc := NewEventService(repo, &mockCalRepo{}, nil, bus)
+
+	_, err := svc.Create(&api.CreateEventRequest{
+		Title:     "New",
+		StartTime: optDateTime("2026-03-15T10:00:00Z"),
+		EndTime:   optDateTime("2026-03-15T11:00:00Z"),
+	})
+	require.NoError(t, err)
+	c := <-changes
+	assert.Equal(t, KindEvent, c.Kind)
+	assert.Equal(t, model.ActionCreate, c.Action)
+	assert.Equal(t, int64(7), c.ID)
+	require.NotNil(t, c.Event)
+	assert.Equal(t, "New", c.Event.Title)
+
+	require.NoError(t, svc.Delete(7))
+	c = <-changes
+	assert.Equal(t, model.ActionDelete, c.Action)
+	require.NotNil(t, c.Event, "a deletion carries the deleted event")
+	assert.Equal(t, "Old", c.Event.Title)
+}
+
+func TestEventBus_OnChange(t *testing.T) {
+	bus := NewEventBus()
+	var got []Change
+	bus.OnChange(func(c Change) { got = append(got, c) })
+	bus.Publish(Change{Kind: KindFeed, Action: ActionRefreshFailed, ID: 3})
+	bus.Close()
+	bus.Publish(Change{Kind: KindFeed, Action: model.ActionDelete, ID: 3})
+	require.Len(t, got, 2, "handlers are called even after the subscribers are gone")
+	assert.Equal(t, ActionRefreshFailed, got[0].Action)
+}
+
+func TestCalendarService_PublishesChanges(t *testing.T) {
+	bus := NewEventBus()
+	changes, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	svc := NewCalendarService(&mockCalRepo{}, bus)
+
+	id, err := svc.GetOrCreateByName("Work")
+	require.NoError(t, err)
+	assert.Equal(t, Change{Kind: KindCalendar, Action: model.ActionCreate, ID: id}, <-changes)
+}
+
+func TestImportSingle_PublishesCalendarAfterCommit(t *testing.T) {
+	bus := NewEventBus()
+	changes, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	var publishedDuringTx int
+	repo := &mockRepo{
+		createFn: func(e *model.Event) error {
+			publishedDuringTx = len(changes)
+			return errRepo
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, bus)
+
+	_, err := svc.ImportSingle([]model.Event{{Title: "Meeting", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}}, "Work")
+	require.ErrorIs(t, err, errRepo)
+	assert.Zero(t, publishedDuringTx, "the new calendar is published after the commit")
+	assert.Empty(t, changes, "nothing is published for a rolled back import")
+}
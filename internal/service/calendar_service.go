@@ -9,10 +9,11 @@ import (
 
 type CalendarService struct {
 	repo repository.CalendarRepository
+	bus  *EventBus
 }
 
-func NewCalendarService(repo repository.CalendarRepository) *CalendarService {
-	return &CalendarService{repo: repo}
+func NewCalendarService(repo repository.CalendarRepository, bus *EventBus) *CalendarService {
+	return &CalendarService{repo: repo, bus: bus}
 }
 
 func (s *CalendarService) List() ([]model.Calendar, error) {
@@ -46,6 +47,7 @@ func (s *CalendarService) Update(id int64, name, color string) (*model.Calendar,
 	if err := s.repo.UpdateCalendar(cal); err != nil {
 		return nil, err
 	}
+	s.bus.Publish(Change{Kind: KindCalendar, Action: model.ActionUpdate, ID: cal.ID})
 	return cal, nil
 }
 
@@ -68,6 +70,7 @@ func (s *CalendarService) GetOrCreateByName(name string) (int64, error) {
 	if err := s.repo.CreateCalendar(newCal); err != nil {
 		return 0, err
 	}
+	s.bus.Publish(Change{Kind: KindCalendar, Action: model.ActionCreate, ID: newCal.ID})
 	return newCal.ID, nil
 }
 
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func toOptDateTime(s string) api.OptDateTime {
+	if s != "" {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return api.NewOptDateTime(t)
+		}
+	}
+	return api.OptDateTime{}
+}
+
+func toOptURI(s string) api.OptURI {
+	if s != "" {
+		if u, err := url.Parse(s); err == nil {
+			return api.NewOptURI(*u)
+		}
+	}
+	return api.OptURI{}
+}
+
+// EventToAPI converts an event to its API representation. StringID must be set.
+func EventToAPI(e *model.Event) *api.Event {
+	ae := &api.Event{
+		ID:    e.StringID,
+		Title: e.Title,
+	}
+	if e.AllDay {
+		ae.AllDay = api.NewOptBool(true)
+		if t, err := time.Parse(time.RFC3339, e.StartTime); err == nil {
+			ae.StartDate = api.NewOptDate(t)
+		}
+		if t, err := time.Parse(time.RFC3339, e.EndTime); err == nil {
+			ae.EndDate = api.NewOptDate(t)
+		}
+	} else {
+		if t, err := time.Parse(time.RFC3339, e.StartTime); err == nil {
+			ae.StartTime = api.NewOptDateTime(t)
+		}
+		if t, err := time.Parse(time.RFC3339, e.EndTime); err == nil {
+			ae.EndTime = api.NewOptDateTime(t)
+		}
+	}
+	if e.ParentID != "" {
+		ae.ParentID = api.NewOptString(e.ParentID)
+	}
+	if e.Description != "" {
+		ae.Description = api.NewOptString(e.Description)
+	}
+	if e.Color != "" {
+		ae.Color = api.NewOptString(e.Color)
+	}
+	if e.RecurrenceFreq != "" {
+		ae.RecurrenceFreq = api.NewOptEventRecurrenceFreq(api.EventRecurrenceFreq(e.RecurrenceFreq))
+	}
+	if e.RecurrenceCount != 0 {
+		ae.RecurrenceCount = api.NewOptInt(e.RecurrenceCount)
+	}
+	ae.RecurrenceUntil = toOptDateTime(e.RecurrenceUntil)
+	if e.RecurrenceInterval != 0 {
+		ae.RecurrenceInterval = api.NewOptInt(e.RecurrenceInterval)
+	}
+	if e.RecurrenceByDay != "" {
+		ae.RecurrenceByDay = api.NewOptString(e.RecurrenceByDay)
+	}
+	if e.RecurrenceByMonthDay != "" {
+		ae.RecurrenceByMonthday = api.NewOptString(e.RecurrenceByMonthDay)
+	}
+	if e.RecurrenceByMonth != "" {
+		ae.RecurrenceByMonth = api.NewOptString(e.RecurrenceByMonth)
+	}
+	if e.ExDates != "" {
+		ae.Exdates = api.NewOptString(e.ExDates)
+	}
+	if e.RDates != "" {
+		ae.Rdates = api.NewOptString(e.RDates)
+	}
+	if e.RecurrenceParentID != nil {
+		ae.RecurrenceParentID = api.NewOptNilInt64(*e.RecurrenceParentID)
+	}
+	if e.RecurrenceOriginalStart != "" {
+		ae.RecurrenceOriginalStart = toOptDateTime(e.RecurrenceOriginalStart)
+	}
+	if e.Duration != "" {
+		ae.Duration = api.NewOptString(e.Duration)
+	}
+	if e.Categories != "" {
+		ae.Categories = api.NewOptString(e.Categories)
+	}
+	ae.URL = toOptURI(e.URL)
+	if e.ReminderMinutes != 0 {
+		ae.ReminderMinutes = api.NewOptInt(e.ReminderMinutes)
+	}
+	if e.Transparent {
+		ae.Transparent = api.NewOptBool(true)
+	}
+	if e.Location != "" {
+		ae.Location = api.NewOptString(e.Location)
+	}
+	if e.Latitude != nil {
+		ae.Latitude = api.NewOptNilFloat64(*e.Latitude)
+	}
+	if e.Longitude != nil {
+		ae.Longitude = api.NewOptNilFloat64(*e.Longitude)
+	}
+	ae.CalendarID = api.NewOptInt64(e.CalendarID)
+	if e.CalendarName != "" {
+		ae.CalendarName = api.NewOptString(e.CalendarName)
+	}
+	ae.CreatedAt = toOptDateTime(e.CreatedAt)
+	ae.UpdatedAt = toOptDateTime(e.UpdatedAt)
+	ae.DeletedAt = toOptDateTime(e.DeletedAt)
+	if e.Snippet != "" {
+		ae.Snippet = api.NewOptString(e.Snippet)
+	}
+	return ae
+}
+
+// FeedToAPI converts a feed subscription to its API representation.
+func FeedToAPI(f *model.Feed) *api.Feed {
+	feedURL, _ := url.Parse(f.URL)
+	af := &api.Feed{
+		ID:  f.ID,
+		URL: *feedURL,
+	}
+	if f.Type == model.FeedTypeCalDAV {
+		af.Type = api.NewOptFeedType(api.FeedTypeCaldav)
+	} else {
+		af.Type = api.NewOptFeedType(api.FeedTypeIcs)
+	}
+	if f.Username != "" {
+		af.Username = api.NewOptString(f.Username)
+	}
+	switch f.AuthType {
+	case model.FeedAuthBasic:
+		af.Auth = api.NewOptFeedAuth(api.FeedAuthBasic)
+	case model.FeedAuthBearer:
+		af.Auth = api.NewOptFeedAuth(api.FeedAuthBearer)
+	default:
+		af.Auth = api.NewOptFeedAuth(api.FeedAuthNone)
+	}
+	af.HeaderNames = f.HeaderNames
+	if f.CollectionURL != "" {
+		af.CollectionURL = api.NewOptString(f.CollectionURL)
+	}
+	af.Rules = feedRulesToAPI(f.Rules)
+	if f.CalendarID != 0 {
+		af.CalendarID = api.NewOptInt64(f.CalendarID)
+	}
+	if f.CalendarName != "" {
+		af.CalendarName = api.NewOptString(f.CalendarName)
+	}
+	if f.RefreshIntervalMinutes != 0 {
+		af.RefreshIntervalMinutes = api.NewOptInt(f.RefreshIntervalMinutes)
+	}
+	af.LastRefreshedAt = toOptDateTime(f.LastRefreshedAt)
+	if f.LastError != "" {
+		af.LastError = api.NewOptString(f.LastError)
+	}
+	af.Enabled = api.NewOptBool(f.Enabled)
+	af.CreatedAt = toOptDateTime(f.CreatedAt)
+	af.UpdatedAt = toOptDateTime(f.UpdatedAt)
+	return af
+}
+
+// feedRulesToAPI converts the rules of a feed, leaving out empty fields.
+func feedRulesToAPI(rules []model.FeedRule) api.FeedRules {
+	if rules == nil {
+		return nil
+	}
+	result := make(api.FeedRules, len(rules))
+	for i, r := range rules {
+		result[i] = api.FeedRule{
+			Field:   api.NewOptFeedRuleField(api.FeedRuleField(r.Field)),
+			Pattern: optNonEmptyString(r.Pattern),
+			Action:  api.FeedRuleAction(r.Action),
+			Value:   optNonEmptyString(r.Value),
+		}
+	}
+	return result
+}
+
+// FeedPreviewToAPI converts a preview of the rules of a feed.
+func FeedPreviewToAPI(p *FeedPreview) *api.FeedPreview {
+	fetchedAt, _ := time.Parse(time.RFC3339, p.FetchedAt)
+	ap := &api.FeedPreview{
+		FetchedAt: fetchedAt,
+		Total:     p.Total,
+		Imported:  p.Imported,
+		Events:    make([]api.FeedPreviewEvent, len(p.Events)),
+	}
+	for i, e := range p.Events {
+		start, _ := time.Parse(time.RFC3339, e.StartTime)
+		end, _ := time.Parse(time.RFC3339, e.EndTime)
+		ae := api.FeedPreviewEvent{
+			UID:        optNonEmptyString(e.ImportUID),
+			Title:      e.Title,
+			StartTime:  start,
+			EndTime:    end,
+			AllDay:     e.AllDay,
+			Location:   optNonEmptyString(e.Location),
+			Categories: optNonEmptyString(e.Categories),
+			Color:      optNonEmptyString(e.Color),
+			Excluded:   e.Excluded,
+		}
+		if e.ReminderMinutes != 0 {
+			ae.ReminderMinutes = api.NewOptInt(e.ReminderMinutes)
+		}
+		if e.Transparent {
+			ae.Transparent = api.NewOptBool(true)
+		}
+		ap.Events[i] = ae
+	}
+	return ap
+}
+
+// WebhookToAPI converts a webhook to its API representation, without the secret.
+func WebhookToAPI(hook *model.Webhook) *api.Webhook {
+	hookURL, _ := url.Parse(hook.URL)
+	ah := &api.Webhook{
+		ID:         hook.ID,
+		URL:        *hookURL,
+		EventTypes: make([]api.WebhookEventType, len(hook.EventTypes)),
+		Enabled:    hook.Enabled,
+		CreatedAt:  toOptDateTime(hook.CreatedAt),
+		UpdatedAt:  toOptDateTime(hook.UpdatedAt),
+	}
+	for i, t := range hook.EventTypes {
+		ah.EventTypes[i] = api.WebhookEventType(t)
+	}
+	return ah
+}
+
+// PublicationToAPI converts a publication to its API representation.
+func PublicationToAPI(pub *model.Publication) *api.Publication {
+	ap := &api.Publication{
+		ID:           pub.ID,
+		Name:         pub.Name,
+		CalendarIds:  pub.CalendarIDs,
+		HiddenFields: make([]api.PublicationField, len(pub.HiddenFields)),
+		TimeZone:     pub.TimeZone,
+		Enabled:      pub.Enabled,
+		URL:          "public/" + pub.Token,
+		IcsURL:       "public/" + pub.Token + ".ics",
+		CreatedAt:    toOptDateTime(pub.CreatedAt),
+		UpdatedAt:    toOptDateTime(pub.UpdatedAt),
+	}
+	if ap.CalendarIds == nil {
+		ap.CalendarIds = []int64{}
+	}
+	for i, f := range pub.HiddenFields {
+		ap.HiddenFields[i] = api.PublicationField(f)
+	}
+	return ap
+}
+
+// DeliveryToAPI converts a webhook delivery to its API representation.
+func DeliveryToAPI(d *model.WebhookDelivery) *api.WebhookDelivery {
+	ad := &api.WebhookDelivery{
+		ID:          d.ID,
+		EventType:   api.WebhookEventType(d.EventType),
+		Status:      api.WebhookDeliveryStatus(d.Status),
+		Attempts:    d.Attempts,
+		DeliveredAt: toOptDateTime(d.DeliveredAt),
+	}
+	if d.Status == model.DeliveryPending {
+		ad.NextAttemptAt = toOptDateTime(d.NextAttemptAt)
+	}
+	if d.LastStatus != 0 {
+		ad.LastStatus = api.NewOptInt(d.LastStatus)
+	}
+	if d.LastError != "" {
+		ad.LastError = api.NewOptString(d.LastError)
+	}
+	if t, err := time.Parse(time.RFC3339, d.CreatedAt); err == nil {
+		ad.CreatedAt = t
+	}
+	return ad
+}
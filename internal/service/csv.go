@@ -0,0 +1,560 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// csvFields are the fields of CreateEventRequest, by their JSON names, that
+// CSV columns can be mapped to.
+var csvFields = map[string]bool{
+	"title": true, "description": true, "all_day": true,
+	"start_date": true, "end_date": true, "start_time": true, "end_time": true, "duration": true,
+	"location": true, "latitude": true, "longitude": true, "categories": true, "url": true,
+	"color": true, "reminder_minutes": true, "calendar_id": true,
+	"recurrence_freq": true, "recurrence_count": true, "recurrence_until": true, "recurrence_interval": true,
+	"recurrence_by_day": true, "recurrence_by_monthday": true, "recurrence_by_month": true,
+	"exdates": true, "rdates": true,
+}
+
+// csvHeaderAliases map the normalized column headers of common spreadsheet
+// and calendar exports, such as Google Calendar's, to fields.
+var csvHeaderAliases = map[string]string{
+	"subject":       "title",
+	"summary":       "title",
+	"name":          "title",
+	"notes":         "description",
+	"all_day_event": "all_day",
+	"category":      "categories",
+	"start":         "start_time",
+	"end":           "end_time",
+	"reminder":      "reminder_minutes",
+}
+
+// csvExportColumns are the columns of a CSV export. Apart from id, they are
+// fields of CreateEventRequest, so that an export can be imported again.
+var csvExportColumns = []string{
+	"id", "title", "description", "all_day", "start_date", "end_date", "start_time", "end_time",
+	"location", "latitude", "longitude", "categories", "url", "color", "reminder_minutes", "calendar_id",
+}
+
+// csvTextFields are the columns of free text, which may start with characters
+// that spreadsheets take for a formula.
+var csvTextFields = map[string]bool{"title": true, "description": true, "location": true, "categories": true}
+
+// csvDateFormats are the date formats CSV imports detect, in order of
+// preference when several of them fit.
+var csvDateFormats = []struct {
+	name, layout string
+}{
+	{"YYYY-MM-DD", "2006-1-2"},
+	{"MM/DD/YYYY", "1/2/2006"},
+	{"DD/MM/YYYY", "2/1/2006"},
+	{"DD.MM.YYYY", "2.1.2006"},
+	{"DD-MM-YYYY", "2-1-2006"},
+	{"YYYY/MM/DD", "2006/1/2"},
+}
+
+// csvTimeLayouts are the formats of times of day, after upper-casing.
+var csvTimeLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04:05 PM", "3 PM", "3PM"}
+
+// CSVImportOptions configure a CSV import.
+type CSVImportOptions struct {
+	// Columns maps fields of CreateEventRequest, by their JSON names, to the
+	// headers of the columns holding them. If empty, columns are mapped by
+	// their headers.
+	Columns map[string]string
+	// DateFormat is the format of dates, such as "DD/MM/YYYY". If empty, it
+	// is detected from the values.
+	DateFormat string
+	// Location is the time zone of times without an offset, UTC if nil.
+	Location *time.Location
+	// Calendar is the name of the calendar of the rows without calendar_id.
+	Calendar string
+	// DryRun validates the rows without importing them.
+	DryRun bool
+}
+
+// CSVRow is the result of one row of a CSV import.
+type CSVRow struct {
+	Row   int // the row in the spreadsheet, the header being row 1
+	Event *model.Event
+	Err   error
+}
+
+// CSVImportResult is the result of a CSV import.
+type CSVImportResult struct {
+	DateFormat string // the date format used
+	Rows       []CSVRow
+	Committed  bool
+}
+
+// ImportCSV creates an event from each row of a CSV file with a header row.
+// The rows go through the same validation as created events. Nothing is
+// imported if any row is invalid or opts.DryRun is set; the result then has
+// the events that would be created and the errors of the invalid rows.
+func (s *EventService) ImportCSV(r io.Reader, opts CSVImportOptions) (*CSVImportResult, error) {
+	if len(opts.Calendar) > model.MaxCalendarNameLength {
+		return nil, fmt.Errorf("%w: calendar name must be at most %d characters", ErrValidation, model.MaxCalendarNameLength)
+	}
+	records, err := readCSV(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV: %s", ErrValidation, err.Error())
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: CSV has no header row", ErrValidation)
+	}
+	columns, err := csvColumns(records[0], opts.Columns)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+	}
+	rows := records[1:]
+
+	result := &CSVImportResult{DateFormat: opts.DateFormat}
+	var layout string
+	if opts.DateFormat == "" {
+		result.DateFormat, layout = detectDateFormat(rows, columns)
+	} else {
+		for _, f := range csvDateFormats {
+			if f.name == opts.DateFormat {
+				layout = f.layout
+			}
+		}
+		if layout == "" {
+			return nil, fmt.Errorf("%w: unknown date format %q", ErrValidation, opts.DateFormat)
+		}
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	valid := true
+	for i, record := range rows {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		row := CSVRow{Row: i + 2}
+		req, err := csvRequest(record, columns, layout, loc)
+		if err == nil {
+			row.Event, err = s.newEvent(req)
+		} else {
+			err = fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
+		if err != nil {
+			if !errors.Is(err, ErrValidation) {
+				return nil, err
+			}
+			row.Err = err
+			valid = false
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if opts.DryRun || !valid {
+		return result, nil
+	}
+
+	err = s.inTx(func(tx *EventService) error {
+		calendarID, err := tx.resolveCalendarName(opts.Calendar)
+		if err != nil {
+			return err
+		}
+		for _, row := range result.Rows {
+			e := row.Event
+			if e.CalendarID == 0 {
+				e.CalendarID = calendarID
+			}
+			if err := tx.repo.Create(e); err != nil {
+				return err
+			}
+			if err := tx.history.record(tx.actor, model.ActionCreate, e.ID, nil, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Committed = true
+	return result, nil
+}
+
+// readCSV reads all records of a CSV file, separated by commas, or by
+// semicolons or tabs if the header row has more of those, as spreadsheets in
+// some locales write.
+func readCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	comma := ','
+	for _, c := range []rune{';', '\t'} {
+		if bytes.Count(header, []byte(string(c))) > bytes.Count(header, []byte(string(comma))) {
+			comma = c
+		}
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	return cr.ReadAll()
+}
+
+// csvColumns returns the index of the column of each mapped field.
+func csvColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := make(map[string]int)
+	if len(mapping) == 0 {
+		for i, h := range header {
+			field := strings.ToLower(strings.TrimSpace(h))
+			field = strings.NewReplacer(" ", "_", "-", "_").Replace(field)
+			if alias, ok := csvHeaderAliases[field]; ok {
+				field = alias
+			}
+			if _, mapped := columns[field]; csvFields[field] && !mapped {
+				columns[field] = i
+			}
+		}
+	} else {
+		fields := make([]string, 0, len(mapping))
+		for field := range mapping {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if !csvFields[field] {
+				return nil, fmt.Errorf("unknown field %q", field)
+			}
+			i := indexFold(header, mapping[field])
+			if i < 0 {
+				return nil, fmt.Errorf("no column %q for %s", mapping[field], field)
+			}
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, fmt.Errorf("no column for title")
+	}
+	_, hasDate := columns["start_date"]
+	_, hasTime := columns["start_time"]
+	if !hasDate && !hasTime {
+		return nil, fmt.Errorf("no column for start_date or start_time")
+	}
+	return columns, nil
+}
+
+func indexFold(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// detectDateFormat returns the date format, and its layout, that most of the
+// dates in the rows have.
+func detectDateFormat(rows [][]string, columns map[string]int) (name, layout string) {
+	var values []string
+	for _, record := range rows {
+		for _, field := range []string{"start_date", "end_date", "start_time", "end_time"} {
+			if v := csvValue(record, columns, field); v != "" {
+				if _, ok := parseTimeOfDay(v); !ok {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	best, bestCount := 0, -1
+	for i, f := range csvDateFormats {
+		count := 0
+		for _, v := range values {
+			if _, ok := parseCSVDate(v, f.layout); ok {
+				count++
+			} else if _, ok := parseCSVDateTime(v, f.layout, time.UTC); ok {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	return csvDateFormats[best].name, csvDateFormats[best].layout
+}
+
+func csvValue(record []string, columns map[string]int, field string) string {
+	i, ok := columns[field]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// csvRequest maps a row to a create event request. Dates are in the date
+// format layout, and times without an offset in loc; times are converted to
+// UTC. Times of day are on the
+// date of start_date or end_date. Rows without all_day are all-day events if
+// they have no start time.
+func csvRequest(record []string, columns map[string]int, layout string, loc *time.Location) (*api.CreateEventRequest, error) {
+	get := func(field string) string {
+		v := csvValue(record, columns, field)
+		if csvTextFields[field] {
+			v = unescapeCSVFormula(v)
+		}
+		return v
+	}
+	req := &api.CreateEventRequest{Title: get("title")}
+
+	for field, opt := range map[string]*api.OptString{
+		"description":            &req.Description,
+		"location":               &req.Location,
+		"categories":             &req.Categories,
+		"color":                  &req.Color,
+		"duration":               &req.Duration,
+		"recurrence_until":       &req.RecurrenceUntil,
+		"recurrence_by_day":      &req.RecurrenceByDay,
+		"recurrence_by_monthday": &req.RecurrenceByMonthday,
+		"recurrence_by_month":    &req.RecurrenceByMonth,
+		"exdates":                &req.Exdates,
+		"rdates":                 &req.Rdates,
+	} {
+		if v := get(field); v != "" {
+			*opt = api.NewOptString(v)
+		}
+	}
+	if v := get("recurrence_freq"); v != "" {
+		req.RecurrenceFreq = api.NewOptCreateEventRequestRecurrenceFreq(api.CreateEventRequestRecurrenceFreq(strings.ToUpper(v)))
+	}
+	for field, opt := range map[string]*api.OptInt{
+		"recurrence_count":    &req.RecurrenceCount,
+		"recurrence_interval": &req.RecurrenceInterval,
+		"reminder_minutes":    &req.ReminderMinutes,
+	} {
+		if v := get(field); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a whole number", field)
+			}
+			*opt = api.NewOptInt(n)
+		}
+	}
+	if v := get("calendar_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("calendar_id must be a whole number")
+		}
+		req.CalendarID = api.NewOptInt64(id)
+	}
+	for field, opt := range map[string]*api.OptNilFloat64{
+		"latitude":  &req.Latitude,
+		"longitude": &req.Longitude,
+	} {
+		if v := get(field); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", field)
+			}
+			*opt = api.NewOptNilFloat64(f)
+		}
+	}
+	if v := get("url"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("url is invalid")
+		}
+		req.URL = api.NewOptURI(*u)
+	}
+
+	var startDate, endDate time.Time
+	if v := get("start_date"); v != "" {
+		d, ok := parseCSVDate(v, layout)
+		if !ok {
+			return nil, fmt.Errorf("start_date %q is not a date", v)
+		}
+		startDate = d
+		req.StartDate = api.NewOptDate(d)
+	}
+	if v := get("end_date"); v != "" {
+		d, ok := parseCSVDate(v, layout)
+		if !ok {
+			return nil, fmt.Errorf("end_date %q is not a date", v)
+		}
+		endDate = d
+		req.EndDate = api.NewOptDate(d)
+	}
+	if endDate.IsZero() {
+		endDate = startDate
+	}
+	for _, t := range []struct {
+		field string
+		date  time.Time
+		opt   *api.OptDateTime
+	}{
+		{"start_time", startDate, &req.StartTime},
+		{"end_time", endDate, &req.EndTime},
+	} {
+		v := get(t.field)
+		if v == "" {
+			continue
+		}
+		if dt, ok := parseCSVDateTime(v, layout, loc); ok {
+			*t.opt = api.NewOptDateTime(dt.UTC())
+			continue
+		}
+		tod, ok := parseTimeOfDay(v)
+		if !ok {
+			return nil, fmt.Errorf("%s %q is not a time", t.field, v)
+		}
+		if t.date.IsZero() {
+			return nil, fmt.Errorf("%s %q has no date", t.field, v)
+		}
+		*t.opt = api.NewOptDateTime(time.Date(t.date.Year(), t.date.Month(), t.date.Day(),
+			tod.Hour(), tod.Minute(), tod.Second(), 0, loc).UTC())
+	}
+
+	if v := get("all_day"); v != "" {
+		allDay, ok := parseCSVBool(v)
+		if !ok {
+			return nil, fmt.Errorf("all_day %q is not true or false", v)
+		}
+		req.AllDay = allDay
+	} else {
+		req.AllDay = !req.StartTime.Set
+	}
+	if req.AllDay {
+		req.StartTime, req.EndTime = api.OptDateTime{}, api.OptDateTime{}
+	} else {
+		req.StartDate, req.EndDate = api.OptDate{}, api.OptDate{}
+	}
+	return req, nil
+}
+
+func parseCSVDate(v, layout string) (time.Time, bool) {
+	t, err := time.Parse(layout, v)
+	return t, err == nil
+}
+
+// parseCSVDateTime parses an RFC 3339 time, or a date in the date format
+// layout followed by a time of day in loc.
+func parseCSVDateTime(v, layout string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	v = strings.ToUpper(v)
+	for _, sep := range []string{" ", "T"} {
+		for _, tl := range csvTimeLayouts {
+			if t, err := time.ParseInLocation(layout+sep+tl, v, loc); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseTimeOfDay(v string) (time.Time, bool) {
+	v = strings.ToUpper(v)
+	for _, tl := range csvTimeLayouts {
+		if t, err := time.Parse(tl, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseCSVBool(v string) (value, ok bool) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "y", "1", "x":
+		return true, true
+	case "false", "no", "n", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// escapeCSVFormula prefixes text that a spreadsheet would take for a formula
+// with an apostrophe, which spreadsheets hide.
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeCSVFormula reverts escapeCSVFormula.
+func unescapeCSVFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// WriteCSV writes the events between from and to, as listed by List, to w as
+// CSV with a header row, and returns the number of events written.
+func (s *EventService) WriteCSV(w io.Writer, from, to string, calendarIDs []int64) (int, error) {
+	events, err := s.List(from, to, calendarIDs)
+	if err != nil {
+		return 0, err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvExportColumns); err != nil {
+		return 0, err
+	}
+	for i := range events {
+		if err := cw.Write(csvRecord(&events[i])); err != nil {
+			return i, err
+		}
+	}
+	cw.Flush()
+	return len(events), cw.Error()
+}
+
+// csvRecord returns the values of the csvExportColumns of e.
+func csvRecord(e *model.Event) []string {
+	e.SetStringID()
+	values := map[string]string{
+		"id":          e.StringID,
+		"title":       e.Title,
+		"description": e.Description,
+		"all_day":     strconv.FormatBool(e.AllDay),
+		"location":    e.Location,
+		"categories":  e.Categories,
+		"url":         e.URL,
+		"color":       e.Color,
+		"calendar_id": strconv.FormatInt(e.CalendarID, 10),
+	}
+	if e.AllDay {
+		values["start_date"], _, _ = strings.Cut(e.StartTime, "T")
+		values["end_date"], _, _ = strings.Cut(e.EndTime, "T")
+	} else {
+		values["start_time"] = e.StartTime
+		values["end_time"] = e.EndTime
+	}
+	if e.Latitude != nil && e.Longitude != nil {
+		values["latitude"] = strconv.FormatFloat(*e.Latitude, 'f', -1, 64)
+		values["longitude"] = strconv.FormatFloat(*e.Longitude, 'f', -1, 64)
+	}
+	if e.ReminderMinutes > 0 {
+		values["reminder_minutes"] = strconv.Itoa(e.ReminderMinutes)
+	}
+	record := make([]string, len(csvExportColumns))
+	for i, column := range csvExportColumns {
+		record[i] = values[column]
+		if csvTextFields[column] {
+			record[i] = escapeCSVFormula(record[i])
+		}
+	}
+	return record
+}
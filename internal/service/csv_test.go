@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestImportCSV_ByHeader(t *testing.T) {
+	var created []*model.Event
+	repo := &mockRepo{createFn: func(e *model.Event) error {
+		e.ID = int64(len(created) + 1)
+		created = append(created, e)
+		return nil
+	}}
+	histRepo := &mockHistoryRepo{}
+	svc := NewEventService(repo, &mockCalRepo{}, histRepo, nil)
+
+	input := "\xef\xbb\xbfSubject;Start Date;Start Time;End Date;End Time;All Day Event;Location\n" +
+		"Team meeting;17/02/2026;2:00 PM;17/02/2026;3:00 PM;False;Office\n" +
+		";;;;;;\n" +
+		"'=Holiday;03/04/2026;;04/04/2026;;True;\n"
+	result, err := svc.ImportCSV(strings.NewReader(input), CSVImportOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Committed)
+	assert.Equal(t, "DD/MM/YYYY", result.DateFormat)
+	require.Len(t, result.Rows, 2)
+	assert.Equal(t, 2, result.Rows[0].Row)
+	assert.Equal(t, 4, result.Rows[1].Row)
+
+	require.Len(t, created, 2)
+	assert.Equal(t, "Team meeting", created[0].Title)
+	assert.Equal(t, "2026-02-17T14:00:00Z", created[0].StartTime)
+	assert.Equal(t, "2026-02-17T15:00:00Z", created[0].EndTime)
+	assert.Equal(t, "Office", created[0].Location)
+	assert.Equal(t, "=Holiday", created[1].Title)
+	assert.True(t, created[1].AllDay)
+	assert.Equal(t, "2026-04-03T00:00:00Z", created[1].StartTime)
+	assert.Len(t, histRepo.entries, 2)
+}
+
+func TestImportCSV_ColumnMapping(t *testing.T) {
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, nil, nil)
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+
+	input := "What,When,Until\nLunch,2026-02-17 12:00,2026-02-17 13:00\n"
+	result, err := svc.ImportCSV(strings.NewReader(input), CSVImportOptions{
+		Columns:  map[string]string{"title": "what", "start_time": "When", "end_time": "Until"},
+		Location: stockholm,
+		DryRun:   true,
+	})
+	require.NoError(t, err)
+	assert.False(t, result.Committed)
+	require.Len(t, result.Rows, 1)
+	require.NoError(t, result.Rows[0].Err)
+	assert.False(t, result.Rows[0].Event.AllDay)
+	assert.Equal(t, "2026-02-17T11:00:00Z", result.Rows[0].Event.StartTime)
+	assert.Equal(t, "2026-02-17T12:00:00Z", result.Rows[0].Event.EndTime)
+
+	_, err = svc.ImportCSV(strings.NewReader(input), CSVImportOptions{Columns: map[string]string{"title": "Missing"}})
+	assert.True(t, errors.Is(err, ErrValidation))
+	_, err = svc.ImportCSV(strings.NewReader(input), CSVImportOptions{Columns: map[string]string{"bogus": "What"}})
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestImportCSV_DateFormatDetection(t *testing.T) {
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, nil, nil)
+	for _, tt := range []struct {
+		input, format, start string
+	}{
+		{"title,start_date\nA,02/03/2026\nB,12/25/2026\n", "MM/DD/YYYY", "2026-02-03T00:00:00Z"},
+		{"title,start_date\nA,02/03/2026\nB,25/12/2026\n", "DD/MM/YYYY", "2026-03-02T00:00:00Z"},
+		{"title,start_date\nA,02.03.2026\n", "DD.MM.YYYY", "2026-03-02T00:00:00Z"},
+		{"title,start_date\nA,2026-3-2\n", "YYYY-MM-DD", "2026-03-02T00:00:00Z"},
+	} {
+		result, err := svc.ImportCSV(strings.NewReader(tt.input), CSVImportOptions{DryRun: true})
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.format, result.DateFormat, tt.input)
+		require.NoError(t, result.Rows[0].Err, tt.input)
+		assert.Equal(t, tt.start, result.Rows[0].Event.StartTime, tt.input)
+	}
+
+	result, err := svc.ImportCSV(strings.NewReader("title,start_date\nA,02/03/2026\n"), CSVImportOptions{DateFormat: "DD/MM/YYYY", DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-02T00:00:00Z", result.Rows[0].Event.StartTime)
+
+	_, err = svc.ImportCSV(strings.NewReader("title,start_date\n"), CSVImportOptions{DateFormat: "YY"})
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestImportCSV_InvalidRows(t *testing.T) {
+	repo := &mockRepo{createFn: func(e *model.Event) error {
+		t.Fatal("nothing is created when a row is invalid")
+		return nil
+	}}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+
+	input := "title,start_time,end_time,reminder_minutes\n" +
+		"Good,2026-02-17T10:00:00Z,2026-02-17T11:00:00Z,\n" +
+		",2026-02-17T10:00:00Z,2026-02-17T11:00:00Z,\n" +
+		"Backwards,2026-02-17T11:00:00Z,2026-02-17T10:00:00Z,\n" +
+		"Reminder,2026-02-17T10:00:00Z,2026-02-17T11:00:00Z,soon\n"
+	result, err := svc.ImportCSV(strings.NewReader(input), CSVImportOptions{})
+	require.NoError(t, err)
+	assert.False(t, result.Committed)
+	require.Len(t, result.Rows, 4)
+	assert.NoError(t, result.Rows[0].Err)
+	for _, row := range result.Rows[1:] {
+		assert.True(t, errors.Is(row.Err, ErrValidation), "row %d", row.Row)
+	}
+	assert.Contains(t, result.Rows[3].Err.Error(), "reminder_minutes")
+}
+
+func TestWriteCSV(t *testing.T) {
+	lat, lon := 59.3293, 18.0686
+	repo := &mockRepo{listFn: func(from, to string, calendarIDs []int64) ([]model.Event, error) {
+		return []model.Event{
+			{ID: 1, Title: "=SUM(A1)", Description: "Line 1\nLine 2", StartTime: "2026-02-17T14:00:00Z", EndTime: "2026-02-17T15:00:00Z",
+				Latitude: &lat, Longitude: &lon, ReminderMinutes: 15, CalendarID: 2},
+			{ID: 2, Title: "Holiday", AllDay: true, StartTime: "2026-04-03T00:00:00Z", EndTime: "2026-04-04T00:00:00Z"},
+		}, nil
+	}}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+
+	var buf bytes.Buffer
+	n, err := svc.WriteCSV(&buf, "2026-01-01T00:00:00Z", "2027-01-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, csvExportColumns, records[0])
+	assert.Equal(t, []string{"1", "'=SUM(A1)", "Line 1\nLine 2", "false", "", "", "2026-02-17T14:00:00Z", "2026-02-17T15:00:00Z",
+		"", "59.3293", "18.0686", "", "", "", "15", "2"}, records[1])
+	assert.Equal(t, []string{"2", "Holiday", "", "true", "2026-04-03", "2026-04-04", "", "", "", "", "", "", "", "", "", "0"}, records[2])
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	var exported []model.Event
+	repo := &mockRepo{listFn: func(from, to string, calendarIDs []int64) ([]model.Event, error) {
+		return exported, nil
+	}}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+	exported = []model.Event{
+		{ID: 1, Title: "-1 point", StartTime: "2026-02-17T14:00:00Z", EndTime: "2026-02-17T15:00:00Z", Categories: "work,team"},
+		{ID: 2, Title: "Holiday", AllDay: true, StartTime: "2026-04-03T00:00:00Z", EndTime: "2026-04-04T00:00:00Z"},
+	}
+
+	var buf bytes.Buffer
+	_, err := svc.WriteCSV(&buf, "2026-01-01T00:00:00Z", "2027-01-01T00:00:00Z", nil)
+	require.NoError(t, err)
+	result, err := svc.ImportCSV(&buf, CSVImportOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, result.Rows, 2)
+	for i, row := range result.Rows {
+		require.NoError(t, row.Err)
+		assert.Equal(t, exported[i].Title, row.Event.Title)
+		assert.Equal(t, exported[i].AllDay, row.Event.AllDay)
+		assert.Equal(t, exported[i].StartTime, row.Event.StartTime)
+		assert.Equal(t, exported[i].EndTime, row.Event.EndTime)
+		assert.Equal(t, exported[i].Categories, row.Event.Categories)
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+	"github.com/mikaelstaldal/mycal/internal/sanitize"
+)
+
+// DumpService exports and restores the whole instance in the versioned JSON
+// dump format.
+type DumpService struct {
+	repo    repository.DumpRepository
+	history historyRecorder
+}
+
+func NewDumpService(repo repository.DumpRepository, histRepo repository.HistoryRepository, bus *EventBus) *DumpService {
+	return &DumpService{repo: repo, history: historyRecorder{repo: histRepo, bus: bus}}
+}
+
+func (s *DumpService) Export() (*api.Dump, error) {
+	dump, err := s.repo.ExportDump()
+	if err != nil {
+		return nil, err
+	}
+	return modelDumpToAPI(dump), nil
+}
+
+// Restore validates a dump and adds its contents. Nothing is restored if any
+// part of the dump is invalid.
+func (s *DumpService) Restore(d *api.Dump) (*api.DumpResult, error) {
+	if d.Version < 1 || d.Version > model.DumpVersion {
+		return nil, fmt.Errorf("%w: unsupported dump version %d, this version of mycal supports up to %d", ErrValidation, d.Version, model.DumpVersion)
+	}
+	dump, err := apiDumpToModel(d)
+	if err != nil {
+		return nil, err
+	}
+	var result *model.DumpResult
+	err = s.history.inTx(s.repo, func(repo repository.EventRepository, h historyRecorder) error {
+		dumpRepo, ok := repo.(repository.DumpRepository)
+		if !ok {
+			return errors.New("restore dump: repository has no dump support in transactions")
+		}
+		var err error
+		if result, err = dumpRepo.RestoreDump(dump); err != nil {
+			return err
+		}
+		actor := model.Actor{Name: "restore", Source: model.SourceImport}
+		for i := range dump.Events {
+			if err := h.record(actor, model.ActionCreate, dump.Events[i].ID, nil, &dump.Events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.DumpResult{
+		Calendars:   result.Calendars,
+		Events:      result.Events,
+		Feeds:       result.Feeds,
+		Preferences: result.Preferences,
+	}, nil
+}
+
+func modelDumpToAPI(dump *model.Dump) *api.Dump {
+	d := &api.Dump{
+		Version:     dump.Version,
+		Calendars:   make([]api.DumpCalendar, len(dump.Calendars)),
+		Events:      make([]api.DumpEvent, len(dump.Events)),
+		Feeds:       make([]api.DumpFeed, len(dump.Feeds)),
+		Preferences: api.Preferences(dump.Preferences),
+	}
+	if t, err := time.Parse(time.RFC3339, dump.ExportedAt); err == nil {
+		d.ExportedAt = api.NewOptDateTime(t)
+	}
+	for i, c := range dump.Calendars {
+		d.Calendars[i] = api.DumpCalendar{ID: c.ID, Name: c.Name, Color: c.Color}
+	}
+	for i, e := range dump.Events {
+		de := api.DumpEvent{
+			ID:                      e.ID,
+			Title:                   e.Title,
+			Description:             optNonEmptyString(e.Description),
+			StartTime:               e.StartTime,
+			EndTime:                 e.EndTime,
+			Color:                   optNonEmptyString(e.Color),
+			RecurrenceFreq:          optNonEmptyString(e.RecurrenceFreq),
+			RecurrenceUntil:         optNonEmptyString(e.RecurrenceUntil),
+			RecurrenceByDay:         optNonEmptyString(e.RecurrenceByDay),
+			RecurrenceByMonthday:    optNonEmptyString(e.RecurrenceByMonthDay),
+			RecurrenceByMonth:       optNonEmptyString(e.RecurrenceByMonth),
+			Exdates:                 optNonEmptyString(e.ExDates),
+			Rdates:                  optNonEmptyString(e.RDates),
+			RecurrenceOriginalStart: optNonEmptyString(e.RecurrenceOriginalStart),
+			Duration:                optNonEmptyString(e.Duration),
+			Categories:              optNonEmptyString(e.Categories),
+			URL:                     optNonEmptyString(e.URL),
+			Location:                optNonEmptyString(e.Location),
+			CalendarID:              api.NewOptInt64(e.CalendarID),
+			IcsUID:                  optNonEmptyString(e.IcsUID),
+			CreatedAt:               optNonEmptyString(e.CreatedAt),
+			UpdatedAt:               optNonEmptyString(e.UpdatedAt),
+		}
+		if e.AllDay {
+			de.AllDay = api.NewOptBool(true)
+		}
+		if e.RecurrenceCount != 0 {
+			de.RecurrenceCount = api.NewOptInt(e.RecurrenceCount)
+		}
+		if e.RecurrenceInterval != 0 {
+			de.RecurrenceInterval = api.NewOptInt(e.RecurrenceInterval)
+		}
+		if e.ReminderMinutes != 0 {
+			de.ReminderMinutes = api.NewOptInt(e.ReminderMinutes)
+		}
+		if e.Transparent {
+			de.Transparent = api.NewOptBool(true)
+		}
+		if e.RecurrenceParentID != nil {
+			de.RecurrenceParentID = api.NewOptNilInt64(*e.RecurrenceParentID)
+		}
+		if e.Latitude != nil {
+			de.Latitude = api.NewOptNilFloat64(*e.Latitude)
+		}
+		if e.Longitude != nil {
+			de.Longitude = api.NewOptNilFloat64(*e.Longitude)
+		}
+		d.Events[i] = de
+	}
+	for i, f := range dump.Feeds {
+		d.Feeds[i] = api.DumpFeed{
+			ID:                     f.ID,
+			URL:                    f.URL,
+			Username:               optNonEmptyString(f.Username),
+			CalendarID:             f.CalendarID,
+			RefreshIntervalMinutes: f.RefreshIntervalMinutes,
+			LastRefreshedAt:        optNonEmptyString(f.LastRefreshedAt),
+			LastError:              optNonEmptyString(f.LastError),
+			Enabled:                f.Enabled,
+			Rules:                  feedRulesToAPI(f.Rules),
+		}
+		if f.Type == model.FeedTypeCalDAV {
+			d.Feeds[i].Type = api.NewOptFeedType(api.FeedTypeCaldav)
+		}
+	}
+	return d
+}
+
+// apiDumpToModel converts and validates a dump. Event fields get the same
+// validation and sanitizing as in an iCalendar import. Errors name the invalid
+// item and wrap ErrValidation.
+func apiDumpToModel(d *api.Dump) (*model.Dump, error) {
+	dump := &model.Dump{
+		Version:     d.Version,
+		Calendars:   make([]model.Calendar, len(d.Calendars)),
+		Events:      make([]model.Event, len(d.Events)),
+		Feeds:       make([]model.Feed, len(d.Feeds)),
+		Preferences: make(map[string]string),
+	}
+	for i, c := range d.Calendars {
+		if c.Name == "" || len(c.Name) > model.MaxCalendarNameLength {
+			return nil, fmt.Errorf("calendar %d: %w: name must be 1 to %d characters", c.ID, ErrValidation, model.MaxCalendarNameLength)
+		}
+		if err := model.ValidateColor(c.Color); err != nil {
+			return nil, fmt.Errorf("calendar %d: %w: %s", c.ID, ErrValidation, err.Error())
+		}
+		dump.Calendars[i] = model.Calendar{ID: c.ID, Name: c.Name, Color: c.Color}
+	}
+	for i, de := range d.Events {
+		e := model.Event{
+			ID:                      de.ID,
+			Title:                   sanitize.HTML(de.Title),
+			Description:             sanitize.HTML(de.Description.Value),
+			StartTime:               de.StartTime,
+			EndTime:                 de.EndTime,
+			AllDay:                  de.AllDay.Value,
+			Color:                   de.Color.Value,
+			RecurrenceFreq:          de.RecurrenceFreq.Value,
+			RecurrenceCount:         de.RecurrenceCount.Value,
+			RecurrenceUntil:         de.RecurrenceUntil.Value,
+			RecurrenceInterval:      de.RecurrenceInterval.Value,
+			RecurrenceByDay:         de.RecurrenceByDay.Value,
+			RecurrenceByMonthDay:    de.RecurrenceByMonthday.Value,
+			RecurrenceByMonth:       de.RecurrenceByMonth.Value,
+			ExDates:                 de.Exdates.Value,
+			RDates:                  de.Rdates.Value,
+			RecurrenceOriginalStart: de.RecurrenceOriginalStart.Value,
+			Duration:                de.Duration.Value,
+			Categories:              sanitize.HTML(de.Categories.Value),
+			URL:                     de.URL.Value,
+			ReminderMinutes:         de.ReminderMinutes.Value,
+			Transparent:             de.Transparent.Value,
+			Location:                sanitize.HTML(de.Location.Value),
+			CalendarID:              de.CalendarID.Value,
+			IcsUID:                  de.IcsUID.Value,
+			CreatedAt:               de.CreatedAt.Value,
+			UpdatedAt:               de.UpdatedAt.Value,
+		}
+		if v, ok := de.RecurrenceParentID.Get(); ok {
+			e.RecurrenceParentID = &v
+		}
+		if v, ok := de.Latitude.Get(); ok {
+			e.Latitude = &v
+		}
+		if v, ok := de.Longitude.Get(); ok {
+			e.Longitude = &v
+		}
+		if e.RecurrenceParentID == nil {
+			if _, err := buildEventForImport(e); err != nil {
+				return nil, fmt.Errorf("event %d: %w", de.ID, err)
+			}
+		} else {
+			for _, ts := range []string{e.StartTime, e.EndTime, e.RecurrenceOriginalStart} {
+				if _, err := time.Parse(time.RFC3339, ts); err != nil {
+					return nil, fmt.Errorf("event %d: %w: invalid time %q", de.ID, ErrValidation, ts)
+				}
+			}
+		}
+		dump.Events[i] = e
+	}
+	for i, f := range d.Feeds {
+		u, err := url.Parse(f.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(f.URL) > maxFeedURLLength {
+			return nil, fmt.Errorf("feed %d: %w: invalid url", f.ID, ErrValidation)
+		}
+		if f.RefreshIntervalMinutes < minRefreshIntervalMinutes || f.RefreshIntervalMinutes > maxRefreshIntervalMinutes {
+			return nil, fmt.Errorf("feed %d: %w: refresh_interval_minutes must be between %d and %d", f.ID, ErrValidation, minRefreshIntervalMinutes, maxRefreshIntervalMinutes)
+		}
+		dump.Feeds[i] = model.Feed{
+			ID:                     f.ID,
+			Type:                   string(f.Type.Or(api.FeedTypeIcs)),
+			URL:                    f.URL,
+			CalendarID:             f.CalendarID,
+			RefreshIntervalMinutes: f.RefreshIntervalMinutes,
+			LastRefreshedAt:        f.LastRefreshedAt.Value,
+			LastError:              f.LastError.Value,
+			Enabled:                f.Enabled,
+			Username:               f.Username.Value,
+		}
+		if f.Rules != nil {
+			dump.Feeds[i].Rules = feedRulesFromAPI(f.Rules)
+			if _, err := compileFeedRules(dump.Feeds[i].Rules); err != nil {
+				return nil, fmt.Errorf("feed %d: %w: %s", f.ID, ErrValidation, err.Error())
+			}
+		}
+	}
+	// Check the references up front, so restoring does not fail halfway.
+	calendars := map[int64]bool{0: true}
+	for _, c := range dump.Calendars {
+		calendars[c.ID] = true
+	}
+	parents := make(map[int64]bool)
+	seen := make(map[int64]bool, len(dump.Events))
+	for _, e := range dump.Events {
+		if seen[e.ID] {
+			return nil, fmt.Errorf("event %d: %w: duplicate id", e.ID, ErrValidation)
+		}
+		seen[e.ID] = true
+		if e.RecurrenceParentID == nil {
+			parents[e.ID] = true
+		}
+	}
+	for _, e := range dump.Events {
+		if !calendars[e.CalendarID] {
+			return nil, fmt.Errorf("event %d: %w: unknown calendar %d", e.ID, ErrValidation, e.CalendarID)
+		}
+		if e.RecurrenceParentID != nil && !parents[*e.RecurrenceParentID] {
+			return nil, fmt.Errorf("event %d: %w: override of unknown event %d", e.ID, ErrValidation, *e.RecurrenceParentID)
+		}
+	}
+	for _, f := range dump.Feeds {
+		if !calendars[f.CalendarID] {
+			return nil, fmt.Errorf("feed %d: %w: unknown calendar %d", f.ID, ErrValidation, f.CalendarID)
+		}
+	}
+
+	// Only preferences this version knows about are restored, like PATCH
+	// /api/v1/preferences does.
+	for k, v := range d.Preferences {
+		if _, ok := allowedPreferences[k]; ok {
+			dump.Preferences[k] = v
+		}
+	}
+	return dump, nil
+}
+
+func optNonEmptyString(s string) api.OptString {
+	if s == "" {
+		return api.OptString{}
+	}
+	return api.NewOptString(s)
+}
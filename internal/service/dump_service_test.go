@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+)
+
+type mockDumpRepo struct {
+	mockRepo
+	restored *model.Dump
+}
+
+func (m *mockDumpRepo) InTx(fn func(repo repository.EventRepository) error) error {
+	return fn(m)
+}
+
+func (m *mockDumpRepo) ExportDump() (*model.Dump, error) {
+	return &model.Dump{Version: model.DumpVersion}, nil
+}
+
+func (m *mockDumpRepo) RestoreDump(dump *model.Dump) (*model.DumpResult, error) {
+	m.restored = dump
+	return &model.DumpResult{Calendars: len(dump.Calendars), Events: len(dump.Events), Feeds: len(dump.Feeds)}, nil
+}
+
+func validDump() *api.Dump {
+	return &api.Dump{
+		Version:   model.DumpVersion,
+		Calendars: []api.DumpCalendar{{ID: 3, Name: "Work", Color: "tomato"}},
+		Events: []api.DumpEvent{
+			{ID: 10, Title: "Standup", StartTime: "2026-03-02T09:00:00Z", EndTime: "2026-03-02T09:15:00Z",
+				RecurrenceFreq: optString("WEEKLY"), CalendarID: api.NewOptInt64(3)},
+			{ID: 11, Title: "Standup <b>moved</b><script>x</script>", StartTime: "2026-03-09T10:00:00Z", EndTime: "2026-03-09T10:15:00Z",
+				RecurrenceParentID: api.NewOptNilInt64(10), RecurrenceOriginalStart: optString("2026-03-09T09:00:00Z")},
+		},
+		Feeds:       []api.DumpFeed{{ID: 1, URL: "https://example.com/cal.ics", CalendarID: 3, RefreshIntervalMinutes: 60, Enabled: true}},
+		Preferences: api.Preferences{"unknownKey": "ignored"},
+	}
+}
+
+func TestDumpRestore_Valid(t *testing.T) {
+	repo := &mockDumpRepo{}
+	svc := NewDumpService(repo, &mockHistoryRepo{}, nil)
+
+	result, err := svc.Restore(validDump())
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Events)
+	require.NotNil(t, repo.restored)
+	assert.Equal(t, int64(10), *repo.restored.Events[1].RecurrenceParentID)
+	assert.NotContains(t, repo.restored.Events[1].Title, "<script>")
+	assert.Empty(t, repo.restored.Preferences, "unknown preferences are not restored")
+}
+
+func TestDumpRestore_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(d *api.Dump)
+	}{
+		{"newer version", func(d *api.Dump) { d.Version = model.DumpVersion + 1 }},
+		{"bad calendar color", func(d *api.Dump) { d.Calendars[0].Color = "not a color!" }},
+		{"unknown calendar", func(d *api.Dump) { d.Events[0].CalendarID = api.NewOptInt64(99) }},
+		{"unknown parent", func(d *api.Dump) { d.Events[1].RecurrenceParentID = api.NewOptNilInt64(99) }},
+		{"duplicate id", func(d *api.Dump) { d.Events[1].ID = 10 }},
+		{"missing title", func(d *api.Dump) { d.Events[0].Title = "" }},
+		{"bad override time", func(d *api.Dump) { d.Events[1].StartTime = "yesterday" }},
+		{"bad feed url", func(d *api.Dump) { d.Feeds[0].URL = "file:///etc/passwd" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockDumpRepo{}
+			svc := NewDumpService(repo, &mockHistoryRepo{}, nil)
+			d := validDump()
+			tt.modify(d)
+			_, err := svc.Restore(d)
+			assert.ErrorIs(t, err, ErrValidation)
+			assert.Nil(t, repo.restored, "nothing is restored")
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// ErrPreconditionFailed is returned when an event has been changed since the
+// client read it, according to the If-Match entity tag.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// EventETag returns the strong entity tag of an event. It identifies the
+// stored row and its revision, so it changes with every update of the event.
+// Instances of a recurring event without an override have the tag of the
+// recurring event.
+func EventETag(e *model.Event) string {
+	return fmt.Sprintf(`"%d-%d"`, e.ID, e.Revision)
+}
+
+// MatchETag reports whether an If-Match or If-None-Match header value, which
+// is either "*" or a list of entity tags, matches etag. With weak set, the
+// weak comparison of RFC 9110 is used, otherwise the strong one.
+func MatchETag(header, etag string, weak bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch calls fn with a copy of the service in a transaction, if the event
+// with the given ID, or its instance starting at instanceStart, matches the
+// If-Match header value ifMatch. Otherwise it returns ErrPreconditionFailed.
+// An empty ifMatch always matches, and fn is called without a transaction.
+func (s *EventService) IfMatch(id int64, instanceStart, ifMatch string, fn func(s *EventService) error) error {
+	if ifMatch == "" {
+		return fn(s)
+	}
+	return s.inTx(func(tx *EventService) error {
+		var event *model.Event
+		var err error
+		if instanceStart != "" {
+			event, err = tx.GetInstance(id, instanceStart)
+		} else {
+			event, err = tx.GetByID(id)
+		}
+		if err != nil {
+			return err
+		}
+		if !MatchETag(ifMatch, EventETag(event), false) {
+			return ErrPreconditionFailed
+		}
+		return fn(tx)
+	})
+}
+
+// ICSETag returns the weak entity tag of the iCalendar feed of the given
+// calendars in the given format, which changes whenever an event is created,
+// changed or deleted. Nil calendarIDs means all calendars, like in WriteICS.
+func (s *EventService) ICSETag(format ical.Format, calendarIDs []int64) (string, error) {
+	seq, err := s.repo.LatestChange()
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s %#v", format, calendarIDs)
+	return fmt.Sprintf(`W/"%d-%x"`, seq, h.Sum64()), nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestMatchETag(t *testing.T) {
+	assert.True(t, MatchETag(`"1-2"`, `"1-2"`, false))
+	assert.True(t, MatchETag(`"1-1", "1-2"`, `"1-2"`, false))
+	assert.True(t, MatchETag(`*`, `"1-2"`, false))
+	assert.False(t, MatchETag(`"1-1"`, `"1-2"`, false))
+	assert.False(t, MatchETag(`W/"1-2"`, `"1-2"`, false), "weak tags never match strongly")
+	assert.False(t, MatchETag(`W/"7"`, `W/"7"`, false))
+	assert.True(t, MatchETag(`W/"7"`, `W/"7"`, true))
+	assert.True(t, MatchETag(`"7"`, `W/"7"`, true))
+	assert.False(t, MatchETag(`W/"6"`, `W/"7"`, true))
+}
+
+func TestIfMatch(t *testing.T) {
+	repo := &mockRepo{
+		getByIDFn: func(id int64) (*model.Event, error) {
+			if id != 1 {
+				return nil, nil
+			}
+			return &model.Event{ID: 1, Revision: 3, Title: "Old", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}, nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+
+	called := 0
+	fn := func(*EventService) error {
+		called++
+		return nil
+	}
+	require.NoError(t, svc.IfMatch(1, "", `"1-3"`, fn))
+	require.NoError(t, svc.IfMatch(1, "", "", fn))
+	require.NoError(t, svc.IfMatch(1, "", "*", fn))
+	assert.Equal(t, 3, called)
+
+	assert.ErrorIs(t, svc.IfMatch(1, "", `"1-2"`, fn), ErrPreconditionFailed)
+	assert.ErrorIs(t, svc.IfMatch(2, "", "*", fn), ErrNotFound)
+	assert.Equal(t, 3, called)
+}
+
+func TestICSETag(t *testing.T) {
+	seq := int64(41)
+	repo := &mockRepo{latestChangeFn: func() (int64, error) { return seq, nil }}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+
+	etag, err := svc.ICSETag(ical.FormatICal, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(etag, `W/"41-`), etag)
+	seq++
+	changed, err := svc.ICSETag(ical.FormatICal, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, changed)
+
+	for _, other := range []struct {
+		format      ical.Format
+		calendarIDs []int64
+	}{
+		{ical.FormatJCal, nil},
+		{ical.FormatICal, []int64{}},
+		{ical.FormatICal, []int64{2}},
+	} {
+		tag, err := svc.ICSETag(other.format, other.calendarIDs)
+		require.NoError(t, err)
+		assert.NotEqual(t, changed, tag, "each representation and selection of calendars has a tag of its own")
+	}
+}
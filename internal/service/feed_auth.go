@@ -0,0 +1,191 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// errNoSecretKey is returned when credentials are to be stored without a key.
+var errNoSecretKey = errors.New("no secret key configured for storing credentials")
+
+// reservedFeedHeaders are set by mycal itself and cannot be custom headers.
+var reservedFeedHeaders = map[string]bool{
+	"Host": true, "Connection": true, "Content-Length": true, "Content-Type": true,
+	"Transfer-Encoding": true, "Te": true, "Upgrade": true, "Depth": true,
+}
+
+// updateFeedAuth changes the authentication of a feed by the fields that are
+// set. A bearer token replaces the username and password, and the other way
+// around. Credentials that cannot be opened, because the key was changed, are
+// replaced.
+func (s *FeedService) updateFeedAuth(feed *model.Feed, username, password, token api.OptString, headers api.OptFeedHeaders) error {
+	if !username.Set && !password.Set && !token.Set && !headers.Set {
+		return nil
+	}
+	creds, err := s.credentials(feed)
+	if err != nil {
+		creds = model.FeedCredentials{}
+	}
+	if token.Set {
+		creds.Token = token.Value
+	}
+	if username.Set {
+		feed.Username = username.Value
+	}
+	if password.Set {
+		creds.Password = password.Value
+	}
+	// A new token replaces the username and password, and the other way around
+	if token.Value != "" && !username.Set && !password.Set {
+		feed.Username, creds.Password = "", ""
+	}
+	if (username.Value != "" || password.Value != "") && !token.Set {
+		creds.Token = ""
+	}
+	if headers.Set {
+		if creds.Headers, err = canonicalFeedHeaders(headers.Value); err != nil {
+			return fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
+	}
+	if creds.Token != "" && (feed.Username != "" || creds.Password != "") {
+		return fmt.Errorf("%w: use either username and password or a token", ErrValidation)
+	}
+	if _, ok := creds.Headers["Authorization"]; ok && (creds.Token != "" || feed.Username != "" || creds.Password != "") {
+		return fmt.Errorf("%w: an Authorization header cannot be used with username and password or a token", ErrValidation)
+	}
+	return s.sealCredentials(feed, creds)
+}
+
+// canonicalFeedHeaders validates custom headers and canonicalizes their names.
+func canonicalFeedHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if !isHeaderName(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if reservedFeedHeaders[name] {
+			return nil, fmt.Errorf("header %s cannot be set", name)
+		}
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("duplicate header %s", name)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid value for header %s", name)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+// isHeaderName reports whether s is a token (RFC 9110, section 5.6.2).
+func isHeaderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sealCredentials stores the credentials in a feed, with its authentication
+// type and header names.
+func (s *FeedService) sealCredentials(feed *model.Feed, creds model.FeedCredentials) error {
+	switch {
+	case creds.Token != "":
+		feed.AuthType = model.FeedAuthBearer
+	case feed.Username != "" || creds.Password != "":
+		feed.AuthType = model.FeedAuthBasic
+	default:
+		feed.AuthType = model.FeedAuthNone
+	}
+	feed.HeaderNames = nil
+	for name := range creds.Headers {
+		feed.HeaderNames = append(feed.HeaderNames, name)
+	}
+	sort.Strings(feed.HeaderNames)
+
+	if creds.Password == "" && creds.Token == "" && len(creds.Headers) == 0 {
+		feed.Credentials = ""
+		return nil
+	}
+	if s.secrets == nil {
+		return errNoSecretKey
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	feed.Credentials, err = s.secrets.Seal(data)
+	return err
+}
+
+// credentials opens the credentials of a feed.
+func (s *FeedService) credentials(feed *model.Feed) (model.FeedCredentials, error) {
+	var creds model.FeedCredentials
+	if feed.Credentials == "" {
+		return creds, nil
+	}
+	if s.secrets == nil {
+		return creds, errNoSecretKey
+	}
+	data, err := s.secrets.Open(feed.Credentials)
+	if err != nil {
+		return creds, err
+	}
+	err = json.Unmarshal(data, &creds)
+	return creds, err
+}
+
+// feedClient returns the HTTP client for a feed and a function that adds its
+// credentials to a request. With credentials, redirects to another server are
+// refused, since custom headers would be sent along.
+func (s *FeedService) feedClient(feed *model.Feed) (*http.Client, func(*http.Request), error) {
+	if feed.AuthType == model.FeedAuthNone && len(feed.HeaderNames) == 0 {
+		return s.client, func(*http.Request) {}, nil
+	}
+	creds, err := s.credentials(feed)
+	if err != nil {
+		return nil, nil, err
+	}
+	authorize := func(req *http.Request) {
+		for name, value := range creds.Headers {
+			req.Header.Set(name, value)
+		}
+		switch feed.AuthType {
+		case model.FeedAuthBasic:
+			req.SetBasicAuth(feed.Username, creds.Password)
+		case model.FeedAuthBearer:
+			req.Header.Set("Authorization", "Bearer "+creds.Token)
+		}
+	}
+
+	client := *s.client
+	checkRedirect := s.client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) || via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+			return fmt.Errorf("refusing to send credentials along a redirect to %s", req.URL.Host)
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &client, authorize, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/sanitize"
+)
+
+const (
+	maxFeedRules         = 50
+	maxFeedRulePattern   = 500
+	maxFeedPreviewEvents = 1000
+)
+
+// feedRule is a model.FeedRule ready to be applied.
+type feedRule struct {
+	model.FeedRule
+	re    *regexp.Regexp // nil matches every event
+	shift time.Duration
+}
+
+// feedRules are the compiled rules of a feed.
+type feedRules struct {
+	rules   []feedRule
+	include bool // whether there are include rules
+}
+
+// feedRulesFromAPI converts the rules of a request.
+func feedRulesFromAPI(rules api.FeedRules) []model.FeedRule {
+	result := make([]model.FeedRule, len(rules))
+	for i, r := range rules {
+		result[i] = model.FeedRule{
+			Field:   string(r.Field.Or(api.FeedRuleFieldSummary)),
+			Pattern: r.Pattern.Value,
+			Action:  string(r.Action),
+			Value:   r.Value.Value,
+		}
+	}
+	return result
+}
+
+// compileFeedRules validates rules and compiles their patterns.
+func compileFeedRules(rules []model.FeedRule) (*feedRules, error) {
+	if len(rules) > maxFeedRules {
+		return nil, fmt.Errorf("at most %d rules are allowed", maxFeedRules)
+	}
+	compiled := &feedRules{rules: make([]feedRule, len(rules))}
+	for i, r := range rules {
+		fr := feedRule{FeedRule: r}
+		switch r.Field {
+		case model.FeedRuleSummary, model.FeedRuleCategories, model.FeedRuleLocation:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown field %q", i+1, r.Field)
+		}
+		if len(r.Pattern) > maxFeedRulePattern {
+			return nil, fmt.Errorf("rule %d: pattern must be at most %d characters", i+1, maxFeedRulePattern)
+		}
+		if r.Pattern != "" {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern: %v", i+1, err)
+			}
+			fr.re = re
+		}
+		switch r.Action {
+		case model.FeedRuleInclude:
+			compiled.include = true
+		case model.FeedRuleExclude, model.FeedRuleDropAlarms, model.FeedRuleTransparent:
+		case model.FeedRuleRename:
+			if strings.TrimSpace(r.Value) == "" {
+				return nil, fmt.Errorf("rule %d: rename needs a title", i+1)
+			}
+		case model.FeedRuleColor:
+			if r.Value == "" {
+				return nil, fmt.Errorf("rule %d: color needs a color", i+1)
+			}
+			if err := model.ValidateColor(r.Value); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		case model.FeedRuleShift:
+			shift, err := parseShift(r.Value)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid shift %q: %v", i+1, r.Value, err)
+			}
+			fr.shift = shift
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %q", i+1, r.Action)
+		}
+		compiled.rules[i] = fr
+	}
+	return compiled, nil
+}
+
+// parseShift parses an ISO 8601 duration, which may be negative.
+func parseShift(s string) (time.Duration, error) {
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		d, err := model.ParseDuration(rest)
+		return -d, err
+	}
+	return model.ParseDuration(strings.TrimPrefix(s, "+"))
+}
+
+// apply transforms an event by the rules in order, and reports whether it is
+// to be imported. Later rules see the changes of earlier ones.
+func (rs *feedRules) apply(e *model.Event) bool {
+	included := !rs.include
+	for _, r := range rs.rules {
+		var value string
+		switch r.Field {
+		case model.FeedRuleSummary:
+			value = e.Title
+		case model.FeedRuleCategories:
+			value = e.Categories
+		case model.FeedRuleLocation:
+			value = e.Location
+		}
+		var match []int
+		if r.re != nil {
+			if match = r.re.FindStringSubmatchIndex(value); match == nil {
+				continue
+			}
+		}
+		switch r.Action {
+		case model.FeedRuleInclude:
+			included = true
+		case model.FeedRuleExclude:
+			return false
+		case model.FeedRuleRename:
+			title := r.Value
+			if r.re != nil {
+				title = string(r.re.ExpandString(nil, r.Value, value, match))
+			}
+			if title = strings.TrimSpace(sanitize.HTML(title)); title != "" {
+				e.Title = title
+			}
+		case model.FeedRuleColor:
+			e.Color = r.Value
+		case model.FeedRuleDropAlarms:
+			e.ReminderMinutes = 0
+		case model.FeedRuleTransparent:
+			e.Transparent = true
+		case model.FeedRuleShift:
+			shiftEvent(e, r.shift)
+		}
+	}
+	return included
+}
+
+// shiftEvent moves an event, and its recurrence, in time. All-day events are
+// only shifted by whole days.
+func shiftEvent(e *model.Event, d time.Duration) {
+	if e.AllDay && d%(24*time.Hour) != 0 {
+		return
+	}
+	shift := func(ts string) string {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return ts
+		}
+		return t.Add(d).Format(time.RFC3339)
+	}
+	shiftList := func(list string) string {
+		if list == "" {
+			return ""
+		}
+		parts := strings.Split(list, ",")
+		for i, p := range parts {
+			parts[i] = shift(strings.TrimSpace(p))
+		}
+		return strings.Join(parts, ",")
+	}
+	e.StartTime = shift(e.StartTime)
+	e.EndTime = shift(e.EndTime)
+	if e.RecurrenceUntil != "" {
+		e.RecurrenceUntil = shift(e.RecurrenceUntil)
+	}
+	if e.RecurrenceOriginalStart != "" {
+		e.RecurrenceOriginalStart = shift(e.RecurrenceOriginalStart)
+	}
+	e.ExDates = shiftList(e.ExDates)
+	e.RDates = shiftList(e.RDates)
+}
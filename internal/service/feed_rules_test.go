@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestCompileFeedRules_Invalid(t *testing.T) {
+	for name, rule := range map[string]model.FeedRule{
+		"unknown field":  {Field: "description", Action: model.FeedRuleExclude},
+		"unknown action": {Field: model.FeedRuleSummary, Action: "delete"},
+		"invalid regexp": {Field: model.FeedRuleSummary, Pattern: "(", Action: model.FeedRuleExclude},
+		"no title":       {Field: model.FeedRuleSummary, Action: model.FeedRuleRename},
+		"invalid color":  {Field: model.FeedRuleSummary, Action: model.FeedRuleColor, Value: "url(x)"},
+		"invalid shift":  {Field: model.FeedRuleSummary, Action: model.FeedRuleShift, Value: "1h"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := compileFeedRules([]model.FeedRule{rule})
+			assert.Error(t, err)
+		})
+	}
+	_, err := compileFeedRules(make([]model.FeedRule, maxFeedRules+1))
+	assert.Error(t, err)
+}
+
+func TestFeedRules_Apply(t *testing.T) {
+	rules, err := compileFeedRules([]model.FeedRule{
+		{Field: model.FeedRuleLocation, Pattern: "(?i)away", Action: model.FeedRuleExclude},
+		{Field: model.FeedRuleSummary, Pattern: `^Match vs (\w+)`, Action: model.FeedRuleRename, Value: "Home game: $1"},
+		{Field: model.FeedRuleSummary, Pattern: "^Home game", Action: model.FeedRuleInclude},
+		{Field: model.FeedRuleSummary, Action: model.FeedRuleShift, Value: "P1D"},
+	})
+	require.NoError(t, err)
+
+	e := model.Event{Title: "Match vs Rovers", Location: "Home ground", StartTime: "2026-06-01T17:00:00Z", EndTime: "2026-06-01T19:00:00Z",
+		RecurrenceFreq: "WEEKLY", ExDates: "2026-06-08T17:00:00Z", RecurrenceUntil: "2026-07-01T00:00:00Z"}
+	assert.True(t, rules.apply(&e))
+	assert.Equal(t, "Home game: Rovers", e.Title)
+	assert.Equal(t, "2026-06-02T17:00:00Z", e.StartTime)
+	assert.Equal(t, "2026-06-02T19:00:00Z", e.EndTime)
+	assert.Equal(t, "2026-06-09T17:00:00Z", e.ExDates)
+	assert.Equal(t, "2026-07-02T00:00:00Z", e.RecurrenceUntil)
+
+	away := model.Event{Title: "Match vs United", Location: "AWAY", StartTime: "2026-06-01T17:00:00Z", EndTime: "2026-06-01T19:00:00Z"}
+	assert.False(t, rules.apply(&away))
+	other := model.Event{Title: "Training", StartTime: "2026-06-01T17:00:00Z", EndTime: "2026-06-01T19:00:00Z"}
+	assert.False(t, rules.apply(&other), "not matched by the include rule")
+}
+
+func TestShiftEvent_AllDay(t *testing.T) {
+	e := model.Event{AllDay: true, StartTime: "2026-06-01T00:00:00Z", EndTime: "2026-06-02T00:00:00Z"}
+	shiftEvent(&e, -2*time.Hour)
+	assert.Equal(t, "2026-06-01T00:00:00Z", e.StartTime, "not by part of a day")
+	shift, err := parseShift("-P1D")
+	require.NoError(t, err)
+	shiftEvent(&e, shift)
+	assert.Equal(t, "2026-05-31T00:00:00Z", e.StartTime)
+	assert.Equal(t, "2026-06-01T00:00:00Z", e.EndTime)
+}
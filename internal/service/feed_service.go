@@ -1,6 +1,8 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -9,21 +11,52 @@ import (
 
 	"github.com/mikaelstaldal/go-server-common/httputil"
 	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/caldav"
 	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/metrics"
 	"github.com/mikaelstaldal/mycal/internal/model"
 	"github.com/mikaelstaldal/mycal/internal/repository"
+	"github.com/mikaelstaldal/mycal/internal/secret"
 )
 
-const maxFeedImportSize = 10 * 1024 * 1024 // 10 MiB
+const (
+	// maxFeedImportSize bounds a feed, which is imported as it is read.
+	maxFeedImportSize = 256 * 1024 * 1024 // 256 MiB
+	// maxFeedDocumentSize bounds the documents kept to preview rules against.
+	maxFeedDocumentSize = 16 * 1024 * 1024 // 16 MiB
+	// feedFetchTimeout bounds fetching and importing a feed.
+	feedFetchTimeout = 5 * time.Minute
+)
+
+var (
+	feedRefreshes = metrics.Default.NewCounterVec("mycal_feed_refreshes_total",
+		"Feed refreshes, by result (success or failure).", "result")
+	feedRefreshDuration = metrics.Default.NewHistogramVec("mycal_feed_refresh_duration_seconds",
+		"Duration of feed refreshes, by result (success or failure).", []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60}, "result")
+)
 
 type FeedService struct {
-	feedRepo  repository.FeedRepository
-	eventRepo repository.EventRepository
-	calRepo   repository.CalendarRepository
+	feedRepo    repository.FeedRepository
+	eventRepo   repository.EventRepository
+	calRepo     repository.CalendarRepository
+	history     historyRecorder
+	bus         *EventBus
+	secrets     *secret.Box // seals the credentials of feeds; nil if none may be stored
+	client      *http.Client
+	validateURL func(rawURL string) error
 }
 
-func NewFeedService(feedRepo repository.FeedRepository, eventRepo repository.EventRepository, calRepo repository.CalendarRepository) *FeedService {
-	return &FeedService{feedRepo: feedRepo, eventRepo: eventRepo, calRepo: calRepo}
+func NewFeedService(feedRepo repository.FeedRepository, eventRepo repository.EventRepository, calRepo repository.CalendarRepository, histRepo repository.HistoryRepository, bus *EventBus, secrets *secret.Box) *FeedService {
+	return &FeedService{
+		feedRepo:    feedRepo,
+		eventRepo:   eventRepo,
+		calRepo:     calRepo,
+		history:     historyRecorder{repo: histRepo, bus: bus},
+		bus:         bus,
+		secrets:     secrets,
+		client:      httputil.NewSafeHTTPClient(feedFetchTimeout),
+		validateURL: httputil.ValidateExternalURL,
+	}
 }
 
 func (s *FeedService) Create(req *api.CreateFeedRequest) (*model.Feed, error) {
@@ -32,26 +65,37 @@ func (s *FeedService) Create(req *api.CreateFeedRequest) (*model.Feed, error) {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 	}
 	rawURL := req.URL.String()
-	if err := httputil.ValidateExternalURL(rawURL); err != nil {
+	if err := s.validateURL(rawURL); err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 	}
 
+	feed := &model.Feed{
+		Type:                   string(req.Type.Or(api.FeedTypeIcs)),
+		URL:                    rawURL,
+		RefreshIntervalMinutes: refreshInterval,
+		Enabled:                true,
+	}
+	if err := s.updateFeedAuth(feed, req.Username, req.Password, req.Token, req.Headers); err != nil {
+		return nil, err
+	}
+	if req.Rules != nil {
+		feed.Rules = feedRulesFromAPI(req.Rules)
+		if _, err := compileFeedRules(feed.Rules); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
+	}
+
 	calendarName := req.CalendarName.Or("")
 	calendarColor := req.CalendarColor.Or("")
 	calendarID, err := s.resolveCalendarName(calendarName, calendarColor)
 	if err != nil {
 		return nil, err
 	}
-
-	feed := &model.Feed{
-		URL:                    rawURL,
-		CalendarID:             calendarID,
-		RefreshIntervalMinutes: refreshInterval,
-		Enabled:                true,
-	}
+	feed.CalendarID = calendarID
 	if err := s.feedRepo.CreateFeed(feed); err != nil {
 		return nil, err
 	}
+	s.bus.Publish(Change{Kind: KindFeed, Action: model.ActionCreate, ID: feed.ID, Feed: feed})
 	return feed, nil
 }
 
@@ -77,6 +121,9 @@ func (s *FeedService) List() ([]model.Feed, error) {
 	return feeds, nil
 }
 
+// Update changes a feed. New rules apply to the events imported by later
+// refreshes, since a refresh only imports events with UIDs not imported
+// already; the events imported before are kept as they are.
 func (s *FeedService) Update(id int64, req *api.UpdateFeedRequest) (*model.Feed, error) {
 	if err := ValidateUpdateFeedRequest(req); err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
@@ -90,11 +137,23 @@ func (s *FeedService) Update(id int64, req *api.UpdateFeedRequest) (*model.Feed,
 	}
 	if req.URL.Set {
 		rawURL := req.URL.Value.String()
-		if err := httputil.ValidateExternalURL(rawURL); err != nil {
+		if err := s.validateURL(rawURL); err != nil {
 			return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 		}
+		if rawURL != existing.URL {
+			existing.CollectionURL, existing.SyncToken = "", ""
+		}
 		existing.URL = rawURL
 	}
+	if err := s.updateFeedAuth(existing, req.Username, req.Password, req.Token, req.Headers); err != nil {
+		return nil, err
+	}
+	if req.Rules != nil {
+		existing.Rules = feedRulesFromAPI(req.Rules)
+		if _, err := compileFeedRules(existing.Rules); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
+	}
 	if req.CalendarName.Set {
 		calID, err := s.resolveCalendarName(req.CalendarName.Value, "")
 		if err != nil {
@@ -111,6 +170,7 @@ func (s *FeedService) Update(id int64, req *api.UpdateFeedRequest) (*model.Feed,
 	if err := s.feedRepo.UpdateFeed(existing); err != nil {
 		return nil, err
 	}
+	s.bus.Publish(Change{Kind: KindFeed, Action: model.ActionUpdate, ID: existing.ID, Feed: existing})
 	return existing, nil
 }
 
@@ -126,8 +186,11 @@ func (s *FeedService) Delete(id int64) error {
 	if err := s.feedRepo.DeleteFeed(id); err != nil {
 		return err
 	}
-	if calendarID != 0 {
-		_ = s.calRepo.DeleteCalendarIfUnused(calendarID)
+	s.bus.Publish(Change{Kind: KindFeed, Action: model.ActionDelete, ID: id})
+	if calendarID != 0 && s.calRepo.DeleteCalendarIfUnused(calendarID) == nil {
+		if cal, err := s.calRepo.GetCalendarByID(calendarID); err == nil && cal == nil {
+			s.bus.Publish(Change{Kind: KindCalendar, Action: model.ActionDelete, ID: calendarID})
+		}
 	}
 	return nil
 }
@@ -144,6 +207,72 @@ func (s *FeedService) RefreshFeed(id int64) (*model.Feed, error) {
 	return feed, nil
 }
 
+// FeedPreview is the result of applying rules to the last fetched document of
+// a feed.
+type FeedPreview struct {
+	FetchedAt string
+	Total     int
+	Imported  int
+	Events    []FeedPreviewEvent // at most maxFeedPreviewEvents
+}
+
+// FeedPreviewEvent is an event of a feed with the rules applied.
+type FeedPreviewEvent struct {
+	model.Event
+	Excluded bool
+}
+
+// Preview applies rules, or the rules of the feed if nil, to the document of
+// the last refresh of a feed, without importing anything.
+func (s *FeedService) Preview(id int64, req api.FeedRules) (*FeedPreview, error) {
+	feed, err := s.feedRepo.GetFeedByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if feed == nil {
+		return nil, ErrNotFound
+	}
+	rules := feed.Rules
+	if req != nil {
+		rules = feedRulesFromAPI(req)
+	}
+	compiled, err := compileFeedRules(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+	}
+	data, fetchedAt, err := s.feedRepo.GetFeedDocument(id)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w: the feed has not been fetched", ErrNotFound)
+	}
+
+	preview := &FeedPreview{FetchedAt: fetchedAt, Events: []FeedPreviewEvent{}}
+	dec := ical.NewDecoder(bytes.NewReader(data))
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse iCalendar data: %v", ErrValidation, err)
+		}
+		if e.RecurrenceOriginalStart != "" {
+			continue // not imported, see feedBatch.decode
+		}
+		preview.Total++
+		imported := compiled.apply(&e)
+		if imported {
+			preview.Imported++
+		}
+		if len(preview.Events) < maxFeedPreviewEvents {
+			preview.Events = append(preview.Events, FeedPreviewEvent{Event: e, Excluded: !imported})
+		}
+	}
+	return preview, nil
+}
+
 func (s *FeedService) resolveCalendarName(name, color string) (int64, error) {
 	if name == "" {
 		return 0, nil
@@ -162,6 +291,7 @@ func (s *FeedService) resolveCalendarName(name, color string) (int64, error) {
 	if err := s.calRepo.CreateCalendar(newCal); err != nil {
 		return 0, err
 	}
+	s.bus.Publish(Change{Kind: KindCalendar, Action: model.ActionCreate, ID: newCal.ID})
 	return newCal.ID, nil
 }
 
@@ -172,7 +302,14 @@ func (s *FeedService) doRefresh(feed *model.Feed) {
 			eventColor = cal.Color
 		}
 	}
-	imported, err := s.fetchAndImport(feed.URL, feed.CalendarID, eventColor)
+	start := time.Now()
+	imported, err := s.fetchAndImport(feed, eventColor)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	feedRefreshes.Inc(result)
+	feedRefreshDuration.Observe(time.Since(start).Seconds(), result)
 	now := time.Now().UTC().Format(time.RFC3339)
 	feed.LastRefreshedAt = now
 	if err != nil {
@@ -186,16 +323,44 @@ func (s *FeedService) doRefresh(feed *model.Feed) {
 	}
 	if updateErr := s.feedRepo.UpdateFeed(feed); updateErr != nil {
 		log.Printf("feed %d: failed to update after refresh: %v", feed.ID, updateErr)
+		return
+	}
+	s.bus.Publish(Change{Kind: KindFeed, Action: model.ActionUpdate, ID: feed.ID, Feed: feed})
+	if err != nil {
+		s.bus.Publish(Change{Kind: KindFeed, Action: ActionRefreshFailed, ID: feed.ID, Feed: feed})
 	}
 }
 
-func (s *FeedService) fetchAndImport(feedURL string, calendarID int64, eventColor string) (int, error) {
+func (s *FeedService) fetchAndImport(feed *model.Feed, eventColor string) (int, error) {
+	feedURL := feed.URL
+	rules, err := compileFeedRules(feed.Rules)
+	if err != nil {
+		return 0, err
+	}
+	batch := &feedBatch{s: s, feed: feed, eventColor: eventColor, rules: rules,
+		actor: model.Actor{Name: fmt.Sprintf("feed %d", feed.ID), Source: model.SourceFeed}}
+
 	// Re-validate stored feed URLs on every refresh, not just at create time.
-	if err := httputil.ValidateExternalURL(feedURL); err != nil {
+	if err := s.validateURL(feedURL); err != nil {
 		return 0, err
 	}
-	client := httputil.NewSafeHTTPClient(30 * time.Second)
-	resp, err := client.Get(feedURL)
+	client, authorize, err := s.feedClient(feed)
+	if err != nil {
+		return 0, err
+	}
+	if feed.Type == model.FeedTypeCalDAV {
+		err := s.syncCalDAV(feed, client, authorize, batch)
+		if err == nil && batch.document.buf.Len() > 0 {
+			s.saveDocument(feed, &batch.document)
+		}
+		return batch.imported, err
+	}
+	req, err := http.NewRequest(http.MethodGet, feedURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	authorize(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch URL: %v", err)
 	}
@@ -204,15 +369,156 @@ func (s *FeedService) fetchAndImport(feedURL string, calendarID int64, eventColo
 		return 0, fmt.Errorf("URL returned status %d", resp.StatusCode)
 	}
 
-	events, err := ical.Decode(io.LimitReader(resp.Body, maxFeedImportSize))
+	// Import the feed as it is read, a batch of events at a time.
+	if err := batch.decode(io.TeeReader(io.LimitReader(resp.Body, maxFeedImportSize), &batch.document)); err != nil {
+		return batch.imported, err
+	}
+	if err := batch.flush(); err != nil {
+		return batch.imported, err
+	}
+	s.saveDocument(feed, &batch.document)
+	return batch.imported, nil
+}
+
+// saveDocument keeps the document of a refresh, to preview rules against.
+func (s *FeedService) saveDocument(feed *model.Feed, doc *feedDocument) {
+	if doc.tooLarge {
+		log.Printf("feed %d: document larger than %d bytes not kept for previews", feed.ID, maxFeedDocumentSize)
+		return
+	}
+	if err := s.feedRepo.SaveFeedDocument(feed.ID, doc.buf.Bytes()); err != nil {
+		log.Printf("feed %d: failed to keep document: %v", feed.ID, err)
+	}
+}
+
+// feedDocument copies a document, unless it is larger than
+// maxFeedDocumentSize.
+type feedDocument struct {
+	buf      bytes.Buffer
+	tooLarge bool
+}
+
+func (d *feedDocument) Write(p []byte) (int, error) {
+	if d.tooLarge {
+		return len(p), nil
+	}
+	if d.buf.Len()+len(p) > maxFeedDocumentSize {
+		d.tooLarge = true
+		d.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+	return d.buf.Write(p)
+}
+
+// syncCalDAV imports the events of a CalDAV feed changed since its last
+// refresh, discovering its calendar collection on the first one.
+func (s *FeedService) syncCalDAV(feed *model.Feed, httpClient *http.Client, authorize func(*http.Request), batch *feedBatch) error {
+	client := &caldav.Client{HTTP: httpClient, Authorize: authorize, MaxResponseSize: maxFeedImportSize}
+	ctx, cancel := context.WithTimeout(context.Background(), feedFetchTimeout)
+	defer cancel()
+
+	if feed.CollectionURL == "" {
+		collection, err := client.Discover(ctx, feed.URL)
+		if err != nil {
+			return err
+		}
+		feed.CollectionURL = collection
+	}
+	if err := s.validateURL(feed.CollectionURL); err != nil {
+		return err
+	}
+	// Feeds only add events, so an object read once is not read again.
+	hrefs, err := s.feedRepo.ListFeedObjects(feed.ID)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(hrefs))
+	for _, href := range hrefs {
+		known[href] = true
+	}
+	client.Known = func(href string) bool { return known[href] }
+	var read []string
+	token, err := client.Sync(ctx, feed.CollectionURL, feed.SyncToken, func(o caldav.Object) error {
+		read = append(read, o.Href)
+		// The objects of a sync are kept as one document of concatenated calendars
+		_, _ = batch.document.Write(o.Data)
+		if !bytes.HasSuffix(o.Data, []byte("\n")) {
+			_, _ = batch.document.Write([]byte("\r\n"))
+		}
+		if err := batch.decode(bytes.NewReader(o.Data)); err != nil {
+			return fmt.Errorf("%s: %w", o.Href, err)
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse iCalendar data: %v", err)
+		return err
+	}
+	if err := batch.flush(); err != nil {
+		return err
 	}
+	if err := s.feedRepo.AddFeedObjects(feed.ID, read); err != nil {
+		return err
+	}
+	// Only after all changes are imported, so that a failed refresh is retried.
+	feed.SyncToken = token
+	return nil
+}
 
+// feedBatch collects the events of a feed to import them a batch at a time.
+type feedBatch struct {
+	s          *FeedService
+	feed       *model.Feed
+	eventColor string
+	rules      *feedRules
+	actor      model.Actor
+	events     []model.Event
+	imported   int
+	document   feedDocument // the document decoded, for previews
+}
+
+// decode adds the events of an iCalendar document, importing each full batch.
+func (b *feedBatch) decode(r io.Reader) error {
+	dec := ical.NewDecoder(r)
+	for {
+		e, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse iCalendar data: %v", err)
+		}
+		if e.RecurrenceOriginalStart != "" {
+			continue // skip overrides for now
+		}
+		if !b.rules.apply(&e) {
+			continue
+		}
+		b.events = append(b.events, e)
+		if len(b.events) >= importBatchSize {
+			if err := b.flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// flush imports the events collected.
+func (b *feedBatch) flush() error {
+	if len(b.events) == 0 {
+		return nil
+	}
+	n, err := b.s.importBatch(b.feed, b.events, b.eventColor, b.actor)
+	b.imported += n
+	b.events = b.events[:0]
+	return err
+}
+
+// importBatch imports the events of a feed that are not imported already.
+func (s *FeedService) importBatch(feed *model.Feed, events []model.Event, eventColor string, actor model.Actor) (int, error) {
 	// Collect all UIDs to check existence in a single query.
 	var uidsToCheck []string
 	for _, e := range events {
-		if e.ImportUID != "" && e.RecurrenceOriginalStart == "" {
+		if e.ImportUID != "" {
 			uidsToCheck = append(uidsToCheck, e.ImportUID)
 		}
 	}
@@ -222,25 +528,31 @@ func (s *FeedService) fetchAndImport(feedURL string, calendarID int64, eventColo
 	}
 
 	imported := 0
-	for _, e := range events {
-		if e.RecurrenceOriginalStart != "" {
-			continue // skip overrides for now
-		}
-		if e.ImportUID != "" && existingUIDs[e.ImportUID] {
-			continue
-		}
-		ev, err := buildEventForImport(e)
-		if err != nil {
-			continue
-		}
-		ev.CalendarID = calendarID
-		if eventColor != "" && ev.Color == "" {
-			ev.Color = eventColor
-		}
-		if err := s.eventRepo.Create(ev); err != nil {
-			continue
+	err = s.history.inTx(s.eventRepo, func(repo repository.EventRepository, h historyRecorder) error {
+		for _, e := range events {
+			if e.ImportUID != "" && existingUIDs[e.ImportUID] {
+				continue
+			}
+			ev, err := buildEventForImport(e)
+			if err != nil {
+				continue
+			}
+			ev.CalendarID = feed.CalendarID
+			if eventColor != "" && ev.Color == "" {
+				ev.Color = eventColor
+			}
+			if err := repo.Create(ev); err != nil {
+				continue
+			}
+			if err := h.record(actor, model.ActionCreate, ev.ID, nil, ev); err != nil {
+				return err
+			}
+			imported++
 		}
-		imported++
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 	return imported, nil
 }
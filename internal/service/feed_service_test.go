@@ -0,0 +1,339 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/caldav/caldavtest"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/secret"
+)
+
+// mockFeedRepo implements repository.FeedRepository and keeps feeds in memory.
+type mockFeedRepo struct {
+	feeds     map[int64]model.Feed
+	documents map[int64][]byte
+	objects   map[int64][]string
+}
+
+func (m *mockFeedRepo) CreateFeed(feed *model.Feed) error {
+	if m.feeds == nil {
+		m.feeds = make(map[int64]model.Feed)
+	}
+	feed.ID = int64(len(m.feeds) + 1)
+	m.feeds[feed.ID] = *feed
+	return nil
+}
+func (m *mockFeedRepo) GetFeedByID(id int64) (*model.Feed, error) {
+	f, ok := m.feeds[id]
+	if !ok {
+		return nil, nil
+	}
+	return &f, nil
+}
+func (m *mockFeedRepo) ListFeeds() ([]model.Feed, error) {
+	var feeds []model.Feed
+	for _, f := range m.feeds {
+		feeds = append(feeds, f)
+	}
+	return feeds, nil
+}
+func (m *mockFeedRepo) UpdateFeed(feed *model.Feed) error {
+	m.feeds[feed.ID] = *feed
+	return nil
+}
+func (m *mockFeedRepo) DeleteFeed(id int64) error {
+	delete(m.feeds, id)
+	delete(m.documents, id)
+	delete(m.objects, id)
+	return nil
+}
+func (m *mockFeedRepo) SaveFeedDocument(feedID int64, data []byte) error {
+	if m.documents == nil {
+		m.documents = make(map[int64][]byte)
+	}
+	m.documents[feedID] = append([]byte(nil), data...)
+	return nil
+}
+func (m *mockFeedRepo) GetFeedDocument(feedID int64) ([]byte, string, error) {
+	data, ok := m.documents[feedID]
+	if !ok {
+		return nil, "", nil
+	}
+	return data, "2026-06-01T12:00:00Z", nil
+}
+func (m *mockFeedRepo) ListFeedObjects(feedID int64) ([]string, error) {
+	return m.objects[feedID], nil
+}
+func (m *mockFeedRepo) AddFeedObjects(feedID int64, hrefs []string) error {
+	if m.objects == nil {
+		m.objects = make(map[int64][]string)
+	}
+	m.objects[feedID] = append(m.objects[feedID], hrefs...)
+	return nil
+}
+
+// newTestFeedService returns a feed service that may fetch from local test
+// servers, and the events it imports.
+func newTestFeedService(t *testing.T) (*FeedService, *mockFeedRepo, *[]model.Event) {
+	t.Helper()
+	secrets, err := secret.NewBox(make([]byte, secret.KeySize))
+	require.NoError(t, err)
+	var created []model.Event
+	repo := &mockRepo{
+		createFn: func(e *model.Event) error {
+			e.ID = int64(len(created) + 1)
+			created = append(created, *e)
+			return nil
+		},
+		filterExistingIcsUIDsFn: func(uids []string) (map[string]bool, error) {
+			existing := make(map[string]bool)
+			for _, e := range created {
+				existing[e.IcsUID] = true
+			}
+			return existing, nil
+		},
+	}
+	feedRepo := &mockFeedRepo{}
+	s := NewFeedService(feedRepo, repo, &mockCalRepo{}, &mockHistoryRepo{}, NewEventBus(), secrets)
+	s.client = http.DefaultClient
+	s.validateURL = func(string) error { return nil }
+	return s, feedRepo, &created
+}
+
+func caldavEvent(uid string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + uid +
+		"\r\nDTSTART:20260601T090000Z\r\nDTEND:20260601T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestFeedService_CalDAV(t *testing.T) {
+	srv := caldavtest.NewServer(t)
+	srv.Username, srv.Password = "user", "secret"
+	srv.Put("a.ics", caldavEvent("a"))
+	srv.Put("b.ics", caldavEvent("b"))
+
+	s, feedRepo, created := newTestFeedService(t)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	feed, err := s.Create(&api.CreateFeedRequest{
+		Type:     api.NewOptFeedType(api.FeedTypeCaldav),
+		URL:      *u,
+		Username: api.NewOptString("user"),
+		Password: api.NewOptString("secret"),
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, feedRepo.feeds[feed.ID].Credentials, "secret", "the password is stored encrypted")
+	assert.Equal(t, api.FeedAuthBasic, FeedToAPI(feed).Auth.Value)
+
+	feed, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	assert.Empty(t, feed.LastError)
+	assert.Equal(t, srv.CollectionURL(), feed.CollectionURL, "the collection is discovered")
+	assert.NotEmpty(t, feed.SyncToken)
+	require.Len(t, *created, 2)
+
+	// Only the changes are fetched, and objects already read are not read again
+	srv.Put("a.ics", caldavEvent("a"))
+	srv.Put("c.ics", caldavEvent("c"))
+	feed, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	assert.Empty(t, feed.LastError)
+	require.Len(t, *created, 3)
+	assert.Equal(t, "c", (*created)[2].IcsUID)
+	assert.Equal(t, []string{caldavtest.CollectionPath + "a.ics", caldavtest.CollectionPath + "b.ics", caldavtest.CollectionPath + "c.ics"}, srv.Multiget())
+	assert.Len(t, feedRepo.objects[feed.ID], 3)
+	tokens := srv.SyncTokens()
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "", tokens[0])
+	assert.NotEmpty(t, tokens[1])
+
+	// A wrong password fails the refresh, keeping the sync token
+	token := feed.SyncToken
+	_, err = s.Update(feed.ID, &api.UpdateFeedRequest{Password: api.NewOptString("wrong")})
+	require.NoError(t, err)
+	feed, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "feed refresh failed", feed.LastError)
+	assert.Equal(t, token, feed.SyncToken)
+}
+
+func TestFeedService_Auth(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = io.WriteString(w, caldavEvent("a"))
+	}))
+	defer srv.Close()
+
+	s, feedRepo, created := newTestFeedService(t)
+	u, err := url.Parse(srv.URL + "/calendar.ics")
+	require.NoError(t, err)
+	feed, err := s.Create(&api.CreateFeedRequest{
+		URL:     *u,
+		Token:   api.NewOptString("tok3n"),
+		Headers: api.NewOptFeedHeaders(api.FeedHeaders{"x-api-key": "k3y"}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.FeedAuthBearer, feed.AuthType)
+	assert.Equal(t, []string{"X-Api-Key"}, feed.HeaderNames)
+	stored := feedRepo.feeds[feed.ID].Credentials
+	assert.NotContains(t, stored, "tok3n")
+	assert.NotContains(t, stored, "k3y")
+
+	feed, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	assert.Empty(t, feed.LastError)
+	assert.Len(t, *created, 1)
+	assert.Equal(t, "Bearer tok3n", got.Get("Authorization"))
+	assert.Equal(t, "k3y", got.Get("X-Api-Key"))
+
+	// Basic authentication replaces the token; the headers are kept
+	feed, err = s.Update(feed.ID, &api.UpdateFeedRequest{Username: api.NewOptString("user"), Password: api.NewOptString("pa55")})
+	require.NoError(t, err)
+	assert.Equal(t, model.FeedAuthBasic, feed.AuthType)
+	_, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	user, pass, ok := (&http.Request{Header: got}).BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "pa55", pass)
+	assert.Equal(t, "k3y", got.Get("X-Api-Key"))
+
+	// Removing everything leaves nothing to store
+	feed, err = s.Update(feed.ID, &api.UpdateFeedRequest{Username: api.NewOptString(""), Password: api.NewOptString(""),
+		Headers: api.NewOptFeedHeaders(api.FeedHeaders{})})
+	require.NoError(t, err)
+	assert.Equal(t, model.FeedAuthNone, feed.AuthType)
+	assert.Empty(t, feed.HeaderNames)
+	assert.Empty(t, feed.Credentials)
+}
+
+func TestFeedService_AuthNotSentToOtherServer(t *testing.T) {
+	otherHit := false
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHit = true
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.RedirectHandler(other.URL+"/calendar.ics", http.StatusFound))
+	defer srv.Close()
+
+	s, _, _ := newTestFeedService(t)
+	u, err := url.Parse(srv.URL + "/calendar.ics")
+	require.NoError(t, err)
+	feed, err := s.Create(&api.CreateFeedRequest{URL: *u, Headers: api.NewOptFeedHeaders(api.FeedHeaders{"X-Api-Key": "k3y"})})
+	require.NoError(t, err)
+	feed, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "feed refresh failed", feed.LastError)
+	assert.False(t, otherHit)
+}
+
+func TestFeedService_AuthValidation(t *testing.T) {
+	s, _, _ := newTestFeedService(t)
+	u, err := url.Parse("https://example.com/calendar.ics")
+	require.NoError(t, err)
+	for name, req := range map[string]*api.CreateFeedRequest{
+		"token and password":   {URL: *u, Token: api.NewOptString("t"), Password: api.NewOptString("p")},
+		"invalid header name":  {URL: *u, Headers: api.NewOptFeedHeaders(api.FeedHeaders{"X Key": "v"})},
+		"reserved header":      {URL: *u, Headers: api.NewOptFeedHeaders(api.FeedHeaders{"host": "example.org"})},
+		"invalid header value": {URL: *u, Headers: api.NewOptFeedHeaders(api.FeedHeaders{"X-Key": "a\r\nX-Other: b"})},
+		"authorization header with token": {URL: *u, Token: api.NewOptString("t"),
+			Headers: api.NewOptFeedHeaders(api.FeedHeaders{"Authorization": "Token t"})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Create(req)
+			assert.ErrorIs(t, err, ErrValidation)
+		})
+	}
+
+	// A custom Authorization header alone is fine
+	feed, err := s.Create(&api.CreateFeedRequest{URL: *u, Headers: api.NewOptFeedHeaders(api.FeedHeaders{"Authorization": "Token t"})})
+	require.NoError(t, err)
+	assert.Equal(t, model.FeedAuthNone, feed.AuthType)
+}
+
+func TestFeedService_Rules(t *testing.T) {
+	const doc = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\nUID:1\r\nSUMMARY:U12: Training\r\nCATEGORIES:U12\r\nDTSTART:20260601T170000Z\r\nDTEND:20260601T180000Z\r\n" +
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT30M\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:2\r\nSUMMARY:U14: Training\r\nCATEGORIES:U14\r\nDTSTART:20260602T170000Z\r\nDTEND:20260602T180000Z\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:3\r\nSUMMARY:U12: Match (cancelled)\r\nCATEGORIES:U12\r\nDTSTART:20260603T170000Z\r\nDTEND:20260603T180000Z\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, doc)
+	}))
+	defer srv.Close()
+
+	s, _, created := newTestFeedService(t)
+	u, err := url.Parse(srv.URL + "/club.ics")
+	require.NoError(t, err)
+	feed, err := s.Create(&api.CreateFeedRequest{URL: *u, Rules: api.FeedRules{
+		{Field: api.NewOptFeedRuleField(api.FeedRuleFieldCategories), Pattern: api.NewOptString("^U12$"), Action: api.FeedRuleActionInclude},
+		{Pattern: api.NewOptString("cancelled"), Action: api.FeedRuleActionExclude},
+		{Pattern: api.NewOptString(`^U\d+: (.*)$`), Action: api.FeedRuleActionRename, Value: api.NewOptString("Football $1")},
+		{Pattern: api.NewOptString("Training"), Action: api.FeedRuleActionColor, Value: api.NewOptString("green")},
+		{Action: api.FeedRuleActionDropAlarms},
+		{Action: api.FeedRuleActionTransparent},
+		{Action: api.FeedRuleActionShift, Value: api.NewOptString("-PT1H")},
+	}})
+	require.NoError(t, err)
+	require.Len(t, feed.Rules, 7)
+	assert.Equal(t, model.FeedRuleSummary, feed.Rules[1].Field, "the field defaults to the summary")
+
+	_, err = s.Preview(feed.ID, nil)
+	assert.ErrorIs(t, err, ErrNotFound, "not fetched yet")
+
+	feed, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	assert.Empty(t, feed.LastError)
+	require.Len(t, *created, 1)
+	e := (*created)[0]
+	assert.Equal(t, "Football Training", e.Title)
+	assert.Equal(t, "green", e.Color)
+	assert.Zero(t, e.ReminderMinutes)
+	assert.True(t, e.Transparent)
+	assert.Equal(t, "2026-06-01T16:00:00Z", e.StartTime)
+	assert.Equal(t, "2026-06-01T17:00:00Z", e.EndTime)
+
+	// The preview uses the rules of the feed, or those given
+	preview, err := s.Preview(feed.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, preview.Total)
+	assert.Equal(t, 1, preview.Imported)
+	require.Len(t, preview.Events, 3)
+	assert.Equal(t, "Football Training", preview.Events[0].Title)
+	assert.True(t, preview.Events[1].Excluded)
+	assert.True(t, preview.Events[2].Excluded)
+
+	preview, err = s.Preview(feed.ID, api.FeedRules{{Pattern: api.NewOptString("Match"), Action: api.FeedRuleActionExclude}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.Imported)
+	assert.Equal(t, "U12: Training", preview.Events[0].Title)
+
+	preview, err = s.Preview(feed.ID, api.FeedRules{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, preview.Imported, "no rules import everything")
+
+	// Rules are replaced on update
+	feed, err = s.Update(feed.ID, &api.UpdateFeedRequest{Rules: api.FeedRules{}})
+	require.NoError(t, err)
+	assert.Empty(t, feed.Rules)
+	feed, err = s.Update(feed.ID, &api.UpdateFeedRequest{RefreshIntervalMinutes: api.NewOptInt(30)})
+	require.NoError(t, err)
+	assert.Empty(t, feed.Rules)
+
+	// New rules only apply to the events imported from then on
+	_, err = s.RefreshFeed(feed.ID)
+	require.NoError(t, err)
+	require.Len(t, *created, 3, "the events excluded before are imported")
+	assert.Equal(t, "Football Training", (*created)[0].Title, "imported events are not changed")
+	assert.Equal(t, "U14: Training", (*created)[1].Title)
+	assert.Equal(t, "U12: Match (cancelled)", (*created)[2].Title)
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+)
+
+// historyRecorder writes change history entries and publishes the changes on
+// the event bus. Entries are written in the transaction of the change, so that
+// no change is committed without its entry, and the changes are published once
+// the transaction is committed.
+type historyRecorder struct {
+	repo repository.HistoryRepository
+	bus  *EventBus
+	// deferred collects the changes made in a transaction, to be published
+	// once it is committed. It is nil outside of a transaction.
+	deferred *[]Change
+}
+
+// record adds a history entry for a change, and publishes the change after the
+// commit of the transaction it is made in.
+func (h historyRecorder) record(actor model.Actor, action string, eventID int64, old, new *model.Event) error {
+	if h.repo != nil {
+		entry := &model.HistoryEntry{
+			EventID: eventID,
+			Action:  action,
+			Actor:   actor.Name,
+			Source:  actor.Source,
+			Old:     old,
+			New:     new,
+		}
+		if err := h.repo.AddHistory(entry); err != nil {
+			return fmt.Errorf("record %s of event %d in history: %w", action, eventID, err)
+		}
+	}
+	h.publish(eventChange(action, eventID, old, new))
+	return nil
+}
+
+// publish publishes a change on the event bus after the commit of the
+// transaction it is made in.
+func (h historyRecorder) publish(c Change) {
+	if h.deferred != nil {
+		*h.deferred = append(*h.deferred, c)
+	} else {
+		h.bus.Publish(c)
+	}
+}
+
+// txRepository is a repository that can run functions in a transaction.
+type txRepository interface {
+	InTx(fn func(repo repository.EventRepository) error) error
+}
+
+// inTx calls fn with a repository and a recorder that both work in one
+// transaction of repo, and publishes the recorded changes once it is
+// committed. In a transaction already, fn joins it.
+func (h historyRecorder) inTx(repo txRepository, fn func(repo repository.EventRepository, h historyRecorder) error) error {
+	if h.deferred != nil {
+		return repo.InTx(func(txRepo repository.EventRepository) error {
+			return fn(txRepo, h)
+		})
+	}
+	var changes []Change
+	err := repo.InTx(func(txRepo repository.EventRepository) error {
+		tx := h
+		if histRepo, ok := txRepo.(repository.HistoryRepository); ok && h.repo != nil {
+			tx.repo = histRepo
+		}
+		tx.deferred = &changes
+		return fn(txRepo, tx)
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		h.bus.Publish(c)
+	}
+	return nil
+}
+
+// History returns the recorded changes of an event, oldest first. It also works
+// for events that have since been deleted.
+func (s *EventService) History(id int64) ([]model.HistoryEntry, error) {
+	entries, err := s.history.repo.ListHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []model.HistoryEntry{}
+	}
+	return entries, nil
+}
+
+// RestoreFromHistory undoes the change recorded in a history entry by putting
+// back the event values from before that change. A deleted event is re-created
+// under its old ID. The creation of an event cannot be undone this way.
+func (s *EventService) RestoreFromHistory(id, entryID int64) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.restoreFromHistory(id, entryID) })
+}
+
+func (s *EventService) restoreFromHistory(id, entryID int64) (*model.Event, error) {
+	entry, err := s.history.repo.GetHistoryEntry(entryID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.EventID != id {
+		return nil, ErrNotFound
+	}
+	if entry.Old == nil {
+		return nil, fmt.Errorf("%w: the creation of an event cannot be restored, delete the event instead", ErrValidation)
+	}
+
+	restored := *entry.Old
+	restored.ID = id
+	if restored.RecurrenceParentID != nil {
+		parent, err := s.repo.GetByID(*restored.RecurrenceParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("%w: the recurring event of this override no longer exists", ErrValidation)
+		}
+	}
+
+	existing, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// A deleted event may still be in the trash, occupying its ID.
+		err := s.repo.Restore(id)
+		if err == nil {
+			existing, err = s.repo.GetByID(id)
+			if err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	if existing == nil {
+		if err := s.repo.Create(&restored); err != nil {
+			return nil, err
+		}
+	} else {
+		restored.CreatedAt = existing.CreatedAt
+		if err := s.repo.Update(&restored); err != nil {
+			return nil, err
+		}
+		restored.CalendarName = existing.CalendarName
+		if restored.CalendarID != existing.CalendarID {
+			if cal, err := s.calRepo.GetCalendarByID(restored.CalendarID); err == nil && cal != nil {
+				restored.CalendarName = cal.Name
+			}
+		}
+	}
+	if err := s.history.record(s.actor, model.ActionRestore, id, existing, &restored); err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
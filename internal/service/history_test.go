@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestUpdate_RecordsHistory(t *testing.T) {
+	repo := &mockRepo{
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Old", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}, nil
+		},
+	}
+	histRepo := &mockHistoryRepo{}
+	svc := NewEventService(repo, &mockCalRepo{}, histRepo, nil).As(model.Actor{Name: "alice", Source: model.SourceUI})
+
+	_, err := svc.Update(1, &api.UpdateEventRequest{Title: optString("New")})
+	require.NoError(t, err)
+
+	require.Len(t, histRepo.entries, 1)
+	entry := histRepo.entries[0]
+	assert.Equal(t, int64(1), entry.EventID)
+	assert.Equal(t, model.ActionUpdate, entry.Action)
+	assert.Equal(t, "alice", entry.Actor)
+	assert.Equal(t, model.SourceUI, entry.Source)
+	assert.Equal(t, "Old", entry.Old.Title)
+	assert.Equal(t, "New", entry.New.Title)
+}
+
+func TestUpdate_HistoryFailure(t *testing.T) {
+	repo := &mockRepo{
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Old", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}, nil
+		},
+	}
+	histErr := errors.New("disk full")
+	bus := NewEventBus()
+	changes, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{err: histErr}, bus)
+
+	_, err := svc.Update(1, &api.UpdateEventRequest{Title: optString("New")})
+	assert.ErrorIs(t, err, histErr, "the change fails, and its transaction is rolled back")
+	assert.Empty(t, changes)
+}
+
+func TestDelete_RecordsHistory(t *testing.T) {
+	repo := &mockRepo{
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Gone"}, nil
+		},
+	}
+	histRepo := &mockHistoryRepo{}
+	svc := NewEventService(repo, &mockCalRepo{}, histRepo, nil)
+
+	require.NoError(t, svc.Delete(3))
+
+	require.Len(t, histRepo.entries, 1)
+	assert.Equal(t, model.ActionDelete, histRepo.entries[0].Action)
+	assert.Equal(t, model.SourceAPI, histRepo.entries[0].Source)
+	assert.Equal(t, "Gone", histRepo.entries[0].Old.Title)
+	assert.Nil(t, histRepo.entries[0].New)
+}
+
+func TestRestoreFromHistory_UndoesUpdate(t *testing.T) {
+	current := &model.Event{ID: 1, Title: "Clobbered", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z", CreatedAt: "2026-01-01T00:00:00Z"}
+	var updated *model.Event
+	repo := &mockRepo{
+		getByIDFn: func(id int64) (*model.Event, error) { return current, nil },
+		updateFn: func(e *model.Event) error {
+			updated = e
+			return nil
+		},
+	}
+	histRepo := &mockHistoryRepo{}
+	old := &model.Event{ID: 1, Title: "Original", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}
+	require.NoError(t, histRepo.AddHistory(&model.HistoryEntry{EventID: 1, Action: model.ActionUpdate, Source: model.SourceFeed, Old: old, New: current}))
+	svc := NewEventService(repo, &mockCalRepo{}, histRepo, nil)
+
+	restored, err := svc.RestoreFromHistory(1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Original", restored.Title)
+	require.NotNil(t, updated)
+	assert.Equal(t, "Original", updated.Title)
+	assert.Equal(t, "2026-01-01T00:00:00Z", updated.CreatedAt)
+
+	require.Len(t, histRepo.entries, 2)
+	assert.Equal(t, model.ActionRestore, histRepo.entries[1].Action)
+	assert.Equal(t, "Clobbered", histRepo.entries[1].Old.Title)
+}
+
+func TestRestoreFromHistory_RecreatesDeleted(t *testing.T) {
+	var created *model.Event
+	repo := &mockRepo{
+		createFn: func(e *model.Event) error {
+			created = e
+			return nil
+		},
+	}
+	histRepo := &mockHistoryRepo{}
+	old := &model.Event{ID: 5, Title: "Deleted", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z"}
+	require.NoError(t, histRepo.AddHistory(&model.HistoryEntry{EventID: 5, Action: model.ActionDelete, Old: old}))
+	svc := NewEventService(repo, &mockCalRepo{}, histRepo, nil)
+
+	_, err := svc.RestoreFromHistory(5, 1)
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.Equal(t, int64(5), created.ID)
+	assert.Equal(t, "Deleted", created.Title)
+}
+
+func TestRestoreFromHistory_CreationCannotBeRestored(t *testing.T) {
+	histRepo := &mockHistoryRepo{}
+	require.NoError(t, histRepo.AddHistory(&model.HistoryEntry{EventID: 5, Action: model.ActionCreate, New: &model.Event{ID: 5}}))
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, histRepo, nil)
+
+	_, err := svc.RestoreFromHistory(5, 1)
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestRestoreFromHistory_EntryOfOtherEvent(t *testing.T) {
+	histRepo := &mockHistoryRepo{}
+	require.NoError(t, histRepo.AddHistory(&model.HistoryEntry{EventID: 5, Action: model.ActionDelete, Old: &model.Event{ID: 5}}))
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, histRepo, nil)
+
+	_, err := svc.RestoreFromHistory(6, 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
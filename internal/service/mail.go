@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// maxMailDepth bounds the nesting of multiparts and attached messages.
+const maxMailDepth = 10
+
+// MailAction is what IngestMail did with an event of a message.
+type MailAction string
+
+const (
+	MailCreated   MailAction = "created"
+	MailUpdated   MailAction = "updated"
+	MailCancelled MailAction = "cancelled"
+	MailSkipped   MailAction = "skipped"
+)
+
+// MailItem is the result of one event of a message.
+type MailItem struct {
+	UID    string
+	Action MailAction
+	Event  *model.Event // the event created, updated or cancelled
+	Reason string       // why the event was skipped
+}
+
+// MailResult is the result of IngestMail.
+type MailResult struct {
+	Calendars int // number of iCalendar parts in the message
+	Items     []MailItem
+}
+
+// IngestMail applies the iCalendar parts of an email message (RFC 5322),
+// such as a forwarded invitation, in one transaction. The events of a
+// REQUEST or PUBLISH are created in the named calendar, or update the event
+// imported with the same UID wherever it is. A CANCEL moves that event to the
+// trash, or excludes an instance of it for an event with RECURRENCE-ID. Other
+// methods, such as REPLY, are skipped.
+func (s *EventService) IngestMail(r io.Reader, calendarName string) (*MailResult, error) {
+	if len(calendarName) > model.MaxCalendarNameLength {
+		return nil, fmt.Errorf("%w: calendar name must be at most %d characters", ErrValidation, model.MaxCalendarNameLength)
+	}
+	parts, err := calendarParts(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: message contains no calendar data", ErrValidation)
+	}
+	calendarID, err := s.resolveCalendarName(calendarName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MailResult{Calendars: len(parts)}
+	err = s.inTx(func(tx *EventService) error {
+		for _, data := range parts {
+			dec := ical.NewDecoder(bytes.NewReader(data))
+			var events []model.Event
+			for {
+				e, err := dec.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return fmt.Errorf("%w: invalid calendar data: %v", ErrValidation, err)
+				}
+				events = append(events, e)
+			}
+			// Recurring events before their overrides
+			sort.SliceStable(events, func(i, j int) bool {
+				return events[i].RecurrenceOriginalStart == "" && events[j].RecurrenceOriginalStart != ""
+			})
+			for _, e := range events {
+				item, err := tx.applyMailEvent(dec.Method(), e, calendarID)
+				if err != nil {
+					return err
+				}
+				result.Items = append(result.Items, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *EventService) applyMailEvent(method string, e model.Event, calendarID int64) (MailItem, error) {
+	switch method {
+	case "", "PUBLISH", "REQUEST":
+		return s.mailRequest(e, calendarID)
+	case "CANCEL":
+		return s.mailCancel(e)
+	default:
+		return MailItem{UID: e.ImportUID, Action: MailSkipped, Reason: fmt.Sprintf("METHOD:%s is not supported", method)}, nil
+	}
+}
+
+// mailRequest creates or updates the event of a REQUEST.
+func (s *EventService) mailRequest(e model.Event, calendarID int64) (MailItem, error) {
+	item := MailItem{UID: e.ImportUID}
+	ev, err := buildEventForImport(e)
+	if err != nil {
+		item.Action, item.Reason = MailSkipped, err.Error()
+		return item, nil
+	}
+
+	var existing *model.Event
+	if e.RecurrenceOriginalStart != "" {
+		parent, err := s.mailEvent(e.ImportUID)
+		if err != nil {
+			return item, err
+		}
+		if parent == nil {
+			item.Action, item.Reason = MailSkipped, "no event with this UID to change an instance of"
+			return item, nil
+		}
+		ev.RecurrenceParentID = &parent.ID
+		ev.RecurrenceOriginalStart = e.RecurrenceOriginalStart
+		ev.RecurrenceFreq, ev.RecurrenceCount, ev.RecurrenceUntil, ev.RecurrenceInterval = "", 0, "", 0
+		ev.RecurrenceByDay, ev.RecurrenceByMonthDay, ev.RecurrenceByMonth, ev.ExDates, ev.RDates = "", "", "", "", ""
+		ev.CalendarID = parent.CalendarID
+		if existing, err = s.repo.GetOverride(parent.ID, e.RecurrenceOriginalStart); err != nil {
+			return item, err
+		}
+	} else if existing, err = s.mailEvent(e.ImportUID); err != nil {
+		return item, err
+	}
+
+	if existing == nil {
+		if ev.RecurrenceParentID == nil {
+			ev.CalendarID = calendarID
+		}
+		if err := s.repo.Create(ev); err != nil {
+			return item, err
+		}
+		if err := s.history.record(s.actor, model.ActionCreate, ev.ID, nil, ev); err != nil {
+			return item, err
+		}
+		item.Action, item.Event = MailCreated, ev
+		return item, nil
+	}
+
+	// Keep what the invitation does not say
+	ev.ID = existing.ID
+	ev.CalendarID = existing.CalendarID
+	ev.CreatedAt = existing.CreatedAt
+	if ev.Color == "" {
+		ev.Color = existing.Color
+	}
+	if ev.ReminderMinutes == 0 {
+		ev.ReminderMinutes = existing.ReminderMinutes
+	}
+	if err := s.repo.Update(ev); err != nil {
+		return item, err
+	}
+	if err := s.history.record(s.actor, model.ActionUpdate, ev.ID, existing, ev); err != nil {
+		return item, err
+	}
+	item.Action, item.Event = MailUpdated, ev
+	return item, nil
+}
+
+// mailCancel cancels the event, or the instance of it, of a CANCEL.
+func (s *EventService) mailCancel(e model.Event) (MailItem, error) {
+	item := MailItem{UID: e.ImportUID}
+	existing, err := s.mailEvent(e.ImportUID)
+	if err != nil {
+		return item, err
+	}
+	if existing == nil {
+		item.Action, item.Reason = MailSkipped, "no event with this UID to cancel"
+		return item, nil
+	}
+	if e.RecurrenceOriginalStart != "" {
+		parent, err := s.AddExDate(existing.ID, e.RecurrenceOriginalStart)
+		if errors.Is(err, ErrValidation) {
+			item.Action, item.Reason = MailSkipped, err.Error()
+			return item, nil
+		}
+		if err != nil {
+			return item, err
+		}
+		item.Action, item.Event = MailCancelled, parent
+		return item, nil
+	}
+	if err := s.Delete(existing.ID); err != nil {
+		return item, err
+	}
+	item.Action, item.Event = MailCancelled, existing
+	return item, nil
+}
+
+// mailEvent returns the event imported with a UID, or nil.
+func (s *EventService) mailEvent(uid string) (*model.Event, error) {
+	if uid == "" {
+		return nil, nil
+	}
+	return s.repo.GetByIcsUID(uid)
+}
+
+// calendarParts returns the iCalendar parts of an email message: text/calendar
+// and application/ics parts and attachments named *.ics, also in attached
+// messages. Identical parts, like an invitation both inline and attached,
+// are returned once.
+func calendarParts(r io.Reader) ([][]byte, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not an email message: %v", ErrValidation, err)
+	}
+	var parts [][]byte
+	if err := walkMailPart(textproto.MIMEHeader(msg.Header), msg.Body, 0, &parts); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+func walkMailPart(header textproto.MIMEHeader, body io.Reader, depth int, parts *[][]byte) error {
+	if depth > maxMailDepth {
+		return fmt.Errorf("%w: message is nested too deeply", ErrValidation)
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain" // the default of RFC 2045
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: invalid multipart message: %v", ErrValidation, err)
+			}
+			if err := walkMailPart(p.Header, p, depth+1, parts); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		msg, err := mail.ReadMessage(transferDecoder(header, body))
+		if err != nil {
+			return nil // not a message after all; nothing to find in it
+		}
+		return walkMailPart(textproto.MIMEHeader(msg.Header), msg.Body, depth+1, parts)
+	case mediaType == "text/calendar", mediaType == "application/ics", isICSAttachment(header, params):
+		data, err := io.ReadAll(transferDecoder(header, body))
+		if err != nil {
+			return fmt.Errorf("%w: invalid %s part: %v", ErrValidation, mediaType, err)
+		}
+		data = bytes.TrimSpace(data)
+		for _, p := range *parts {
+			if bytes.Equal(p, data) {
+				return nil
+			}
+		}
+		*parts = append(*parts, data)
+	}
+	return nil
+}
+
+// isICSAttachment reports whether a part is a file named *.ics, which some
+// mail clients send as application/octet-stream.
+func isICSAttachment(header textproto.MIMEHeader, contentTypeParams map[string]string) bool {
+	name := contentTypeParams["name"]
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	return strings.HasSuffix(strings.ToLower(name), ".ics")
+}
+
+// transferDecoder decodes the Content-Transfer-Encoding of a part.
+func transferDecoder(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
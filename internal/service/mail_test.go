@@ -0,0 +1,71 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const invitation = "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:inv-1\r\nSUMMARY:Planning\r\n" +
+	"DTSTART:20260601T090000Z\r\nDTEND:20260601T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestCalendarParts(t *testing.T) {
+	// An invitation both inline and attached, forwarded as an attached message.
+	forwarded := "From: organizer@example.com\r\n" +
+		"Subject: Invitation: Planning\r\n" +
+		"Content-Type: multipart/mixed; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n" +
+		"\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"You are invited.\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/calendar; method=REQUEST; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(invitation, "=", "=3D") +
+		"--alt--\r\n" +
+		"--inner\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"invite.ics\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"QkVHSU46VkNBTEVOREFSDQpNRVRIT0Q6UkVRVUVTVA0KQkVHSU46VkVWRU5UDQpVSUQ6aW52LTEN\r\n" +
+		"ClNVTU1BUlk6UGxhbm5pbmcNCkRUU1RBUlQ6MjAyNjA2MDFUMDkwMDAwWg0KRFRFTkQ6MjAyNjA2\r\n" +
+		"MDFUMTAwMDAwWg0KRU5EOlZFVkVOVA0KRU5EOlZDQUxFTkRBUg0K\r\n" +
+		"--inner--\r\n"
+	msg := "From: me@example.com\r\n" +
+		"To: calendar@example.com\r\n" +
+		"Subject: Fwd: Invitation: Planning\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See below.\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		forwarded +
+		"--outer--\r\n"
+
+	parts, err := calendarParts(strings.NewReader(msg))
+	require.NoError(t, err)
+	require.Len(t, parts, 1, "identical parts are returned once")
+	assert.Equal(t, strings.TrimSpace(invitation), string(parts[0]))
+}
+
+func TestCalendarParts_NoCalendar(t *testing.T) {
+	parts, err := calendarParts(strings.NewReader("From: me@example.com\r\nSubject: Hello\r\n\r\nJust text.\r\n"))
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+
+	_, err = calendarParts(strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrValidation)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// Page is one page of a list of events.
+type Page struct {
+	Events     []model.Event
+	Total      int    // number of events on all pages
+	NextCursor string // empty on the last page
+}
+
+// pageCursor is the position after the last event of a page. Lists in time
+// order continue after the event with the key (Start, Created, ID), so events
+// added or removed elsewhere in the list do not shift the pages. Search
+// results are ranked and continue at Offset instead.
+type pageCursor struct {
+	Start   string `json:"s,omitempty"`
+	Created string `json:"c,omitempty"`
+	ID      string `json:"i,omitempty"`
+	Offset  int    `json:"o,omitempty"`
+}
+
+func (c pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.Offset < 0 {
+		return c, fmt.Errorf("%w: invalid cursor", ErrValidation)
+	}
+	return c, nil
+}
+
+func compareEventKeys(a model.Event, b pageCursor) int {
+	if c := strings.Compare(a.StartTime, b.Start); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.CreatedAt, b.Created); c != 0 {
+		return c
+	}
+	return strings.Compare(a.StringID, b.ID)
+}
+
+// PaginateByTime returns the page of a time-ordered list of events starting
+// after cursor. A limit of 0 returns all events. StringID is set on the events.
+func PaginateByTime(events []model.Event, limit int, cursor string) (Page, error) {
+	for i := range events {
+		events[i].SetStringID()
+	}
+	// Break the ties of the list order, so the keys are in order.
+	slices.SortStableFunc(events, func(a, b model.Event) int {
+		return compareEventKeys(a, pageCursor{Start: b.StartTime, Created: b.CreatedAt, ID: b.StringID})
+	})
+
+	start := 0
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		start, _ = slices.BinarySearchFunc(events, c, compareEventKeys)
+		if start < len(events) && compareEventKeys(events[start], c) == 0 {
+			start++
+		}
+	}
+	return page(events, start, limit, func(last model.Event, _ int) pageCursor {
+		return pageCursor{Start: last.StartTime, Created: last.CreatedAt, ID: last.StringID}
+	}), nil
+}
+
+// PaginateRanked returns the page of a ranked list of events starting at
+// cursor. A limit of 0 returns all events. StringID is set on the events.
+func PaginateRanked(events []model.Event, limit int, cursor string) (Page, error) {
+	for i := range events {
+		events[i].SetStringID()
+	}
+	start := 0
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		start = min(c.Offset, len(events))
+	}
+	return page(events, start, limit, func(_ model.Event, end int) pageCursor {
+		return pageCursor{Offset: end}
+	}), nil
+}
+
+func page(events []model.Event, start, limit int, next func(last model.Event, end int) pageCursor) Page {
+	p := Page{Total: len(events)}
+	end := len(events)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+		p.NextCursor = next(events[end-1], end).encode()
+	}
+	p.Events = events[start:end]
+	return p
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func timedEvents() []model.Event {
+	return []model.Event{
+		{ID: 1, StartTime: "2026-03-01T10:00:00Z", CreatedAt: "2026-01-01T00:00:00Z"},
+		{ID: 3, StartTime: "2026-03-02T10:00:00Z", CreatedAt: "2026-01-01T00:00:00Z"},
+		{ID: 2, StartTime: "2026-03-02T10:00:00Z", CreatedAt: "2026-01-01T00:00:00Z"},
+		{ID: 4, StartTime: "2026-03-03T10:00:00Z", CreatedAt: "2026-01-01T00:00:00Z"},
+		{ID: 5, StartTime: "2026-03-04T10:00:00Z", CreatedAt: "2026-01-01T00:00:00Z"},
+	}
+}
+
+func pageIDs(p Page) []int64 {
+	var ids []int64
+	for _, e := range p.Events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestPaginateByTime(t *testing.T) {
+	p, err := PaginateByTime(timedEvents(), 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, pageIDs(p), "ties broken by id")
+	assert.Equal(t, 5, p.Total)
+	require.NotEmpty(t, p.NextCursor)
+
+	// An event added before the cursor does not shift the next page.
+	events := append(timedEvents(), model.Event{ID: 6, StartTime: "2026-02-01T10:00:00Z"})
+	p, err = PaginateByTime(events, 2, p.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, pageIDs(p))
+	assert.Equal(t, 6, p.Total)
+
+	// The event at the cursor was deleted.
+	events = timedEvents()
+	events = append(events[:3], events[4:]...)
+	p, err = PaginateByTime(events, 2, p.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5}, pageIDs(p))
+	assert.Empty(t, p.NextCursor, "last page")
+
+	p, err = PaginateByTime(timedEvents(), 0, "")
+	require.NoError(t, err)
+	assert.Len(t, p.Events, 5, "no limit")
+	assert.Empty(t, p.NextCursor)
+}
+
+func TestPaginateRanked(t *testing.T) {
+	events := timedEvents()
+	p, err := PaginateRanked(events, 3, "")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3, 2}, pageIDs(p), "rank order is kept")
+
+	p, err = PaginateRanked(timedEvents(), 3, p.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, pageIDs(p))
+	assert.Empty(t, p.NextCursor)
+}
+
+func TestPaginate_InvalidCursor(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "eyJvIjotMX0"} {
+		_, err := PaginateByTime(timedEvents(), 2, cursor)
+		assert.ErrorIs(t, err, ErrValidation, cursor)
+		_, err = PaginateRanked(timedEvents(), 2, cursor)
+		assert.ErrorIs(t, err, ErrValidation, cursor)
+	}
+}
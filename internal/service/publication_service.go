@@ -0,0 +1,269 @@
+package service
+
+import (
+	"crypto/rand"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+)
+
+const (
+	// publicAgendaDays is how many days ahead the agenda page shows.
+	publicAgendaDays = 90
+	// maxPublicAgendaEvents is how many events the agenda page shows at most.
+	maxPublicAgendaEvents = 500
+)
+
+// PublicationService manages publications, and provides the published events
+// of them with the hidden fields removed.
+type PublicationService struct {
+	repo   repository.PublicationRepository
+	events *EventService
+}
+
+func NewPublicationService(repo repository.PublicationRepository, events *EventService) *PublicationService {
+	return &PublicationService{repo: repo, events: events}
+}
+
+func (s *PublicationService) List() ([]model.Publication, error) {
+	pubs, err := s.repo.ListPublications()
+	if err != nil {
+		return nil, err
+	}
+	if pubs == nil {
+		pubs = []model.Publication{}
+	}
+	return pubs, nil
+}
+
+func (s *PublicationService) GetByID(id int64) (*model.Publication, error) {
+	pub, err := s.repo.GetPublicationByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if pub == nil {
+		return nil, ErrNotFound
+	}
+	return pub, nil
+}
+
+// Published returns the enabled publication with the given token.
+func (s *PublicationService) Published(token string) (*model.Publication, error) {
+	pub, err := s.repo.GetPublicationByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if pub == nil || !pub.Enabled {
+		return nil, ErrNotFound
+	}
+	return pub, nil
+}
+
+func (s *PublicationService) Create(req *api.CreatePublicationRequest) (*model.Publication, error) {
+	pub := &model.Publication{
+		Token:   rand.Text(),
+		Enabled: req.Enabled.Or(true),
+	}
+	var err error
+	if pub.Name, err = publicationName(req.Name); err != nil {
+		return nil, err
+	}
+	if pub.CalendarIDs, err = s.publicationCalendars(req.CalendarIds); err != nil {
+		return nil, err
+	}
+	if pub.HiddenFields, err = publicationFields(req.HiddenFields); err != nil {
+		return nil, err
+	}
+	if pub.TimeZone, err = publicationTimeZone(req.TimeZone.Or("UTC")); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreatePublication(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+func (s *PublicationService) Update(id int64, req *api.UpdatePublicationRequest) (*model.Publication, error) {
+	pub, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name.Set {
+		if pub.Name, err = publicationName(req.Name.Value); err != nil {
+			return nil, err
+		}
+	}
+	if req.CalendarIds != nil {
+		if pub.CalendarIDs, err = s.publicationCalendars(req.CalendarIds); err != nil {
+			return nil, err
+		}
+	}
+	if req.HiddenFields != nil {
+		if pub.HiddenFields, err = publicationFields(req.HiddenFields); err != nil {
+			return nil, err
+		}
+	}
+	if req.TimeZone.Set {
+		if pub.TimeZone, err = publicationTimeZone(req.TimeZone.Value); err != nil {
+			return nil, err
+		}
+	}
+	if req.Enabled.Set {
+		pub.Enabled = req.Enabled.Value
+	}
+	if req.RegenerateToken.Value {
+		pub.Token = rand.Text()
+	}
+	if err := s.repo.UpdatePublication(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+func (s *PublicationService) Delete(id int64) error {
+	pub, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeletePublication(pub.ID)
+}
+
+// Agenda returns the published events of the next publicAgendaDays days,
+// starting at the beginning of the day of now in the time zone of the
+// publication, and whether there were more than could be shown.
+func (s *PublicationService) Agenda(pub *model.Publication, now time.Time) ([]model.Event, bool, error) {
+	loc := PublicationLocation(pub)
+	y, m, d := now.In(loc).Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, publicAgendaDays)
+	events, err := s.events.List(from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), pub.CalendarIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := len(events) > maxPublicAgendaEvents
+	if truncated {
+		events = events[:maxPublicAgendaEvents]
+	}
+	for i := range events {
+		publishEvent(pub, &events[i])
+	}
+	return events, truncated, nil
+}
+
+// ICSETag returns the entity tag of the feed of a publication in the given
+// format, which changes with the events and with the publication itself.
+func (s *PublicationService) ICSETag(format ical.Format, pub *model.Publication) (string, error) {
+	seq, err := s.events.repo.LatestChange()
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s %q %v %q", format, pub.Name, pub.CalendarIDs, pub.HiddenFields)
+	return fmt.Sprintf(`W/"%d-%x"`, seq, h.Sum64()), nil
+}
+
+// WriteICS streams the published events of a publication to w, and returns
+// how many there were.
+func (s *PublicationService) WriteICS(w io.Writer, format ical.Format, pub *model.Publication) (int, error) {
+	enc := ical.NewFormatEncoder(w, format)
+	enc.Name = pub.Name
+	n := 0
+	err := s.events.repo.EachEvent(pub.CalendarIDs, func(e *model.Event) error {
+		n++
+		publishEvent(pub, e)
+		return enc.Encode(e)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, enc.Close()
+}
+
+// PublicationLocation returns the time zone of a publication.
+func PublicationLocation(pub *model.Publication) *time.Location {
+	loc, err := time.LoadLocation(pub.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// publishEvent removes what is not published from an event: the hidden
+// fields, the reminder and the calendar name.
+func publishEvent(pub *model.Publication, e *model.Event) {
+	for _, f := range pub.HiddenFields {
+		switch f {
+		case model.PublicationDescription:
+			e.Description = ""
+		case model.PublicationLocation:
+			e.Location = ""
+			e.Latitude, e.Longitude = nil, nil
+		case model.PublicationURL:
+			e.URL = ""
+		case model.PublicationCategories:
+			e.Categories = ""
+		}
+	}
+	e.ReminderMinutes = 0
+	e.CalendarName = ""
+}
+
+func publicationName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrValidation)
+	}
+	return name, nil
+}
+
+func (s *PublicationService) publicationCalendars(ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: at least one calendar is required", ErrValidation)
+	}
+	var result []int64
+	for _, id := range ids {
+		if slices.Contains(result, id) {
+			continue
+		}
+		cal, err := s.events.calRepo.GetCalendarByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if cal == nil {
+			return nil, fmt.Errorf("%w: unknown calendar %d", ErrValidation, id)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+func publicationFields(fields []api.PublicationField) ([]string, error) {
+	var result []string
+	for _, f := range fields {
+		if !slices.Contains(model.PublicationFields, string(f)) {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrValidation, f)
+		}
+		if !slices.Contains(result, string(f)) {
+			result = append(result, string(f))
+		}
+	}
+	return result, nil
+}
+
+func publicationTimeZone(name string) (string, error) {
+	if name == "" || name == "Local" {
+		return "", fmt.Errorf("%w: invalid time zone %q", ErrValidation, name)
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return "", fmt.Errorf("%w: invalid time zone %q", ErrValidation, name)
+	}
+	return name, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestPublicationService_Agenda(t *testing.T) {
+	var gotFrom, gotTo string
+	var gotIDs []int64
+	events := make([]model.Event, maxPublicAgendaEvents+1)
+	for i := range events {
+		events[i] = model.Event{
+			Title:           "On call",
+			Description:     "Call 555-1234",
+			Location:        "Home",
+			URL:             "https://example.com/oncall",
+			StartTime:       "2026-03-15T10:00:00Z",
+			EndTime:         "2026-03-15T11:00:00Z",
+			ReminderMinutes: 15,
+			CalendarName:    "Ops",
+		}
+	}
+	repo := &mockRepo{listFn: func(from, to string, calendarIDs []int64) ([]model.Event, error) {
+		gotFrom, gotTo, gotIDs = from, to, calendarIDs
+		return events, nil
+	}}
+	s := NewPublicationService(nil, NewEventService(repo, &mockCalRepo{}, nil, nil))
+	pub := &model.Publication{
+		CalendarIDs:  []int64{2},
+		HiddenFields: []string{model.PublicationDescription, model.PublicationLocation},
+		TimeZone:     "Europe/Stockholm",
+	}
+
+	agenda, truncated, err := s.Agenda(pub, time.Date(2026, 3, 14, 23, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-14T23:00:00Z", gotFrom, "from the start of the day in the time zone")
+	assert.Equal(t, "2026-06-12T22:00:00Z", gotTo)
+	assert.Equal(t, []int64{2}, gotIDs)
+	assert.True(t, truncated)
+	require.Len(t, agenda, maxPublicAgendaEvents)
+	assert.Equal(t, "On call", agenda[0].Title)
+	assert.Equal(t, "https://example.com/oncall", agenda[0].URL)
+	assert.Empty(t, agenda[0].Description)
+	assert.Empty(t, agenda[0].Location)
+	assert.Zero(t, agenda[0].ReminderMinutes, "reminders are never published")
+	assert.Empty(t, agenda[0].CalendarName)
+}
+
+func TestPublicationService_WriteICS(t *testing.T) {
+	repo := &mockRepo{listAllFn: func(calendarIDs []int64) ([]model.Event, error) {
+		return []model.Event{{Title: "Holiday", Categories: "secret", URL: "https://example.com", StartTime: "2026-03-15T00:00:00Z", EndTime: "2026-03-16T00:00:00Z", AllDay: true}}, nil
+	}}
+	s := NewPublicationService(nil, NewEventService(repo, &mockCalRepo{}, nil, nil))
+	pub := &model.Publication{Name: "Holidays", HiddenFields: []string{model.PublicationURL, model.PublicationCategories}}
+
+	var buf bytes.Buffer
+	n, err := s.WriteICS(&buf, ical.FormatICal, pub)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Contains(t, buf.String(), "X-WR-CALNAME:Holidays\r\n")
+	assert.Contains(t, buf.String(), "SUMMARY:Holiday\r\n")
+	assert.NotContains(t, buf.String(), "secret")
+	assert.NotContains(t, buf.String(), "URL:")
+}
+
+func TestPublicationService_ICSETag(t *testing.T) {
+	repo := &mockRepo{latestChangeFn: func() (int64, error) { return 7, nil }}
+	s := NewPublicationService(nil, NewEventService(repo, &mockCalRepo{}, nil, nil))
+	pub := &model.Publication{Name: "Holidays", CalendarIDs: []int64{2}}
+
+	etag, err := s.ICSETag(ical.FormatICal, pub)
+	require.NoError(t, err)
+	same, err := s.ICSETag(ical.FormatICal, &model.Publication{Name: "Holidays", CalendarIDs: []int64{2}})
+	require.NoError(t, err)
+	assert.Equal(t, etag, same)
+
+	jcal, err := s.ICSETag(ical.FormatJCal, pub)
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, jcal, "each format has a tag of its own")
+	pub.HiddenFields = []string{model.PublicationLocation}
+	hidden, err := s.ICSETag(ical.FormatICal, pub)
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, hidden)
+}
+
+func TestPublicationTimeZone(t *testing.T) {
+	for _, tz := range []string{"", "Local", "Mars/Olympus"} {
+		_, err := publicationTimeZone(tz)
+		assert.ErrorIs(t, err, ErrValidation, tz)
+	}
+	tz, err := publicationTimeZone("America/New_York")
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", tz)
+}
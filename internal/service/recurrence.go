@@ -106,20 +106,23 @@ func nthWeekdayOfMonth(year int, month time.Month, wd time.Weekday, n int) (time
 	return t, true
 }
 
+// expandRecurring returns the instances of a recurring event that overlap
+// the window from-to.
 func expandRecurring(event model.Event, from, to time.Time) []model.Event {
 	if event.RecurrenceFreq == "" {
 		return nil
 	}
+	return expandStarts(event, recurrenceStarts(event, to), from, to)
+}
 
+// recurrenceStarts returns the start times generated by the recurrence rule
+// of event, in the order they are generated, up to the first one at or after
+// to. EXDATE and RDATE are not taken into account.
+func recurrenceStarts(event model.Event, to time.Time) []time.Time {
 	startTime, err := time.Parse(time.RFC3339, event.StartTime)
 	if err != nil {
 		return nil
 	}
-	endTime, err := time.Parse(time.RFC3339, event.EndTime)
-	if err != nil {
-		return nil
-	}
-	duration := endTime.Sub(startTime)
 
 	var untilTime time.Time
 	if event.RecurrenceUntil != "" {
@@ -137,6 +140,33 @@ func expandRecurring(event model.Event, from, to time.Time) []model.Event {
 	byMonthDay := parseIntList(event.RecurrenceByMonthDay)
 	byMonth := parseIntList(event.RecurrenceByMonth)
 
+	if len(byDay) > 0 || len(byMonthDay) > 0 || len(byMonth) > 0 {
+		return expandWithByParams(startTime, event.RecurrenceFreq, interval, byDay, byMonthDay, byMonth, untilTime, to, event.RecurrenceCount)
+	}
+	return expandSimple(startTime, event.RecurrenceFreq, interval, untilTime, to, event.RecurrenceCount)
+}
+
+// expandStarts builds the instances of a recurring event from the start
+// times generated by its rule, leaving out EXDATE and adding RDATE instances,
+// and returns those that overlap the window from-to.
+func expandStarts(event model.Event, candidates []time.Time, from, to time.Time) []model.Event {
+	startTime, err := time.Parse(time.RFC3339, event.StartTime)
+	if err != nil {
+		return nil
+	}
+	endTime, err := time.Parse(time.RFC3339, event.EndTime)
+	if err != nil {
+		return nil
+	}
+	duration := endTime.Sub(startTime)
+
+	var untilTime time.Time
+	if event.RecurrenceUntil != "" {
+		if t, err := time.Parse(time.RFC3339, event.RecurrenceUntil); err == nil {
+			untilTime = t
+		}
+	}
+
 	// Parse EXDATE set for filtering
 	exdateSet := make(map[string]bool)
 	if event.ExDates != "" {
@@ -148,34 +178,27 @@ func expandRecurring(event model.Event, from, to time.Time) []model.Event {
 		}
 	}
 
-	// Generate candidate start times
-	var candidates []time.Time
-	hasByParams := len(byDay) > 0 || len(byMonthDay) > 0 || len(byMonth) > 0
-
-	if hasByParams {
-		candidates = expandWithByParams(startTime, event.RecurrenceFreq, interval, byDay, byMonthDay, byMonth, untilTime, to, event.RecurrenceCount)
-	} else {
-		candidates = expandSimple(startTime, event.RecurrenceFreq, interval, untilTime, to, event.RecurrenceCount)
-	}
-
 	// Build instances from candidates, filtering by EXDATE and query window
 	var instances []model.Event
 	for i, instStart := range candidates {
 		instEnd := instStart.Add(duration)
 
-		// Filter by EXDATE
-		if exdateSet[instStart.Format(time.RFC3339)] {
+		// Include it if overlaps the query window
+		if !instEnd.After(from) || !instStart.Before(to) {
 			continue
 		}
 
-		// Include it if overlaps the query window
-		if instEnd.After(from) && instStart.Before(to) {
-			inst := event
-			inst.StartTime = instStart.Format(time.RFC3339)
-			inst.EndTime = instEnd.Format(time.RFC3339)
-			inst.RecurrenceIndex = i
-			instances = append(instances, inst)
+		// Filter by EXDATE
+		start := instStart.Format(time.RFC3339)
+		if exdateSet[start] {
+			continue
 		}
+
+		inst := event
+		inst.StartTime = start
+		inst.EndTime = instEnd.Format(time.RFC3339)
+		inst.RecurrenceIndex = i
+		instances = append(instances, inst)
 	}
 
 	// Add RDATE instances
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+const (
+	// occurrenceHorizon is how far beyond the requested window the start
+	// times of a recurrence rule are generated, so that navigating to the
+	// following months needs no new expansion.
+	occurrenceHorizon = 366 * 24 * time.Hour
+
+	// maxCachedRules bounds the number of recurrence rules in the cache.
+	maxCachedRules = 10000
+)
+
+// recurrenceRule is everything the start times of a recurring event depend on.
+// Changing any of it, or the start time, makes a new rule; EXDATE and RDATE
+// are applied after the cache, so excluding an instance still hits it.
+type recurrenceRule struct {
+	start      string
+	freq       string
+	interval   int
+	count      int
+	until      string
+	byDay      string
+	byMonthDay string
+	byMonth    string
+}
+
+func ruleOf(event *model.Event) recurrenceRule {
+	return recurrenceRule{
+		start:      event.StartTime,
+		freq:       event.RecurrenceFreq,
+		interval:   event.RecurrenceInterval,
+		count:      event.RecurrenceCount,
+		until:      event.RecurrenceUntil,
+		byDay:      event.RecurrenceByDay,
+		byMonthDay: event.RecurrenceByMonthDay,
+		byMonth:    event.RecurrenceByMonth,
+	}
+}
+
+// occurrences are the start times generated by a rule up to the first one at
+// or after horizon.
+type occurrences struct {
+	horizon time.Time
+	starts  []time.Time
+}
+
+// occurrenceCache keeps the start times generated by recurrence rules, so that
+// listing events does not expand every recurring event from its first
+// occurrence on each request. Since it is keyed by the rule itself, updating a
+// recurring event never finds stale start times. A nil cache expands every
+// time.
+type occurrenceCache struct {
+	mu    sync.Mutex
+	rules map[recurrenceRule]occurrences
+}
+
+func newOccurrenceCache() *occurrenceCache {
+	return &occurrenceCache{rules: make(map[recurrenceRule]occurrences)}
+}
+
+// expand returns the instances of a recurring event that overlap the window
+// from-to, like expandRecurring.
+func (c *occurrenceCache) expand(event model.Event, from, to time.Time) []model.Event {
+	if event.RecurrenceFreq == "" {
+		return nil
+	}
+	if c == nil {
+		return expandRecurring(event, from, to)
+	}
+	return expandStarts(event, c.starts(&event, to), from, to)
+}
+
+// starts returns the same start times as recurrenceStarts(event, to). The
+// returned slice must not be modified.
+func (c *occurrenceCache) starts(event *model.Event, to time.Time) []time.Time {
+	rule := ruleOf(event)
+	c.mu.Lock()
+	o, ok := c.rules[rule]
+	c.mu.Unlock()
+	if !ok || o.horizon.Before(to) {
+		horizon := to.Add(occurrenceHorizon)
+		o = occurrences{horizon: horizon, starts: recurrenceStarts(*event, horizon)}
+		c.mu.Lock()
+		if len(c.rules) >= maxCachedRules {
+			// Evict an arbitrary rule; the ones still in use come back on
+			// the next request.
+			for r := range c.rules {
+				delete(c.rules, r)
+				break
+			}
+		}
+		c.rules[rule] = o
+		c.mu.Unlock()
+	}
+
+	// The rule generates start times in the same order whatever the window,
+	// and stops at the first one at or after the end of it.
+	for i, start := range o.starts {
+		if start.Compare(to) >= 0 {
+			return o.starts[:i]
+		}
+	}
+	return o.starts
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestOccurrenceCache_SameAsExpansion(t *testing.T) {
+	events := []model.Event{
+		makeEvent("DAILY", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z"),
+		makeEvent("DAILY", "2025-01-01T10:00:00Z", "2025-01-01T11:00:00Z", func(e *model.Event) {
+			e.RecurrenceInterval = 3
+			e.ExDates = "2026-03-03T10:00:00Z"
+		}),
+		makeEvent("WEEKLY", "2024-06-03T09:00:00Z", "2024-06-03T09:30:00Z", func(e *model.Event) {
+			e.RecurrenceByDay = "MO,WE,FR"
+		}),
+		makeEvent("MONTHLY", "2020-01-31T12:00:00Z", "2020-01-31T13:00:00Z", func(e *model.Event) {
+			e.RecurrenceByMonthDay = "-1"
+		}),
+		makeEvent("MONTHLY", "2025-01-14T18:00:00Z", "2025-01-14T20:00:00Z", func(e *model.Event) {
+			e.RecurrenceByDay = "2TU"
+			e.RecurrenceCount = 20
+		}),
+		makeEvent("YEARLY", "2000-05-17T00:00:00Z", "2000-05-18T00:00:00Z", func(e *model.Event) {
+			e.RDates = "2026-11-17T00:00:00Z"
+		}),
+		makeEvent("WEEKLY", "2025-09-01T08:00:00Z", "2025-09-01T09:00:00Z", func(e *model.Event) {
+			e.RecurrenceUntil = "2026-04-15T00:00:00Z"
+		}),
+	}
+
+	c := newOccurrenceCache()
+	// Navigate month by month, back and forth, and beyond the horizon.
+	months := []string{"2026-03", "2026-04", "2026-02", "2026-05", "2028-01", "2026-03"}
+	for _, m := range months {
+		from := parseTime(m + "-01T00:00:00Z")
+		to := from.AddDate(0, 1, 0)
+		for i, e := range events {
+			assert.Equal(t, expandRecurring(e, from, to), c.expand(e, from, to), "event %d in %s", i, m)
+		}
+	}
+	assert.Len(t, c.rules, len(events))
+}
+
+func TestOccurrenceCache_RuleChange(t *testing.T) {
+	c := newOccurrenceCache()
+	e := makeEvent("DAILY", "2026-03-01T10:00:00Z", "2026-03-01T11:00:00Z")
+	from := parseTime("2026-03-01T00:00:00Z")
+	to := parseTime("2026-03-08T00:00:00Z")
+	require.Len(t, c.expand(e, from, to), 7)
+
+	// An updated rule is a different cache entry.
+	e.RecurrenceInterval = 2
+	assert.Len(t, c.expand(e, from, to), 4)
+
+	// Excluding an instance does not change the rule.
+	e.ExDates = "2026-03-03T10:00:00Z"
+	assert.Len(t, c.expand(e, from, to), 3)
+	assert.Len(t, c.rules, 2)
+}
+
+func TestOccurrenceCache_Eviction(t *testing.T) {
+	c := newOccurrenceCache()
+	from := parseTime("2026-03-01T00:00:00Z")
+	to := parseTime("2026-04-01T00:00:00Z")
+	start := parseTime("2026-01-01T00:00:00Z")
+	for i := 0; i < maxCachedRules+10; i++ {
+		s := start.Add(time.Duration(i) * time.Minute)
+		c.expand(makeEvent("WEEKLY", s.Format(time.RFC3339), s.Add(time.Hour).Format(time.RFC3339)), from, to)
+	}
+	assert.Len(t, c.rules, maxCachedRules)
+}
+
+// longRunningSeries returns n recurring events that started years before
+// 2026, as in a calendar that has been in use for a long time.
+func longRunningSeries(n int) []model.Event {
+	events := make([]model.Event, n)
+	start := parseTime("2023-06-01T08:00:00Z")
+	for i := range events {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		events[i] = model.Event{
+			ID:             int64(i + 1),
+			Title:          fmt.Sprintf("Series %d", i),
+			StartTime:      s.Format(time.RFC3339),
+			EndTime:        s.Add(30 * time.Minute).Format(time.RFC3339),
+			RecurrenceFreq: "DAILY",
+		}
+		switch i % 3 {
+		case 1:
+			events[i].RecurrenceFreq = "WEEKLY"
+			events[i].RecurrenceByDay = "MO,TU,WE,TH,FR"
+		case 2:
+			events[i].RecurrenceFreq = "MONTHLY"
+			events[i].RecurrenceByDay = "1MO,3MO"
+		}
+	}
+	return events
+}
+
+// BenchmarkList lists the events of a month, with 200 recurring events that
+// started years earlier, moving on one month each time.
+func BenchmarkList(b *testing.B) {
+	series := longRunningSeries(200)
+	repo := &mockRepo{
+		listRecurringFn: func(to string, calendarIDs []int64) ([]model.Event, error) {
+			return series, nil
+		},
+	}
+	for _, bc := range []struct {
+		name  string
+		cache *occurrenceCache
+	}{
+		{"expand", nil},
+		{"cached", newOccurrenceCache()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+			svc.occurrences = bc.cache
+			month := parseTime("2026-01-01T00:00:00Z")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				from := month.AddDate(0, i%12, 0)
+				to := from.AddDate(0, 1, 0)
+				if _, err := svc.List(from.Format(time.RFC3339), to.Format(time.RFC3339), nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkExpandRecurring expands a daily series that started three years
+// before the month shown.
+func BenchmarkExpandRecurring(b *testing.B) {
+	e := makeEvent("DAILY", "2023-01-01T10:00:00Z", "2023-01-01T11:00:00Z")
+	from := parseTime("2026-03-01T00:00:00Z")
+	to := parseTime("2026-04-01T00:00:00Z")
+	b.Run("expand", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			expandRecurring(e, from, to)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := newOccurrenceCache()
+		for i := 0; i < b.N; i++ {
+			c.expand(e, from, to)
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+	"github.com/mikaelstaldal/mycal/internal/sanitize"
+)
+
+const maxSearchTerms = 20
+
+// searchFields maps the field prefixes of the query language to search fields.
+var searchFields = map[string]string{
+	"title":       model.SearchFieldTitle,
+	"description": model.SearchFieldDescription,
+	"desc":        model.SearchFieldDescription,
+	"location":    model.SearchFieldLocation,
+	"loc":         model.SearchFieldLocation,
+	"category":    model.SearchFieldCategories,
+	"categories":  model.SearchFieldCategories,
+}
+
+// searchToken is a lexical element of a search query.
+type searchToken struct {
+	field  string // prefix before ':', lower case
+	text   string
+	quoted bool
+	prefix bool
+	negate bool
+}
+
+// ParseSearchQuery parses the search query language:
+//
+//	plan          events containing the word
+//	plan*         words starting with "plan"
+//	"exact words" the words next to each other, in order
+//	a OR b        either term
+//	-a, NOT a     events not containing the term
+//	category:work, location:"main office", title:..., description:...
+//	              the term in that field only
+//	after:2026-01-01, before:2026-02-01
+//	              events starting on or after / before the date (or RFC 3339 time)
+//
+// Terms are combined with AND. A field prefix that is not recognized is
+// searched for as part of the text.
+func ParseSearchQuery(input string) (model.SearchQuery, error) {
+	var q model.SearchQuery
+	tokens := tokenizeSearchQuery(input)
+	if len(tokens) > maxSearchTerms {
+		return q, fmt.Errorf("%w: search query has more than %d terms", ErrValidation, maxSearchTerms)
+	}
+
+	or := false
+	for _, tok := range tokens {
+		if !tok.quoted && tok.field == "" && !tok.negate {
+			switch tok.text {
+			case "OR":
+				or = len(q.Clauses) > 0
+				continue
+			case "AND", "NOT":
+				// A trailing NOT has nothing to negate.
+				continue
+			}
+		}
+
+		switch tok.field {
+		case "after", "before":
+			t, err := parseSearchDate(tok.text)
+			if err != nil {
+				return q, fmt.Errorf("%w: %s: %s", ErrValidation, tok.field, err.Error())
+			}
+			if tok.field == "after" {
+				q.After = t
+			} else {
+				q.Before = t
+			}
+			or = false
+			continue
+		}
+
+		term := model.SearchTerm{Field: searchFields[tok.field], Text: tok.text, Prefix: tok.prefix}
+		if term.Field == "" && tok.field != "" {
+			term.Text = tok.field + ":" + tok.text
+		}
+		if strings.TrimFunc(term.Text, isSearchSeparator) == "" {
+			continue
+		}
+
+		if tok.negate {
+			q.Exclude = append(q.Exclude, term)
+			or = false
+			continue
+		}
+		if or {
+			last := len(q.Clauses) - 1
+			q.Clauses[last] = append(q.Clauses[last], term)
+		} else {
+			q.Clauses = append(q.Clauses, model.SearchClause{term})
+		}
+		or = false
+	}
+
+	if q.IsEmpty() && (len(q.Exclude) > 0 || q.After != "" || q.Before != "") {
+		return q, fmt.Errorf("%w: search query needs at least one term to search for", ErrValidation)
+	}
+	return q, nil
+}
+
+// tokenizeSearchQuery splits a query into terms at whitespace outside quotes.
+// An unterminated quote extends to the end of the query.
+func tokenizeSearchQuery(input string) []searchToken {
+	var tokens []searchToken
+	s := input
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return tokens
+		}
+
+		var tok searchToken
+		if s[0] == '-' && len(s) > 1 && !unicode.IsSpace(rune(s[1])) {
+			tok.negate = true
+			s = s[1:]
+		}
+		if i := strings.IndexByte(s, ':'); i > 0 && isFieldName(s[:i]) {
+			tok.field = strings.ToLower(s[:i])
+			s = s[i+1:]
+		}
+
+		if strings.HasPrefix(s, `"`) {
+			tok.quoted = true
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				tok.text, s = s[1:], ""
+			} else {
+				tok.text, s = s[1:end+1], s[end+2:]
+			}
+			if strings.HasPrefix(s, "*") {
+				tok.prefix = true
+				s = s[1:]
+			}
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			tok.text, s = s[:end], s[end:]
+			if len(tok.text) > 1 && strings.HasSuffix(tok.text, "*") {
+				tok.prefix = true
+				tok.text = strings.TrimRight(tok.text, "*")
+			}
+		}
+
+		// "NOT term" negates the term that follows.
+		if n := len(tokens); n > 0 && !tok.negate {
+			prev := tokens[n-1]
+			if prev.text == "NOT" && !prev.quoted && prev.field == "" && !prev.negate {
+				tokens = tokens[:n-1]
+				tok.negate = true
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+func isFieldName(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSearchSeparator reports whether r is ignored by the full-text tokenizer.
+func isSearchSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// parseSearchDate accepts a date (midnight UTC) or an RFC 3339 time.
+func parseSearchDate(s string) (string, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("invalid date %q, use YYYY-MM-DD", s)
+}
+
+// highlightSnippet turns a search snippet into HTML: the text is stripped of
+// markup and escaped, and the matches are wrapped in <mark>.
+func highlightSnippet(snippet string) string {
+	text := html.UnescapeString(sanitize.StripTags(snippet))
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, repository.SnippetMatchStart, "<mark>")
+	return strings.ReplaceAll(text, repository.SnippetMatchEnd, "</mark>")
+}
+
+// searchNextOccurrenceHorizon is how far ahead the next occurrence of a
+// matched series is looked for.
+const searchNextOccurrenceHorizon = 5 * 365 * 24 * time.Hour
+
+// searchWindow is the time range of a search. Events must overlap [from, to)
+// and start within [after, before). Zero times are unbounded.
+type searchWindow struct {
+	from, to, after, before time.Time
+}
+
+func newSearchWindow(q model.SearchQuery, from, to string) searchWindow {
+	var w searchWindow
+	w.from, _ = time.Parse(time.RFC3339, from)
+	w.to, _ = time.Parse(time.RFC3339, to)
+	w.after, _ = time.Parse(time.RFC3339, q.After)
+	w.before, _ = time.Parse(time.RFC3339, q.Before)
+	return w
+}
+
+// start is the earliest time an event in the window can end at or after.
+func (w searchWindow) start() time.Time {
+	if w.after.After(w.from) {
+		return w.after
+	}
+	return w.from
+}
+
+// end is the time events in the window start before, zero if unbounded.
+func (w searchWindow) end() time.Time {
+	if w.to.IsZero() || (!w.before.IsZero() && w.before.Before(w.to)) {
+		return w.before
+	}
+	return w.to
+}
+
+func (w searchWindow) contains(e model.Event) bool {
+	start, err := time.Parse(time.RFC3339, e.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(time.RFC3339, e.EndTime)
+	if err != nil {
+		return false
+	}
+	return (w.from.IsZero() || end.After(w.from)) &&
+		(w.to.IsZero() || start.Before(w.to)) &&
+		(w.after.IsZero() || !start.Before(w.after)) &&
+		(w.before.IsZero() || start.Before(w.before))
+}
+
+// expandSearchResults turns the rows matched by a search into the events to
+// show, keeping the order of the rows.
+//
+// A matched recurring series is replaced by its instances within the window,
+// with overrides applied. An override that does not match the query itself
+// hides its instance. With nextOccurrence, or when the window has a start but
+// no end, a series is instead represented by its next instance starting at or
+// after the start of the window (or now). When the window is unbounded, series
+// and overrides are returned as stored. Other rows are within the window
+// already.
+func (s *EventService) expandSearchResults(rows []model.Event, q model.SearchQuery, from, to string, nextOccurrence bool) ([]model.Event, error) {
+	w := newSearchWindow(q, from, to)
+	matched := make(map[int64]*model.Event, len(rows))
+	var parentIDs []int64
+	for i := range rows {
+		matched[rows[i].ID] = &rows[i]
+		if rows[i].IsRecurring() {
+			parentIDs = append(parentIDs, rows[i].ID)
+		}
+	}
+
+	lo, hi := w.start(), w.end()
+	single := nextOccurrence || (hi.IsZero() && !lo.IsZero())
+	expand := len(parentIDs) > 0 && (single || !hi.IsZero())
+
+	var instances map[int64][]model.Event
+	if expand {
+		if single {
+			if lo.IsZero() {
+				lo = time.Now().UTC()
+			}
+			if horizon := lo.Add(searchNextOccurrenceHorizon); hi.IsZero() || horizon.Before(hi) {
+				hi = horizon
+			}
+		}
+		overrides, err := s.repo.ListOverrides(parentIDs, lo.Format(time.RFC3339), hi.Format(time.RFC3339))
+		if err != nil {
+			return nil, err
+		}
+		overridesByParent := make(map[int64][]model.Event)
+		for _, o := range overrides {
+			overridesByParent[*o.RecurrenceParentID] = append(overridesByParent[*o.RecurrenceParentID], o)
+		}
+
+		instances = make(map[int64][]model.Event, len(parentIDs))
+		for _, id := range parentIDs {
+			expanded := s.occurrences.expand(*matched[id], lo, hi)
+			if len(overridesByParent[id]) > 0 {
+				expanded = applyOverrides(expanded, overridesByParent[id], lo, hi)
+			}
+			var kept []model.Event
+			for _, inst := range expanded {
+				if inst.RecurrenceParentID != nil {
+					// The matched row carries the snippet.
+					m, ok := matched[inst.ID]
+					if !ok {
+						continue
+					}
+					inst = *m
+				}
+				if w.contains(inst) {
+					kept = append(kept, inst)
+				}
+			}
+			kept = mergeEvents(kept, nil)
+			if single && len(kept) > 1 {
+				kept = kept[:1]
+			}
+			instances[id] = kept
+		}
+	}
+
+	events := []model.Event{}
+	for _, e := range rows {
+		switch {
+		case e.IsRecurring() && expand:
+			events = append(events, instances[e.ID]...)
+		case e.RecurrenceParentID != nil && hasInstances(instances, *e.RecurrenceParentID):
+			// Part of the instances of its series.
+		default:
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func hasInstances(instances map[int64][]model.Event, parentID int64) bool {
+	_, ok := instances[parentID]
+	return ok
+}
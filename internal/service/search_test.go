@@ -0,0 +1,135 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	term := func(text string) model.SearchTerm { return model.SearchTerm{Text: text} }
+	tests := []struct {
+		name  string
+		input string
+		want  model.SearchQuery
+	}{
+		{"words", "team  lunch", model.SearchQuery{Clauses: []model.SearchClause{{term("team")}, {term("lunch")}}}},
+		{"phrase and prefix", `"exact phrase" plan*`, model.SearchQuery{Clauses: []model.SearchClause{
+			{term("exact phrase")},
+			{{Text: "plan", Prefix: true}},
+		}}},
+		{"fields", `category:work location:"main office" Title:sync`, model.SearchQuery{Clauses: []model.SearchClause{
+			{{Field: model.SearchFieldCategories, Text: "work"}},
+			{{Field: model.SearchFieldLocation, Text: "main office"}},
+			{{Field: model.SearchFieldTitle, Text: "sync"}},
+		}}},
+		{"unknown field is text", "http://example.com", model.SearchQuery{Clauses: []model.SearchClause{{term("http://example.com")}}}},
+		{"or", "a OR b OR c d", model.SearchQuery{Clauses: []model.SearchClause{{term("a"), term("b"), term("c")}, {term("d")}}}},
+		{"dangling operators", "OR a AND NOT", model.SearchQuery{Clauses: []model.SearchClause{{term("a")}}}},
+		{"exclude", "a -b NOT c", model.SearchQuery{Clauses: []model.SearchClause{{term("a")}}, Exclude: []model.SearchTerm{term("b"), term("c")}}},
+		{"dates", "a after:2026-01-01 before:2026-02-01T12:00:00+01:00", model.SearchQuery{
+			Clauses: []model.SearchClause{{term("a")}},
+			After:   "2026-01-01T00:00:00Z",
+			Before:  "2026-02-01T11:00:00Z",
+		}},
+		{"unterminated quote", `"half open`, model.SearchQuery{Clauses: []model.SearchClause{{term("half open")}}}},
+		{"punctuation only", `- * ""`, model.SearchQuery{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSearchQuery_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"a after:yesterday",
+		"-only -excluded",
+		"after:2026-01-01",
+		"a b c d e f g h i j k l m n o p q r s t u",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseSearchQuery(input)
+			assert.ErrorIs(t, err, ErrValidation)
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	assert.Equal(t, "Plan the <mark>budget</mark> &amp; costs",
+		highlightSnippet("<p>Plan the \x02budget\x03 &amp; costs</p>"))
+	assert.Equal(t, "&lt;script&gt; <mark>x</mark>",
+		highlightSnippet("&lt;script&gt; \x02x\x03"))
+}
+
+func TestSearch_ExpandsRecurring(t *testing.T) {
+	parentID := int64(1)
+	parent := model.Event{ID: parentID, Title: "Standup", StartTime: "2026-03-02T09:00:00Z", EndTime: "2026-03-02T09:15:00Z",
+		RecurrenceFreq: "WEEKLY", Snippet: "\x02Standup\x03"}
+	moved := model.Event{ID: 2, Title: "Standup moved", StartTime: "2026-03-09T10:00:00Z", EndTime: "2026-03-09T10:15:00Z",
+		RecurrenceParentID: &parentID, RecurrenceOriginalStart: "2026-03-09T09:00:00Z", Snippet: "\x02Standup\x03 moved"}
+	retitled := model.Event{ID: 3, Title: "Retro", StartTime: "2026-03-16T09:00:00Z", EndTime: "2026-03-16T09:15:00Z",
+		RecurrenceParentID: &parentID, RecurrenceOriginalStart: "2026-03-16T09:00:00Z"}
+	otherParentID := int64(99)
+	orphan := model.Event{ID: 4, Title: "Standup instead", StartTime: "2026-03-20T09:00:00Z", EndTime: "2026-03-20T09:15:00Z",
+		RecurrenceParentID: &otherParentID, RecurrenceOriginalStart: "2026-03-20T08:00:00Z"}
+	notes := model.Event{ID: 5, Title: "Standup notes", StartTime: "2026-03-04T12:00:00Z", EndTime: "2026-03-04T13:00:00Z"}
+
+	repo := &mockRepo{
+		searchFn: func(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error) {
+			// The retitled override no longer matches. Like the repository,
+			// only the rows of recurring series are left for the service to
+			// filter by time.
+			w := newSearchWindow(query, from, to)
+			var rows []model.Event
+			for _, e := range []model.Event{parent, moved, orphan, notes} {
+				if e.IsRecurring() || w.contains(e) {
+					rows = append(rows, e)
+				}
+			}
+			return rows, nil
+		},
+		listOverridesFn: func(parentIDs []int64, from, to string) ([]model.Event, error) {
+			assert.Equal(t, []int64{parentID}, parentIDs)
+			return []model.Event{moved, retitled}, nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+
+	starts := func(events []model.Event) []string {
+		var s []string
+		for _, e := range events {
+			s = append(s, e.StartTime)
+		}
+		return s
+	}
+
+	events, err := svc.Search("standup", "2026-03-01T00:00:00Z", "2026-04-01T00:00:00Z", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"2026-03-02T09:00:00Z", "2026-03-09T10:00:00Z", "2026-03-23T09:00:00Z", "2026-03-30T09:00:00Z",
+		"2026-03-20T09:00:00Z",
+		"2026-03-04T12:00:00Z",
+	}, starts(events), "instances in rank order of their series, the retitled one hidden")
+	assert.Equal(t, "<mark>Standup</mark>", events[0].Snippet)
+	assert.Equal(t, "Standup moved", events[1].Title)
+	assert.Equal(t, "<mark>Standup</mark> moved", events[1].Snippet)
+
+	events, err = svc.Search("standup", "2026-03-10T00:00:00Z", "2026-04-01T00:00:00Z", nil, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2026-03-23T09:00:00Z", "2026-03-20T09:00:00Z"}, starts(events), "the next occurrence of the series")
+
+	events, err = svc.Search("standup after:2026-03-05", "", "", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2026-03-09T10:00:00Z", "2026-03-20T09:00:00Z"}, starts(events), "next occurrence when the range has no end")
+
+	events, err = svc.Search("standup", "", "", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2026-03-02T09:00:00Z", "2026-03-09T10:00:00Z", "2026-03-20T09:00:00Z", "2026-03-04T12:00:00Z"}, starts(events), "rows as stored without a range")
+}
@@ -4,11 +4,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"maps"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/ical"
 	"github.com/mikaelstaldal/mycal/internal/model"
 	"github.com/mikaelstaldal/mycal/internal/repository"
 	"github.com/mikaelstaldal/mycal/internal/sanitize"
@@ -20,12 +24,23 @@ var (
 )
 
 type EventService struct {
-	repo    repository.EventRepository
-	calRepo repository.CalendarRepository
+	repo        repository.EventRepository
+	calRepo     repository.CalendarRepository
+	history     historyRecorder
+	actor       model.Actor
+	occurrences *occurrenceCache
 }
 
-func NewEventService(repo repository.EventRepository, calRepo repository.CalendarRepository) *EventService {
-	return &EventService{repo: repo, calRepo: calRepo}
+func NewEventService(repo repository.EventRepository, calRepo repository.CalendarRepository, histRepo repository.HistoryRepository, bus *EventBus) *EventService {
+	return &EventService{repo: repo, calRepo: calRepo, history: historyRecorder{repo: histRepo, bus: bus}, actor: model.Actor{Source: model.SourceAPI}, occurrences: newOccurrenceCache()}
+}
+
+// As returns a copy of the service that attributes the changes it makes to actor
+// in the event history.
+func (s *EventService) As(actor model.Actor) *EventService {
+	c := *s
+	c.actor = actor
+	return &c
 }
 
 func (s *EventService) ListAll(calendarIDs []int64) ([]model.Event, error) {
@@ -39,6 +54,21 @@ func (s *EventService) ListAll(calendarIDs []int64) ([]model.Event, error) {
 	return events, nil
 }
 
+// WriteICS streams the stored events as an iCalendar document in the given
+// format to w and returns the number of events written.
+func (s *EventService) WriteICS(w io.Writer, format ical.Format, calendarIDs []int64) (int, error) {
+	enc := ical.NewFormatEncoder(w, format)
+	n := 0
+	err := s.repo.EachEvent(calendarIDs, func(e *model.Event) error {
+		n++
+		return enc.Encode(e)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, enc.Close()
+}
+
 func (s *EventService) List(from, to string, calendarIDs []int64) ([]model.Event, error) {
 	events, err := s.repo.List(from, to, calendarIDs)
 	if err != nil {
@@ -59,7 +89,7 @@ func (s *EventService) List(from, to string, calendarIDs []int64) ([]model.Event
 
 	var expanded []model.Event
 	for _, re := range recurring {
-		expanded = append(expanded, expandRecurring(re, fromTime, toTime)...)
+		expanded = append(expanded, s.occurrences.expand(re, fromTime, toTime)...)
 	}
 
 	// Fetch overrides for recurring parents and apply them
@@ -132,13 +162,24 @@ func applyOverrides(expanded []model.Event, overrides []model.Event, from, to ti
 	return result
 }
 
-func (s *EventService) Search(query, from, to string, calendarIDs []int64) ([]model.Event, error) {
-	events, err := s.repo.Search(query, from, to, calendarIDs)
+// Search returns the events matching a query in the language of
+// ParseSearchQuery, best match first, each with a highlighted snippet.
+// Matched recurring series are expanded as described at expandSearchResults.
+func (s *EventService) Search(query, from, to string, calendarIDs []int64, nextOccurrence bool) ([]model.Event, error) {
+	q, err := ParseSearchQuery(query)
 	if err != nil {
 		return nil, err
 	}
-	if events == nil {
-		events = []model.Event{}
+	rows, err := s.repo.Search(q, from, to, calendarIDs)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.expandSearchResults(rows, q, from, to, nextOccurrence)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		events[i].Snippet = highlightSnippet(events[i].Snippet)
 	}
 	return events, nil
 }
@@ -194,6 +235,25 @@ func (s *EventService) GetInstance(parentID int64, instanceStart string) (*model
 }
 
 func (s *EventService) Create(req *api.CreateEventRequest) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.create(req) })
+}
+
+func (s *EventService) create(req *api.CreateEventRequest) (*model.Event, error) {
+	e, err := s.newEvent(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(e); err != nil {
+		return nil, err
+	}
+	if err := s.history.record(s.actor, model.ActionCreate, e.ID, nil, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// newEvent validates req and returns the event to create from it.
+func (s *EventService) newEvent(req *api.CreateEventRequest) (*model.Event, error) {
 	startTime, endTime, err := ValidateCreateEventRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
@@ -217,7 +277,12 @@ func (s *EventService) Create(req *api.CreateEventRequest) (*model.Event, error)
 		Duration:             req.Duration.Or(""),
 		Categories:           sanitize.HTML(req.Categories.Or("")),
 		ReminderMinutes:      req.ReminderMinutes.Or(0),
+		Transparent:          req.Transparent.Or(false),
 		Location:             sanitize.HTML(req.Location.Or("")),
+		CalendarID:           req.CalendarID.Or(0),
+	}
+	if _, err := s.calendar(e.CalendarID); err != nil {
+		return nil, err
 	}
 	if req.URL.Set {
 		e.URL = req.URL.Value.String()
@@ -230,15 +295,16 @@ func (s *EventService) Create(req *api.CreateEventRequest) (*model.Event, error)
 		v := req.Longitude.Value
 		e.Longitude = &v
 	}
-	if err := s.repo.Create(e); err != nil {
-		return nil, err
-	}
 	return e, nil
 }
 
 const dateOnly = "2006-01-02"
 
 func (s *EventService) Update(id int64, req *api.UpdateEventRequest) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.update(id, req) })
+}
+
+func (s *EventService) update(id int64, req *api.UpdateEventRequest) (*model.Event, error) {
 	if err := ValidateUpdateEventRequest(req); err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 	}
@@ -249,6 +315,7 @@ func (s *EventService) Update(id int64, req *api.UpdateEventRequest) (*model.Eve
 	if existing == nil {
 		return nil, ErrNotFound
 	}
+	before := *existing
 
 	if req.Title.Set {
 		existing.Title = sanitize.HTML(req.Title.Value)
@@ -301,6 +368,9 @@ func (s *EventService) Update(id int64, req *api.UpdateEventRequest) (*model.Eve
 	if req.ReminderMinutes.Set {
 		existing.ReminderMinutes = req.ReminderMinutes.Value
 	}
+	if req.Transparent.Set {
+		existing.Transparent = req.Transparent.Value
+	}
 	if req.Location.Set {
 		existing.Location = sanitize.HTML(req.Location.Value)
 	}
@@ -312,6 +382,14 @@ func (s *EventService) Update(id int64, req *api.UpdateEventRequest) (*model.Eve
 		v := req.Longitude.Value
 		existing.Longitude = &v
 	}
+	if req.CalendarID.Set {
+		cal, err := s.calendar(req.CalendarID.Value)
+		if err != nil {
+			return nil, err
+		}
+		existing.CalendarID = req.CalendarID.Value
+		existing.CalendarName = cal.Name
+	}
 
 	// If Duration is set, recompute EndTime
 	if req.Duration.Set && req.Duration.Value != "" {
@@ -367,16 +445,28 @@ func (s *EventService) Update(id int64, req *api.UpdateEventRequest) (*model.Eve
 	if err := s.repo.Update(existing); err != nil {
 		return nil, err
 	}
+	if err := s.history.record(s.actor, model.ActionUpdate, existing.ID, &before, existing); err != nil {
+		return nil, err
+	}
 	return existing, nil
 }
 
 func (s *EventService) CreateOrUpdateOverride(parentID int64, instanceStart string, req *api.UpdateEventRequest) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) {
+		return tx.createOrUpdateOverride(parentID, instanceStart, req)
+	})
+}
+
+func (s *EventService) createOrUpdateOverride(parentID int64, instanceStart string, req *api.UpdateEventRequest) (*model.Event, error) {
 	if _, err := time.Parse(time.RFC3339, instanceStart); err != nil {
 		return nil, fmt.Errorf("%w: instance_start must be RFC 3339 format", ErrValidation)
 	}
 	if err := ValidateUpdateEventRequest(req); err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 	}
+	if req.CalendarID.Set {
+		return nil, fmt.Errorf("%w: a single instance cannot be moved to another calendar", ErrValidation)
+	}
 
 	parent, err := s.repo.GetByID(parentID)
 	if err != nil {
@@ -412,6 +502,7 @@ func (s *EventService) CreateOrUpdateOverride(parentID int64, instanceStart stri
 		Categories:              parent.Categories,
 		URL:                     parent.URL,
 		ReminderMinutes:         parent.ReminderMinutes,
+		Transparent:             parent.Transparent,
 		Location:                parent.Location,
 		Latitude:                parent.Latitude,
 		Longitude:               parent.Longitude,
@@ -473,6 +564,9 @@ func (s *EventService) CreateOrUpdateOverride(parentID int64, instanceStart stri
 	if req.ReminderMinutes.Set {
 		override.ReminderMinutes = req.ReminderMinutes.Value
 	}
+	if req.Transparent.Set {
+		override.Transparent = req.Transparent.Value
+	}
 	if req.Location.Set {
 		override.Location = sanitize.HTML(req.Location.Value)
 	}
@@ -488,6 +582,9 @@ func (s *EventService) CreateOrUpdateOverride(parentID int64, instanceStart stri
 	if err := s.repo.Create(override); err != nil {
 		return nil, err
 	}
+	if err := s.history.record(s.actor, model.ActionCreate, override.ID, nil, override); err != nil {
+		return nil, err
+	}
 	return override, nil
 }
 
@@ -561,6 +658,9 @@ func buildEventForImport(e model.Event) (*model.Event, error) {
 	if e.ReminderMinutes != 0 {
 		req.ReminderMinutes = api.NewOptInt(e.ReminderMinutes)
 	}
+	if e.Transparent {
+		req.Transparent = api.NewOptBool(true)
+	}
 	if e.Location != "" {
 		req.Location = api.NewOptString(e.Location)
 	}
@@ -595,6 +695,7 @@ func buildEventForImport(e model.Event) (*model.Event, error) {
 		Categories:           e.Categories,
 		URL:                  e.URL,
 		ReminderMinutes:      e.ReminderMinutes,
+		Transparent:          e.Transparent,
 		Location:             e.Location,
 		Latitude:             e.Latitude,
 		Longitude:            e.Longitude,
@@ -603,6 +704,10 @@ func buildEventForImport(e model.Event) (*model.Event, error) {
 }
 
 func (s *EventService) ImportSingle(events []model.Event, calendarName string) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.importSingle(events, calendarName) })
+}
+
+func (s *EventService) importSingle(events []model.Event, calendarName string) (*model.Event, error) {
 	if len(calendarName) > model.MaxCalendarNameLength {
 		return nil, fmt.Errorf("%w: calendar name must be at most %d characters", ErrValidation, model.MaxCalendarNameLength)
 	}
@@ -632,10 +737,47 @@ func (s *EventService) ImportSingle(events []model.Event, calendarName string) (
 	if err := s.repo.Create(ev); err != nil {
 		return nil, err
 	}
+	if err := s.history.record(s.actor, model.ActionCreate, ev.ID, nil, ev); err != nil {
+		return nil, err
+	}
 	return ev, nil
 }
 
 func (s *EventService) Import(events []model.Event, calendarName string) (int, error) {
+	src := eventSlice(events)
+	return s.ImportFrom(&src, calendarName, false)
+}
+
+// EventSource yields the events of an import in document order, and io.EOF
+// after the last one. *ical.Decoder is an EventSource.
+type EventSource interface {
+	Next() (model.Event, error)
+}
+
+// eventSlice is an EventSource of events in memory.
+type eventSlice []model.Event
+
+func (s *eventSlice) Next() (model.Event, error) {
+	if len(*s) == 0 {
+		return model.Event{}, io.EOF
+	}
+	e := (*s)[0]
+	*s = (*s)[1:]
+	return e, nil
+}
+
+// importBatchSize is the number of events imported in each transaction.
+const importBatchSize = 500
+
+// ImportFrom imports the events of src into the named calendar. They are read
+// and imported importBatchSize at a time, each batch in a transaction, so that
+// a large calendar is never held in memory. If atomic is set, everything is
+// imported in one transaction instead, and nothing is if src fails. Events
+// that cannot be imported are skipped, as are recurrence overrides without
+// their parent event in src, and those beyond the first maxImportOrphans read
+// before it. The number of events imported in committed batches is returned
+// also when src fails.
+func (s *EventService) ImportFrom(src EventSource, calendarName string, atomic bool) (int, error) {
 	if len(calendarName) > model.MaxCalendarNameLength {
 		return 0, fmt.Errorf("%w: calendar name must be at most %d characters", ErrValidation, model.MaxCalendarNameLength)
 	}
@@ -645,71 +787,189 @@ func (s *EventService) Import(events []model.Event, calendarName string) (int, e
 		return 0, err
 	}
 
-	imported := 0
+	imp := &eventImport{calendarID: calendarID, parentByUID: make(map[string]int64)}
+	if atomic {
+		if err := s.inTx(func(tx *EventService) error {
+			return imp.run(src, func(fn func(tx *EventService) error) error {
+				return fn(tx)
+			})
+		}); err != nil {
+			return 0, err
+		}
+		return imp.imported, nil
+	}
+	err = imp.run(src, func(fn func(tx *EventService) error) error {
+		return s.inTx(fn)
+	})
+	return imp.imported, err
+}
+
+// maxImportOrphans is the number of recurrence overrides read before their
+// parent event that an import keeps until the end of src. Any more are
+// dropped.
+const maxImportOrphans = importBatchSize
+
+// eventImport is the state of an import that lasts across batches.
+type eventImport struct {
+	calendarID  int64
+	parentByUID map[string]int64 // created parent IDs by their import UID
+	orphans     []model.Event    // overrides read before their parent
+	imported    int
+}
 
-	// Separate parents and overrides
-	var parents []model.Event
+// importedBatch is what a batch of an import has created, added to the
+// eventImport once the batch is committed.
+type importedBatch struct {
+	parentByUID map[string]int64
+	orphans     []model.Event
+	imported    int
+}
+
+// run reads src to the end, and calls commit to import each batch.
+func (imp *eventImport) run(src EventSource, commit func(fn func(tx *EventService) error) error) error {
+	batch := make([]model.Event, 0, importBatchSize)
+	for {
+		e, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, e)
+		if len(batch) < importBatchSize {
+			continue
+		}
+		if err := imp.commitBatch(commit, batch, nil); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	orphans := imp.orphans
+	imp.orphans = nil
+	if len(batch) == 0 && len(orphans) == 0 {
+		return nil
+	}
+	return imp.commitBatch(commit, batch, orphans)
+}
+
+// commitBatch imports a batch of events, and then the overrides read before
+// their parent, and counts them once commit succeeds.
+func (imp *eventImport) commitBatch(commit func(fn func(tx *EventService) error) error, events, orphans []model.Event) error {
+	var b importedBatch
+	err := commit(func(tx *EventService) error {
+		b = importedBatch{parentByUID: make(map[string]int64)}
+		if err := imp.store(tx, &b, events); err != nil {
+			return err
+		}
+		for _, e := range orphans {
+			if err := imp.createOverride(tx, &b, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	maps.Copy(imp.parentByUID, b.parentByUID)
+	imp.imported += b.imported
+	if n := len(imp.orphans) + len(b.orphans) - maxImportOrphans; n > 0 {
+		log.Printf("import: skipped %d recurrence overrides, more than %d read before their event", n, maxImportOrphans)
+		b.orphans = b.orphans[:len(b.orphans)-n]
+	}
+	imp.orphans = append(imp.orphans, b.orphans...)
+	return nil
+}
+
+// parentID returns the ID of the created parent event of an override.
+func (imp *eventImport) parentID(b *importedBatch, e model.Event) (int64, bool) {
+	if id, ok := b.parentByUID[e.ImportUID]; ok {
+		return id, true
+	}
+	id, ok := imp.parentByUID[e.ImportUID]
+	return id, ok
+}
+
+// store imports a batch of events, parents before overrides.
+func (imp *eventImport) store(tx *EventService, b *importedBatch, events []model.Event) error {
 	var overrides []model.Event
 	for _, e := range events {
 		if e.RecurrenceOriginalStart != "" {
 			overrides = append(overrides, e)
-		} else {
-			parents = append(parents, e)
+			continue
 		}
-	}
-
-	// Track created parent IDs by their import UID
-	parentByUID := make(map[string]int64)
-
-	for _, e := range parents {
 		ev, err := buildEventForImport(e)
 		if err != nil {
 			continue
 		}
-		ev.CalendarID = calendarID
-		if err := s.repo.Create(ev); err != nil {
+		ev.CalendarID = imp.calendarID
+		if err := tx.repo.Create(ev); err != nil {
+			log.Printf("import: skipped event %q: %v", e.Title, err)
 			continue
 		}
+		if err := tx.history.record(tx.actor, model.ActionCreate, ev.ID, nil, ev); err != nil {
+			return err
+		}
 		if e.ImportUID != "" {
-			parentByUID[e.ImportUID] = ev.ID
+			b.parentByUID[e.ImportUID] = ev.ID
 		}
-		imported++
+		b.imported++
 	}
-
-	// Import overrides matched by ImportUID
 	for _, e := range overrides {
-		parentID, ok := parentByUID[e.ImportUID]
-		if !ok {
+		if _, ok := imp.parentID(b, e); !ok {
+			b.orphans = append(b.orphans, e)
 			continue
 		}
-		ev := &model.Event{
-			Title:                   sanitize.HTML(e.Title),
-			Description:             sanitize.HTML(e.Description),
-			StartTime:               e.StartTime,
-			EndTime:                 e.EndTime,
-			AllDay:                  e.AllDay,
-			Color:                   e.Color,
-			Duration:                e.Duration,
-			Categories:              e.Categories,
-			URL:                     e.URL,
-			ReminderMinutes:         e.ReminderMinutes,
-			Location:                e.Location,
-			Latitude:                e.Latitude,
-			Longitude:               e.Longitude,
-			CalendarID:              calendarID,
-			RecurrenceParentID:      &parentID,
-			RecurrenceOriginalStart: e.RecurrenceOriginalStart,
-		}
-		if err := s.repo.Create(ev); err != nil {
-			continue
+		if err := imp.createOverride(tx, b, e); err != nil {
+			return err
 		}
-		imported++
 	}
+	return nil
+}
 
-	return imported, nil
+// createOverride imports a recurrence override matched to its parent by
+// ImportUID.
+func (imp *eventImport) createOverride(tx *EventService, b *importedBatch, e model.Event) error {
+	parentID, ok := imp.parentID(b, e)
+	if !ok {
+		return nil
+	}
+	ev := &model.Event{
+		Title:                   sanitize.HTML(e.Title),
+		Description:             sanitize.HTML(e.Description),
+		StartTime:               e.StartTime,
+		EndTime:                 e.EndTime,
+		AllDay:                  e.AllDay,
+		Color:                   e.Color,
+		Duration:                e.Duration,
+		Categories:              e.Categories,
+		URL:                     e.URL,
+		ReminderMinutes:         e.ReminderMinutes,
+		Transparent:             e.Transparent,
+		Location:                e.Location,
+		Latitude:                e.Latitude,
+		Longitude:               e.Longitude,
+		CalendarID:              imp.calendarID,
+		RecurrenceParentID:      &parentID,
+		RecurrenceOriginalStart: e.RecurrenceOriginalStart,
+	}
+	if err := tx.repo.Create(ev); err != nil {
+		log.Printf("import: skipped recurrence override of %q at %s: %v", e.ImportUID, e.RecurrenceOriginalStart, err)
+		return nil
+	}
+	if err := tx.history.record(tx.actor, model.ActionCreate, ev.ID, nil, ev); err != nil {
+		return err
+	}
+	b.imported++
+	return nil
 }
 
 func (s *EventService) AddExDate(id int64, instanceStart string) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.addExDate(id, instanceStart) })
+}
+
+func (s *EventService) addExDate(id int64, instanceStart string) (*model.Event, error) {
 	if _, err := time.Parse(time.RFC3339, instanceStart); err != nil {
 		return nil, fmt.Errorf("%w: instance_start must be RFC 3339 format", ErrValidation)
 	}
@@ -723,6 +983,7 @@ func (s *EventService) AddExDate(id int64, instanceStart string) (*model.Event,
 	if !existing.IsRecurring() {
 		return nil, fmt.Errorf("%w: event is not recurring", ErrValidation)
 	}
+	before := *existing
 
 	// Append to existing EXDATE list
 	if existing.ExDates == "" {
@@ -734,6 +995,9 @@ func (s *EventService) AddExDate(id int64, instanceStart string) (*model.Event,
 	if err := s.repo.Update(existing); err != nil {
 		return nil, err
 	}
+	if err := s.history.record(s.actor, model.ActionUpdate, existing.ID, &before, existing); err != nil {
+		return nil, err
+	}
 
 	// Also delete any override for this instance
 	override, err := s.repo.GetOverride(id, instanceStart)
@@ -741,13 +1005,21 @@ func (s *EventService) AddExDate(id int64, instanceStart string) (*model.Event,
 		return nil, err
 	}
 	if override != nil {
-		_ = s.repo.Delete(override.ID)
+		if err := s.repo.Delete(override.ID); err == nil {
+			if err := s.history.record(s.actor, model.ActionDelete, override.ID, override, nil); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return existing, nil
 }
 
 func (s *EventService) RemoveExDate(id int64, instanceStart string) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.removeExDate(id, instanceStart) })
+}
+
+func (s *EventService) removeExDate(id int64, instanceStart string) (*model.Event, error) {
 	existing, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -755,6 +1027,7 @@ func (s *EventService) RemoveExDate(id int64, instanceStart string) (*model.Even
 	if existing == nil {
 		return nil, ErrNotFound
 	}
+	before := *existing
 
 	// Remove the specified EXDATE
 	var remaining []string
@@ -769,9 +1042,28 @@ func (s *EventService) RemoveExDate(id int64, instanceStart string) (*model.Even
 	if err := s.repo.Update(existing); err != nil {
 		return nil, err
 	}
+	if err := s.history.record(s.actor, model.ActionUpdate, existing.ID, &before, existing); err != nil {
+		return nil, err
+	}
 	return existing, nil
 }
 
+// calendar returns the calendar with the given ID, or a validation error if
+// there is none. ID 0 is the default calendar.
+func (s *EventService) calendar(id int64) (*model.Calendar, error) {
+	if id == 0 {
+		return &model.Calendar{}, nil
+	}
+	cal, err := s.calRepo.GetCalendarByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if cal == nil {
+		return nil, fmt.Errorf("%w: calendar %d does not exist", ErrValidation, id)
+	}
+	return cal, nil
+}
+
 func (s *EventService) resolveCalendarName(name string) (int64, error) {
 	if name == "" {
 		return 0, nil
@@ -787,16 +1079,41 @@ func (s *EventService) resolveCalendarName(name string) (int64, error) {
 	if err := s.calRepo.CreateCalendar(newCal); err != nil {
 		return 0, err
 	}
+	s.history.publish(Change{Kind: KindCalendar, Action: model.ActionCreate, ID: newCal.ID})
 	return newCal.ID, nil
 }
 
 func (s *EventService) Delete(id int64) error {
-	// Also delete all overrides for this parent
-	_ = s.repo.DeleteByParentID(id)
+	return s.inTx(func(tx *EventService) error { return tx.delete(id) })
+}
+
+func (s *EventService) delete(id int64) error {
+	existing, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	// An override is excluded from its recurring event instead, since it
+	// cannot be restored from the trash on its own, and the instance would
+	// come back with the values of the recurring event.
+	if existing != nil && existing.RecurrenceParentID != nil {
+		parent, err := s.repo.GetByID(*existing.RecurrenceParentID)
+		if err != nil {
+			return err
+		}
+		if parent != nil && parent.IsRecurring() {
+			_, err := s.addExDate(parent.ID, existing.RecurrenceOriginalStart)
+			return err
+		}
+	}
 
-	err := s.repo.Delete(id)
+	// Moves the overrides of a recurring event to the trash too
+	err = s.repo.Delete(id)
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrNotFound
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return s.history.record(s.actor, model.ActionDelete, id, existing, nil)
 }
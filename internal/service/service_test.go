@@ -12,6 +12,7 @@ import (
 
 	"github.com/mikaelstaldal/mycal/internal/api"
 	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
 )
 
 // mockRepo implements repository.EventRepository with configurable behavior per test.
@@ -19,15 +20,24 @@ type mockRepo struct {
 	listFn                  func(from, to string, calendarIDs []int64) ([]model.Event, error)
 	listAllFn               func(calendarIDs []int64) ([]model.Event, error)
 	listRecurringFn         func(to string, calendarIDs []int64) ([]model.Event, error)
-	searchFn                func(query, from, to string, calendarIDs []int64) ([]model.Event, error)
+	searchFn                func(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error)
 	getByIDFn               func(id int64) (*model.Event, error)
 	createFn                func(event *model.Event) error
 	updateFn                func(event *model.Event) error
 	deleteFn                func(id int64) error
 	listOverridesFn         func(parentIDs []int64, from, to string) ([]model.Event, error)
 	getOverrideFn           func(parentID int64, originalStart string) (*model.Event, error)
-	deleteByParentIDFn      func(parentID int64) error
+	listDeletedFn           func() ([]model.Event, error)
+	listDeletedBeforeFn     func(before string) ([]model.Event, error)
+	getDeletedFn            func(id int64) (*model.Event, error)
+	restoreFn               func(id int64) error
+	purgeFn                 func(id int64) error
+	purgeDeletedBeforeFn    func(before string) (int64, error)
 	filterExistingIcsUIDsFn func(uids []string) (map[string]bool, error)
+	getByIcsUIDFn           func(uid string) (*model.Event, error)
+	listChangesFn           func(since int64) ([]model.EventChange, int64, error)
+	latestChangeFn          func() (int64, error)
+	findEventsFn            func(filter model.EventFilter, limit, offset int) ([]model.Event, error)
 }
 
 func (m *mockRepo) FilterExistingIcsUIDs(uids []string) (map[string]bool, error) {
@@ -37,6 +47,13 @@ func (m *mockRepo) FilterExistingIcsUIDs(uids []string) (map[string]bool, error)
 	return map[string]bool{}, nil
 }
 
+func (m *mockRepo) GetByIcsUID(uid string) (*model.Event, error) {
+	if m.getByIcsUIDFn != nil {
+		return m.getByIcsUIDFn(uid)
+	}
+	return nil, nil
+}
+
 func (m *mockRepo) List(from, to string, calendarIDs []int64) ([]model.Event, error) {
 	if m.listFn != nil {
 		return m.listFn(from, to, calendarIDs)
@@ -51,6 +68,19 @@ func (m *mockRepo) ListAll(calendarIDs []int64) ([]model.Event, error) {
 	return nil, nil
 }
 
+func (m *mockRepo) EachEvent(calendarIDs []int64, fn func(e *model.Event) error) error {
+	events, err := m.ListAll(calendarIDs)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if err := fn(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockRepo) ListRecurring(to string, calendarIDs []int64) ([]model.Event, error) {
 	if m.listRecurringFn != nil {
 		return m.listRecurringFn(to, calendarIDs)
@@ -58,7 +88,7 @@ func (m *mockRepo) ListRecurring(to string, calendarIDs []int64) ([]model.Event,
 	return nil, nil
 }
 
-func (m *mockRepo) Search(query, from, to string, calendarIDs []int64) ([]model.Event, error) {
+func (m *mockRepo) Search(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error) {
 	if m.searchFn != nil {
 		return m.searchFn(query, from, to, calendarIDs)
 	}
@@ -87,6 +117,38 @@ func (m *mockCalRepo) DeleteCalendarIfUnused(id int64) error {
 	return nil
 }
 
+// mockHistoryRepo implements repository.HistoryRepository and keeps entries in memory.
+type mockHistoryRepo struct {
+	entries []model.HistoryEntry
+	err     error
+}
+
+func (m *mockHistoryRepo) AddHistory(entry *model.HistoryEntry) error {
+	if m.err != nil {
+		return m.err
+	}
+	entry.ID = int64(len(m.entries) + 1)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+func (m *mockHistoryRepo) ListHistory(eventID int64) ([]model.HistoryEntry, error) {
+	var result []model.HistoryEntry
+	for _, e := range m.entries {
+		if e.EventID == eventID {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+func (m *mockHistoryRepo) GetHistoryEntry(id int64) (*model.HistoryEntry, error) {
+	for _, e := range m.entries {
+		if e.ID == id {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
 func (m *mockRepo) GetByID(id int64) (*model.Event, error) {
 	if m.getByIDFn != nil {
 		return m.getByIDFn(id)
@@ -129,13 +191,74 @@ func (m *mockRepo) GetOverride(parentID int64, originalStart string) (*model.Eve
 	return nil, nil
 }
 
-func (m *mockRepo) DeleteByParentID(parentID int64) error {
-	if m.deleteByParentIDFn != nil {
-		return m.deleteByParentIDFn(parentID)
+func (m *mockRepo) ListDeleted() ([]model.Event, error) {
+	if m.listDeletedFn != nil {
+		return m.listDeletedFn()
+	}
+	return nil, nil
+}
+
+func (m *mockRepo) ListDeletedBefore(before string) ([]model.Event, error) {
+	if m.listDeletedBeforeFn != nil {
+		return m.listDeletedBeforeFn(before)
+	}
+	return nil, nil
+}
+
+func (m *mockRepo) GetDeleted(id int64) (*model.Event, error) {
+	if m.getDeletedFn != nil {
+		return m.getDeletedFn(id)
+	}
+	return nil, nil
+}
+
+func (m *mockRepo) Restore(id int64) error {
+	if m.restoreFn != nil {
+		return m.restoreFn(id)
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepo) Purge(id int64) error {
+	if m.purgeFn != nil {
+		return m.purgeFn(id)
 	}
 	return nil
 }
 
+func (m *mockRepo) PurgeDeletedBefore(before string) (int64, error) {
+	if m.purgeDeletedBeforeFn != nil {
+		return m.purgeDeletedBeforeFn(before)
+	}
+	return 0, nil
+}
+
+func (m *mockRepo) ListChanges(since int64) ([]model.EventChange, int64, error) {
+	if m.listChangesFn != nil {
+		return m.listChangesFn(since)
+	}
+	return nil, 0, nil
+}
+
+func (m *mockRepo) LatestChange() (int64, error) {
+	if m.latestChangeFn != nil {
+		return m.latestChangeFn()
+	}
+	return 0, nil
+}
+
+func (m *mockRepo) FindEvents(filter model.EventFilter, limit, offset int) ([]model.Event, error) {
+	if m.findEventsFn != nil {
+		return m.findEventsFn(filter, limit, offset)
+	}
+	return nil, nil
+}
+
+// InTx runs fn without a transaction; the mock cannot roll back.
+func (m *mockRepo) InTx(fn func(repo repository.EventRepository) error) error {
+	return fn(m)
+}
+
 // helpers
 func float64Ptr(f float64) *float64 { return &f }
 
@@ -164,7 +287,7 @@ var errRepo = errors.New("repo error")
 func TestNewEventService(t *testing.T) {
 	repo := &mockRepo{}
 	calRepo := &mockCalRepo{}
-	svc := NewEventService(repo, calRepo)
+	svc := NewEventService(repo, calRepo, &mockHistoryRepo{}, nil)
 	assert.NotNil(t, svc)
 }
 
@@ -176,7 +299,7 @@ func TestListAll_ReturnsEvents(t *testing.T) {
 			return []model.Event{{ID: 1, Title: "A"}, {ID: 2, Title: "B"}}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events, err := svc.ListAll(nil)
 	require.NoError(t, err)
 	assert.Len(t, events, 2)
@@ -188,7 +311,7 @@ func TestListAll_NilNormalizesToEmptySlice(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events, err := svc.ListAll(nil)
 	require.NoError(t, err)
 	assert.NotNil(t, events)
@@ -201,7 +324,7 @@ func TestListAll_RepoError(t *testing.T) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.ListAll(nil)
 	assert.ErrorIs(t, err, errRepo)
 }
@@ -217,7 +340,7 @@ func TestList_BasicList(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events, err := svc.List("2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
 	require.NoError(t, err)
 	assert.Len(t, events, 1)
@@ -232,7 +355,7 @@ func TestList_NilNormalizesToEmptySlice(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events, err := svc.List("2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
 	require.NoError(t, err)
 	assert.NotNil(t, events)
@@ -244,7 +367,7 @@ func TestList_RepoListError(t *testing.T) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.List("2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
 	assert.ErrorIs(t, err, errRepo)
 }
@@ -258,7 +381,7 @@ func TestList_RepoListRecurringError(t *testing.T) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.List("2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
 	assert.ErrorIs(t, err, errRepo)
 }
@@ -289,7 +412,7 @@ func TestList_WithRecurringAndOverrides(t *testing.T) {
 			}}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events, err := svc.List("2026-02-01T00:00:00Z", "2026-02-04T00:00:00Z", nil)
 	require.NoError(t, err)
 	// Should have expanded instances with override applied
@@ -322,7 +445,7 @@ func TestList_ListOverridesError(t *testing.T) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.List("2026-02-01T00:00:00Z", "2026-02-04T00:00:00Z", nil)
 	assert.ErrorIs(t, err, errRepo)
 }
@@ -331,36 +454,36 @@ func TestList_ListOverridesError(t *testing.T) {
 
 func TestSearch_ReturnsResults(t *testing.T) {
 	repo := &mockRepo{
-		searchFn: func(query, from, to string, calendarIDs []int64) ([]model.Event, error) {
+		searchFn: func(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error) {
 			return []model.Event{{ID: 1, Title: "Meeting"}}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
-	events, err := svc.Search("meet", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	events, err := svc.Search("meet", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil, false)
 	require.NoError(t, err)
 	assert.Len(t, events, 1)
 }
 
 func TestSearch_NilNormalizesToEmptySlice(t *testing.T) {
 	repo := &mockRepo{
-		searchFn: func(query, from, to string, calendarIDs []int64) ([]model.Event, error) {
+		searchFn: func(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
-	events, err := svc.Search("nothing", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	events, err := svc.Search("nothing", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil, false)
 	require.NoError(t, err)
 	assert.NotNil(t, events)
 }
 
 func TestSearch_RepoError(t *testing.T) {
 	repo := &mockRepo{
-		searchFn: func(query, from, to string, calendarIDs []int64) ([]model.Event, error) {
+		searchFn: func(query model.SearchQuery, from, to string, calendarIDs []int64) ([]model.Event, error) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
-	_, err := svc.Search("test", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil)
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	_, err := svc.Search("test", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z", nil, false)
 	assert.ErrorIs(t, err, errRepo)
 }
 
@@ -372,7 +495,7 @@ func TestGetByID_Found(t *testing.T) {
 			return &model.Event{ID: id, Title: "Found"}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	e, err := svc.GetByID(42)
 	require.NoError(t, err)
 	assert.Equal(t, int64(42), e.ID)
@@ -385,7 +508,7 @@ func TestGetByID_NotFound(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.GetByID(42)
 	assert.ErrorIs(t, err, ErrNotFound)
 }
@@ -396,7 +519,7 @@ func TestGetByID_RepoError(t *testing.T) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.GetByID(42)
 	assert.ErrorIs(t, err, errRepo)
 }
@@ -412,7 +535,7 @@ func TestCreate_Valid(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.CreateEventRequest{
 		Title:     "New Event",
 		StartTime: optDateTime("2026-02-15T10:00:00Z"),
@@ -426,7 +549,7 @@ func TestCreate_Valid(t *testing.T) {
 
 func TestCreate_ValidationFailure(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.CreateEventRequest{
 		Title: "", // required
 	}
@@ -440,7 +563,7 @@ func TestCreate_RepoError(t *testing.T) {
 			return errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.CreateEventRequest{
 		Title:     "Test",
 		StartTime: optDateTime("2026-02-15T10:00:00Z"),
@@ -458,7 +581,7 @@ func TestCreate_HTMLSanitization(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.CreateEventRequest{
 		Title:       "Test",
 		Description: optString(`<b>bold</b><script>alert('xss')</script>`),
@@ -486,7 +609,7 @@ func TestUpdate_PartialUpdate(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		Title: optString("Updated"),
 	}
@@ -503,7 +626,7 @@ func TestUpdate_NotFound(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("X")}
 	_, err := svc.Update(1, req)
 	assert.ErrorIs(t, err, ErrNotFound)
@@ -511,7 +634,7 @@ func TestUpdate_NotFound(t *testing.T) {
 
 func TestUpdate_ValidationFailure(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("")} // an empty title isn't allowed
 	_, err := svc.Update(1, req)
 	assert.ErrorIs(t, err, ErrValidation)
@@ -528,7 +651,7 @@ func TestUpdate_EndBeforeStart(t *testing.T) {
 			}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		EndTime: optDateTime("2026-02-15T09:00:00Z"),
 	}
@@ -550,7 +673,7 @@ func TestUpdate_DurationRecomputesEndTime(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		Duration: optString("PT2H"),
 	}
@@ -574,7 +697,7 @@ func TestUpdate_AllDayDateHandling(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		StartDate: optDate("2026-02-20"),
 		EndDate:   optDate("2026-02-22"),
@@ -600,7 +723,7 @@ func TestUpdate_ToggleToAllDay(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		AllDay: optBool(true),
 	}
@@ -625,7 +748,7 @@ func TestUpdate_AllFieldUpdates(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		Color:                optString("blue"),
 		RecurrenceFreq:       optFreqUpdate("WEEKLY"),
@@ -674,7 +797,7 @@ func TestUpdate_HTMLSanitization(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		Description: optString(`<em>hi</em><script>bad</script>`),
 	}
@@ -697,7 +820,7 @@ func TestUpdate_RepoError(t *testing.T) {
 			return errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("New")}
 	_, err := svc.Update(1, req)
 	assert.ErrorIs(t, err, errRepo)
@@ -725,7 +848,7 @@ func TestCreateOrUpdateOverride_NewOverride(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("Modified Instance")}
 	e, err := svc.CreateOrUpdateOverride(parentID, "2026-02-08T09:00:00Z", req)
 	require.NoError(t, err)
@@ -775,7 +898,7 @@ func TestCreateOrUpdateOverride_ExistingOverride(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("Updated Override")}
 	e, err := svc.CreateOrUpdateOverride(parentID, "2026-02-08T09:00:00Z", req)
 	require.NoError(t, err)
@@ -788,7 +911,7 @@ func TestCreateOrUpdateOverride_ParentNotFound(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("X")}
 	_, err := svc.CreateOrUpdateOverride(999, "2026-02-08T09:00:00Z", req)
 	assert.ErrorIs(t, err, ErrNotFound)
@@ -806,7 +929,7 @@ func TestCreateOrUpdateOverride_ParentNotRecurring(t *testing.T) {
 			}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("X")}
 	_, err := svc.CreateOrUpdateOverride(1, "2026-02-08T09:00:00Z", req)
 	assert.ErrorIs(t, err, ErrValidation)
@@ -814,7 +937,7 @@ func TestCreateOrUpdateOverride_ParentNotRecurring(t *testing.T) {
 
 func TestCreateOrUpdateOverride_InvalidInstanceStart(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("X")}
 	_, err := svc.CreateOrUpdateOverride(1, "not-a-date", req)
 	assert.ErrorIs(t, err, ErrValidation)
@@ -847,7 +970,7 @@ func TestCreateOrUpdateOverride_NewOverrideWithAllFields(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{
 		Title:           optString("New Title"),
 		Description:     optString("<b>bold</b><script>bad</script>"),
@@ -897,7 +1020,7 @@ func TestCreateOrUpdateOverride_GetOverrideError(t *testing.T) {
 			return nil, errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("X")}
 	_, err := svc.CreateOrUpdateOverride(parentID, "2026-02-08T09:00:00Z", req)
 	assert.ErrorIs(t, err, errRepo)
@@ -905,7 +1028,7 @@ func TestCreateOrUpdateOverride_GetOverrideError(t *testing.T) {
 
 func TestCreateOrUpdateOverride_ValidationFailure(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	req := &api.UpdateEventRequest{Title: optString("")} // an empty title isn't allowed
 	_, err := svc.CreateOrUpdateOverride(1, "2026-02-08T09:00:00Z", req)
 	assert.ErrorIs(t, err, ErrValidation)
@@ -920,7 +1043,7 @@ func TestImportSingle_SingleEvent(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{{
 		Title:     "Imported",
 		StartTime: "2026-02-15T10:00:00Z",
@@ -933,14 +1056,14 @@ func TestImportSingle_SingleEvent(t *testing.T) {
 
 func TestImportSingle_NoEvents(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.ImportSingle(nil, "")
 	assert.ErrorIs(t, err, ErrValidation)
 }
 
 func TestImportSingle_MultipleParents(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{
 		{Title: "A", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"},
 		{Title: "B", StartTime: "2026-02-16T10:00:00Z", EndTime: "2026-02-16T11:00:00Z"},
@@ -952,7 +1075,7 @@ func TestImportSingle_MultipleParents(t *testing.T) {
 func TestImportSingle_RejectsOverrides(t *testing.T) {
 	parentID := int64(5)
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 
 	t.Run("parent with override", func(t *testing.T) {
 		events := []model.Event{
@@ -983,7 +1106,7 @@ func TestImportSingle_AllDayFormatConversion(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{{
 		Title:     "All Day",
 		StartTime: "2026-02-15T00:00:00Z",
@@ -998,7 +1121,7 @@ func TestImportSingle_AllDayFormatConversion(t *testing.T) {
 
 func TestImportSingle_ValidationFailure(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{{
 		Title:     "", // empty title
 		StartTime: "2026-02-15T10:00:00Z",
@@ -1021,7 +1144,7 @@ func TestImport_ParentsAndOverrides(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{
 		{
 			Title:          "Weekly Meeting",
@@ -1055,7 +1178,7 @@ func TestImport_SkipsInvalidEvents(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{
 		{Title: "", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"}, // invalid: no title
 		{Title: "Valid", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"},
@@ -1072,7 +1195,7 @@ func TestImport_OverrideWithoutParent(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{
 		{
 			Title:                   "Orphan Override",
@@ -1096,7 +1219,7 @@ func TestImport_AllDayFormatConversion(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{{
 		Title:     "All Day Import",
 		StartTime: "2026-03-10T00:00:00Z",
@@ -1115,7 +1238,7 @@ func TestImport_RepoCreateError(t *testing.T) {
 			return errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	events := []model.Event{
 		{Title: "Test", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"},
 	}
@@ -1124,6 +1247,154 @@ func TestImport_RepoCreateError(t *testing.T) {
 	assert.Equal(t, 0, count)
 }
 
+// failingSource is an EventSource that fails after its events.
+type failingSource struct {
+	events eventSlice
+	err    error
+}
+
+func (s *failingSource) Next() (model.Event, error) {
+	if len(s.events) == 0 {
+		return model.Event{}, s.err
+	}
+	return s.events.Next()
+}
+
+// countingTxRepo counts the transactions of a mockRepo.
+type countingTxRepo struct {
+	*mockRepo
+	transactions int
+}
+
+func (r *countingTxRepo) InTx(fn func(repo repository.EventRepository) error) error {
+	r.transactions++
+	return fn(r)
+}
+
+func TestImportFrom_Batches(t *testing.T) {
+	var created []*model.Event
+	repo := &countingTxRepo{mockRepo: &mockRepo{
+		createFn: func(event *model.Event) error {
+			created = append(created, event)
+			event.ID = int64(len(created))
+			return nil
+		},
+	}}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+
+	events := []model.Event{{
+		Title:                   "Override before its parent",
+		StartTime:               "2026-02-08T10:00:00Z",
+		EndTime:                 "2026-02-08T11:00:00Z",
+		RecurrenceOriginalStart: "2026-02-08T10:00:00Z",
+		ImportUID:               "uid-late",
+	}}
+	for i := 0; i < importBatchSize+10; i++ {
+		events = append(events, model.Event{Title: "Event", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"})
+	}
+	events = append(events, model.Event{
+		Title: "Parent", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z",
+		RecurrenceFreq: "WEEKLY", ImportUID: "uid-late",
+	})
+	src := eventSlice(events)
+	count, err := svc.ImportFrom(&src, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, len(events), count)
+	assert.Equal(t, 2, repo.transactions)
+	override := created[len(created)-1]
+	require.NotNil(t, override.RecurrenceParentID)
+	assert.Equal(t, created[len(created)-2].ID, *override.RecurrenceParentID)
+}
+
+func TestImportFrom_SourceError(t *testing.T) {
+	repo := &mockRepo{
+		createFn: func(event *model.Event) error {
+			event.ID = 1
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	var events eventSlice
+	for i := 0; i < importBatchSize+1; i++ {
+		events = append(events, model.Event{Title: "Event", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"})
+	}
+
+	count, err := svc.ImportFrom(&failingSource{events: events, err: errRepo}, "", false)
+	assert.ErrorIs(t, err, errRepo)
+	assert.Equal(t, importBatchSize, count, "the batches before the error are imported")
+
+	count, err = svc.ImportFrom(&failingSource{events: events, err: errRepo}, "", true)
+	assert.ErrorIs(t, err, errRepo)
+	assert.Equal(t, 0, count)
+}
+
+// failingCommitRepo is a mockRepo whose transactions fail to commit after the
+// first ones.
+type failingCommitRepo struct {
+	*mockRepo
+	commits int
+}
+
+func (r *failingCommitRepo) InTx(fn func(repo repository.EventRepository) error) error {
+	if err := fn(r); err != nil {
+		return err
+	}
+	if r.commits == 0 {
+		return errRepo
+	}
+	r.commits--
+	return nil
+}
+
+func TestImportFrom_CommitError(t *testing.T) {
+	nextID := int64(1)
+	repo := &failingCommitRepo{mockRepo: &mockRepo{
+		createFn: func(event *model.Event) error {
+			event.ID = nextID
+			nextID++
+			return nil
+		},
+	}, commits: 1}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	var events eventSlice
+	for i := 0; i < importBatchSize*2; i++ {
+		events = append(events, model.Event{Title: "Event", StartTime: "2026-02-15T10:00:00Z", EndTime: "2026-02-15T11:00:00Z"})
+	}
+
+	count, err := svc.ImportFrom(&events, "", false)
+	assert.ErrorIs(t, err, errRepo)
+	assert.Equal(t, importBatchSize, count, "the events of a failed commit are not counted")
+}
+
+func TestImportFrom_OrphanLimit(t *testing.T) {
+	nextID := int64(1)
+	repo := &mockRepo{
+		createFn: func(event *model.Event) error {
+			event.ID = nextID
+			nextID++
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	var events eventSlice
+	start := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < importBatchSize*2; i++ {
+		instance := start.AddDate(0, 0, i).Format(time.RFC3339)
+		events = append(events, model.Event{
+			Title: "Override before its parent", StartTime: instance, EndTime: instance,
+			RecurrenceOriginalStart: instance, ImportUID: "uid-late",
+		})
+	}
+	events = append(events, model.Event{
+		Title: "Parent", StartTime: "2026-02-01T10:00:00Z", EndTime: "2026-02-01T11:00:00Z",
+		RecurrenceFreq: "DAILY", ImportUID: "uid-late",
+	})
+
+	count, err := svc.ImportFrom(&events, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, maxImportOrphans+1, count, "overrides beyond the limit are skipped")
+}
+
 // --- AddExDate ---
 
 func TestAddExDate_Appends(t *testing.T) {
@@ -1147,7 +1418,7 @@ func TestAddExDate_Appends(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	e, err := svc.AddExDate(1, "2026-02-15T09:00:00Z")
 	require.NoError(t, err)
 	expected := "2026-02-08T09:00:00Z,2026-02-15T09:00:00Z"
@@ -1175,7 +1446,7 @@ func TestAddExDate_FirstExDate(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.AddExDate(1, "2026-02-08T09:00:00Z")
 	require.NoError(t, err)
 	assert.Equal(t, "2026-02-08T09:00:00Z", updated.ExDates)
@@ -1187,7 +1458,7 @@ func TestAddExDate_NotFound(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.AddExDate(999, "2026-02-08T09:00:00Z")
 	assert.ErrorIs(t, err, ErrNotFound)
 }
@@ -1203,14 +1474,14 @@ func TestAddExDate_NotRecurring(t *testing.T) {
 			}, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.AddExDate(1, "2026-02-08T09:00:00Z")
 	assert.ErrorIs(t, err, ErrValidation)
 }
 
 func TestAddExDate_InvalidFormat(t *testing.T) {
 	repo := &mockRepo{}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.AddExDate(1, "not-a-date")
 	assert.ErrorIs(t, err, ErrValidation)
 }
@@ -1239,7 +1510,7 @@ func TestAddExDate_DeletesAssociatedOverride(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.AddExDate(1, "2026-02-08T09:00:00Z")
 	require.NoError(t, err)
 	assert.Equal(t, overrideID, deletedID)
@@ -1265,7 +1536,7 @@ func TestRemoveExDate_RemovesSpecific(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.RemoveExDate(1, "2026-02-15T09:00:00Z")
 	require.NoError(t, err)
 	expected := "2026-02-08T09:00:00Z,2026-02-22T09:00:00Z"
@@ -1278,7 +1549,7 @@ func TestRemoveExDate_NotFound(t *testing.T) {
 			return nil, nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	_, err := svc.RemoveExDate(999, "2026-02-08T09:00:00Z")
 	assert.ErrorIs(t, err, ErrNotFound)
 }
@@ -1286,46 +1557,80 @@ func TestRemoveExDate_NotFound(t *testing.T) {
 // --- Delete ---
 
 func TestDelete_Success(t *testing.T) {
-	deleteByParentCalled := false
+	var deletedID int64
 	repo := &mockRepo{
-		deleteByParentIDFn: func(parentID int64) error {
-			deleteByParentCalled = true
-			return nil
-		},
 		deleteFn: func(id int64) error {
+			deletedID = id
 			return nil
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	err := svc.Delete(1)
 	require.NoError(t, err)
-	assert.True(t, deleteByParentCalled, "expected DeleteByParentID to be called")
+	assert.Equal(t, int64(1), deletedID)
 }
 
-func TestDelete_NotFound(t *testing.T) {
+func TestDelete_OverrideAddsExDate(t *testing.T) {
+	parentID := int64(1)
+	var updated *model.Event
+	var deletedID int64
 	repo := &mockRepo{
-		deleteByParentIDFn: func(parentID int64) error {
+		getByIDFn: func(id int64) (*model.Event, error) {
+			if id == parentID {
+				return &model.Event{
+					ID:             id,
+					Title:          "Weekly",
+					StartTime:      "2026-02-01T09:00:00Z",
+					EndTime:        "2026-02-01T10:00:00Z",
+					RecurrenceFreq: "WEEKLY",
+				}, nil
+			}
+			return &model.Event{
+				ID:                      id,
+				Title:                   "Moved",
+				RecurrenceParentID:      &parentID,
+				RecurrenceOriginalStart: "2026-02-08T09:00:00Z",
+			}, nil
+		},
+		updateFn: func(event *model.Event) error {
+			updated = event
 			return nil
 		},
+		getOverrideFn: func(pid int64, originalStart string) (*model.Event, error) {
+			return &model.Event{ID: 20}, nil
+		},
+		deleteFn: func(id int64) error {
+			deletedID = id
+			return nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	err := svc.Delete(20)
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, parentID, updated.ID)
+	assert.Equal(t, "2026-02-08T09:00:00Z", updated.ExDates)
+	assert.Equal(t, int64(20), deletedID)
+}
+
+func TestDelete_NotFound(t *testing.T) {
+	repo := &mockRepo{
 		deleteFn: func(id int64) error {
 			return sql.ErrNoRows
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	err := svc.Delete(999)
 	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestDelete_RepoError(t *testing.T) {
 	repo := &mockRepo{
-		deleteByParentIDFn: func(parentID int64) error {
-			return nil
-		},
 		deleteFn: func(id int64) error {
 			return errRepo
 		},
 	}
-	svc := NewEventService(repo, &mockCalRepo{})
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
 	err := svc.Delete(1)
 	assert.ErrorIs(t, err, errRepo)
 }
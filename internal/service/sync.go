@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// ErrSyncTokenExpired is returned for a sync token the change log does not
+// reach, e.g. after an older backup has been restored. The client has to do
+// an initial sync again.
+var ErrSyncTokenExpired = errors.New("sync token expired")
+
+// Sync returns the events changed since token, and the token to continue
+// from. An empty token is an initial sync, which returns every current event
+// as changed and no deletions.
+func (s *EventService) Sync(token string) (*model.SyncResult, error) {
+	var since int64
+	if token != "" {
+		var err error
+		since, err = strconv.ParseInt(token, 10, 64)
+		if err != nil || since < 0 {
+			return nil, fmt.Errorf("%w: invalid sync token", ErrValidation)
+		}
+	}
+	changes, latest, err := s.repo.ListChanges(since)
+	if err != nil {
+		return nil, err
+	}
+	if since > latest {
+		return nil, ErrSyncTokenExpired
+	}
+	result := &model.SyncResult{Changed: []int64{}, Deleted: []int64{}, Token: strconv.FormatInt(latest, 10)}
+	for _, c := range changes {
+		switch {
+		case !c.Deleted:
+			result.Changed = append(result.Changed, c.EventID)
+		case token != "":
+			result.Deleted = append(result.Deleted, c.EventID)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestSync(t *testing.T) {
+	var gotSince int64
+	repo := &mockRepo{
+		listChangesFn: func(since int64) ([]model.EventChange, int64, error) {
+			gotSince = since
+			return []model.EventChange{
+				{Seq: 8, EventID: 1},
+				{Seq: 9, EventID: 2, Deleted: true},
+			}, 9, nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+
+	result, err := svc.Sync("")
+	require.NoError(t, err)
+	assert.Zero(t, gotSince)
+	assert.Equal(t, []int64{1}, result.Changed)
+	assert.Empty(t, result.Deleted, "an initial sync has no deletions")
+	assert.Equal(t, "9", result.Token)
+
+	result, err = svc.Sync("7")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), gotSince)
+	assert.Equal(t, []int64{1}, result.Changed)
+	assert.Equal(t, []int64{2}, result.Deleted)
+	assert.Equal(t, "9", result.Token)
+}
+
+func TestSync_InvalidToken(t *testing.T) {
+	svc := NewEventService(&mockRepo{}, &mockCalRepo{}, nil, nil)
+	for _, token := range []string{"abc", "-1"} {
+		_, err := svc.Sync(token)
+		assert.ErrorIs(t, err, ErrValidation, token)
+	}
+}
+
+func TestSync_TokenAheadOfChangeLog(t *testing.T) {
+	repo := &mockRepo{
+		listChangesFn: func(since int64) ([]model.EventChange, int64, error) {
+			return nil, 3, nil
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, nil, nil)
+	_, err := svc.Sync("10")
+	assert.ErrorIs(t, err, ErrSyncTokenExpired)
+}
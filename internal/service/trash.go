@@ -0,0 +1,95 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// Trash returns the deleted events that have not been purged yet, most
+// recently deleted first.
+func (s *EventService) Trash() ([]model.Event, error) {
+	events, err := s.repo.ListDeleted()
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []model.Event{}
+	}
+	return events, nil
+}
+
+// RestoreDeleted takes an event out of the trash, together with the overrides
+// that were deleted along with it.
+func (s *EventService) RestoreDeleted(id int64) (*model.Event, error) {
+	return inTxResult(s, func(tx *EventService) (*model.Event, error) { return tx.restoreDeleted(id) })
+}
+
+func (s *EventService) restoreDeleted(id int64) (*model.Event, error) {
+	trashed, err := s.repo.GetDeleted(id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.Restore(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	restored, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if restored == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.history.record(s.actor, model.ActionRestore, id, trashed, restored); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// Purge permanently removes an event from the trash.
+func (s *EventService) Purge(id int64) error {
+	return s.inTx(func(tx *EventService) error { return tx.purge(id) })
+}
+
+func (s *EventService) purge(id int64) error {
+	old, err := s.repo.GetDeleted(id)
+	if err != nil {
+		return err
+	}
+	err = s.repo.Purge(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.history.record(s.actor, model.ActionDelete, id, old, nil)
+}
+
+// PurgeTrash permanently removes the events that have been in the trash for
+// longer than retention, and returns how many were removed.
+func (s *EventService) PurgeTrash(retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention).UTC().Format(time.RFC3339)
+	return inTxResult(s, func(tx *EventService) (int64, error) {
+		deleted, err := tx.repo.ListDeletedBefore(cutoff)
+		if err != nil {
+			return 0, err
+		}
+		n, err := tx.repo.PurgeDeletedBefore(cutoff)
+		if err != nil {
+			return 0, err
+		}
+		for i := range deleted {
+			if err := tx.history.record(tx.actor, model.ActionDelete, deleted[i].ID, &deleted[i], nil); err != nil {
+				return 0, err
+			}
+		}
+		return n, nil
+	})
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+func TestRestoreDeleted_RecordsHistory(t *testing.T) {
+	var restoredID int64
+	repo := &mockRepo{
+		restoreFn: func(id int64) error {
+			restoredID = id
+			return nil
+		},
+		getByIDFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Back"}, nil
+		},
+		getDeletedFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Back", DeletedAt: "2026-03-01T00:00:00Z"}, nil
+		},
+	}
+	hist := &mockHistoryRepo{}
+	svc := NewEventService(repo, &mockCalRepo{}, hist, nil)
+
+	event, err := svc.RestoreDeleted(5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), restoredID)
+	assert.Equal(t, "Back", event.Title)
+	require.Len(t, hist.entries, 1)
+	assert.Equal(t, model.ActionRestore, hist.entries[0].Action)
+	require.NotNil(t, hist.entries[0].Old, "the trashed event, so the restore can be undone")
+	assert.Equal(t, "2026-03-01T00:00:00Z", hist.entries[0].Old.DeletedAt)
+}
+
+func TestRestoreDeleted_NotInTrash(t *testing.T) {
+	repo := &mockRepo{
+		restoreFn: func(id int64) error {
+			return sql.ErrNoRows
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	_, err := svc.RestoreDeleted(5)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPurge_NotInTrash(t *testing.T) {
+	repo := &mockRepo{
+		purgeFn: func(id int64) error {
+			return sql.ErrNoRows
+		},
+	}
+	svc := NewEventService(repo, &mockCalRepo{}, &mockHistoryRepo{}, nil)
+	assert.ErrorIs(t, svc.Purge(5), ErrNotFound)
+}
+
+func TestPurge_RecordsHistory(t *testing.T) {
+	repo := &mockRepo{
+		getDeletedFn: func(id int64) (*model.Event, error) {
+			return &model.Event{ID: id, Title: "Gone"}, nil
+		},
+	}
+	hist := &mockHistoryRepo{}
+	svc := NewEventService(repo, &mockCalRepo{}, hist, nil)
+
+	require.NoError(t, svc.Purge(5))
+	require.Len(t, hist.entries, 1)
+	assert.Equal(t, model.ActionDelete, hist.entries[0].Action)
+	assert.Equal(t, int64(5), hist.entries[0].EventID)
+	require.NotNil(t, hist.entries[0].Old)
+	assert.Equal(t, "Gone", hist.entries[0].Old.Title)
+}
+
+func TestPurgeTrash_Cutoff(t *testing.T) {
+	var cutoff string
+	repo := &mockRepo{
+		listDeletedBeforeFn: func(before string) ([]model.Event, error) {
+			return []model.Event{{ID: 2, Title: "Old", DeletedAt: "2020-01-01T00:00:00Z"}}, nil
+		},
+		purgeDeletedBeforeFn: func(before string) (int64, error) {
+			cutoff = before
+			return 3, nil
+		},
+	}
+	hist := &mockHistoryRepo{}
+	svc := NewEventService(repo, &mockCalRepo{}, hist, nil)
+	n, err := svc.PurgeTrash(48 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	require.Len(t, hist.entries, 1)
+	assert.Equal(t, int64(2), hist.entries[0].EventID)
+
+	parsed, err := time.Parse(time.RFC3339, cutoff)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-48*time.Hour), parsed, time.Minute)
+}
@@ -336,6 +336,9 @@ func ValidateCreateFeedRequest(req *api.CreateFeedRequest) (refreshInterval int,
 	if req.CalendarName.Set && len(req.CalendarName.Value) > model.MaxCalendarNameLength {
 		return 0, fmt.Errorf("calendar_name must be at most %d characters", model.MaxCalendarNameLength)
 	}
+	if req.Token.Value != "" && (req.Username.Value != "" || req.Password.Value != "") {
+		return 0, fmt.Errorf("use either username and password or a token")
+	}
 	if req.CalendarColor.Set {
 		if err := model.ValidateColor(req.CalendarColor.Value); err != nil {
 			return 0, err
@@ -369,6 +372,9 @@ func ValidateUpdateFeedRequest(req *api.UpdateFeedRequest) error {
 	if req.CalendarName.Set && len(req.CalendarName.Value) > model.MaxCalendarNameLength {
 		return fmt.Errorf("calendar_name must be at most %d characters", model.MaxCalendarNameLength)
 	}
+	if req.Token.Value != "" && (req.Username.Value != "" || req.Password.Value != "") {
+		return fmt.Errorf("use either username and password or a token")
+	}
 	if req.RefreshIntervalMinutes.Set {
 		if req.RefreshIntervalMinutes.Value < minRefreshIntervalMinutes {
 			return fmt.Errorf("refresh_interval_minutes must be at least %d", minRefreshIntervalMinutes)
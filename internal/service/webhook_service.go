@@ -0,0 +1,410 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mikaelstaldal/go-server-common/httputil"
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+	"github.com/mikaelstaldal/mycal/internal/repository"
+)
+
+const (
+	// maxWebhookAttempts is how many times a delivery is tried before it fails.
+	// With the doubling delay, the last attempt is about 4 hours after the first.
+	maxWebhookAttempts = 10
+	// firstWebhookRetryDelay is the delay after the first failed attempt.
+	firstWebhookRetryDelay = 30 * time.Second
+	// webhookBatchSize is how many due deliveries are sent per round.
+	webhookBatchSize = 20
+	// webhookPollInterval is how often the queue is checked for due retries.
+	webhookPollInterval = 30 * time.Second
+	// deliveryRetention is how long completed deliveries are kept.
+	deliveryRetention = 7 * 24 * time.Hour
+	// maxListedDeliveries is how many deliveries of a webhook are listed.
+	maxListedDeliveries = 100
+)
+
+// WebhookService manages webhook subscriptions, and queues and sends their
+// deliveries for the changes published on the event bus.
+type WebhookService struct {
+	repo        repository.WebhookRepository
+	client      *http.Client
+	validateURL func(rawURL string) error
+	wake        chan struct{}
+
+	mu    sync.Mutex
+	hooks []model.Webhook // cache of all webhooks, nil until loaded
+}
+
+func NewWebhookService(repo repository.WebhookRepository, bus *EventBus) *WebhookService {
+	s := &WebhookService{
+		repo:        repo,
+		client:      httputil.NewSafeHTTPClient(10 * time.Second),
+		validateURL: httputil.ValidateExternalURL,
+		wake:        make(chan struct{}, 1),
+	}
+	if bus != nil {
+		bus.OnChange(s.enqueue)
+	}
+	return s
+}
+
+func (s *WebhookService) List() ([]model.Webhook, error) {
+	hooks, err := s.repo.ListWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	if hooks == nil {
+		hooks = []model.Webhook{}
+	}
+	return hooks, nil
+}
+
+func (s *WebhookService) GetByID(id int64) (*model.Webhook, error) {
+	hook, err := s.repo.GetWebhookByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if hook == nil {
+		return nil, ErrNotFound
+	}
+	return hook, nil
+}
+
+func (s *WebhookService) Create(req *api.CreateWebhookRequest) (*model.Webhook, error) {
+	hook := &model.Webhook{
+		URL:     req.URL.String(),
+		Secret:  req.Secret,
+		Enabled: req.Enabled.Or(true),
+	}
+	if err := s.validateURL(hook.URL); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+	}
+	var err error
+	if hook.EventTypes, err = webhookEventTypes(req.EventTypes); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateWebhook(hook); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return hook, nil
+}
+
+func (s *WebhookService) Update(id int64, req *api.UpdateWebhookRequest) (*model.Webhook, error) {
+	hook, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Set {
+		hook.URL = req.URL.Value.String()
+		if err := s.validateURL(hook.URL); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		}
+	}
+	if req.Secret.Set {
+		hook.Secret = req.Secret.Value
+	}
+	if req.EventTypes != nil {
+		if hook.EventTypes, err = webhookEventTypes(req.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+	if req.Enabled.Set {
+		hook.Enabled = req.Enabled.Value
+	}
+	if err := s.repo.UpdateWebhook(hook); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return hook, nil
+}
+
+func (s *WebhookService) Delete(id int64) error {
+	hook, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteWebhook(hook.ID); err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// Deliveries returns the latest deliveries of a webhook, most recent first.
+func (s *WebhookService) Deliveries(id int64) ([]model.WebhookDelivery, error) {
+	if _, err := s.GetByID(id); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.ListDeliveries(id, maxListedDeliveries)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+func webhookEventTypes(types []api.WebhookEventType) ([]string, error) {
+	if len(types) == 0 {
+		return nil, fmt.Errorf("%w: at least one event type is required", ErrValidation)
+	}
+	var result []string
+	for _, t := range types {
+		if !slices.Contains(model.WebhookEventTypes, string(t)) {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrValidation, t)
+		}
+		if !slices.Contains(result, string(t)) {
+			result = append(result, string(t))
+		}
+	}
+	return result, nil
+}
+
+// webhooks returns all webhooks, cached between changes to them.
+func (s *WebhookService) webhooks() ([]model.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hooks == nil {
+		hooks, err := s.repo.ListWebhooks()
+		if err != nil {
+			return nil, err
+		}
+		s.hooks = append([]model.Webhook{}, hooks...)
+	}
+	return s.hooks, nil
+}
+
+func (s *WebhookService) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = nil
+}
+
+// webhookPayload is the body of a delivery.
+type webhookPayload struct {
+	Type      string          `json:"type"`
+	CreatedAt string          `json:"created_at"`
+	Event     json.RawMessage `json:"event,omitempty"`
+	Feed      json.RawMessage `json:"feed,omitempty"`
+}
+
+// webhookEventType returns the webhook event type of a change, or "" if
+// webhooks are not notified of it.
+func webhookEventType(c Change) string {
+	switch {
+	case c.Kind == KindEvent && c.Event != nil:
+		switch c.Action {
+		case model.ActionCreate:
+			return model.WebhookEventCreated
+		case model.ActionUpdate:
+			return model.WebhookEventUpdated
+		case model.ActionDelete:
+			return model.WebhookEventDeleted
+		}
+	case c.Kind == KindFeed && c.Action == ActionRefreshFailed && c.Feed != nil:
+		return model.WebhookFeedRefreshFailed
+	}
+	return ""
+}
+
+func buildWebhookPayload(eventType string, c Change, now time.Time) ([]byte, error) {
+	p := webhookPayload{Type: eventType, CreatedAt: now.UTC().Format(time.RFC3339)}
+	var err error
+	if c.Event != nil {
+		e := *c.Event
+		e.SetStringID()
+		if p.Event, err = EventToAPI(&e).MarshalJSON(); err != nil {
+			return nil, err
+		}
+	}
+	if c.Feed != nil {
+		if p.Feed, err = FeedToAPI(c.Feed).MarshalJSON(); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(p)
+}
+
+// enqueue queues a delivery of a change to every enabled webhook subscribed to
+// it. Failures are only logged, since the change has already been made.
+func (s *WebhookService) enqueue(c Change) {
+	eventType := webhookEventType(c)
+	if eventType == "" {
+		return
+	}
+	hooks, err := s.webhooks()
+	if err != nil {
+		log.Printf("webhooks: failed to list webhooks: %v", err)
+		return
+	}
+	var payload []byte
+	queued := false
+	for _, hook := range hooks {
+		if !hook.Enabled || !slices.Contains(hook.EventTypes, eventType) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = buildWebhookPayload(eventType, c, time.Now()); err != nil {
+				log.Printf("webhooks: failed to build %s payload: %v", eventType, err)
+				return
+			}
+		}
+		delivery := &model.WebhookDelivery{WebhookID: hook.ID, EventType: eventType, Payload: string(payload)}
+		if err := s.repo.EnqueueDelivery(delivery); err != nil {
+			log.Printf("webhook %d: failed to queue %s delivery: %v", hook.ID, eventType, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run sends queued deliveries until ctx is done: right after new ones are
+// queued, and when retries are due.
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		// Keep going while there may be more due deliveries.
+		for s.DeliverDue() == webhookBatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+			cutoff := time.Now().Add(-deliveryRetention).UTC().Format(time.RFC3339)
+			if _, err := s.repo.PurgeDeliveriesBefore(cutoff); err != nil {
+				log.Printf("webhooks: failed to purge old deliveries: %v", err)
+			}
+		}
+	}
+}
+
+// DeliverDue sends a batch of due deliveries and returns how many were
+// processed.
+func (s *WebhookService) DeliverDue() int {
+	now := time.Now().UTC()
+	deliveries, err := s.repo.ListDueDeliveries(now.Format(time.RFC3339), webhookBatchSize)
+	if err != nil {
+		log.Printf("webhooks: failed to list due deliveries: %v", err)
+		return 0
+	}
+	hooks := map[int64]*model.Webhook{}
+	processed := 0
+	for i := range deliveries {
+		d := &deliveries[i]
+		hook, ok := hooks[d.WebhookID]
+		if !ok {
+			if hook, err = s.repo.GetWebhookByID(d.WebhookID); err != nil {
+				log.Printf("webhook %d: %v", d.WebhookID, err)
+				continue
+			}
+			hooks[d.WebhookID] = hook
+		}
+		s.attempt(hook, d, now)
+		if err := s.repo.UpdateDelivery(d); err != nil {
+			log.Printf("webhook %d: failed to update delivery %d: %v", d.WebhookID, d.ID, err)
+			continue
+		}
+		processed++
+	}
+	return processed
+}
+
+// attempt sends a delivery and updates it with the outcome.
+func (s *WebhookService) attempt(hook *model.Webhook, d *model.WebhookDelivery, now time.Time) {
+	switch {
+	case hook == nil:
+		d.Status = model.DeliveryFailed
+		d.LastError = "webhook deleted"
+		return
+	case !hook.Enabled:
+		d.Status = model.DeliveryFailed
+		d.LastError = "webhook disabled"
+		return
+	}
+
+	d.Attempts++
+	d.LastStatus = 0
+	d.LastError = ""
+	if err := s.send(hook, d); err != nil {
+		d.LastError = err.Error()
+		if d.Attempts >= maxWebhookAttempts {
+			d.Status = model.DeliveryFailed
+		} else {
+			d.NextAttemptAt = now.Add(webhookRetryDelay(d.Attempts)).Format(time.RFC3339)
+		}
+		return
+	}
+	d.Status = model.DeliveryDelivered
+	d.DeliveredAt = now.Format(time.RFC3339)
+}
+
+// webhookRetryDelay is the delay after the given number of failed attempts.
+func webhookRetryDelay(attempts int) time.Duration {
+	return firstWebhookRetryDelay << (attempts - 1)
+}
+
+func (s *WebhookService) send(hook *model.Webhook, d *model.WebhookDelivery) error {
+	// Re-validate the URL on every attempt, not just when it is set.
+	if err := s.validateURL(hook.URL); err != nil {
+		return err
+	}
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mycal-webhook")
+	req.Header.Set("X-Mycal-Event", d.EventType)
+	req.Header.Set("X-Mycal-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Mycal-Signature-256", SignWebhookPayload(hook.Secret, body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't reveal network details to API clients (SSRF oracle).
+		log.Printf("webhook %d: delivery %d failed: %v", hook.ID, d.ID, err)
+		return fmt.Errorf("request failed")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	d.LastStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("URL returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the X-Mycal-Signature-256 header value for a
+// delivery body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
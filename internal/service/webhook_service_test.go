@@ -0,0 +1,260 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mikaelstaldal/mycal/internal/api"
+	"github.com/mikaelstaldal/mycal/internal/model"
+)
+
+// mockWebhookRepo implements repository.WebhookRepository and keeps everything in memory.
+type mockWebhookRepo struct {
+	hooks      []model.Webhook
+	deliveries []model.WebhookDelivery
+}
+
+func (m *mockWebhookRepo) CreateWebhook(hook *model.Webhook) error {
+	hook.ID = int64(len(m.hooks) + 1)
+	m.hooks = append(m.hooks, *hook)
+	return nil
+}
+func (m *mockWebhookRepo) GetWebhookByID(id int64) (*model.Webhook, error) {
+	for _, h := range m.hooks {
+		if h.ID == id {
+			return &h, nil
+		}
+	}
+	return nil, nil
+}
+func (m *mockWebhookRepo) ListWebhooks() ([]model.Webhook, error) {
+	return append([]model.Webhook{}, m.hooks...), nil
+}
+func (m *mockWebhookRepo) UpdateWebhook(hook *model.Webhook) error {
+	for i := range m.hooks {
+		if m.hooks[i].ID == hook.ID {
+			m.hooks[i] = *hook
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+func (m *mockWebhookRepo) DeleteWebhook(id int64) error {
+	for i := range m.hooks {
+		if m.hooks[i].ID == id {
+			m.hooks = append(m.hooks[:i], m.hooks[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+func (m *mockWebhookRepo) EnqueueDelivery(delivery *model.WebhookDelivery) error {
+	delivery.ID = int64(len(m.deliveries) + 1)
+	delivery.Status = model.DeliveryPending
+	if delivery.NextAttemptAt == "" {
+		delivery.NextAttemptAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	m.deliveries = append(m.deliveries, *delivery)
+	return nil
+}
+func (m *mockWebhookRepo) ListDueDeliveries(now string, limit int) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == model.DeliveryPending && d.NextAttemptAt <= now && len(result) < limit {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+func (m *mockWebhookRepo) UpdateDelivery(delivery *model.WebhookDelivery) error {
+	m.deliveries[delivery.ID-1] = *delivery
+	return nil
+}
+func (m *mockWebhookRepo) ListDeliveries(webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(result) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			result = append(result, m.deliveries[i])
+		}
+	}
+	return result, nil
+}
+func (m *mockWebhookRepo) PurgeDeliveriesBefore(before string) (int64, error) {
+	return 0, nil
+}
+
+// newTestWebhookService returns a webhook service that may deliver to local
+// test servers.
+func newTestWebhookService(repo *mockWebhookRepo, bus *EventBus) *WebhookService {
+	s := NewWebhookService(repo, bus)
+	s.client = http.DefaultClient
+	s.validateURL = func(string) error { return nil }
+	return s
+}
+
+func createTestWebhook(t *testing.T, s *WebhookService, rawURL string, types ...api.WebhookEventType) *model.Webhook {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	hook, err := s.Create(&api.CreateWebhookRequest{URL: *u, Secret: "0123456789abcdef", EventTypes: types})
+	require.NoError(t, err)
+	return hook
+}
+
+func TestWebhookService_CreateValidation(t *testing.T) {
+	s := NewWebhookService(&mockWebhookRepo{}, nil)
+	u, _ := url.Parse("http://127.0.0.1/hook")
+	_, err := s.Create(&api.CreateWebhookRequest{URL: *u, Secret: "0123456789abcdef", EventTypes: []api.WebhookEventType{api.WebhookEventTypeEventCreated}})
+	assert.ErrorIs(t, err, ErrValidation, "private addresses are rejected")
+
+	s = newTestWebhookService(&mockWebhookRepo{}, nil)
+	u, _ = url.Parse("https://example.com/hook")
+	_, err = s.Create(&api.CreateWebhookRequest{URL: *u, Secret: "0123456789abcdef", EventTypes: []api.WebhookEventType{"event.moved"}})
+	assert.ErrorIs(t, err, ErrValidation)
+
+	hook, err := s.Create(&api.CreateWebhookRequest{URL: *u, Secret: "0123456789abcdef", EventTypes: []api.WebhookEventType{api.WebhookEventTypeEventCreated, api.WebhookEventTypeEventCreated}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{model.WebhookEventCreated}, hook.EventTypes)
+	assert.True(t, hook.Enabled)
+
+	_, err = s.GetByID(42)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestWebhookService_Enqueue(t *testing.T) {
+	repo := &mockWebhookRepo{}
+	bus := NewEventBus()
+	s := newTestWebhookService(repo, bus)
+	created := createTestWebhook(t, s, "https://example.com/created", api.WebhookEventTypeEventCreated)
+	createTestWebhook(t, s, "https://example.com/failed", api.WebhookEventTypeFeedRefreshFailed)
+	disabled := createTestWebhook(t, s, "https://example.com/disabled", api.WebhookEventTypeEventCreated)
+	_, err := s.Update(disabled.ID, &api.UpdateWebhookRequest{Enabled: api.NewOptBool(false)})
+	require.NoError(t, err)
+
+	event := &model.Event{ID: 7, Title: "Meeting", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}
+	bus.Publish(eventChange(model.ActionCreate, event.ID, nil, event))
+	bus.Publish(eventChange(model.ActionUpdate, event.ID, event, event))
+	bus.Publish(Change{Kind: KindCalendar, Action: model.ActionCreate, ID: 1})
+
+	require.Len(t, repo.deliveries, 1)
+	d := repo.deliveries[0]
+	assert.Equal(t, created.ID, d.WebhookID)
+	assert.Equal(t, model.WebhookEventCreated, d.EventType)
+	var payload struct {
+		Type  string `json:"type"`
+		Event struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"event"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(d.Payload), &payload))
+	assert.Equal(t, model.WebhookEventCreated, payload.Type)
+	assert.Equal(t, "7", payload.Event.ID)
+	assert.Equal(t, "Meeting", payload.Event.Title)
+
+	bus.Publish(Change{Kind: KindFeed, Action: ActionRefreshFailed, ID: 3, Feed: &model.Feed{ID: 3, URL: "https://example.com/feed.ics", LastError: "boom"}})
+	require.Len(t, repo.deliveries, 2)
+	assert.Equal(t, model.WebhookFeedRefreshFailed, repo.deliveries[1].EventType)
+}
+
+func TestWebhookService_Deliver(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	repo := &mockWebhookRepo{}
+	bus := NewEventBus()
+	s := newTestWebhookService(repo, bus)
+	hook := createTestWebhook(t, s, srv.URL, api.WebhookEventTypeEventDeleted)
+	event := &model.Event{ID: 7, Title: "Meeting", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}
+	bus.Publish(eventChange(model.ActionDelete, event.ID, event, nil))
+
+	assert.Equal(t, 1, s.DeliverDue())
+	d := repo.deliveries[0]
+	assert.Equal(t, model.DeliveryDelivered, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, http.StatusNoContent, d.LastStatus)
+	assert.NotEmpty(t, d.DeliveredAt)
+
+	assert.Equal(t, d.Payload, string(gotBody))
+	assert.Equal(t, "application/json", gotHeader.Get("Content-Type"))
+	assert.Equal(t, model.WebhookEventDeleted, gotHeader.Get("X-Mycal-Event"))
+	assert.Equal(t, "1", gotHeader.Get("X-Mycal-Delivery"))
+	assert.Equal(t, SignWebhookPayload(hook.Secret, gotBody), gotHeader.Get("X-Mycal-Signature-256"))
+
+	assert.Zero(t, s.DeliverDue(), "nothing left to deliver")
+}
+
+func TestWebhookService_Retry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	repo := &mockWebhookRepo{}
+	bus := NewEventBus()
+	s := newTestWebhookService(repo, bus)
+	createTestWebhook(t, s, srv.URL, api.WebhookEventTypeEventCreated)
+	event := &model.Event{ID: 7, Title: "Meeting", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}
+	bus.Publish(eventChange(model.ActionCreate, event.ID, nil, event))
+
+	before := time.Now().UTC()
+	assert.Equal(t, 1, s.DeliverDue())
+	d := repo.deliveries[0]
+	assert.Equal(t, model.DeliveryPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, d.LastStatus)
+	assert.Equal(t, "URL returned status 503", d.LastError)
+	next, err := time.Parse(time.RFC3339, d.NextAttemptAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, before.Add(firstWebhookRetryDelay), next, 2*time.Second)
+	assert.Zero(t, s.DeliverDue(), "the retry is not due yet")
+
+	// The last attempt fails the delivery for good.
+	d.Attempts = maxWebhookAttempts - 1
+	d.NextAttemptAt = before.Format(time.RFC3339)
+	repo.deliveries[0] = d
+	assert.Equal(t, 1, s.DeliverDue())
+	assert.Equal(t, model.DeliveryFailed, repo.deliveries[0].Status)
+	assert.Equal(t, maxWebhookAttempts, repo.deliveries[0].Attempts)
+}
+
+func TestWebhookService_DeletedWebhook(t *testing.T) {
+	repo := &mockWebhookRepo{}
+	bus := NewEventBus()
+	s := newTestWebhookService(repo, bus)
+	hook := createTestWebhook(t, s, "https://example.com/hook", api.WebhookEventTypeEventCreated)
+	event := &model.Event{ID: 7, Title: "Meeting", StartTime: "2026-03-15T10:00:00Z", EndTime: "2026-03-15T11:00:00Z"}
+	bus.Publish(eventChange(model.ActionCreate, event.ID, nil, event))
+	require.NoError(t, s.Delete(hook.ID))
+
+	assert.Equal(t, 1, s.DeliverDue())
+	assert.Equal(t, model.DeliveryFailed, repo.deliveries[0].Status)
+	assert.Zero(t, repo.deliveries[0].Attempts)
+
+	// No more deliveries are queued for it.
+	bus.Publish(eventChange(model.ActionCreate, event.ID, nil, event))
+	assert.Len(t, repo.deliveries, 1)
+	assert.True(t, errors.Is(s.Delete(hook.ID), ErrNotFound))
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhookRetryDelay(1))
+	assert.Equal(t, time.Minute, webhookRetryDelay(2))
+	assert.Equal(t, 30*time.Second<<8, webhookRetryDelay(9))
+}
@@ -26,9 +26,12 @@ import (
 	"github.com/mikaelstaldal/go-server-common/csrf"
 	"github.com/mikaelstaldal/go-server-common/httputil"
 	commonweb "github.com/mikaelstaldal/go-server-common/web"
+	"github.com/mikaelstaldal/mycal/internal/api"
 	"github.com/mikaelstaldal/mycal/internal/handler"
 	"github.com/mikaelstaldal/mycal/internal/ical"
+	"github.com/mikaelstaldal/mycal/internal/metrics"
 	"github.com/mikaelstaldal/mycal/internal/repository"
+	"github.com/mikaelstaldal/mycal/internal/secret"
 	"github.com/mikaelstaldal/mycal/internal/service"
 	"github.com/mikaelstaldal/mycal/web"
 )
@@ -88,6 +91,17 @@ func main() {
 	httpsMode := flag.Bool("https", false, "set Strict-Transport-Security header (use when served behind a TLS-terminating proxy)")
 	publicURL := flag.String("public-url", "", "Public-facing base URL for CSRF validation, e.g. https://example.com (defaults to http://<addr>:<port>)")
 	exportICS := flag.String("export-ics", "", "export all events to an .ics file and exit")
+	exportJSON := flag.String("export-json", "", "export calendars, events, feeds and preferences to a JSON dump file and exit")
+	importJSON := flag.String("import-json", "", "restore a JSON dump file made with -export-json and exit")
+	backupFile := flag.String("backup", "", "write a consistent backup of the database to a file and exit (safe while a server is running)")
+	restoreFile := flag.String("restore", "", "replace the database with a backup file and exit (stop the server first)")
+	backupInterval := flag.Duration("backup-interval", 0, "interval between automatic backups into the backups directory in the data directory (0 = disabled)")
+	backupKeep := flag.Int("backup-keep", 7, "number of automatic backups to keep (0 = keep all)")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "report the schema migrations that would be applied to the database and exit, without changing it")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve /healthz, /readyz and /metrics on, without authentication, e.g. 127.0.0.1:9090 (empty = disabled)")
+	secretKeyBase64 := flag.String("secret-key", "", "base64 key that encrypts stored credentials, instead of -secret-key-file")
+	secretKeyFile := flag.String("secret-key-file", "", "file with the base64 key that encrypts stored credentials, such as feed passwords; created with a new key if missing (default secret.key in the data directory)")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted events are kept in the trash before they are purged permanently (0 = keep forever)")
 	flag.Parse()
 
 	if *version {
@@ -128,7 +142,7 @@ func main() {
 
 	if *exportICS != "" {
 		// Open database read-only so this can run concurrently with a server
-		db, err := sql.Open("sqlite", databaseFile+"?mode=ro")
+		db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: databaseFile, RawQuery: "mode=ro"}).String())
 		if err != nil {
 			log.Fatalf("open database: %v", err)
 		}
@@ -139,25 +153,134 @@ func main() {
 			log.Fatalf("init repository: %v", err)
 		}
 
-		svc := service.NewEventService(repo, repo)
-		events, err := svc.ListAll(nil)
-		if err != nil {
-			log.Fatalf("list events: %v", err)
-		}
-
+		svc := service.NewEventService(repo, repo, repo, nil)
 		f, err := os.Create(*exportICS)
 		if err != nil {
 			log.Fatalf("create file: %v", err)
 		}
-		if err := ical.Encode(f, events); err != nil {
+		n, err := svc.WriteICS(f, ical.FormatICal, nil)
+		if err != nil {
 			f.Close()
-			log.Fatalf("encode ical: %v", err)
+			log.Fatalf("export ical: %v", err)
 		}
 		if err := f.Close(); err != nil {
 			log.Fatalf("close file: %v", err)
 		}
 
-		log.Printf("exported %d events to %s", len(events), *exportICS)
+		log.Printf("exported %d events to %s", n, *exportICS)
+		return
+	}
+
+	if *exportJSON != "" {
+		// Open database read-only so this can run concurrently with a server
+		db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: databaseFile, RawQuery: "mode=ro"}).String())
+		if err != nil {
+			log.Fatalf("open database: %v", err)
+		}
+		defer db.Close()
+
+		repo, err := repository.NewSQLiteRepository(db)
+		if err != nil {
+			log.Fatalf("init repository: %v", err)
+		}
+
+		dump, err := service.NewDumpService(repo, repo, nil).Export()
+		if err != nil {
+			log.Fatalf("export: %v", err)
+		}
+		data, err := dump.MarshalJSON()
+		if err != nil {
+			log.Fatalf("encode dump: %v", err)
+		}
+		if err := os.WriteFile(*exportJSON, data, 0600); err != nil {
+			log.Fatalf("write file: %v", err)
+		}
+
+		log.Printf("exported %d calendars, %d events and %d feeds to %s", len(dump.Calendars), len(dump.Events), len(dump.Feeds), *exportJSON)
+		return
+	}
+
+	if *importJSON != "" {
+		data, err := os.ReadFile(*importJSON)
+		if err != nil {
+			log.Fatalf("read file: %v", err)
+		}
+		var dump api.Dump
+		if err := dump.UnmarshalJSON(data); err != nil {
+			log.Fatalf("decode dump: %v", err)
+		}
+
+		db, err := repository.OpenDB(databaseFile, 5000)
+		if err != nil {
+			log.Fatalf("open database: %v", err)
+		}
+		defer db.Close()
+
+		repo, err := repository.NewSQLiteRepository(db)
+		if err != nil {
+			log.Fatalf("init repository: %v", err)
+		}
+
+		result, err := service.NewDumpService(repo, repo, nil).Restore(&dump)
+		if err != nil {
+			log.Fatalf("import: %v", err)
+		}
+
+		log.Printf("imported %d calendars, %d events, %d feeds and %d preferences from %s", result.Calendars, result.Events, result.Feeds, result.Preferences, *importJSON)
+		return
+	}
+
+	if *backupFile != "" {
+		if _, err := os.Stat(databaseFile); err != nil {
+			log.Fatalf("backup: %v", err)
+		}
+		// Open database read-only so this can run concurrently with a server
+		db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: databaseFile, RawQuery: "mode=ro"}).String())
+		if err != nil {
+			log.Fatalf("open database: %v", err)
+		}
+		defer db.Close()
+
+		if err := repository.Backup(db, *backupFile); err != nil {
+			log.Fatalf("backup: %v", err)
+		}
+		log.Printf("backed up %s to %s", databaseFile, *backupFile)
+		return
+	}
+
+	if *restoreFile != "" {
+		if err := repository.RestoreBackup(*restoreFile, databaseFile); err != nil {
+			log.Fatalf("restore: %v", err)
+		}
+		log.Printf("restored %s from %s", databaseFile, *restoreFile)
+		return
+	}
+
+	if *migrateDryRun {
+		// Try the migrations in a transaction that is rolled back. A database
+		// that does not exist yet is stood in for by an empty one in memory.
+		dsn := databaseFile
+		if _, err := os.Stat(databaseFile); errors.Is(err, os.ErrNotExist) {
+			dsn = ":memory:"
+		}
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			log.Fatalf("open database: %v", err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		current, pending, err := repository.DryRunMigrations(db)
+		if err != nil {
+			log.Fatalf("migrate dry run: database at schema version %d: %v", current, err)
+		}
+		log.Printf("database %s is at schema version %d", databaseFile, current)
+		if len(pending) == 0 {
+			log.Printf("schema is up to date")
+		}
+		for _, m := range pending {
+			log.Printf("would apply migration %d (%s), checksum %s", m.Version, m.Name, m.Checksum[:12])
+		}
 		return
 	}
 
@@ -185,7 +308,7 @@ func main() {
 	db.SetMaxOpenConns(numConns)
 	db.SetMaxIdleConns(numConns)
 
-	if err = ensureWritable(db); err != nil {
+	if err = repository.EnsureWritable(context.Background(), db); err != nil {
 		log.Fatalf("open database: %v", err)
 	}
 
@@ -198,12 +321,34 @@ func main() {
 	if err != nil {
 		log.Fatalf("init repository: %v", err)
 	}
+	repo.RegisterMetrics(metrics.Default)
 
-	calSvc := service.NewCalendarService(repo)
-	svc := service.NewEventService(repo, repo)
+	if *secretKeyFile == "" {
+		*secretKeyFile = filepath.Join(*dataDir, "secret.key")
+	}
+	var secretKey []byte
+	if *secretKeyBase64 != "" {
+		secretKey, err = secret.ParseKey(*secretKeyBase64)
+	} else {
+		secretKey, err = secret.LoadOrCreateKeyFile(*secretKeyFile)
+	}
+	if err != nil {
+		log.Fatalf("load secret key: %v", err)
+	}
+	secrets, err := secret.NewBox(secretKey)
+	if err != nil {
+		log.Fatalf("load secret key: %v", err)
+	}
+
+	bus := service.NewEventBus()
+	calSvc := service.NewCalendarService(repo, bus)
+	svc := service.NewEventService(repo, repo, repo, bus)
 	prefSvc := service.NewPreferencesService(repo)
-	feedSvc := service.NewFeedService(repo, repo, repo)
-	apiRouter := handler.NewRouter(svc, prefSvc, feedSvc, calSvc)
+	feedSvc := service.NewFeedService(repo, repo, repo, repo, bus, secrets)
+	dumpSvc := service.NewDumpService(repo, repo, bus)
+	webhookSvc := service.NewWebhookService(repo, bus)
+	publicationSvc := service.NewPublicationService(repo, svc)
+	apiRouter := handler.NewRouter(svc, prefSvc, feedSvc, calSvc, dumpSvc, webhookSvc, publicationSvc, bus)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -222,6 +367,50 @@ func main() {
 		}
 	}()
 
+	// Start background webhook delivery goroutine
+	go webhookSvc.Run(ctx)
+
+	// Start background backup goroutine
+	if *backupInterval > 0 {
+		backupDir := filepath.Join(*dataDir, "backups")
+		go func() {
+			ticker := time.NewTicker(*backupInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if dest, err := repository.BackupToDir(db, backupDir, *backupKeep); err != nil {
+						log.Printf("automatic backup: %v", err)
+					} else {
+						log.Printf("backed up database to %s", dest)
+					}
+				}
+			}
+		}()
+	}
+
+	// Start background trash purge goroutine
+	if *trashRetention > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for {
+				if n, err := svc.PurgeTrash(*trashRetention); err != nil {
+					log.Printf("purge trash: %v", err)
+				} else if n > 0 {
+					log.Printf("purged %d events from the trash", n)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
 	resolvedMymailURL := deriveMymailURL(*publicURL)
 	if resolvedMymailURL != "" {
 		log.Printf("mycal: MyMail URL configured as %s", resolvedMymailURL)
@@ -295,15 +484,21 @@ func main() {
 	if *httpsMode {
 		hsts = "max-age=31536000; includeSubDomains"
 	}
-	httpHandler = httputil.SecurityHeaders(httputil.SecurityHeadersOptions{
+	securityHeaders := httputil.SecurityHeaders(httputil.SecurityHeadersOptions{
 		CSP:            csp,
 		ReferrerPolicy: "strict-origin-when-cross-origin",
 		HSTS:           hsts,
-	})(httpHandler)
+	})
+	httpHandler = securityHeaders(httpHandler)
 	if authMiddleware != nil {
 		httpHandler = authMiddleware(httpHandler)
 	}
-	httpHandler = http.MaxBytesHandler(httpHandler, 10*1024*1024) // 10 MiB global request body limit (matches import endpoint)
+	// The published calendars are read-only and public, so they are served
+	// outside of the authentication, but with the same security headers.
+	rootMux := http.NewServeMux()
+	rootMux.Handle("/public/", securityHeaders(handler.NewPublicRouter(publicationSvc, calSvc)))
+	rootMux.Handle("/", httpHandler)
+	httpHandler = handler.LimitRequestBody(rootMux, 10*1024*1024) // 10 MiB global request body limit, more for iCalendar imports
 
 	serverAddr := fmt.Sprintf("%s:%d", *addr, *port)
 	srv := &http.Server{
@@ -311,8 +506,32 @@ func main() {
 		Handler:           httpHandler,
 		ReadHeaderTimeout: 2 * time.Second,
 		ReadTimeout:       5 * time.Second,
-		WriteTimeout:      20 * time.Second,
-		IdleTimeout:       time.Minute,
+		// The change stream (/api/v1/stream) stays open indefinitely; it
+		// extends its own write deadline before every write instead.
+		WriteTimeout: 20 * time.Second,
+		IdleTimeout:  time.Minute,
+	}
+	// End the change streams on shutdown, or Shutdown would wait for them.
+	srv.RegisterOnShutdown(bus.Close)
+
+	var opsSrv *http.Server
+	if *metricsAddr != "" {
+		opsSrv = &http.Server{
+			Addr: *metricsAddr,
+			Handler: handler.NewOpsRouter(func(ctx context.Context) error {
+				return repository.EnsureWritable(ctx, db)
+			}, metrics.Default),
+			ReadHeaderTimeout: 2 * time.Second,
+			ReadTimeout:       5 * time.Second,
+			WriteTimeout:      20 * time.Second,
+			IdleTimeout:       time.Minute,
+		}
+		go func() {
+			log.Printf("Serving health checks and metrics on %s", *metricsAddr)
+			if err := opsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
 	}
 
 	sigCh := make(chan os.Signal, 1)
@@ -325,6 +544,9 @@ func main() {
 		shutdownCtx, done := context.WithTimeout(context.Background(), 10*time.Second)
 		defer done()
 		srv.Shutdown(shutdownCtx) //nolint:errcheck
+		if opsSrv != nil {
+			opsSrv.Shutdown(shutdownCtx) //nolint:errcheck
+		}
 	}()
 
 	log.Printf("Starting server on %s", serverAddr)
@@ -362,29 +584,3 @@ func printVersion() {
 		}
 	}
 }
-
-func ensureWritable(db *sql.DB) error {
-	conn, err := db.Conn(context.Background())
-	if err != nil {
-		return err
-	}
-	defer func(conn *sql.Conn) {
-		_ = conn.Close()
-	}(conn)
-
-	return conn.Raw(func(c any) error {
-		if d, ok := c.(interface{ IsReadOnly(string) (bool, error) }); ok {
-			// Use "main" for the primary database schema
-			isReadOnly, err := d.IsReadOnly("main")
-			if err != nil {
-				return err
-			}
-			if isReadOnly {
-				return fmt.Errorf("database is read-only")
-			}
-			return nil
-		}
-
-		return fmt.Errorf("cannot check if database is read-only")
-	})
-}
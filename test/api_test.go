@@ -63,11 +63,14 @@ func setupTestServer(t *testing.T) *httptest.Server {
 	require.NoError(t, err)
 	repo, err := repository.NewSQLiteRepository(db)
 	require.NoError(t, err)
-	calSvc := service.NewCalendarService(repo)
-	svc := service.NewEventService(repo, repo)
+	calSvc := service.NewCalendarService(repo, nil)
+	svc := service.NewEventService(repo, repo, repo, nil)
 	prefSvc := service.NewPreferencesService(repo)
-	feedSvc := service.NewFeedService(repo, repo, repo)
-	router := handler.NewRouter(svc, prefSvc, feedSvc, calSvc)
+	feedSvc := service.NewFeedService(repo, repo, repo, repo, nil, nil)
+	dumpSvc := service.NewDumpService(repo, repo, nil)
+	webhookSvc := service.NewWebhookService(repo, nil)
+	publicationSvc := service.NewPublicationService(repo, svc)
+	router := handler.NewRouter(svc, prefSvc, feedSvc, calSvc, dumpSvc, webhookSvc, publicationSvc, nil)
 	ts := httptest.NewServer(router)
 	t.Cleanup(func() {
 		ts.Close()
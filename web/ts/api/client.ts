@@ -10,6 +10,13 @@ type UpdateEventRequest = components['schemas']['UpdateEventRequest'];
 type CreateFeedRequest = components['schemas']['CreateFeedRequest'];
 type UpdateCalendarRequest = components['schemas']['UpdateCalendarRequest'];
 
+// A change announced on the change stream (/api/v1/stream).
+export type Change = {
+  kind: 'event' | 'calendar' | 'feed';
+  action: 'create' | 'update' | 'delete';
+  id: number;
+};
+
 // The app may be served from a sub-path; derive the API base from the document base URI.
 const APP_BASE = new URL('.', document.baseURI).pathname.replace(/\/$/, '');
 const BASE = APP_BASE + '/api/v1';
@@ -137,6 +144,25 @@ export const api = {
       request<Preferences>('PATCH', '/preferences', prefs),
   },
 
+  changes: {
+    // Subscribes to the change stream. onReconnect is called when the stream is
+    // back after an interruption, since changes may have been missed in between.
+    // Returns a function that unsubscribes.
+    subscribe(onChange: (change: Change) => void, onReconnect: () => void): () => void {
+      const source = new EventSource(BASE + '/stream');
+      let interrupted = false;
+      source.addEventListener('change', e => onChange(JSON.parse((e as MessageEvent<string>).data) as Change));
+      source.addEventListener('error', () => { interrupted = true; });
+      source.addEventListener('open', () => {
+        if (interrupted) {
+          interrupted = false;
+          onReconnect();
+        }
+      });
+      return () => source.close();
+    },
+  },
+
   import: {
     single: (contentOrUrl: string, calendar?: string) =>
       importRequest<Event>('/import-single', contentOrUrl, calendar),
@@ -117,6 +117,30 @@ function App() {
 
     useEffect(() => { loadEvents(); }, [loadEvents]);
 
+    // Reload when something is changed elsewhere, e.g. in another tab or on another device.
+    const reloaders = useRef({ loadEvents, loadCalendars });
+    reloaders.current = { loadEvents, loadCalendars };
+    useEffect(() => {
+        let timer: ReturnType<typeof setTimeout> | undefined;
+        let calendarsChanged = false;
+        const scheduleReload = (calendarsToo: boolean) => {
+            calendarsChanged ||= calendarsToo;
+            clearTimeout(timer);
+            timer = setTimeout(() => {
+                if (calendarsChanged) reloaders.current.loadCalendars();
+                calendarsChanged = false;
+                reloaders.current.loadEvents();
+            }, 300);
+        };
+        const unsubscribe = api.changes.subscribe(
+            change => scheduleReload(change.kind !== 'event'),
+            () => scheduleReload(true));
+        return () => {
+            clearTimeout(timer);
+            unsubscribe();
+        };
+    }, []);
+
     useEffect(() => {
         if (viewMode === 'schedule') setScheduleDaysLoaded(30);
     }, [viewMode]);
@@ -482,7 +506,9 @@ function App() {
                                     <div class="search-result-title">{event.title}</div>
                                     <div class="search-result-date">{formatSearchDate(eventStartStr(event))}</div>
                                     <div class="search-result-time">{event.all_day ? '' : formatSearchTime(event.start_time!, event.end_time!)}</div>
-                                    {event.description && <div class="search-result-desc" dangerouslySetInnerHTML={{ __html: event.description }} />}
+                                    {event.snippet
+                                        ? <div class="search-result-desc" dangerouslySetInnerHTML={{ __html: event.snippet }} />
+                                        : event.description && <div class="search-result-desc" dangerouslySetInnerHTML={{ __html: event.description }} />}
                                 </div>
                             ))}
                         </div>
@@ -70,6 +70,7 @@ export function EventForm({ event, defaultDate, defaultAllDay, copiedEvent, onSa
     const [rdates, setRdates] = useState('');
     const [newRdate, setNewRdate] = useState('');
     const [reminderMinutes, setReminderMinutes] = useState(0);
+    const [transparent, setTransparent] = useState(false);
     const [location, setLocation] = useState('');
     const [latitude, setLatitude] = useState('');
     const [longitude, setLongitude] = useState('');
@@ -107,6 +108,7 @@ export function EventForm({ event, defaultDate, defaultAllDay, copiedEvent, onSa
         setRecurrenceByMonthDay(src.recurrence_by_monthday || '');
         setRecurrenceByMonth(src.recurrence_by_month || '');
         setReminderMinutes(src.reminder_minutes || 0);
+        setTransparent(!!src.transparent);
         setLocation(src.location || '');
         setLatitude(src.latitude != null ? String(src.latitude) : '');
         setLongitude(src.longitude != null ? String(src.longitude) : '');
@@ -172,6 +174,7 @@ export function EventForm({ event, defaultDate, defaultAllDay, copiedEvent, onSa
             setExdates('');
             setRdates('');
             setReminderMinutes(0);
+            setTransparent(false);
             setLocation('');
             setLatitude('');
             setLongitude('');
@@ -280,7 +283,7 @@ export function EventForm({ event, defaultDate, defaultAllDay, copiedEvent, onSa
             longitude: longitude !== '' ? parseFloat(longitude) : null,
         };
 
-        const extraFields: any = {};
+        const extraFields: any = { transparent };
         if (categories) extraFields.categories = categories;
         if (eventURL) extraFields.url = eventURL;
 
@@ -568,6 +571,14 @@ export function EventForm({ event, defaultDate, defaultAllDay, copiedEvent, onSa
                     </label>
                 )}
 
+                {editing && (
+                    <label class="checkbox-label">
+                        <input type="checkbox" checked={transparent}
+                               onChange={(e: Event) => setTransparent((e.target as HTMLInputElement).checked)} />
+                        Show as free
+                    </label>
+                )}
+
                 {useDuration && editing ? (
                     <label>
                         Duration
@@ -893,6 +904,10 @@ export function EventForm({ event, defaultDate, defaultAllDay, copiedEvent, onSa
                     <div class="detail-row"><span class="detail-label">Reminder:</span> {displayReminder()}</div>
                 ) : null}
 
+                {transparent && !editing ? (
+                    <div class="detail-row"><span class="detail-label">Show as:</span> Free</div>
+                ) : null}
+
             </form>
         </dialog>
     );
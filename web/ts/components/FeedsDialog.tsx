@@ -102,6 +102,8 @@ export function FeedsDialog({ onClose, onRefreshed }: FeedsDialogProps): VNode |
                                     <div class="feed-item-info">
                                         <div class="feed-item-url" title={feed.url}>{feed.url}</div>
                                         <div class="feed-item-meta">
+                                            {feed.type === 'caldav' && <span>CalDAV &#xb7;</span>}
+                                            {feed.auth && feed.auth !== 'none' && <span>{feed.auth === 'bearer' ? 'Token' : 'Password'} &#xb7;</span>}
                                             {feed.calendar_name && <span class="feed-calendar">{feed.calendar_name}</span>}
                                             <span>Every {feed.refresh_interval_minutes} min</span>
                                             <span>&#xb7; Last: {formatDate(feed.last_refreshed_at)}</span>
@@ -144,7 +146,11 @@ interface AddFeedFormProps {
 }
 
 function AddFeedForm({ onAdd, onCancel }: AddFeedFormProps): VNode | null {
+    const [type, setType] = useState('ics');
     const [url, setUrl] = useState('');
+    const [username, setUsername] = useState('');
+    const [password, setPassword] = useState('');
+    const [token, setToken] = useState('');
     const [calendarName, setCalendarName] = useState('');
     const [calendarColor, setCalendarColor] = useState('dodgerblue');
     const [interval, setInterval] = useState(60);
@@ -157,10 +163,14 @@ function AddFeedForm({ onAdd, onCancel }: AddFeedFormProps): VNode | null {
         setError('');
         try {
             const data: any = {
+                type,
                 url: url.trim(),
                 calendar_name: calendarName.trim(),
                 refresh_interval_minutes: Number(interval),
             };
+            if (username.trim()) data.username = username.trim();
+            if (password) data.password = password;
+            if (type === 'ics' && token && !data.username && !data.password) data.token = token;
             if (calendarName.trim()) data.calendar_color = calendarColor;
             await onAdd(data);
         } catch (err: any) {
@@ -173,10 +183,34 @@ function AddFeedForm({ onAdd, onCancel }: AddFeedFormProps): VNode | null {
     return (
         <div class="feed-add-form">
             <label>
-                Feed URL
+                Type
+                <select value={type} onChange={(e: Event) => setType((e.target as HTMLSelectElement).value)}>
+                    <option value="ics">iCalendar URL (.ics)</option>
+                    <option value="caldav">CalDAV calendar</option>
+                </select>
+            </label>
+            <label>
+                {type === 'caldav' ? 'Server or calendar URL' : 'Feed URL'}
                 <input type="url" value={url} onInput={(e: Event) => setUrl((e.target as HTMLInputElement).value)}
-                       placeholder="https://calendar.google.com/..." />
+                       placeholder={type === 'caldav' ? 'https://cloud.example.com/remote.php/dav/' : 'https://calendar.google.com/...'} />
+            </label>
+            <label>
+                Username (optional)
+                <input type="text" value={username} autocomplete="off"
+                       onInput={(e: Event) => setUsername((e.target as HTMLInputElement).value)} />
             </label>
+            <label>
+                Password (optional)
+                <input type="password" value={password} autocomplete="new-password"
+                       onInput={(e: Event) => setPassword((e.target as HTMLInputElement).value)} />
+            </label>
+            {type === 'ics' && !username.trim() && !password && (
+                <label>
+                    Bearer token (optional)
+                    <input type="password" value={token} autocomplete="off"
+                           onInput={(e: Event) => setToken((e.target as HTMLInputElement).value)} />
+                </label>
+            )}
             <label>
                 Calendar name (optional)
                 <input type="text" value={calendarName} onInput={(e: Event) => setCalendarName((e.target as HTMLInputElement).value)}